@@ -0,0 +1,264 @@
+package hdfs
+
+import (
+	"fmt"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// SafeModeAction represents an action that can be passed to SetSafeMode.
+type SafeModeAction int
+
+const (
+	// SafeModeGet leaves the safe mode state unchanged.
+	SafeModeGet SafeModeAction = iota
+	// SafeModeEnter puts the namenode into safe mode.
+	SafeModeEnter
+	// SafeModeLeave takes the namenode out of safe mode.
+	SafeModeLeave
+	// SafeModeForceExit takes the namenode out of safe mode, even if it's
+	// still waiting for enough blocks to be reported.
+	SafeModeForceExit
+)
+
+// RollingUpgradeAction represents an action that can be passed to
+// RollingUpgrade.
+type RollingUpgradeAction int
+
+const (
+	// RollingUpgradeQuery returns the status of the current rolling upgrade.
+	RollingUpgradeQuery RollingUpgradeAction = iota
+	// RollingUpgradePrepare starts a rolling upgrade, by creating a rollback
+	// image.
+	RollingUpgradePrepare
+	// RollingUpgradeFinalize finalizes the current rolling upgrade.
+	RollingUpgradeFinalize
+)
+
+// RollingUpgradeInfo describes the state of a rolling upgrade.
+type RollingUpgradeInfo struct {
+	BlockPoolID string
+	StartTime   time.Time
+	// FinalizeTime is zero if the upgrade hasn't been finalized yet.
+	FinalizeTime time.Time
+	// CreatedRollbackImages indicates whether the namenode has finished
+	// creating the rollback image, after which it's safe to proceed with the
+	// upgrade.
+	CreatedRollbackImages bool
+	Finalized             bool
+}
+
+// The functions below all act on the namenode the client is currently
+// connected to. In an HA setup, that's the active namenode, and actions must
+// be repeated against each namenode individually (by creating a Client with
+// just that address) to affect the others.
+
+// SetSafeMode performs the given action, and returns whether the namenode is
+// in safe mode afterwards.
+//
+// This requires superuser privileges, unless the action is SafeModeGet.
+func (c *Client) SetSafeMode(action SafeModeAction) (bool, error) {
+	var a hdfs.SafeModeActionProto
+	switch action {
+	case SafeModeGet:
+		a = hdfs.SafeModeActionProto_SAFEMODE_GET
+	case SafeModeEnter:
+		a = hdfs.SafeModeActionProto_SAFEMODE_ENTER
+	case SafeModeLeave:
+		a = hdfs.SafeModeActionProto_SAFEMODE_LEAVE
+	case SafeModeForceExit:
+		a = hdfs.SafeModeActionProto_SAFEMODE_FORCE_EXIT
+	default:
+		return false, fmt.Errorf("invalid safe mode action: %d", action)
+	}
+
+	req := &hdfs.SetSafeModeRequestProto{
+		Action:  a.Enum(),
+		Checked: proto.Bool(true),
+	}
+	resp := &hdfs.SetSafeModeResponseProto{}
+
+	err := c.namenode.Execute("setSafeMode", req, resp)
+	if err != nil {
+		return false, interpretException(err)
+	}
+
+	return resp.GetResult(), nil
+}
+
+// SaveNamespace saves the current namespace to a new fsimage, and resets the
+// edit log. The namenode must be in safe mode.
+//
+// This requires superuser privileges.
+func (c *Client) SaveNamespace() error {
+	req := &hdfs.SaveNamespaceRequestProto{}
+	resp := &hdfs.SaveNamespaceResponseProto{}
+
+	err := c.namenode.Execute("saveNamespace", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// RollEdits rolls the edit log on the namenode, and returns the transaction ID
+// at which the new segment starts.
+//
+// This requires superuser privileges.
+func (c *Client) RollEdits() (int64, error) {
+	req := &hdfs.RollEditsRequestProto{}
+	resp := &hdfs.RollEditsResponseProto{}
+
+	err := c.namenode.Execute("rollEdits", req, resp)
+	if err != nil {
+		return 0, interpretException(err)
+	}
+
+	return int64(resp.GetNewSegmentTxId()), nil
+}
+
+// SetRestoreFailedStorage enables or disables the automatic restoration of
+// failed storage directories on the namenode, and returns the new setting.
+//
+// This requires superuser privileges.
+func (c *Client) SetRestoreFailedStorage(enabled bool) (bool, error) {
+	arg := "false"
+	if enabled {
+		arg = "true"
+	}
+
+	return c.restoreFailedStorage(arg)
+}
+
+// RestoreFailedStorage returns whether the namenode automatically restores
+// failed storage directories.
+//
+// This requires superuser privileges.
+func (c *Client) RestoreFailedStorage() (bool, error) {
+	return c.restoreFailedStorage("check")
+}
+
+func (c *Client) restoreFailedStorage(arg string) (bool, error) {
+	req := &hdfs.RestoreFailedStorageRequestProto{Arg: proto.String(arg)}
+	resp := &hdfs.RestoreFailedStorageResponseProto{}
+
+	err := c.namenode.Execute("restoreFailedStorage", req, resp)
+	if err != nil {
+		return false, interpretException(err)
+	}
+
+	return resp.GetResult(), nil
+}
+
+// RefreshNodes makes the namenode reread its hosts and exclude files, which
+// determine which datanodes are allowed to connect and which should be
+// decommissioned.
+//
+// This requires superuser privileges.
+func (c *Client) RefreshNodes() error {
+	req := &hdfs.RefreshNodesRequestProto{}
+	resp := &hdfs.RefreshNodesResponseProto{}
+
+	err := c.namenode.Execute("refreshNodes", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// FinalizeUpgrade finalizes a previous (non-rolling) upgrade, removing the
+// backups kept for rolling back.
+//
+// This requires superuser privileges.
+func (c *Client) FinalizeUpgrade() error {
+	req := &hdfs.FinalizeUpgradeRequestProto{}
+	resp := &hdfs.FinalizeUpgradeResponseProto{}
+
+	err := c.namenode.Execute("finalizeUpgrade", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// UpgradeFinalized returns whether the last upgrade of the namenode has been
+// finalized.
+//
+// This requires superuser privileges.
+func (c *Client) UpgradeFinalized() (bool, error) {
+	req := &hdfs.UpgradeStatusRequestProto{}
+	resp := &hdfs.UpgradeStatusResponseProto{}
+
+	err := c.namenode.Execute("upgradeStatus", req, resp)
+	if err != nil {
+		return false, interpretException(err)
+	}
+
+	return resp.GetUpgradeFinalized(), nil
+}
+
+// RollingUpgrade performs the given rolling upgrade action, and returns the
+// resulting state of the upgrade. If there is no rolling upgrade in progress,
+// it returns nil.
+//
+// This requires superuser privileges.
+func (c *Client) RollingUpgrade(action RollingUpgradeAction) (*RollingUpgradeInfo, error) {
+	var a hdfs.RollingUpgradeActionProto
+	switch action {
+	case RollingUpgradeQuery:
+		a = hdfs.RollingUpgradeActionProto_QUERY
+	case RollingUpgradePrepare:
+		a = hdfs.RollingUpgradeActionProto_START
+	case RollingUpgradeFinalize:
+		a = hdfs.RollingUpgradeActionProto_FINALIZE
+	default:
+		return nil, fmt.Errorf("invalid rolling upgrade action: %d", action)
+	}
+
+	req := &hdfs.RollingUpgradeRequestProto{Action: a.Enum()}
+	resp := &hdfs.RollingUpgradeResponseProto{}
+
+	err := c.namenode.Execute("rollingUpgrade", req, resp)
+	if err != nil {
+		return nil, interpretException(err)
+	}
+
+	info := resp.GetRollingUpgradeInfo()
+	if info == nil {
+		return nil, nil
+	}
+
+	res := &RollingUpgradeInfo{
+		BlockPoolID:           info.GetStatus().GetBlockPoolId(),
+		StartTime:             msToTime(info.GetStartTime()),
+		CreatedRollbackImages: info.GetCreatedRollbackImages(),
+		Finalized:             info.GetStatus().GetFinalized(),
+	}
+
+	if info.GetFinalizeTime() != 0 {
+		res.FinalizeTime = msToTime(info.GetFinalizeTime())
+	}
+
+	return res, nil
+}
+
+// MetaSave dumps the namenode's primary data structures to the given file,
+// which is created in the namenode's log directory.
+//
+// This requires superuser privileges.
+func (c *Client) MetaSave(filename string) error {
+	req := &hdfs.MetaSaveRequestProto{Filename: proto.String(filename)}
+	resp := &hdfs.MetaSaveResponseProto{}
+
+	err := c.namenode.Execute("metaSave", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
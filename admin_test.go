@@ -0,0 +1,69 @@
+package hdfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeMode(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	on, err := client.SetSafeMode(SafeModeGet)
+	require.NoError(t, err)
+	assert.False(t, on)
+
+	on, err = client.SetSafeMode(SafeModeEnter)
+	require.NoError(t, err)
+	defer client.SetSafeMode(SafeModeLeave)
+	assert.True(t, on)
+
+	err = client.SaveNamespace()
+	assert.NoError(t, err)
+
+	on, err = client.SetSafeMode(SafeModeLeave)
+	require.NoError(t, err)
+	assert.False(t, on)
+}
+
+func TestSafeModeWithoutPermission(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.SetSafeMode(SafeModeEnter)
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
+
+func TestSaveNamespaceOutsideSafeMode(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	err := client.SaveNamespace()
+	assert.Error(t, err)
+}
+
+func TestRollEdits(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	first, err := client.RollEdits()
+	require.NoError(t, err)
+
+	second, err := client.RollEdits()
+	require.NoError(t, err)
+	assert.Greater(t, second, first)
+}
+
+func TestRefreshNodes(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	err := client.RefreshNodes()
+	assert.NoError(t, err)
+}
+
+func TestRollingUpgradeQuery(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	info, err := client.RollingUpgrade(RollingUpgradeQuery)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
@@ -0,0 +1,194 @@
+// Package aferofs provides an implementation of afero.Fs backed by an HDFS
+// client, so that code written against afero can read and write files in
+// HDFS.
+//
+// HDFS files can only be written sequentially, by a single writer, so Fs
+// doesn't support every combination of flags that os.OpenFile does. In
+// particular, files can't be opened with os.O_RDWR, and files opened for
+// writing must either be new, truncated (os.O_TRUNC), or appended to
+// (os.O_APPEND). Operations that HDFS can't support return an error wrapping
+// ErrNotSupported.
+package aferofs
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/spf13/afero"
+)
+
+// ErrNotSupported is returned for operations or flags that HDFS doesn't
+// support, such as opening a file with os.O_RDWR or writing at an arbitrary
+// offset.
+var ErrNotSupported = errors.New("operation not supported by HDFS")
+
+var _ afero.Fs = (*Fs)(nil)
+
+// Fs implements afero.Fs on top of an hdfs.Client.
+type Fs struct {
+	client *hdfs.Client
+}
+
+// New returns an Fs that uses the given client.
+func New(client *hdfs.Client) *Fs {
+	return &Fs{client: client}
+}
+
+// Name implements afero.Fs.
+func (fs *Fs) Name() string {
+	return "hdfs"
+}
+
+// Create creates a new file, or truncates an existing one, and opens it for
+// writing. Unlike os.Create, the file is write-only.
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// Mkdir implements afero.Fs.
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.client.Mkdir(name, perm)
+}
+
+// MkdirAll implements afero.Fs.
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.client.MkdirAll(path, perm)
+}
+
+// Open opens the named file or directory for reading.
+func (fs *Fs) Open(name string) (afero.File, error) {
+	r, err := fs.client.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{client: fs.client, name: name, reader: r}, nil
+}
+
+// OpenFile opens the named file with the given flags, which are mapped onto
+// HDFS operations as follows:
+//
+//   - os.O_RDONLY opens the file for reading, like Open. os.O_CREATE,
+//     os.O_TRUNC and os.O_APPEND aren't supported in combination with it.
+//   - os.O_WRONLY|os.O_APPEND appends to an existing file. With os.O_CREATE,
+//     the file is created if it doesn't exist.
+//   - os.O_WRONLY|os.O_CREATE creates a new file. If the file already exists,
+//     os.O_TRUNC is required to replace it, and os.O_EXCL makes OpenFile fail
+//     instead.
+//   - os.O_RDWR isn't supported.
+//
+// perm is only used when creating a new file.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		if flag&(os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+			return nil, &os.PathError{"open", name, ErrNotSupported}
+		}
+
+		return fs.Open(name)
+	case os.O_WRONLY:
+	default:
+		return nil, &os.PathError{"open", name, ErrNotSupported}
+	}
+
+	info, err := fs.client.Stat(name)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if exists && info.IsDir() {
+		return nil, &os.PathError{"open", name, errors.New("is a directory")}
+	}
+
+	var w *hdfs.FileWriter
+	switch {
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{"open", name, os.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{"open", name, os.ErrNotExist}
+	case exists && flag&os.O_APPEND != 0:
+		w, err = fs.client.Append(name)
+	case exists && flag&os.O_TRUNC != 0:
+		w, err = fs.client.CreateWithOptions(name, hdfs.CreateOptions{
+			Overwrite: true,
+			Perm:      perm,
+		})
+	case exists:
+		// Writing over an existing file from the beginning, without
+		// truncating it first, is impossible in HDFS.
+		return nil, &os.PathError{"open", name, ErrNotSupported}
+	default:
+		w, err = fs.create(name, perm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{client: fs.client, name: name, writer: w}, nil
+}
+
+func (fs *Fs) create(name string, perm os.FileMode) (*hdfs.FileWriter, error) {
+	defaults, err := fs.client.ServerDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.client.CreateFile(name, defaults.Replication, defaults.BlockSize, perm)
+}
+
+// Remove implements afero.Fs.
+func (fs *Fs) Remove(name string) error {
+	return fs.client.Remove(name)
+}
+
+// RemoveAll implements afero.Fs.
+func (fs *Fs) RemoveAll(path string) error {
+	return fs.client.RemoveAll(path)
+}
+
+// Rename implements afero.Fs.
+func (fs *Fs) Rename(oldname, newname string) error {
+	return fs.client.Rename(oldname, newname)
+}
+
+// Stat implements afero.Fs.
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	return fs.client.Stat(name)
+}
+
+// Chmod implements afero.Fs.
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.client.Chmod(name, mode)
+}
+
+// Chown implements afero.Fs. Since HDFS identifies users and groups by name,
+// uid and gid are looked up on the local system; if no such user or group
+// exists, the number itself is used as the name. As with os.Chown, passing
+// -1 for either leaves it unchanged.
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	var owner, group string
+	if uid != -1 {
+		owner = strconv.Itoa(uid)
+		if u, err := user.LookupId(owner); err == nil {
+			owner = u.Username
+		}
+	}
+
+	if gid != -1 {
+		group = strconv.Itoa(gid)
+		if g, err := user.LookupGroupId(group); err == nil {
+			group = g.Name
+		}
+	}
+
+	return fs.client.Chown(name, owner, group)
+}
+
+// Chtimes implements afero.Fs.
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.client.Chtimes(name, atime, mtime)
+}
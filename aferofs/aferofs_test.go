@@ -0,0 +1,156 @@
+package aferofs
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cachedFs *Fs
+
+func getFs(t *testing.T) *Fs {
+	if cachedFs != nil {
+		return cachedFs
+	}
+
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	options := hdfs.ClientOptionsFromConf(conf)
+	if options.Addresses == nil {
+		t.Fatal("Missing namenode addresses in ambient config")
+	} else if options.KerberosClient != nil {
+		t.Skip("Kerberos isn't supported by these tests")
+	}
+
+	options.User = "gohdfs1"
+	client, err := hdfs.NewClient(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedFs = New(client)
+	return cachedFs
+}
+
+func setup(t *testing.T, dir string) *Fs {
+	fs := getFs(t)
+	require.NoError(t, fs.RemoveAll(dir))
+	require.NoError(t, fs.MkdirAll(dir, 0755))
+	return fs
+}
+
+func TestCreateAndRead(t *testing.T) {
+	fs := setup(t, "/_test/afero/create")
+
+	err := afero.WriteFile(fs, "/_test/afero/create/foo", []byte("foo\n"), 0600)
+	require.NoError(t, err)
+
+	b, err := afero.ReadFile(fs, "/_test/afero/create/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo\n", string(b))
+
+	info, err := fs.Stat("/_test/afero/create/foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0600, info.Mode().Perm())
+
+	// Overwriting truncates the file.
+	err = afero.WriteFile(fs, "/_test/afero/create/foo", []byte("ba"), 0644)
+	require.NoError(t, err)
+
+	b, err = afero.ReadFile(fs, "/_test/afero/create/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "ba", string(b))
+}
+
+func TestOpenFileAppend(t *testing.T) {
+	fs := setup(t, "/_test/afero/append")
+
+	for _, s := range []string{"foo", "bar"} {
+		f, err := fs.OpenFile("/_test/afero/append/foo", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		require.NoError(t, err)
+
+		_, err = f.WriteString(s)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	b, err := afero.ReadFile(fs, "/_test/afero/append/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(b))
+}
+
+func TestOpenFileFlags(t *testing.T) {
+	fs := setup(t, "/_test/afero/flags")
+	require.NoError(t, afero.WriteFile(fs, "/_test/afero/flags/foo", []byte("foo"), 0644))
+
+	_, err := fs.OpenFile("/_test/afero/flags/foo", os.O_RDWR, 0)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	_, err = fs.OpenFile("/_test/afero/flags/foo", os.O_WRONLY, 0)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	_, err = fs.OpenFile("/_test/afero/flags/foo", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	_, err = fs.OpenFile("/_test/afero/flags/bar", os.O_WRONLY|os.O_APPEND, 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFileWrongMode(t *testing.T) {
+	fs := setup(t, "/_test/afero/mode")
+
+	f, err := fs.Create("/_test/afero/mode/foo")
+	require.NoError(t, err)
+
+	_, err = f.Read(make([]byte, 1))
+	assert.Error(t, err)
+
+	_, err = f.WriteAt([]byte("foo"), 0)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	require.NoError(t, f.Close())
+
+	f, err = fs.Open("/_test/afero/mode/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("foo"))
+	assert.Error(t, err)
+
+	_, err = f.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReaddirnames(t *testing.T) {
+	fs := setup(t, "/_test/afero/readdir")
+	require.NoError(t, fs.Mkdir("/_test/afero/readdir/dir", 0755))
+	require.NoError(t, afero.WriteFile(fs, "/_test/afero/readdir/foo", nil, 0644))
+
+	names, err := afero.ReadDir(fs, "/_test/afero/readdir")
+	require.NoError(t, err)
+	require.Len(t, names, 2)
+	assert.Equal(t, "dir", names[0].Name())
+	assert.True(t, names[0].IsDir())
+	assert.Equal(t, "foo", names[1].Name())
+}
+
+func TestRenameAndRemove(t *testing.T) {
+	fs := setup(t, "/_test/afero/rename")
+	require.NoError(t, afero.WriteFile(fs, "/_test/afero/rename/foo", []byte("foo"), 0644))
+
+	require.NoError(t, fs.Rename("/_test/afero/rename/foo", "/_test/afero/rename/bar"))
+	_, err := fs.Stat("/_test/afero/rename/foo")
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, fs.Remove("/_test/afero/rename/bar"))
+	_, err = fs.Stat("/_test/afero/rename/bar")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,134 @@
+package aferofs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/spf13/afero"
+)
+
+var _ afero.File = (*File)(nil)
+
+// File implements afero.File. Depending on how it was opened, it wraps either
+// an hdfs.FileReader or an hdfs.FileWriter; calling a read method on a file
+// opened for writing (or vice versa) returns an error, like it would for an
+// os.File.
+type File struct {
+	client *hdfs.Client
+	name   string
+	reader *hdfs.FileReader
+	writer *hdfs.FileWriter
+}
+
+// Name returns the name of the file, as passed to Open or OpenFile.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Close closes the file. For files opened for writing, it's very important
+// to check the returned error, since that's when the last of the data is
+// acknowledged by the datanodes.
+func (f *File) Close() error {
+	if f.writer != nil {
+		return f.writer.Close()
+	}
+
+	return f.reader.Close()
+}
+
+// Read implements io.Reader.
+func (f *File) Read(b []byte) (int, error) {
+	if f.reader == nil {
+		return 0, f.badFile("read")
+	}
+
+	return f.reader.Read(b)
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	if f.reader == nil {
+		return 0, f.badFile("read")
+	}
+
+	return f.reader.ReadAt(b, off)
+}
+
+// Seek implements io.Seeker. Files opened for writing can't seek.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, &os.PathError{"seek", f.name, ErrNotSupported}
+	}
+
+	return f.reader.Seek(offset, whence)
+}
+
+// Write implements io.Writer.
+func (f *File) Write(b []byte) (int, error) {
+	if f.writer == nil {
+		return 0, f.badFile("write")
+	}
+
+	return f.writer.Write(b)
+}
+
+// WriteAt always returns an error, since HDFS files can only be written
+// sequentially.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	return 0, &os.PathError{"write", f.name, ErrNotSupported}
+}
+
+// WriteString is like Write, but writes the contents of the string s.
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Readdir reads the contents of a directory opened for reading. See
+// hdfs.FileReader.Readdir.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.reader == nil {
+		return nil, f.badFile("readdir")
+	}
+
+	return f.reader.Readdir(count)
+}
+
+// Readdirnames is like Readdir, but returns only the names of the entries.
+func (f *File) Readdirnames(n int) ([]string, error) {
+	if f.reader == nil {
+		return nil, f.badFile("readdirent")
+	}
+
+	return f.reader.Readdirnames(n)
+}
+
+// Stat returns the os.FileInfo for the file. For files opened for writing,
+// the size reflects only the data acknowledged so far.
+func (f *File) Stat() (os.FileInfo, error) {
+	if f.reader != nil {
+		return f.reader.Stat(), nil
+	}
+
+	return f.client.Stat(f.name)
+}
+
+// Sync flushes any buffered data to the datanodes. It does nothing for files
+// opened for reading.
+func (f *File) Sync() error {
+	if f.writer == nil {
+		return nil
+	}
+
+	return f.writer.Flush()
+}
+
+// Truncate always returns an error, since HDFS can't truncate a file that's
+// open. Use hdfs.Client.Truncate instead.
+func (f *File) Truncate(size int64) error {
+	return &os.PathError{"truncate", f.name, ErrNotSupported}
+}
+
+func (f *File) badFile(op string) error {
+	return &os.PathError{op, f.name, syscall.EBADF}
+}
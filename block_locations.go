@@ -0,0 +1,122 @@
+package hdfs
+
+import (
+	"fmt"
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// BlockLocation represents the location of a single block of a file in HDFS,
+// and is the equivalent of BlockLocation in the Java client. It's useful for
+// scheduling work close to the data it operates on.
+//
+// The slices Hosts, Names, TopologyPaths, StorageIDs and StorageTypes all have
+// one entry per replica, in the same order, which is the order of proximity
+// to the client as determined by the namenode.
+type BlockLocation struct {
+	// Block is the name of the block, in the form
+	// <pool>:blk_<id>_<generation stamp>, as it appears in the namenode and
+	// datanode logs.
+	Block string
+	// Offset is the offset of the first byte of the block in the file.
+	Offset int64
+	// Length is the number of bytes in the block.
+	Length int64
+	// Hosts contains the hostnames of the datanodes holding a replica of the
+	// block.
+	Hosts []string
+	// Names contains the data transfer addresses (ip:port) of the datanodes
+	// holding a replica of the block.
+	Names []string
+	// TopologyPaths contains the full network topology path of each replica,
+	// in the form /rack/ip:port.
+	TopologyPaths []string
+	// StorageIDs contains the ID of the datanode volume storing each replica.
+	StorageIDs []string
+	// StorageTypes contains the type of volume storing each replica, for
+	// example "DISK" or "SSD".
+	StorageTypes []string
+	// CachedHosts contains the hostnames of the datanodes which have the block
+	// cached in memory.
+	CachedHosts []string
+	// Corrupt is true if all the replicas of the block are corrupt. If only
+	// some replicas are corrupt, the namenode leaves them out entirely.
+	Corrupt bool
+}
+
+// GetBlockLocations returns the locations of the blocks containing the byte
+// range of length bytes, starting at offset, in the named file.
+func (c *Client) GetBlockLocations(name string, offset, length int64) ([]BlockLocation, error) {
+	blocks, err := c.getBlockLocations(name, offset, length)
+	if err != nil {
+		return nil, &os.PathError{"block locations", name, interpretException(err)}
+	}
+
+	res := make([]BlockLocation, 0, len(blocks))
+	for _, block := range blocks {
+		res = append(res, newBlockLocation(block))
+	}
+
+	return res, nil
+}
+
+func (c *Client) getBlockLocations(name string, offset, length int64) ([]*hdfs.LocatedBlockProto, error) {
+	req := &hdfs.GetBlockLocationsRequestProto{
+		Src:    proto.String(name),
+		Offset: proto.Uint64(uint64(offset)),
+		Length: proto.Uint64(uint64(length)),
+	}
+	resp := &hdfs.GetBlockLocationsResponseProto{}
+
+	err := c.namenode.Execute("getBlockLocations", req, resp)
+	if err != nil {
+		return nil, err
+	} else if resp.GetLocations() == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return resp.GetLocations().GetBlocks(), nil
+}
+
+func newBlockLocation(block *hdfs.LocatedBlockProto) BlockLocation {
+	locs := block.GetLocs()
+	b := block.GetB()
+	name := fmt.Sprintf("%s:blk_%d_%d", b.GetPoolId(), b.GetBlockId(), b.GetGenerationStamp())
+	bl := BlockLocation{
+		Block:         name,
+		Offset:        int64(block.GetOffset()),
+		Length:        int64(b.GetNumBytes()),
+		Hosts:         make([]string, len(locs)),
+		Names:         make([]string, len(locs)),
+		TopologyPaths: make([]string, len(locs)),
+		StorageIDs:    make([]string, len(locs)),
+		StorageTypes:  make([]string, len(locs)),
+		Corrupt:       block.GetCorrupt(),
+	}
+
+	storageIDs := block.GetStorageIDs()
+	storageTypes := block.GetStorageTypes()
+	cached := block.GetIsCached()
+	for i, loc := range locs {
+		id := loc.GetId()
+		bl.Hosts[i] = id.GetHostName()
+		bl.Names[i] = fmt.Sprintf("%s:%d", id.GetIpAddr(), id.GetXferPort())
+		bl.TopologyPaths[i] = loc.GetLocation() + "/" + bl.Names[i]
+
+		if i < len(storageIDs) {
+			bl.StorageIDs[i] = storageIDs[i]
+		}
+
+		if i < len(storageTypes) {
+			bl.StorageTypes[i] = storageTypes[i].String()
+		}
+
+		if i < len(cached) && cached[i] {
+			bl.CachedHosts = append(bl.CachedHosts, bl.Hosts[i])
+		}
+	}
+
+	return bl
+}
@@ -0,0 +1,55 @@
+package hdfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBlockLocations(t *testing.T) {
+	client := getClient(t)
+
+	locs, err := client.GetBlockLocations("/_test/mobydick.txt", 0, 1048576)
+	require.NoError(t, err)
+	require.Len(t, locs, 1)
+
+	loc := locs[0]
+	assert.Regexp(t, `^BP-.+:blk_\d+_\d+$`, loc.Block)
+	assert.EqualValues(t, 0, loc.Offset)
+	assert.EqualValues(t, 1048576, loc.Length)
+	assert.False(t, loc.Corrupt)
+
+	require.NotEmpty(t, loc.Hosts)
+	assert.Len(t, loc.Names, len(loc.Hosts))
+	assert.Len(t, loc.TopologyPaths, len(loc.Hosts))
+	assert.Len(t, loc.StorageTypes, len(loc.Hosts))
+
+	for i := range loc.Hosts {
+		assert.True(t, strings.HasSuffix(loc.TopologyPaths[i], "/"+loc.Names[i]))
+		assert.True(t, strings.HasPrefix(loc.TopologyPaths[i], "/"))
+		assert.NotEmpty(t, loc.StorageTypes[i])
+	}
+}
+
+func TestGetBlockLocationsRange(t *testing.T) {
+	client := getClient(t)
+
+	locs, err := client.GetBlockLocations("/_test/mobydick.txt", 1048576, 10)
+	require.NoError(t, err)
+	require.Len(t, locs, 1)
+	assert.EqualValues(t, 1048576, locs[0].Offset)
+
+	all, err := client.GetBlockLocations("/_test/mobydick.txt", 0, 1<<30)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestGetBlockLocationsNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.GetBlockLocations("/_test/nonexistent", 0, 1)
+	assertPathError(t, err, "block locations", "/_test/nonexistent", os.ErrNotExist)
+}
@@ -9,7 +9,9 @@ import (
 	"os"
 	"os/user"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/colinmarc/hdfs/v2/hadoopconf"
 	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
@@ -21,18 +23,32 @@ import (
 
 type dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
+const (
+	defaultDatanodeConnCacheSize   = 16
+	defaultDatanodeConnCacheExpiry = 3 * time.Second
+)
+
 const (
 	DataTransferProtectionAuthentication = "authentication"
 	DataTransferProtectionIntegrity      = "integrity"
 	DataTransferProtectionPrivacy        = "privacy"
 )
 
+const (
+	ReplaceDatanodeOnFailureDefault = "DEFAULT"
+	ReplaceDatanodeOnFailureAlways  = "ALWAYS"
+	ReplaceDatanodeOnFailureNever   = "NEVER"
+)
+
 // Client represents a connection to an HDFS cluster. A Client will
 // automatically maintain leases for any open files, preventing other clients
 // from modifying them, until Close is called.
 type Client struct {
-	namenode *rpc.NamenodeConnection
-	options  ClientOptions
+	namenode     *rpc.NamenodeConnection
+	options      ClientOptions
+	hedgedReads  *transfer.HedgedReadPool
+	peerCache    *transfer.PeerCache
+	shortCircuit *transfer.ShortCircuit
 
 	defaults      *hdfs.FsServerDefaultsProto
 	encryptionKey *hdfs.DataEncryptionKeyProto
@@ -60,6 +76,11 @@ type ClientOptions struct {
 	// unless kerberos authentication is enabled, in which case it is overridden
 	// by the username set in KerberosClient.
 	User string
+	// ProxyUser specifies a user to impersonate. If set, the client
+	// authenticates as User (or the user set in KerberosClient), but acts as
+	// ProxyUser. The namenode must be configured to allow this, using the
+	// hadoop.proxyuser.* properties in core-site.xml.
+	ProxyUser string
 	// UseDatanodeHostname specifies whether the client should connect to the
 	// datanodes via hostname (which is useful in multi-homed setups) or IP
 	// address, which may be required if DNS isn't available.
@@ -91,6 +112,75 @@ type ClientOptions struct {
 	// has dfs.encrypt.data.transfer enabled, this setting is ignored and
 	// a level of "privacy" is used.
 	DataTransferProtection string
+	// TrashInterval specifies how long files moved to the trash with
+	// MoveToTrash are kept before being deleted. It's only used if the
+	// namenode doesn't specify an interval itself (see
+	// ServerDefaults.TrashInterval); if neither does, the trash is disabled.
+	TrashInterval time.Duration
+	// ReadAheadSize enables read-ahead for sequential reads with
+	// FileReader.Read, and limits how much data each FileReader buffers ahead
+	// of its offset. The data is fetched as ReadAheadConcurrency ranges at
+	// once, which are split at block boundaries, so that reads spanning
+	// several blocks fetch from all of them concurrently. Seeking forward
+	// within the buffered data is free; any other seek discards it, and
+	// cancels the fetches still in progress. If zero, read-ahead is disabled,
+	// and blocks are read one at a time.
+	ReadAheadSize int64
+	// ReadAheadConcurrency specifies how many ranges are fetched at once when
+	// ReadAheadSize is set. If zero, it defaults to 4.
+	ReadAheadConcurrency int
+	// HedgedReadThreshold enables hedged reads for FileReader.ReadAt. If
+	// reading from a datanode takes longer than the threshold, the same read
+	// is started on another datanode holding a replica of the block, and
+	// whichever finishes first is used. This mirrors the Java client's
+	// dfs.client.hedged.read.threshold.millis. If zero, hedged reads are
+	// disabled.
+	HedgedReadThreshold time.Duration
+	// HedgedReadPoolSize limits how many hedged reads can be in flight at once,
+	// across all the files opened by the Client. When the limit is reached,
+	// reads simply wait for the datanodes they've already started on. If zero,
+	// it defaults to 16.
+	HedgedReadPoolSize int
+	// DatanodeConnCacheSize is the number of idle datanode connections that
+	// the Client keeps open after reads, to reuse for later reads from the
+	// same datanodes. That saves a round trip, and a SASL handshake if data
+	// transfer protection is enabled. This mirrors the Java client's
+	// dfs.client.socketcache.capacity. If zero, it defaults to 16; if
+	// negative, connections aren't reused.
+	DatanodeConnCacheSize int
+	// DatanodeConnCacheExpiry is how long idle datanode connections are kept.
+	// It should be shorter than the datanodes' own idle timeout
+	// (dfs.datanode.socket.reuse.keepalive, four seconds by default). This
+	// mirrors dfs.client.socketcache.expiryMsec. If zero, it defaults to three
+	// seconds.
+	DatanodeConnCacheExpiry time.Duration
+	// ShortCircuitSocketPath enables short-circuit local reads. When a block
+	// has a replica on a datanode running on the same host, the Client asks
+	// the datanode for the block's files over this UNIX domain socket, and
+	// reads them directly instead of over TCP. If that fails for any reason,
+	// the block is read over the network as usual. The path must match the
+	// datanode's dfs.domain.socket.path; the special string '_PORT' is
+	// replaced with the datanode's data transfer port. Short-circuit reads are
+	// only supported on Linux.
+	ShortCircuitSocketPath string
+	// ShortCircuitSkipChecksum disables checksum verification for
+	// short-circuit reads. This mirrors
+	// dfs.client.read.shortcircuit.skip.checksum.
+	ShortCircuitSkipChecksum bool
+	// ReplaceDatanodeOnFailure determines when a datanode that fails while
+	// writing is replaced with a new one, rather than continuing to write to
+	// the remaining datanodes in the pipeline. It can be 'DEFAULT', 'ALWAYS'
+	// or 'NEVER', like the Java client's
+	// dfs.client.block.write.replace-datanode-on-failure.policy. 'DEFAULT'
+	// (or an empty string) replaces a failed datanode if the replication is
+	// at least three, and either half the datanodes have failed, or the file
+	// is being appended to or has been flushed.
+	ReplaceDatanodeOnFailure string
+	// ReplaceDatanodeOnFailureBestEffort specifies that writes should continue
+	// with the remaining datanodes if a failed datanode can't be replaced,
+	// rather than failing. This mirrors
+	// dfs.client.block.write.replace-datanode-on-failure.best-effort.
+	ReplaceDatanodeOnFailureBestEffort bool
 	// skipSaslForPrivilegedDatanodePorts implements a strange edge case present
 	// in the official java client. If data.transfer.protection is set but not
 	// dfs.encrypt.data.transfer, and the datanode is running on a privileged
@@ -124,6 +214,39 @@ type ClientOptions struct {
 //   // (in the latter case, it is set to 'privacy').
 //   DataTransferProtection string
 //
+//   // Determined by fs.trash.interval, which is in minutes.
+//   TrashInterval time.Duration
+//
+//   // Set if dfs.client.hedged.read.threadpool.size is greater than zero, to
+//   // dfs.client.hedged.read.threshold.millis (or its default of 500ms).
+//   HedgedReadThreshold time.Duration
+//
+//   // Determined by dfs.client.hedged.read.threadpool.size.
+//   HedgedReadPoolSize int
+//
+//   // Determined by dfs.client.socketcache.capacity (set to -1 if it's zero,
+//   // which disables the cache).
+//   DatanodeConnCacheSize int
+//
+//   // Determined by dfs.client.socketcache.expiryMsec.
+//   DatanodeConnCacheExpiry time.Duration
+//
+//   // Set to dfs.domain.socket.path if dfs.client.read.shortcircuit is
+//   // 'true'.
+//   ShortCircuitSocketPath string
+//
+//   // Determined by dfs.client.read.shortcircuit.skip.checksum.
+//   ShortCircuitSkipChecksum bool
+//
+//   // Determined by dfs.client.block.write.replace-datanode-on-failure.policy,
+//   // or set to 'NEVER' if
+//   // dfs.client.block.write.replace-datanode-on-failure.enable is 'false'.
+//   ReplaceDatanodeOnFailure string
+//
+//   // Determined by
+//   // dfs.client.block.write.replace-datanode-on-failure.best-effort.
+//   ReplaceDatanodeOnFailureBestEffort bool
+//
 // Because of the way Kerberos can be forced by the Hadoop configuration but not
 // actually configured, you should check for whether KerberosClient is set in
 // the resulting ClientOptions before proceeding:
@@ -138,6 +261,42 @@ func ClientOptionsFromConf(conf hadoopconf.HadoopConf) ClientOptions {
 
 	options.UseDatanodeHostname = (conf["dfs.client.use.datanode.hostname"] == "true")
 
+	if minutes, err := strconv.ParseFloat(conf["fs.trash.interval"], 64); err == nil && minutes > 0 {
+		options.TrashInterval = time.Duration(minutes * float64(time.Minute))
+	}
+
+	if size, err := strconv.Atoi(conf["dfs.client.hedged.read.threadpool.size"]); err == nil && size > 0 {
+		options.HedgedReadPoolSize = size
+		options.HedgedReadThreshold = 500 * time.Millisecond
+		if millis, err := strconv.Atoi(conf["dfs.client.hedged.read.threshold.millis"]); err == nil && millis > 0 {
+			options.HedgedReadThreshold = time.Duration(millis) * time.Millisecond
+		}
+	}
+
+	if size, err := strconv.Atoi(conf["dfs.client.socketcache.capacity"]); err == nil {
+		options.DatanodeConnCacheSize = size
+		if size == 0 {
+			options.DatanodeConnCacheSize = -1
+		}
+	}
+
+	if millis, err := strconv.Atoi(conf["dfs.client.socketcache.expiryMsec"]); err == nil && millis > 0 {
+		options.DatanodeConnCacheExpiry = time.Duration(millis) * time.Millisecond
+	}
+
+	if conf["dfs.client.read.shortcircuit"] == "true" {
+		options.ShortCircuitSocketPath = conf["dfs.domain.socket.path"]
+	}
+
+	options.ShortCircuitSkipChecksum = (conf["dfs.client.read.shortcircuit.skip.checksum"] == "true")
+
+	options.ReplaceDatanodeOnFailure = conf["dfs.client.block.write.replace-datanode-on-failure.policy"]
+	if conf["dfs.client.block.write.replace-datanode-on-failure.enable"] == "false" {
+		options.ReplaceDatanodeOnFailure = ReplaceDatanodeOnFailureNever
+	}
+
+	options.ReplaceDatanodeOnFailureBestEffort = (conf["dfs.client.block.write.replace-datanode-on-failure.best-effort"] == "true")
+
 	if strings.ToLower(conf["hadoop.security.authentication"]) == "kerberos" {
 		// Set an empty KerberosClient here so that the user is forced to either
 		// unset it (disabling kerberos altogether) or replace it with a valid
@@ -193,6 +352,7 @@ func NewClient(options ClientOptions) (*Client, error) {
 		rpc.NamenodeConnectionOptions{
 			Addresses:                    options.Addresses,
 			User:                         options.User,
+			ProxyUser:                    options.ProxyUser,
 			DialFunc:                     options.NamenodeDialFunc,
 			KerberosClient:               options.KerberosClient,
 			KerberosServicePrincipleName: options.KerberosServicePrincipleName,
@@ -203,7 +363,39 @@ func NewClient(options ClientOptions) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{namenode: namenode, options: options}, nil
+	c := &Client{namenode: namenode, options: options}
+	if options.HedgedReadThreshold > 0 {
+		size := options.HedgedReadPoolSize
+		if size <= 0 {
+			size = defaultHedgedReadPoolSize
+		}
+
+		c.hedgedReads = transfer.NewHedgedReadPool(size)
+	}
+
+	if options.DatanodeConnCacheSize >= 0 {
+		size := options.DatanodeConnCacheSize
+		if size == 0 {
+			size = defaultDatanodeConnCacheSize
+		}
+
+		expiry := options.DatanodeConnCacheExpiry
+		if expiry <= 0 {
+			expiry = defaultDatanodeConnCacheExpiry
+		}
+
+		c.peerCache = transfer.NewPeerCache(size, expiry)
+	}
+
+	if options.ShortCircuitSocketPath != "" {
+		c.shortCircuit = &transfer.ShortCircuit{
+			SocketPath:   options.ShortCircuitSocketPath,
+			ClientName:   namenode.ClientName,
+			SkipChecksum: options.ShortCircuitSkipChecksum,
+		}
+	}
+
+	return c, nil
 }
 
 // New returns Client connected to the namenode(s) specified by address, or an
@@ -239,7 +431,7 @@ func New(address string) (*Client, error) {
 }
 
 // User returns the user that the Client is acting under. This is either the
-// current system user or the kerberos principal.
+// current system user or the kerberos principal, or ProxyUser if it was set.
 func (c *Client) User() string {
 	return c.namenode.User
 }
@@ -357,5 +549,10 @@ func (c *Client) wrapDatanodeDial(dc dialContext, token *hadoop.TokenProto) (dia
 
 // Close terminates all underlying socket connections to remote server.
 func (c *Client) Close() error {
+	c.peerCache.Close()
+	if c.shortCircuit != nil {
+		c.shortCircuit.Close()
+	}
+
 	return c.namenode.Close()
 }
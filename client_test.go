@@ -7,6 +7,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/colinmarc/hdfs/v2/hadoopconf"
 	krb "github.com/jcmturner/gokrb5/v8/client"
@@ -156,6 +157,59 @@ func TestNewWithMultipleNodes(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestDatanodeConnCacheOptionsFromConf(t *testing.T) {
+	options := ClientOptionsFromConf(hadoopconf.HadoopConf{})
+	assert.Zero(t, options.DatanodeConnCacheSize)
+	assert.Zero(t, options.DatanodeConnCacheExpiry)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.socketcache.capacity":   "32",
+		"dfs.client.socketcache.expiryMsec": "1000",
+	})
+	assert.Equal(t, 32, options.DatanodeConnCacheSize)
+	assert.Equal(t, time.Second, options.DatanodeConnCacheExpiry)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.socketcache.capacity": "0",
+	})
+	assert.Equal(t, -1, options.DatanodeConnCacheSize)
+}
+
+func TestShortCircuitOptionsFromConf(t *testing.T) {
+	options := ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.domain.socket.path": "/var/lib/hadoop-hdfs/dn_socket",
+	})
+	assert.Empty(t, options.ShortCircuitSocketPath)
+	assert.False(t, options.ShortCircuitSkipChecksum)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.read.shortcircuit":               "true",
+		"dfs.client.read.shortcircuit.skip.checksum": "true",
+		"dfs.domain.socket.path":                     "/var/lib/hadoop-hdfs/dn_socket",
+	})
+	assert.Equal(t, "/var/lib/hadoop-hdfs/dn_socket", options.ShortCircuitSocketPath)
+	assert.True(t, options.ShortCircuitSkipChecksum)
+}
+
+func TestReplaceDatanodeOnFailureOptionsFromConf(t *testing.T) {
+	options := ClientOptionsFromConf(hadoopconf.HadoopConf{})
+	assert.Empty(t, options.ReplaceDatanodeOnFailure)
+	assert.False(t, options.ReplaceDatanodeOnFailureBestEffort)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.block.write.replace-datanode-on-failure.policy":      "ALWAYS",
+		"dfs.client.block.write.replace-datanode-on-failure.best-effort": "true",
+	})
+	assert.Equal(t, ReplaceDatanodeOnFailureAlways, options.ReplaceDatanodeOnFailure)
+	assert.True(t, options.ReplaceDatanodeOnFailureBestEffort)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.block.write.replace-datanode-on-failure.enable": "false",
+		"dfs.client.block.write.replace-datanode-on-failure.policy": "ALWAYS",
+	})
+	assert.Equal(t, ReplaceDatanodeOnFailureNever, options.ReplaceDatanodeOnFailure)
+}
+
 func TestNewWithFailingNode(t *testing.T) {
 	_, err := New("localhost:100")
 	assert.NotNil(t, err)
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+func blocks(paths []string) {
+	if len(paths) == 0 {
+		fatalWithUsage()
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(paths)
+	if err != nil {
+		fatal(err)
+	}
+
+	for i, p := range expanded {
+		info, err := client.Stat(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		} else if info.IsDir() {
+			fmt.Fprintln(os.Stderr, &os.PathError{"blocks", p, errors.New("is a directory")})
+			status = 1
+			continue
+		}
+
+		locs, err := client.GetBlockLocations(p, 0, info.Size())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		if len(expanded) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+
+			fmt.Printf("%s:\n", p)
+		}
+
+		printBlocks(locs)
+	}
+}
+
+func printBlocks(locs []hdfs.BlockLocation) {
+	tw := tabwriter.NewWriter(os.Stdout, 3, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "OFFSET\tLENGTH\tCORRUPT\tREPLICAS\n")
+
+	for _, loc := range locs {
+		cached := make(map[string]bool, len(loc.CachedHosts))
+		for _, host := range loc.CachedHosts {
+			cached[host] = true
+		}
+
+		replicas := make([]string, len(loc.Hosts))
+		for i, host := range loc.Hosts {
+			attrs := []string{loc.TopologyPaths[i], loc.StorageTypes[i]}
+			if cached[host] {
+				attrs = append(attrs, "CACHED")
+			}
+
+			replicas[i] = fmt.Sprintf("%s[%s]", host, strings.Join(attrs, ","))
+		}
+
+		fmt.Fprintf(tw, "%d\t%d\t%t\t%s\n",
+			loc.Offset, loc.Length, loc.Corrupt, strings.Join(replicas, " "))
+	}
+
+	tw.Flush()
+}
@@ -21,10 +21,19 @@ var knownCommands = []string{
 	"tail",
 	"du",
 	"checksum",
+	"blocks",
 	"get",
 	"getmerge",
 	"put",
 	"df",
+	"setrep",
+	"expunge",
+	"fsck",
+	"dfsadmin",
+	"haadmin",
+	"serve-webhdfs",
+	"serve-s3",
+	"serve-sftp",
 }
 
 func complete(args []string) {
@@ -46,7 +55,7 @@ func completeArg(command, fragment string, position int) {
 	if (command == "put" && position == 1) ||
 		((command == "get" || command == "getmerge") && position == 2) {
 		fmt.Println("_FILE_") // The bash_completion bit knows about this special string.
-	} else if (command == "chmod" || command == "chown") && position == 1 {
+	} else if (command == "chmod" || command == "chown" || command == "setrep") && position == 1 {
 		return
 	} else if !strings.HasPrefix(fragment, "-") {
 		completePath(fragment)
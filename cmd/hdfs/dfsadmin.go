@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+const dfsadminSeparator = "-------------------------------------------------"
+
+var safeModeWaitInterval = 1 * time.Second
+
+func dfsadmin(args []string) {
+	if len(args) == 0 {
+		fatalWithUsage()
+	}
+
+	switch args[0] {
+	case "-report":
+		dfsadminReport(args[1:])
+	case "-safemode":
+		if len(args) != 2 {
+			fatalWithUsage()
+		}
+
+		dfsadminSafeMode(args[1])
+	case "-saveNamespace":
+		dfsadminSaveNamespace()
+	case "-rollEdits":
+		dfsadminRollEdits()
+	case "-refreshNodes":
+		dfsadminRefreshNodes()
+	case "-rollingUpgrade":
+		action := "query"
+		if len(args) > 2 {
+			fatalWithUsage()
+		} else if len(args) == 2 {
+			action = args[1]
+		}
+
+		dfsadminRollingUpgrade(action)
+	default:
+		fatalWithUsage("Unknown dfsadmin command:", args[0])
+	}
+}
+
+func dfsadminReport(args []string) {
+	var types []hdfs.DatanodeReportType
+	for _, arg := range args {
+		switch arg {
+		case "-live":
+			types = append(types, hdfs.DatanodeReportLive)
+		case "-dead":
+			types = append(types, hdfs.DatanodeReportDead)
+		case "-decommissioning":
+			types = append(types, hdfs.DatanodeReportDecommissioning)
+		case "-enteringmaintenance":
+			types = append(types, hdfs.DatanodeReportEnteringMaintenance)
+		case "-inmaintenance":
+			types = append(types, hdfs.DatanodeReportInMaintenance)
+		default:
+			fatalWithUsage("Unknown report option:", arg)
+		}
+	}
+
+	// Like the java CLI, print only live and dead datanodes by default.
+	if len(types) == 0 {
+		types = []hdfs.DatanodeReportType{hdfs.DatanodeReportLive, hdfs.DatanodeReportDead}
+	}
+
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	fs, err := client.StatFs()
+	if err != nil {
+		fatal(err)
+	}
+
+	present := fs.Used + fs.Remaining
+	fmt.Printf("Configured Capacity: %s\n", formatBytesWithRaw(fs.Capacity))
+	fmt.Printf("Present Capacity: %s\n", formatBytesWithRaw(present))
+	fmt.Printf("DFS Remaining: %s\n", formatBytesWithRaw(fs.Remaining))
+	fmt.Printf("DFS Used: %s\n", formatBytesWithRaw(fs.Used))
+	fmt.Printf("DFS Used%%: %s\n", formatPercent(fs.Used, present))
+
+	fmt.Println("Replicated Blocks:")
+	fmt.Printf("\tUnder replicated blocks: %d\n", fs.UnderReplicated)
+	fmt.Printf("\tBlocks with corrupt replicas: %d\n", fs.CorruptBlocks)
+	fmt.Printf("\tMissing blocks: %d\n", fs.MissingBlocks)
+	fmt.Printf("\tMissing blocks (with replication factor 1): %d\n", fs.MissingReplOneBlocks)
+	fmt.Printf("\tLow redundancy blocks with highest priority to recover: %d\n",
+		fs.ReplicatedBlocks.HighestPriorityLowRedundancyBlocks)
+	fmt.Printf("\tPending deletion blocks: %d\n", fs.PendingDeletionBlocks)
+
+	fmt.Println("Erasure Coded Block Groups:")
+	fmt.Printf("\tLow redundancy block groups: %d\n", fs.ECBlockGroups.LowRedundancy)
+	fmt.Printf("\tBlock groups with corrupt internal blocks: %d\n", fs.ECBlockGroups.CorruptBlocks)
+	fmt.Printf("\tMissing block groups: %d\n", fs.ECBlockGroups.MissingBlocks)
+	fmt.Printf("\tLow redundancy blocks with highest priority to recover: %d\n",
+		fs.ECBlockGroups.HighestPriorityLowRedundancyBlocks)
+	fmt.Printf("\tPending deletion blocks: %d\n", fs.ECBlockGroups.PendingDeletionBlocks)
+
+	fmt.Println()
+	fmt.Println(dfsadminSeparator)
+
+	for _, t := range types {
+		reports, err := client.DatanodeStorageReport(t)
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Printf("%s datanodes (%d):\n\n", reportTypeName(t), len(reports))
+		for _, report := range reports {
+			printDatanodeReport(report)
+			fmt.Println()
+		}
+	}
+}
+
+func dfsadminSafeMode(action string) {
+	var a hdfs.SafeModeAction
+	wait := false
+	switch action {
+	case "get":
+		a = hdfs.SafeModeGet
+	case "enter":
+		a = hdfs.SafeModeEnter
+	case "leave":
+		a = hdfs.SafeModeLeave
+	case "forceExit":
+		a = hdfs.SafeModeForceExit
+	case "wait":
+		a = hdfs.SafeModeGet
+		wait = true
+	default:
+		fatalWithUsage("Unknown safemode action:", action)
+	}
+
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	on, err := client.SetSafeMode(a)
+	if err != nil {
+		fatal(err)
+	}
+
+	for wait && on {
+		time.Sleep(safeModeWaitInterval)
+		on, err = client.SetSafeMode(hdfs.SafeModeGet)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	if on {
+		fmt.Println("Safe mode is ON")
+	} else {
+		fmt.Println("Safe mode is OFF")
+	}
+}
+
+func dfsadminSaveNamespace() {
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	err = client.SaveNamespace()
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("Save namespace successful")
+}
+
+func dfsadminRollEdits() {
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	txid, err := client.RollEdits()
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("Successfully rolled edit logs.")
+	fmt.Printf("New segment starts at txid %d\n", txid)
+}
+
+func dfsadminRefreshNodes() {
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	err = client.RefreshNodes()
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("Refresh nodes successful")
+}
+
+func dfsadminRollingUpgrade(action string) {
+	var a hdfs.RollingUpgradeAction
+	switch action {
+	case "query":
+		a = hdfs.RollingUpgradeQuery
+	case "prepare":
+		a = hdfs.RollingUpgradePrepare
+	case "finalize":
+		a = hdfs.RollingUpgradeFinalize
+	default:
+		fatalWithUsage("Unknown rollingUpgrade action:", action)
+	}
+
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	info, err := client.RollingUpgrade(a)
+	if err != nil {
+		fatal(err)
+	}
+
+	if info == nil {
+		fmt.Println("There is no rolling upgrade in progress or rolling upgrade has already been finalized.")
+		return
+	}
+
+	if info.Finalized {
+		fmt.Println("Rolling upgrade is finalized.")
+	} else if info.CreatedRollbackImages {
+		fmt.Println("Proceed with rolling upgrade:")
+	} else {
+		fmt.Println("Preparing for upgrade. Data is being saved for rollback.")
+		fmt.Println("Run \"dfsadmin -rollingUpgrade query\" to check the status")
+		fmt.Println("for proceeding with rolling upgrade")
+	}
+
+	fmt.Printf("  Block Pool ID: %s\n", info.BlockPoolID)
+	fmt.Printf("     Start Time: %s\n", info.StartTime.Format(time.UnixDate))
+	if !info.FinalizeTime.IsZero() {
+		fmt.Printf("  Finalize Time: %s\n", info.FinalizeTime.Format(time.UnixDate))
+	}
+}
+
+func printDatanodeReport(report hdfs.DatanodeStorageReport) {
+	dn := report.Datanode
+	fmt.Printf("Name: %s (%s)\n", dn.Name, dn.Hostname)
+	fmt.Printf("Hostname: %s\n", dn.Hostname)
+	if dn.Rack != "" {
+		fmt.Printf("Rack: %s\n", dn.Rack)
+	}
+
+	if dn.UpgradeDomain != "" {
+		fmt.Printf("Upgrade domain: %s\n", dn.UpgradeDomain)
+	}
+
+	fmt.Printf("Decommission Status : %s\n", adminStateName(dn.AdminState))
+	fmt.Printf("Configured Capacity: %s\n", formatBytesWithRaw(dn.Capacity))
+	fmt.Printf("DFS Used: %s\n", formatBytesWithRaw(dn.DfsUsed))
+	fmt.Printf("Non DFS Used: %s\n", formatBytesWithRaw(dn.NonDfsUsed))
+	fmt.Printf("DFS Remaining: %s\n", formatBytesWithRaw(dn.Remaining))
+	fmt.Printf("DFS Used%%: %s\n", formatPercent(dn.DfsUsed, dn.Capacity))
+	fmt.Printf("DFS Remaining%%: %s\n", formatPercent(dn.Remaining, dn.Capacity))
+	fmt.Printf("Configured Cache Capacity: %s\n", formatBytesWithRaw(dn.CacheCapacity))
+	fmt.Printf("Cache Used: %s\n", formatBytesWithRaw(dn.CacheUsed))
+	fmt.Printf("Cache Remaining: %s\n", formatBytesWithRaw(dn.CacheCapacity-dn.CacheUsed))
+	fmt.Printf("Cache Used%%: %s\n", formatPercent(dn.CacheUsed, dn.CacheCapacity))
+	fmt.Printf("Cache Remaining%%: %s\n", formatPercent(dn.CacheCapacity-dn.CacheUsed, dn.CacheCapacity))
+	fmt.Printf("Xceivers: %d\n", dn.XceiverCount)
+	fmt.Printf("Last contact: %s\n", dn.LastContact.Format(time.UnixDate))
+	if !dn.LastBlockReport.IsZero() {
+		fmt.Printf("Last Block Report: %s\n", dn.LastBlockReport.Format(time.UnixDate))
+	}
+
+	fmt.Printf("Num of Blocks: %d\n", dn.NumBlocks)
+
+	for _, storage := range report.Storages {
+		state := storage.State
+		if storage.Failed {
+			state = "FAILED"
+		}
+
+		fmt.Printf("Volume %s: %s, %s, %s used of %s\n",
+			storage.StorageID, storage.StorageType, state,
+			formatBytes(storage.DfsUsed), formatBytes(storage.Capacity))
+	}
+}
+
+func reportTypeName(t hdfs.DatanodeReportType) string {
+	switch t {
+	case hdfs.DatanodeReportLive:
+		return "Live"
+	case hdfs.DatanodeReportDead:
+		return "Dead"
+	case hdfs.DatanodeReportDecommissioning:
+		return "Decommissioning"
+	case hdfs.DatanodeReportEnteringMaintenance:
+		return "Entering maintenance"
+	case hdfs.DatanodeReportInMaintenance:
+		return "In maintenance"
+	default:
+		return "All"
+	}
+}
+
+func adminStateName(state string) string {
+	switch state {
+	case "DECOMMISSION_INPROGRESS":
+		return "Decommission in progress"
+	case "DECOMMISSIONED":
+		return "Decommissioned"
+	case "ENTERING_MAINTENANCE":
+		return "Entering maintenance"
+	case "IN_MAINTENANCE":
+		return "In maintenance"
+	default:
+		return "Normal"
+	}
+}
+
+func formatBytesWithRaw(i uint64) string {
+	return fmt.Sprintf("%d (%s)", i, formatBytes(i))
+}
+
+func formatPercent(n, total uint64) string {
+	if total == 0 {
+		return "0.00%"
+	}
+
+	return fmt.Sprintf("%.2f%%", 100*float64(n)/float64(total))
+}
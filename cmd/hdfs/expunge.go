@@ -0,0 +1,22 @@
+package main
+
+func expunge(args []string) {
+	immediate := false
+	for _, arg := range args {
+		if arg == "-immediate" {
+			immediate = true
+		} else {
+			fatalWithUsage("Unknown expunge option:", arg)
+		}
+	}
+
+	client, err := getClient("")
+	if err != nil {
+		fatal(err)
+	}
+
+	err = client.ExpungeTrash(immediate)
+	if err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// fsckOptions corresponds to the flags accepted by the fsck command.
+type fsckOptions struct {
+	files     bool
+	blocks    bool
+	locations bool
+	verify    bool
+	json      bool
+}
+
+// fsckReport is the result of checking a tree. It's printed either as text
+// or, with -json, marshaled directly.
+type fsckReport struct {
+	Path    string `json:"path"`
+	Healthy bool   `json:"healthy"`
+
+	TotalSize   int64 `json:"totalSize"`
+	TotalDirs   int   `json:"totalDirs"`
+	TotalFiles  int   `json:"totalFiles"`
+	TotalBlocks int   `json:"totalBlocks"`
+
+	MinimallyReplicatedBlocks int `json:"minimallyReplicatedBlocks"`
+	OverReplicatedBlocks      int `json:"overReplicatedBlocks"`
+	UnderReplicatedBlocks     int `json:"underReplicatedBlocks"`
+	CorruptBlocks             int `json:"corruptBlocks"`
+	MissingBlocks             int `json:"missingBlocks"`
+	MissingReplicas           int `json:"missingReplicas"`
+	MismatchedBlocks          int `json:"mismatchedBlocks,omitempty"`
+	CorruptReplicas           int `json:"corruptReplicas,omitempty"`
+
+	// Files contains every file if -files is passed, and otherwise only the
+	// files with problems.
+	Files []*fsckFile `json:"files,omitempty"`
+	// Errors contains any errors encountered while walking the tree.
+	Errors []string `json:"errors,omitempty"`
+}
+
+type fsckFile struct {
+	Path        string       `json:"path"`
+	Size        int64        `json:"size"`
+	Replication int          `json:"replication"`
+	NumBlocks   int          `json:"numBlocks"`
+	Problems    []string     `json:"problems,omitempty"`
+	Blocks      []*fsckBlock `json:"blocks,omitempty"`
+}
+
+type fsckBlock struct {
+	Block        string   `json:"block"`
+	Length       int64    `json:"length"`
+	LiveReplicas int      `json:"liveReplicas"`
+	Locations    []string `json:"locations,omitempty"`
+}
+
+func fsck(args []string) {
+	var opts fsckOptions
+	var paths []string
+	listCorrupt := false
+	for _, arg := range args {
+		switch arg {
+		case "-list-corruptfileblocks":
+			listCorrupt = true
+		case "-files":
+			opts.files = true
+		case "-blocks":
+			opts.blocks = true
+		case "-locations":
+			opts.locations = true
+		case "-verify":
+			opts.verify = true
+		case "-json":
+			opts.json = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fatalWithUsage("Unknown fsck option:", arg)
+			}
+
+			paths = append(paths, arg)
+		}
+	}
+
+	if len(paths) != 1 {
+		fatalWithUsage()
+	}
+
+	if listCorrupt {
+		fsckListCorruptFileBlocks(paths[0])
+		return
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(paths)
+	if err != nil {
+		fatal(err)
+	}
+
+	report := &fsckReport{Path: paths[0]}
+	for _, p := range expanded {
+		err = client.Walk(p, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				return nil
+			}
+
+			if info.IsDir() {
+				report.TotalDirs++
+			} else {
+				fsckFileBlocks(client, report, name, info, opts)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	report.Healthy = (report.CorruptBlocks == 0 && report.MissingBlocks == 0 &&
+		report.MismatchedBlocks == 0 && report.CorruptReplicas == 0)
+
+	if opts.json {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Println(string(b))
+	} else {
+		printFsckReport(report, opts)
+	}
+
+	if !report.Healthy || len(report.Errors) > 0 {
+		status = 1
+	}
+}
+
+// fsckFileBlocks checks the blocks of a single file against its replication
+// target, and adds the results to the report.
+func fsckFileBlocks(client *hdfs.Client, report *fsckReport, name string, info os.FileInfo, opts fsckOptions) {
+	fi := info.(*hdfs.FileInfo)
+	file := &fsckFile{Path: name, Size: fi.Size(), Replication: fi.Replication()}
+	report.TotalFiles++
+	report.TotalSize += fi.Size()
+
+	locs, err := client.GetBlockLocations(name, 0, fi.Size())
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return
+	}
+
+	var checksums [][]hdfs.ReplicaChecksum
+	var verified [][]hdfs.ReplicaVerification
+	if opts.verify {
+		checksums, err = client.ReplicaChecksums(name)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else if len(checksums) != len(locs) {
+			// The file changed in between the two calls.
+			checksums = nil
+		}
+
+		verified, err = client.VerifyReplicas(name)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else if len(verified) != len(locs) {
+			verified = nil
+		}
+	}
+
+	file.NumBlocks = len(locs)
+	for i, loc := range locs {
+		report.TotalBlocks++
+		live := len(loc.Hosts)
+		if loc.Corrupt {
+			live = 0
+		}
+
+		block := &fsckBlock{
+			Block:        loc.Block,
+			Length:       loc.Length,
+			LiveReplicas: live,
+		}
+
+		if opts.locations || opts.json {
+			block.Locations = loc.Names
+		}
+
+		file.Blocks = append(file.Blocks, block)
+
+		switch {
+		case loc.Corrupt:
+			report.CorruptBlocks++
+			file.Problems = append(file.Problems,
+				fmt.Sprintf("CORRUPT block %s", loc.Block))
+		case live == 0:
+			report.MissingBlocks++
+			file.Problems = append(file.Problems,
+				fmt.Sprintf("MISSING block %s len=%d", loc.Block, loc.Length))
+		}
+
+		if live > 0 {
+			report.MinimallyReplicatedBlocks++
+		}
+
+		if live < fi.Replication() {
+			report.UnderReplicatedBlocks++
+			report.MissingReplicas += fi.Replication() - live
+			if live > 0 {
+				file.Problems = append(file.Problems, fmt.Sprintf(
+					"Under replicated %s. Target Replicas is %d but found %d live replica(s).",
+					loc.Block, fi.Replication(), live))
+			}
+		} else if live > fi.Replication() {
+			report.OverReplicatedBlocks++
+		}
+
+		if checksums != nil {
+			if problem := verifyReplicas(loc.Block, checksums[i]); problem != "" {
+				report.MismatchedBlocks++
+				file.Problems = append(file.Problems, problem)
+			}
+		}
+
+		if verified != nil {
+			for _, replica := range verified[i] {
+				if replica.Corrupt {
+					report.CorruptReplicas++
+					file.Problems = append(file.Problems,
+						fmt.Sprintf("CORRUPT replica of %s on %s", loc.Block, replica.Datanode))
+				} else if replica.Err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf(
+						"%s: couldn't read replica of %s on %s: %s", name, loc.Block, replica.Datanode, replica.Err))
+				}
+			}
+		}
+	}
+
+	if !opts.blocks && !opts.json {
+		file.Blocks = nil
+	}
+
+	if opts.files || len(file.Problems) > 0 {
+		report.Files = append(report.Files, file)
+	}
+}
+
+// verifyReplicas compares the checksums of all the replicas of a block, and
+// returns a description of the problem if they don't match or couldn't be
+// read.
+func verifyReplicas(block string, replicas []hdfs.ReplicaChecksum) string {
+	var failed []string
+	var mismatched bool
+	var expected []byte
+	for _, replica := range replicas {
+		if replica.Err != nil {
+			failed = append(failed, replica.Datanode)
+			continue
+		}
+
+		if expected == nil {
+			expected = replica.Checksum
+		} else if !bytes.Equal(expected, replica.Checksum) {
+			mismatched = true
+		}
+	}
+
+	if mismatched {
+		return fmt.Sprintf("Replica checksums for %s don't match.", block)
+	} else if len(failed) > 0 {
+		return fmt.Sprintf("Couldn't read checksums for %s from %s.", block, strings.Join(failed, ", "))
+	}
+
+	return ""
+}
+
+func printFsckReport(report *fsckReport, opts fsckOptions) {
+	for _, file := range report.Files {
+		if opts.files {
+			state := "OK"
+			if len(file.Problems) > 0 {
+				state = "PROBLEMS"
+			}
+
+			fmt.Printf("%s %d bytes, replicated: replication=%d, %d block(s):  %s\n",
+				file.Path, file.Size, file.Replication, file.NumBlocks, state)
+		}
+
+		for _, problem := range file.Problems {
+			fmt.Printf("%s: %s\n", file.Path, problem)
+		}
+
+		for i, block := range file.Blocks {
+			fmt.Printf("%d. %s len=%d Live_repl=%d", i, block.Block, block.Length, block.LiveReplicas)
+			if opts.locations {
+				fmt.Printf(" [%s]", strings.Join(block.Locations, ", "))
+			}
+
+			fmt.Println()
+		}
+
+		if opts.files {
+			fmt.Println()
+		}
+	}
+
+	for _, err := range report.Errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	state := "HEALTHY"
+	if !report.Healthy {
+		state = "CORRUPT"
+	}
+
+	avgBlockSize := int64(0)
+	if report.TotalBlocks > 0 {
+		avgBlockSize = report.TotalSize / int64(report.TotalBlocks)
+	}
+
+	fmt.Printf("Status: %s\n", state)
+	fmt.Printf(" Total size:\t%d B\n", report.TotalSize)
+	fmt.Printf(" Total dirs:\t%d\n", report.TotalDirs)
+	fmt.Printf(" Total files:\t%d\n", report.TotalFiles)
+	fmt.Printf(" Total blocks (validated):\t%d (avg. block size %d B)\n", report.TotalBlocks, avgBlockSize)
+	fmt.Printf(" Minimally replicated blocks:\t%d (%s)\n",
+		report.MinimallyReplicatedBlocks, fsckPercent(report.MinimallyReplicatedBlocks, report.TotalBlocks))
+	fmt.Printf(" Over-replicated blocks:\t%d (%s)\n",
+		report.OverReplicatedBlocks, fsckPercent(report.OverReplicatedBlocks, report.TotalBlocks))
+	fmt.Printf(" Under-replicated blocks:\t%d (%s)\n",
+		report.UnderReplicatedBlocks, fsckPercent(report.UnderReplicatedBlocks, report.TotalBlocks))
+	fmt.Printf(" Corrupt blocks:\t\t%d\n", report.CorruptBlocks)
+	fmt.Printf(" Missing blocks:\t\t%d\n", report.MissingBlocks)
+	fmt.Printf(" Missing replicas:\t\t%d\n", report.MissingReplicas)
+	if opts.verify {
+		fmt.Printf(" Blocks with mismatched replicas:\t%d\n", report.MismatchedBlocks)
+		fmt.Printf(" Corrupt replicas:\t\t%d\n", report.CorruptReplicas)
+	}
+
+	fmt.Println()
+	fmt.Printf("The filesystem under path '%s' is %s\n", report.Path, state)
+}
+
+func fsckPercent(n, total int) string {
+	if total == 0 {
+		return "0.0 %"
+	}
+
+	return fmt.Sprintf("%.1f %%", 100*float64(n)/float64(total))
+}
+
+func fsckListCorruptFileBlocks(path string) {
+	expanded, client, err := getClientAndExpandedPaths([]string{path})
+	if err != nil {
+		fatal(err)
+	}
+
+	count := 0
+	for _, p := range expanded {
+		cookie := ""
+		for {
+			var files []string
+			files, cookie, err = client.ListCorruptFileBlocks(p, cookie)
+			if err != nil {
+				fatal(err)
+			} else if len(files) == 0 {
+				break
+			}
+
+			for _, file := range files {
+				fmt.Println(file)
+			}
+
+			count += len(files)
+		}
+	}
+
+	if count == 0 {
+		fmt.Printf("The filesystem under path '%s' has 0 CORRUPT files\n", path)
+	} else {
+		fmt.Printf("The filesystem under path '%s' has %d CORRUPT files\n", path, count)
+		status = 1
+	}
+}
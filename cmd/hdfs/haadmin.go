@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+)
+
+const defaultZKFCPort = "8019"
+
+var errAutoFailover = errors.New("Automatic failover is enabled. Refusing to manually manage HA state, since it may cause a split-brain scenario. Use --forcemanual to override this.")
+
+// haadminTarget identifies a namenode in an HA nameservice.
+type haadminTarget struct {
+	id      string
+	address string
+}
+
+func haadmin(args []string) {
+	nameservice := ""
+	if len(args) >= 2 && args[0] == "-ns" {
+		nameservice = args[1]
+		args = args[2:]
+	}
+
+	if len(args) == 0 {
+		fatalWithUsage()
+	}
+
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil {
+		fatal("Problem loading configuration:", err)
+	}
+
+	if nameservice == "" {
+		nameservices := conf.Nameservices()
+		if len(nameservices) == 1 {
+			nameservice = nameservices[0]
+		}
+	}
+
+	command, args := args[0], args[1:]
+	forceManual := false
+	forceActive := false
+	var ids []string
+	for _, arg := range args {
+		switch arg {
+		case "--forcemanual":
+			forceManual = true
+		case "--forceactive":
+			forceActive = true
+		default:
+			ids = append(ids, arg)
+		}
+	}
+
+	switch command {
+	case "-getServiceState", "-checkHealth":
+		if len(ids) != 1 {
+			fatalWithUsage()
+		}
+
+		haadminService(conf, command, haadminResolve(conf, nameservice, ids[0]))
+	case "-transitionToActive", "-transitionToStandby", "-transitionToObserver":
+		if len(ids) != 1 {
+			fatalWithUsage()
+		}
+
+		if !forceManual && autoFailoverEnabled(conf, nameservice) {
+			fatal(errAutoFailover)
+		}
+
+		target := haadminResolve(conf, nameservice, ids[0])
+		haadminTransition(conf, command, target, forceManual)
+	case "-getAllServiceState":
+		if len(ids) != 0 {
+			fatalWithUsage()
+		}
+
+		haadminAllServiceState(conf, nameservice)
+	case "-failover":
+		if len(ids) != 2 {
+			fatalWithUsage()
+		}
+
+		from := haadminResolve(conf, nameservice, ids[0])
+		to := haadminResolve(conf, nameservice, ids[1])
+		if autoFailoverEnabled(conf, nameservice) {
+			if forceActive {
+				fatal("--forceactive is not supported with automatic failover enabled.")
+			}
+
+			haadminGracefulFailover(conf, to)
+		} else {
+			haadminFailover(conf, from, to, forceActive)
+		}
+	default:
+		fatalWithUsage("Unknown haadmin command:", command)
+	}
+}
+
+func haadminService(conf hadoopconf.HadoopConf, command string, target haadminTarget) {
+	client := getHAServiceClient(conf, target)
+	defer client.Close()
+
+	switch command {
+	case "-getServiceState":
+		status, err := client.ServiceStatus()
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Println(status.State)
+	case "-checkHealth":
+		err := client.MonitorHealth()
+		if err != nil {
+			fatal("Health check failed for", target.id+":", err)
+		}
+	}
+}
+
+func haadminTransition(conf hadoopconf.HadoopConf, command string, target haadminTarget, forced bool) {
+	client := getHAServiceClient(conf, target)
+	defer client.Close()
+
+	var err error
+	switch command {
+	case "-transitionToActive":
+		err = client.TransitionToActive(forced)
+	case "-transitionToStandby":
+		err = client.TransitionToStandby(forced)
+	case "-transitionToObserver":
+		err = client.TransitionToObserver(forced)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func haadminAllServiceState(conf hadoopconf.HadoopConf, nameservice string) {
+	ids := conf.HANamenodes(nameservice)
+	if len(ids) == 0 {
+		fatal("No HA namenodes configured for nameservice", nameservice)
+	}
+
+	for _, id := range ids {
+		target := haadminResolve(conf, nameservice, id)
+
+		var state string
+		client, err := newHAServiceClient(conf, target)
+		if err == nil {
+			var st *hdfs.HAServiceStatus
+			st, err = client.ServiceStatus()
+			client.Close()
+			if err == nil {
+				state = st.State.String()
+			}
+		}
+
+		if err != nil {
+			state = fmt.Sprintf("Failed to connect: %s", err)
+		}
+
+		fmt.Printf("%-50s %-10s\n", target.address, state)
+	}
+}
+
+// haadminFailover performs a manual failover, by transitioning from to
+// standby and then to to active. Unlike the java CLI, it doesn't support
+// fencing; if from can't be made standby, the failover is aborted.
+func haadminFailover(conf hadoopconf.HadoopConf, from, to haadminTarget, forceActive bool) {
+	fromClient := getHAServiceClient(conf, from)
+	defer fromClient.Close()
+
+	toClient := getHAServiceClient(conf, to)
+	defer toClient.Close()
+
+	status, err := toClient.ServiceStatus()
+	if err != nil {
+		fatal(err)
+	} else if status.State == hdfs.HAServiceActive {
+		fatal("Can't failover to an active service:", to.id)
+	} else if !forceActive && !status.ReadyToBecomeActive {
+		fatal(to.id, "is not ready to become active:", status.NotReadyReason)
+	}
+
+	err = toClient.MonitorHealth()
+	if err != nil {
+		fatal("Can't failover to an unhealthy service:", to.id+":", err)
+	}
+
+	err = fromClient.TransitionToStandby(false)
+	if err != nil {
+		fatal("Unable to make", from.id, "standby:", err)
+	}
+
+	err = toClient.TransitionToActive(false)
+	if err != nil {
+		// Try to fail back, so that the nameservice isn't left without an
+		// active namenode.
+		msg := fmt.Sprintf("Unable to make %s active: %s.", to.id, err)
+		if err := fromClient.TransitionToActive(false); err != nil {
+			msg += fmt.Sprintf(" Failback to %s also failed: %s.", from.id, err)
+		} else {
+			msg += fmt.Sprintf(" Failed back to %s.", from.id)
+		}
+
+		fatal(msg)
+	}
+
+	fmt.Printf("Failover from %s to %s successful\n", from.id, to.id)
+}
+
+// haadminGracefulFailover asks the ZKFC of the target namenode to coordinate
+// a failover, which is required when automatic failover is enabled.
+func haadminGracefulFailover(conf hadoopconf.HadoopConf, to haadminTarget) {
+	host, _, err := net.SplitHostPort(to.address)
+	if err != nil {
+		fatal(err)
+	}
+
+	port := conf["dfs.ha.zkfc.port"]
+	if port == "" {
+		port = defaultZKFCPort
+	}
+
+	options, err := getClientOptions(conf)
+	if err != nil {
+		fatal(err)
+	}
+
+	options.Addresses = []string{net.JoinHostPort(host, port)}
+	client, err := hdfs.NewZKFCClient(options)
+	if err != nil {
+		fatal("Couldn't connect to ZKFC:", err)
+	}
+
+	defer client.Close()
+
+	err = client.GracefulFailover()
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("Failover to %s successful\n", to.id)
+}
+
+// haadminResolve finds the service RPC address for the given namenode ID.
+// For convenience, a host:port address can be passed instead of an ID.
+func haadminResolve(conf hadoopconf.HadoopConf, nameservice, id string) haadminTarget {
+	if nameservice != "" {
+		if addr := conf.NamenodeServiceAddress(nameservice, id); addr != "" {
+			return haadminTarget{id: id, address: addr}
+		}
+	}
+
+	if strings.Contains(id, ":") {
+		return haadminTarget{id: id, address: id}
+	}
+
+	if nameservice == "" {
+		fatal("Couldn't determine the nameservice for", id+". Specify one with -ns.")
+	}
+
+	fatal("Couldn't find an address for namenode", id, "in nameservice", nameservice)
+	return haadminTarget{}
+}
+
+func autoFailoverEnabled(conf hadoopconf.HadoopConf, nameservice string) bool {
+	if v, ok := conf["dfs.ha.automatic-failover.enabled."+nameservice]; ok {
+		return strings.ToLower(v) == "true"
+	}
+
+	return strings.ToLower(conf["dfs.ha.automatic-failover.enabled"]) == "true"
+}
+
+func getHAServiceClient(conf hadoopconf.HadoopConf, target haadminTarget) *hdfs.HAServiceClient {
+	client, err := newHAServiceClient(conf, target)
+	if err != nil {
+		fatal(err)
+	}
+
+	return client
+}
+
+func newHAServiceClient(conf hadoopconf.HadoopConf, target haadminTarget) (*hdfs.HAServiceClient, error) {
+	options, err := getClientOptions(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	options.Addresses = []string{target.address}
+	client, err := hdfs.NewHAServiceClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't connect to %s: %s", target.id, err)
+	}
+
+	return client, nil
+}
@@ -14,7 +14,7 @@ import (
 	"github.com/pborman/getopt"
 )
 
-// TODO: cp, tree, test, trash
+// TODO: cp, tree, test
 
 var (
 	version string
@@ -23,7 +23,7 @@ The flags available are a subset of the POSIX ones, but should behave similarly.
 
 Valid commands:
   ls [-lahR] [FILE]...
-  rm [-rf] FILE...
+  rm [-rf] [-skipTrash] FILE...
   mv [-nT] SOURCE... DEST
   mkdir [-p] FILE...
   touch [-c] FILE...
@@ -35,11 +35,27 @@ Valid commands:
   test [-defsz] FILE...
   du [-sh] FILE...
   checksum FILE...
+  blocks FILE...
   get SOURCE [DEST]
   getmerge SOURCE DEST
   put SOURCE DEST
   df [-h]
   truncate SIZE FILE
+  setrep [-Rw] NUM FILE...
+  expunge [-immediate]
+  fsck [-files [-blocks [-locations]]] [-verify] [-json] FILE
+  fsck -list-corruptfileblocks FILE
+  dfsadmin -report [-live] [-dead] [-decommissioning]
+  dfsadmin -safemode get|enter|leave|forceExit|wait
+  dfsadmin -saveNamespace | -rollEdits | -refreshNodes
+  dfsadmin -rollingUpgrade [query|prepare|finalize]
+  haadmin [-ns NAMESERVICE] -getServiceState|-checkHealth SERVICEID
+  haadmin [-ns NAMESERVICE] -getAllServiceState
+  haadmin [-ns NAMESERVICE] -transitionToActive|-transitionToStandby|-transitionToObserver [--forcemanual] SERVICEID
+  haadmin [-ns NAMESERVICE] -failover [--forceactive] FROM TO
+  serve-webhdfs [-a ADDRESS] [-u DEFAULT_USER]
+  serve-s3 [-a ADDRESS] -c CREDENTIALS_FILE BUCKET=PATH...
+  serve-sftp [-a ADDRESS] [-r ROOT] -k HOST_KEY_FILE -K AUTHORIZED_KEYS_FILE
 `, os.Args[0])
 
 	lsOpts = getopt.New()
@@ -51,6 +67,7 @@ Valid commands:
 	rmOpts = getopt.New()
 	rmr    = rmOpts.Bool('r')
 	rmf    = rmOpts.Bool('f')
+	rmSkip = rmOpts.BoolLong("skipTrash", 0)
 
 	mvOpts = getopt.New()
 	mvn    = mvOpts.Bool('n')
@@ -89,6 +106,24 @@ Valid commands:
 	dfOpts = getopt.New()
 	dfh    = dfOpts.Bool('h')
 
+	setrepOpts = getopt.New()
+	setrepR    = setrepOpts.Bool('R')
+	setrepw    = setrepOpts.Bool('w')
+
+	serveWebHDFSOpts = getopt.New()
+	serveWebHDFSa    = serveWebHDFSOpts.String('a', ":14000")
+	serveWebHDFSu    = serveWebHDFSOpts.String('u', "")
+
+	serveS3Opts = getopt.New()
+	serveS3a    = serveS3Opts.String('a', ":9000")
+	serveS3c    = serveS3Opts.String('c', "")
+
+	serveSFTPOpts = getopt.New()
+	serveSFTPa    = serveSFTPOpts.String('a', ":2022")
+	serveSFTPr    = serveSFTPOpts.String('r', "/")
+	serveSFTPk    = serveSFTPOpts.String('k', "")
+	serveSFTPK    = serveSFTPOpts.String('K', "")
+
 	cachedClients map[string]*hdfs.Client = make(map[string]*hdfs.Client)
 	status                                = 0
 )
@@ -105,6 +140,10 @@ func init() {
 	getmergeOpts.SetUsage(printHelp)
 	dfOpts.SetUsage(printHelp)
 	testOpts.SetUsage(printHelp)
+	setrepOpts.SetUsage(printHelp)
+	serveWebHDFSOpts.SetUsage(printHelp)
+	serveS3Opts.SetUsage(printHelp)
+	serveSFTPOpts.SetUsage(printHelp)
 }
 
 func main() {
@@ -121,8 +160,8 @@ func main() {
 		lsOpts.Parse(argv)
 		ls(lsOpts.Args(), *lsl, *lsa, *lsh, *lsR)
 	case "rm":
-		rmOpts.Parse(argv)
-		rm(rmOpts.Args(), *rmr, *rmf)
+		rmOpts.Parse(javaStyleFlags(argv, "skipTrash"))
+		rm(rmOpts.Args(), *rmr, *rmf, *rmSkip)
 	case "mv":
 		mvOpts.Parse(argv)
 		mv(mvOpts.Args(), !*mvn, *mvT)
@@ -148,6 +187,8 @@ func main() {
 		du(duOpts.Args(), *dus, *duh)
 	case "checksum":
 		checksum(argv[1:])
+	case "blocks":
+		blocks(argv[1:])
 	case "get":
 		get(argv[1:])
 	case "getmerge":
@@ -163,6 +204,26 @@ func main() {
 		test(testOpts.Args(), *teste, *testf, *testd, *testz, *tests)
 	case "truncate":
 		truncate(argv[1:])
+	case "dfsadmin":
+		dfsadmin(argv[1:])
+	case "haadmin":
+		haadmin(argv[1:])
+	case "expunge":
+		expunge(argv[1:])
+	case "fsck":
+		fsck(argv[1:])
+	case "setrep":
+		setrepOpts.Parse(argv)
+		setrep(setrepOpts.Args(), *setrepR, *setrepw)
+	case "serve-webhdfs":
+		serveWebHDFSOpts.Parse(argv)
+		serveWebHDFS(serveWebHDFSOpts.Args(), *serveWebHDFSa, *serveWebHDFSu)
+	case "serve-s3":
+		serveS3Opts.Parse(argv)
+		serveS3(serveS3Opts.Args(), *serveS3a, *serveS3c)
+	case "serve-sftp":
+		serveSFTPOpts.Parse(argv)
+		serveSFTP(serveSFTPOpts.Args(), *serveSFTPa, *serveSFTPr, *serveSFTPk, *serveSFTPK)
 	// it's a seeeeecret command
 	case "complete":
 		complete(argv)
@@ -175,6 +236,23 @@ func main() {
 	os.Exit(status)
 }
 
+// javaStyleFlags rewrites any of the given long flags passed with a single
+// dash, as the java CLI accepts them (for example -skipTrash), to the double
+// dash form expected by getopt.
+func javaStyleFlags(argv []string, flags ...string) []string {
+	res := make([]string, len(argv))
+	for i, arg := range argv {
+		res[i] = arg
+		for _, flag := range flags {
+			if arg == "-"+flag {
+				res[i] = "--" + flag
+			}
+		}
+	}
+
+	return res
+}
+
 func printHelp() {
 	fmt.Fprintln(os.Stderr, usage)
 	os.Exit(0)
@@ -200,35 +278,65 @@ func getClient(namenode string) (*hdfs.Client, error) {
 		return cachedClients[namenode], nil
 	}
 
-	if namenode == "" {
-		namenode = os.Getenv("HADOOP_NAMENODE")
-	}
-
 	conf, err := hadoopconf.LoadFromEnvironment()
 	if err != nil {
 		return nil, fmt.Errorf("Problem loading configuration: %s", err)
 	}
 
-	options := hdfs.ClientOptionsFromConf(conf)
+	options, err := getNamenodeClientOptions(conf, namenode)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := hdfs.NewClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't connect to namenode: %s", err)
+	}
+
+	cachedClients[namenode] = c
+	return c, nil
+}
+
+// getNamenodeClientOptions is like getClientOptions, but also fills in the
+// namenode addresses, either from the given string, HADOOP_NAMENODE or the
+// configuration, in that order.
+func getNamenodeClientOptions(conf hadoopconf.HadoopConf, namenode string) (hdfs.ClientOptions, error) {
+	options, err := getClientOptions(conf)
+	if err != nil {
+		return options, err
+	}
+
+	if namenode == "" {
+		namenode = os.Getenv("HADOOP_NAMENODE")
+	}
+
 	if namenode != "" {
 		options.Addresses = strings.Split(namenode, ",")
 	}
 
 	if options.Addresses == nil {
-		return nil, errors.New("Couldn't find a namenode to connect to. You should specify hdfs://<namenode>:<port> in your paths. Alternatively, set HADOOP_NAMENODE or HADOOP_CONF_DIR in your environment.")
+		return options, errors.New("Couldn't find a namenode to connect to. You should specify hdfs://<namenode>:<port> in your paths. Alternatively, set HADOOP_NAMENODE or HADOOP_CONF_DIR in your environment.")
 	}
 
+	return options, nil
+}
+
+// getClientOptions returns the options for connecting to the cluster described
+// by conf, as the user specified by the environment.
+func getClientOptions(conf hadoopconf.HadoopConf) (hdfs.ClientOptions, error) {
+	var err error
+	options := hdfs.ClientOptionsFromConf(conf)
 	if options.KerberosClient != nil {
 		options.KerberosClient, err = getKerberosClient()
 		if err != nil {
-			return nil, fmt.Errorf("Problem with kerberos authentication: %s", err)
+			return options, fmt.Errorf("Problem with kerberos authentication: %s", err)
 		}
 	} else {
 		options.User = os.Getenv("HADOOP_USER_NAME")
 		if options.User == "" {
 			u, err := user.Current()
 			if err != nil {
-				return nil, fmt.Errorf("Couldn't determine user: %s", err)
+				return options, fmt.Errorf("Couldn't determine user: %s", err)
 			}
 
 			options.User = u.Username
@@ -244,12 +352,5 @@ func getClient(namenode string) (*hdfs.Client, error) {
 
 	options.NamenodeDialFunc = dialFunc
 	options.DatanodeDialFunc = dialFunc
-
-	c, err := hdfs.NewClient(options)
-	if err != nil {
-		return nil, fmt.Errorf("Couldn't connect to namenode: %s", err)
-	}
-
-	cachedClients[namenode] = c
-	return c, nil
+	return options, nil
 }
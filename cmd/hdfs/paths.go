@@ -6,7 +6,6 @@ import (
 	"os"
 	"path"
 	"regexp"
-	"strings"
 
 	"github.com/colinmarc/hdfs/v2"
 )
@@ -68,71 +67,10 @@ func getClientAndExpandedPaths(paths []string) ([]string, *hdfs.Client, error) {
 // TODO: not really sure checking for a leading \ is the way to test for
 // escapedness.
 func hasGlob(fragment string) bool {
-	match, _ := regexp.MatchString(`([^\\]|^)[[*?]`, fragment)
+	match, _ := regexp.MatchString(`([^\\]|^)[[*?{]`, fragment)
 	return match
 }
 
-// expandGlobs recursively expands globs in a filepath. It assumes the paths
-// are already cleaned and normalized (ie, absolute).
-func expandGlobs(client *hdfs.Client, globbedPath string) ([]string, error) {
-	parts := strings.Split(globbedPath, "/")[1:]
-	var res []string
-	var splitAt int
-
-	for splitAt = range parts {
-		if hasGlob(parts[splitAt]) {
-			break
-		}
-	}
-
-	var base, glob, next, remainder string
-	base = "/" + path.Join(parts[:splitAt]...)
-	glob = parts[splitAt]
-
-	if len(parts) > splitAt+1 {
-		next = parts[splitAt+1]
-		remainder = path.Join(parts[splitAt+2:]...)
-	} else {
-		next = ""
-		remainder = ""
-	}
-
-	list, err := client.ReadDir(base)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, fi := range list {
-		match, _ := path.Match(glob, fi.Name())
-		if !match {
-			continue
-		}
-
-		newPath := path.Join(base, fi.Name(), next, remainder)
-		if hasGlob(newPath) {
-			if fi.IsDir() {
-				children, err := expandGlobs(client, newPath)
-				if err != nil {
-					return nil, err
-				}
-
-				res = append(res, children...)
-			}
-		} else {
-			_, err := client.Stat(newPath)
-			if os.IsNotExist(err) {
-				continue
-			} else if err != nil {
-				return nil, err
-			}
-
-			res = append(res, newPath)
-		}
-	}
-
-	return res, nil
-}
-
 func expandPaths(client *hdfs.Client, paths []string) ([]string, error) {
 	var res []string
 	home := userDir(client)
@@ -143,7 +81,7 @@ func expandPaths(client *hdfs.Client, paths []string) ([]string, error) {
 		}
 
 		if hasGlob(p) {
-			expanded, err := expandGlobs(client, p)
+			expanded, err := client.Glob(p)
 			if err != nil {
 				return nil, err
 			} else if len(expanded) == 0 {
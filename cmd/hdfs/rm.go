@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+
+	"github.com/colinmarc/hdfs/v2"
 )
 
-func rm(paths []string, recursive bool, force bool) {
+func rm(paths []string, recursive bool, force bool, skipTrash bool) {
 	expanded, client, err := getClientAndExpandedPaths(paths)
 	if err != nil {
 		fatal(err)
@@ -34,6 +36,18 @@ func rm(paths []string, recursive bool, force bool) {
 			continue
 		}
 
+		if !skipTrash {
+			dest, err := client.MoveToTrash(p)
+			if err == nil {
+				fmt.Printf("Moved: '%s' to trash at: %s\n", p, dest)
+				continue
+			} else if !errors.Is(err, hdfs.ErrTrashDisabled) && !errors.Is(err, hdfs.ErrAlreadyInTrash) {
+				fmt.Fprintf(os.Stderr, "%s. Consider using -skipTrash.\n", err)
+				status = 1
+				continue
+			}
+		}
+
 		err = client.RemoveAll(p)
 		if err != nil {
 			fatal(err)
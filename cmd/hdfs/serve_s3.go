@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/colinmarc/hdfs/v2/s3"
+)
+
+func serveS3(args []string, addr, credentialsFile string) {
+	if len(args) == 0 || credentialsFile == "" {
+		fatalWithUsage()
+	}
+
+	buckets := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, root, ok := strings.Cut(arg, "=")
+		if !ok || name == "" || root == "" {
+			fatalWithUsage("Invalid bucket:", arg)
+		}
+
+		buckets[name] = root
+	}
+
+	credentials, err := readS3Credentials(credentialsFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil {
+		fatal("Problem loading configuration:", err)
+	}
+
+	options, err := getNamenodeClientOptions(conf, "")
+	if err != nil {
+		fatal(err)
+	}
+
+	server, err := s3.NewServer(s3.ServerOptions{
+		ClientOptions: options,
+		Buckets:       buckets,
+		Credentials:   credentials,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	defer server.Close()
+
+	fmt.Fprintf(os.Stderr, "Serving S3 on %s\n", addr)
+	err = http.ListenAndServe(addr, server)
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// readS3Credentials reads a file with one credential per line, in the form
+// ACCESS_KEY SECRET_KEY USER. Blank lines and lines starting with # are
+// ignored.
+func readS3Credentials(name string) (map[string]s3.Credential, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	credentials := make(map[string]s3.Credential)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected ACCESS_KEY SECRET_KEY USER", name, line)
+		}
+
+		credentials[fields[0]] = s3.Credential{SecretKey: fields[1], User: fields[2]}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/colinmarc/hdfs/v2/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func serveSFTP(args []string, addr, root, hostKeyFile, authorizedKeysFile string) {
+	if len(args) != 0 || hostKeyFile == "" || authorizedKeysFile == "" {
+		fatalWithUsage()
+	}
+
+	b, err := os.ReadFile(hostKeyFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	hostKey, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		fatal("Problem parsing host key:", err)
+	}
+
+	authorizedKeys, err := readSFTPAuthorizedKeys(authorizedKeysFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil {
+		fatal("Problem loading configuration:", err)
+	}
+
+	options, err := getNamenodeClientOptions(conf, "")
+	if err != nil {
+		fatal(err)
+	}
+
+	server, err := sftp.NewServer(sftp.ServerOptions{
+		ClientOptions:  options,
+		HostKeys:       []ssh.Signer{hostKey},
+		AuthorizedKeys: authorizedKeys,
+		Root:           root,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	defer server.Close()
+
+	fmt.Fprintf(os.Stderr, "Serving SFTP on %s\n", addr)
+	err = server.ListenAndServe(addr)
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// readSFTPAuthorizedKeys reads a file with one key per line, in the form
+// USER KEY, where KEY is in the OpenSSH authorized_keys format. Blank lines
+// and lines starting with # are ignored.
+func readSFTPAuthorizedKeys(name string) ([]sftp.AuthorizedKey, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []sftp.AuthorizedKey
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		user, rest, _ := strings.Cut(text, " ")
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: expected USER KEY: %s", name, line, err)
+		}
+
+		keys = append(keys, sftp.AuthorizedKey{Key: key, User: user})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
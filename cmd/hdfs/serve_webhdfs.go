@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/colinmarc/hdfs/v2/webhdfs"
+)
+
+func serveWebHDFS(args []string, addr, defaultUser string) {
+	if len(args) != 0 {
+		fatalWithUsage()
+	}
+
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil {
+		fatal("Problem loading configuration:", err)
+	}
+
+	options, err := getNamenodeClientOptions(conf, "")
+	if err != nil {
+		fatal(err)
+	}
+
+	server, err := webhdfs.NewServer(webhdfs.ServerOptions{
+		ClientOptions: options,
+		DefaultUser:   defaultUser,
+		ProxyUsers:    conf.ProxyUsers(),
+	})
+	if err != nil {
+		fatal(err)
+	}
+	defer server.Close()
+
+	fmt.Fprintf(os.Stderr, "Serving WebHDFS on %s\n", addr)
+	err = http.ListenAndServe(addr, server)
+	if err != nil {
+		fatal(err)
+	}
+}
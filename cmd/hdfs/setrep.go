@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+const (
+	setrepPollInterval = 1 * time.Second
+	// setrepWaitTimeout bounds how long -w waits for all the files to reach
+	// the new replication, since a replication the cluster can't satisfy (for
+	// example, one larger than the number of datanodes) is never reached.
+	setrepWaitTimeout = 10 * time.Minute
+)
+
+var errReplicationTimeout = errors.New("timed out waiting for replication")
+
+func setrep(args []string, recursive, wait bool) {
+	if len(args) < 2 {
+		fatalWithUsage()
+	}
+
+	replication, err := strconv.Atoi(args[0])
+	if err != nil || replication < 1 {
+		fatal("invalid replication factor:", args[0])
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(args[1:])
+	if err != nil {
+		fatal(err)
+	}
+
+	var files []string
+	visit := func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if fi.IsDir() {
+			return nil
+		}
+
+		err = client.SetReplication(p, replication)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			return nil
+		}
+
+		fmt.Printf("Replication %d set: %s\n", replication, p)
+		files = append(files, p)
+		return nil
+	}
+
+	for _, p := range expanded {
+		info, err := client.Stat(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		if info.IsDir() && !recursive {
+			fmt.Fprintln(os.Stderr, &os.PathError{"setrep", p, errors.New("is a directory")})
+			status = 1
+			continue
+		}
+
+		err = client.Walk(p, visit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+
+	if wait {
+		deadline := time.Now().Add(setrepWaitTimeout)
+		for _, p := range files {
+			err := waitForReplication(client, p, replication, deadline)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 1
+			}
+		}
+	}
+}
+
+// waitForReplication polls the block locations for the given file until every
+// block has exactly the requested number of replicas, or the deadline passes.
+func waitForReplication(client *hdfs.Client, p string, replication int, deadline time.Time) error {
+	fmt.Printf("Waiting for %s ...", p)
+	for {
+		info, err := client.Stat(p)
+		if err != nil {
+			return err
+		}
+
+		locs, err := client.GetBlockLocations(p, 0, info.Size())
+		if err != nil {
+			return err
+		}
+
+		done := true
+		for _, loc := range locs {
+			if len(loc.Hosts) != replication {
+				done = false
+				break
+			}
+		}
+
+		if done {
+			fmt.Println(" done")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			fmt.Println()
+			return &os.PathError{"setrep", p, errReplicationTimeout}
+		}
+
+		fmt.Print(".")
+		time.Sleep(setrepPollInterval)
+	}
+}
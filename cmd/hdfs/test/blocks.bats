@@ -0,0 +1,24 @@
+#!/usr/bin/env bats
+
+load helper
+
+@test "blocks" {
+  run $HDFS blocks /_test/mobydick.txt
+  assert_success
+  assert_equal 3 "${#lines[@]}"
+  assert_equal "OFFSET" "$(echo ${lines[0]} | awk '{ print $1 }')"
+  assert_equal "0 1048576 false" "$(echo ${lines[1]} | awk '{ print $1, $2, $3 }')"
+  assert_equal "1048576" "$(echo ${lines[2]} | awk '{ print $1 }')"
+}
+
+@test "blocks dir" {
+  run $HDFS blocks /_test
+  assert_failure
+  assert_output "blocks /_test: is a directory"
+}
+
+@test "blocks nonexistent" {
+  run $HDFS blocks /_test_cmd/nonexistent
+  assert_failure
+  assert_output "stat /_test_cmd/nonexistent: file does not exist"
+}
@@ -0,0 +1,73 @@
+#!/usr/bin/env bats
+
+load helper
+
+@test "dfsadmin -report" {
+  run $HDFS dfsadmin -report
+  assert_success
+  assert_line "Live datanodes (1):"
+  assert_line "Dead datanodes (0):"
+  assert_line "Decommission Status : Normal"
+}
+
+@test "dfsadmin -report -dead" {
+  run $HDFS dfsadmin -report -dead
+  assert_success
+  assert_line "Dead datanodes (0):"
+  refute_line "Live datanodes (1):"
+}
+
+@test "dfsadmin -report with invalid option" {
+  run $HDFS dfsadmin -report -foo
+  assert_failure
+}
+
+@test "dfsadmin with unknown command" {
+  run $HDFS dfsadmin -foo
+  assert_failure
+}
+
+@test "dfsadmin -safemode get" {
+  run $HDFS dfsadmin -safemode get
+  assert_success
+  assert_output "Safe mode is OFF"
+}
+
+@test "dfsadmin -safemode enter and leave" {
+  run $HDFS dfsadmin -safemode enter
+  assert_success
+  assert_output "Safe mode is ON"
+
+  run $HDFS dfsadmin -safemode leave
+  assert_success
+  assert_output "Safe mode is OFF"
+}
+
+@test "dfsadmin -safemode wait" {
+  run $HDFS dfsadmin -safemode wait
+  assert_success
+  assert_output "Safe mode is OFF"
+}
+
+@test "dfsadmin -safemode with invalid action" {
+  run $HDFS dfsadmin -safemode foo
+  assert_failure
+}
+
+@test "dfsadmin -rollEdits" {
+  run $HDFS dfsadmin -rollEdits
+  assert_success
+  assert_line "Successfully rolled edit logs."
+}
+
+@test "dfsadmin -refreshNodes" {
+  run $HDFS dfsadmin -refreshNodes
+  assert_success
+  assert_output "Refresh nodes successful"
+}
+
+@test "dfsadmin -rollingUpgrade query" {
+  run $HDFS dfsadmin -rollingUpgrade query
+  assert_success
+  assert_output "There is no rolling upgrade in progress or rolling upgrade has already been finalized."
+}
@@ -0,0 +1,39 @@
+#!/usr/bin/env bats
+
+load helper
+
+@test "fsck" {
+  run $HDFS fsck /_test
+  assert_success
+  assert_line "Status: HEALTHY"
+  assert_line "The filesystem under path '/_test' is HEALTHY"
+}
+
+@test "fsck -files -blocks" {
+  run $HDFS fsck -files -blocks /_test/mobydick.txt
+  assert_success
+  [[ "${lines[0]}" =~ ^/_test/mobydick.txt\ [0-9]+\ bytes,\ replicated:\ replication=[0-9]+,\ 2\ block\(s\): ]]
+}
+
+@test "fsck -verify" {
+  run $HDFS fsck -verify /_test/mobydick.txt
+  assert_success
+  assert_line " Blocks with mismatched replicas:	0"
+  assert_line " Corrupt replicas:		0"
+}
+
+@test "fsck -json" {
+  run $HDFS fsck -json /_test/foo.txt
+  assert_success
+  assert_line '  "healthy": true,'
+}
+
+@test "fsck nonexistent" {
+  run $HDFS fsck /_test/nonexistent
+  assert_failure
+}
+
+@test "fsck with unknown option" {
+  run $HDFS fsck -foo /_test
+  assert_failure
+}
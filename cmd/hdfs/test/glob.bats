@@ -142,6 +142,27 @@ stat /_test_cmd/nonexistent*: file does not exist
 OUT
 }
 
+@test "ls with alternation" {
+  run $HDFS ls "/_test_cmd/glob/dir{1,3}"
+  assert_success
+  assert_output <<OUT
+/_test_cmd/glob/dir1:
+dir
+foo
+
+/_test_cmd/glob/dir3:
+OUT
+}
+
+@test "ls with character class" {
+  run $HDFS ls "/_test_cmd/glob/dir1/dir/[a-b]"
+  assert_success
+  assert_output <<OUT
+/_test_cmd/glob/dir1/dir/a
+/_test_cmd/glob/dir1/dir/b
+OUT
+}
+
 # teardown() {
 #   $HDFS rm -r /_test_cmd/glob
 # }
@@ -0,0 +1,25 @@
+#!/usr/bin/env bats
+
+load helper
+
+@test "haadmin -getServiceState" {
+  run $HDFS haadmin -getServiceState $HADOOP_NAMENODE
+  assert_success
+  assert_output "active"
+}
+
+@test "haadmin -checkHealth" {
+  run $HDFS haadmin -checkHealth $HADOOP_NAMENODE
+  assert_success
+  assert_output ""
+}
+
+@test "haadmin with unknown command" {
+  run $HDFS haadmin -foo
+  assert_failure
+}
+
+@test "haadmin -failover with missing target" {
+  run $HDFS haadmin -failover $HADOOP_NAMENODE
+  assert_failure
+}
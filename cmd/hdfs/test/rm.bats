@@ -54,6 +54,26 @@ OUT
   assert_output ""
 }
 
+@test "rm -skipTrash" {
+  run $HDFS rm -skipTrash /_test_cmd/rm/b
+  assert_success
+  assert_output ""
+
+  run $HDFS ls /_test_cmd/rm/b
+  assert_failure
+}
+
+@test "expunge" {
+  run $HDFS expunge
+  assert_success
+  assert_output ""
+}
+
+@test "expunge with unknown option" {
+  run $HDFS expunge -foo
+  assert_failure
+}
+
 teardown() {
   $HDFS rm -r /_test_cmd/rm
 }
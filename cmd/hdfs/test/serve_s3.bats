@@ -0,0 +1,50 @@
+#!/usr/bin/env bats
+
+load helper
+
+S3_ADDR=localhost:9099
+
+setup() {
+  S3_CREDENTIALS=$(mktemp)
+  echo "gohdfs1key gohdfs1secret gohdfs1" > $S3_CREDENTIALS
+
+  $HDFS serve-s3 -a $S3_ADDR -c $S3_CREDENTIALS test=/_test 3>&- &
+  SERVER_PID=$!
+
+  for i in $(seq 50); do
+    curl -s -o /dev/null "http://$S3_ADDR/" && break
+    sleep 0.1
+  done
+}
+
+teardown() {
+  kill $SERVER_PID
+  rm -f $S3_CREDENTIALS
+}
+
+s3_curl() {
+  curl -s --aws-sigv4 "aws:amz:us-east-1:s3" --user "gohdfs1key:gohdfs1secret" \
+    -H "x-amz-content-sha256: UNSIGNED-PAYLOAD" "$@"
+}
+
+@test "serve-s3 GetObject" {
+  run s3_curl "http://$S3_ADDR/test/foo.txt"
+  assert_success
+  assert_output "bar"
+}
+
+@test "serve-s3 ListObjectsV2" {
+  run s3_curl "http://$S3_ADDR/test?list-type=2&prefix=foo"
+  assert_success
+  [[ "$output" == *'<Key>foo.txt</Key>'* ]]
+}
+
+@test "serve-s3 without credentials" {
+  run curl -s -o /dev/null -w "%{http_code}" "http://$S3_ADDR/test/foo.txt"
+  assert_output "403"
+}
+
+@test "serve-s3 without buckets" {
+  run $HDFS serve-s3 -c /dev/null
+  assert_failure
+}
@@ -0,0 +1,56 @@
+#!/usr/bin/env bats
+
+load helper
+
+SFTP_PORT=2099
+
+setup() {
+  SFTP_DIR=$(mktemp -d)
+  ssh-keygen -q -t ed25519 -N "" -f $SFTP_DIR/host_key
+  ssh-keygen -q -t ed25519 -N "" -f $SFTP_DIR/user_key
+  echo "gohdfs1 $(cat $SFTP_DIR/user_key.pub)" > $SFTP_DIR/authorized_keys
+
+  $HDFS serve-sftp -a localhost:$SFTP_PORT -k $SFTP_DIR/host_key -K $SFTP_DIR/authorized_keys 3>&- &
+  SERVER_PID=$!
+
+  for i in $(seq 50); do
+    nc -z localhost $SFTP_PORT && break
+    sleep 0.1
+  done
+}
+
+teardown() {
+  kill $SERVER_PID
+  rm -rf $SFTP_DIR
+}
+
+sftp_batch() {
+  sftp -b - -P $SFTP_PORT -i $SFTP_DIR/user_key \
+    -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null \
+    partner@localhost
+}
+
+@test "serve-sftp get" {
+  run sftp_batch <<< "get /_test/foo.txt $SFTP_DIR/foo.txt"
+  assert_success
+
+  run cat $SFTP_DIR/foo.txt
+  assert_output "bar"
+}
+
+@test "serve-sftp put" {
+  $HADOOP_FS -rm -r -f /_test_cmd/sftp
+  $HADOOP_FS -mkdir -p /_test_cmd/sftp
+  echo "baz" > $SFTP_DIR/put.txt
+
+  run sftp_batch <<< "put $SFTP_DIR/put.txt /_test_cmd/sftp/put.txt"
+  assert_success
+
+  run $HDFS cat /_test_cmd/sftp/put.txt
+  assert_output "baz"
+}
+
+@test "serve-sftp without a host key" {
+  run $HDFS serve-sftp -K /dev/null
+  assert_failure
+}
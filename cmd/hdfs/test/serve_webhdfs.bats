@@ -0,0 +1,51 @@
+#!/usr/bin/env bats
+
+load helper
+
+WEBHDFS_ADDR=localhost:14099
+
+setup() {
+  $HDFS serve-webhdfs -a $WEBHDFS_ADDR 3>&- &
+  SERVER_PID=$!
+
+  for i in $(seq 50); do
+    curl -s -o /dev/null "http://$WEBHDFS_ADDR/" && break
+    sleep 0.1
+  done
+}
+
+teardown() {
+  kill $SERVER_PID
+}
+
+@test "serve-webhdfs GETFILESTATUS" {
+  run curl -s "http://$WEBHDFS_ADDR/webhdfs/v1/_test/foo.txt?op=GETFILESTATUS&user.name=gohdfs1"
+  assert_success
+  [[ "$output" == *'"type":"FILE"'* ]]
+}
+
+@test "serve-webhdfs OPEN" {
+  run curl -s "http://$WEBHDFS_ADDR/webhdfs/v1/_test/foo.txt?op=OPEN&user.name=gohdfs1"
+  assert_success
+  assert_output "bar"
+}
+
+@test "serve-webhdfs CREATE" {
+  $HADOOP_FS -rm -r -f /_test_cmd/webhdfs
+  run curl -s -L -X PUT --data-binary "baz" \
+    "http://$WEBHDFS_ADDR/webhdfs/v1/_test_cmd/webhdfs/create.txt?op=CREATE&user.name=gohdfs1"
+  assert_success
+
+  run $HDFS cat /_test_cmd/webhdfs/create.txt
+  assert_output "baz"
+}
+
+@test "serve-webhdfs without a user" {
+  run curl -s -o /dev/null -w "%{http_code}" "http://$WEBHDFS_ADDR/webhdfs/v1/_test/foo.txt?op=GETFILESTATUS"
+  assert_output "401"
+}
+
+@test "serve-webhdfs with extra arguments" {
+  run $HDFS serve-webhdfs foo
+  assert_failure
+}
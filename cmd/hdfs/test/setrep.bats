@@ -0,0 +1,51 @@
+#!/usr/bin/env bats
+
+load helper
+
+setup() {
+  $HDFS mkdir -p /_test_cmd/setrep/dir
+  $HDFS put $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/setrep/a
+  $HDFS put $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/setrep/dir/b
+}
+
+@test "setrep" {
+  run $HDFS setrep 2 /_test_cmd/setrep/a
+  assert_success
+  assert_output "Replication 2 set: /_test_cmd/setrep/a"
+}
+
+@test "setrep dir without -R" {
+  run $HDFS setrep 2 /_test_cmd/setrep/dir
+  assert_failure
+  assert_output "setrep /_test_cmd/setrep/dir: is a directory"
+}
+
+@test "setrep recursive" {
+  run $HDFS setrep -R 2 /_test_cmd/setrep/dir
+  assert_success
+  assert_output "Replication 2 set: /_test_cmd/setrep/dir/b"
+}
+
+@test "setrep and wait" {
+  run $HDFS setrep -w 1 /_test_cmd/setrep/a
+  assert_success
+  assert_output <<OUT
+Replication 1 set: /_test_cmd/setrep/a
+Waiting for /_test_cmd/setrep/a ... done
+OUT
+}
+
+@test "setrep invalid replication" {
+  run $HDFS setrep foo /_test_cmd/setrep/a
+  assert_failure
+}
+
+@test "setrep nonexistent" {
+  run $HDFS setrep 2 /_test_cmd/nonexistent
+  assert_failure
+  assert_output "stat /_test_cmd/nonexistent: file does not exist"
+}
+
+teardown() {
+  $HDFS rm -r /_test_cmd/setrep
+}
@@ -0,0 +1,30 @@
+package hdfs
+
+import (
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// Concat appends the contents of the source files to the end of the target
+// file, in order, and then removes the sources. This happens entirely on the
+// namenode, by moving blocks from one file to another, so no data is copied.
+//
+// The target must exist, and the sources must not be empty. Depending on the
+// version of Hadoop, there may be other restrictions, such as the files all
+// having the same block size and replication factor.
+func (c *Client) Concat(target string, srcs []string) error {
+	req := &hdfs.ConcatRequestProto{
+		Trg:  proto.String(target),
+		Srcs: srcs,
+	}
+	resp := &hdfs.ConcatResponseProto{}
+
+	err := c.namenode.Execute("concat", req, resp)
+	if err != nil {
+		return &os.PathError{"concat", target, interpretException(err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package hdfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcat(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/concat")
+	mkdirp(t, "/_test/concat")
+
+	for _, name := range []string{"a", "b", "c"} {
+		f, err := client.Create("/_test/concat/" + name)
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte(name + "\n"))
+		require.NoError(t, err)
+		assertClose(t, f)
+	}
+
+	err := client.Concat("/_test/concat/a", []string{"/_test/concat/b", "/_test/concat/c"})
+	require.NoError(t, err)
+
+	b, err := client.ReadFile("/_test/concat/a")
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\nc\n", string(b))
+
+	_, err = client.Stat("/_test/concat/b")
+	assertPathError(t, err, "stat", "/_test/concat/b", os.ErrNotExist)
+}
+
+func TestConcatNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/concat/nonexistent")
+	touch(t, "/_test/concat/nonexistent-src")
+
+	err := client.Concat("/_test/concat/nonexistent", []string{"/_test/concat/nonexistent-src"})
+	assertPathError(t, err, "concat", "/_test/concat/nonexistent", os.ErrNotExist)
+}
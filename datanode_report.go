@@ -0,0 +1,217 @@
+package hdfs
+
+import (
+	"fmt"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// DatanodeReportType selects which datanodes are included in a report.
+type DatanodeReportType int
+
+const (
+	DatanodeReportAll DatanodeReportType = iota + 1
+	DatanodeReportLive
+	DatanodeReportDead
+	DatanodeReportDecommissioning
+	DatanodeReportEnteringMaintenance
+	DatanodeReportInMaintenance
+)
+
+// DatanodeInfo describes a single datanode, as reported by the namenode.
+type DatanodeInfo struct {
+	// Hostname is the hostname of the datanode.
+	Hostname string
+	// IPAddr is the IP address of the datanode.
+	IPAddr string
+	// Name is the data transfer address of the datanode, in the form ip:port.
+	Name string
+	// UUID is the unique ID assigned to the datanode.
+	UUID string
+	// XferPort, InfoPort, InfoSecurePort and IPCPort are the data transfer,
+	// HTTP, HTTPS, and IPC ports of the datanode, respectively.
+	XferPort       int
+	InfoPort       int
+	InfoSecurePort int
+	IPCPort        int
+	// Rack is the network location of the datanode, for example
+	// /default-rack.
+	Rack string
+	// AdminState is the administrative state of the datanode: one of NORMAL,
+	// DECOMMISSION_INPROGRESS, DECOMMISSIONED, ENTERING_MAINTENANCE, or
+	// IN_MAINTENANCE.
+	AdminState    string
+	UpgradeDomain string
+
+	Capacity      uint64
+	DfsUsed       uint64
+	NonDfsUsed    uint64
+	Remaining     uint64
+	BlockPoolUsed uint64
+	CacheCapacity uint64
+	CacheUsed     uint64
+	XceiverCount  int
+	NumBlocks     int
+
+	// LastContact is the last time the datanode sent a heartbeat to the
+	// namenode.
+	LastContact time.Time
+	// LastBlockReport is the last time the datanode sent a full block report
+	// to the namenode. It's zero for namenodes older than Hadoop 3.
+	LastBlockReport time.Time
+}
+
+// DatanodeStorageReport describes the volumes attached to a single datanode.
+type DatanodeStorageReport struct {
+	Datanode DatanodeInfo
+	Storages []StorageReport
+}
+
+// StorageReport describes a single volume on a datanode.
+type StorageReport struct {
+	// StorageID is the unique ID of the volume.
+	StorageID string
+	// StorageType is the type of the volume, for example DISK or SSD.
+	StorageType string
+	// State is either NORMAL or READ_ONLY_SHARED.
+	State         string
+	Failed        bool
+	Capacity      uint64
+	DfsUsed       uint64
+	NonDfsUsed    uint64
+	Remaining     uint64
+	BlockPoolUsed uint64
+}
+
+// DatanodeReport returns information about the datanodes of the given type
+// known to the namenode.
+//
+// This requires superuser privileges.
+func (c *Client) DatanodeReport(reportType DatanodeReportType) ([]DatanodeInfo, error) {
+	t, err := reportType.proto()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &hdfs.GetDatanodeReportRequestProto{Type: t.Enum()}
+	resp := &hdfs.GetDatanodeReportResponseProto{}
+
+	err = c.namenode.Execute("getDatanodeReport", req, resp)
+	if err != nil {
+		return nil, interpretException(err)
+	}
+
+	res := make([]DatanodeInfo, 0, len(resp.GetDi()))
+	for _, di := range resp.GetDi() {
+		res = append(res, newDatanodeInfo(di))
+	}
+
+	return res, nil
+}
+
+// DatanodeStorageReport returns information about the datanodes of the given
+// type known to the namenode, along with the volumes attached to each of them.
+//
+// This requires superuser privileges.
+func (c *Client) DatanodeStorageReport(reportType DatanodeReportType) ([]DatanodeStorageReport, error) {
+	t, err := reportType.proto()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &hdfs.GetDatanodeStorageReportRequestProto{Type: t.Enum()}
+	resp := &hdfs.GetDatanodeStorageReportResponseProto{}
+
+	err = c.namenode.Execute("getDatanodeStorageReport", req, resp)
+	if err != nil {
+		return nil, interpretException(err)
+	}
+
+	res := make([]DatanodeStorageReport, 0, len(resp.GetDatanodeStorageReports()))
+	for _, dsr := range resp.GetDatanodeStorageReports() {
+		report := DatanodeStorageReport{
+			Datanode: newDatanodeInfo(dsr.GetDatanodeInfo()),
+			Storages: make([]StorageReport, 0, len(dsr.GetStorageReports())),
+		}
+
+		for _, sr := range dsr.GetStorageReports() {
+			storageID := sr.GetStorage().GetStorageUuid()
+			if storageID == "" {
+				storageID = sr.GetStorageUuid()
+			}
+
+			report.Storages = append(report.Storages, StorageReport{
+				StorageID:     storageID,
+				StorageType:   sr.GetStorage().GetStorageType().String(),
+				State:         sr.GetStorage().GetState().String(),
+				Failed:        sr.GetFailed(),
+				Capacity:      sr.GetCapacity(),
+				DfsUsed:       sr.GetDfsUsed(),
+				NonDfsUsed:    sr.GetNonDfsUsed(),
+				Remaining:     sr.GetRemaining(),
+				BlockPoolUsed: sr.GetBlockPoolUsed(),
+			})
+		}
+
+		res = append(res, report)
+	}
+
+	return res, nil
+}
+
+func (t DatanodeReportType) proto() (hdfs.DatanodeReportTypeProto, error) {
+	switch t {
+	case DatanodeReportAll:
+		return hdfs.DatanodeReportTypeProto_ALL, nil
+	case DatanodeReportLive:
+		return hdfs.DatanodeReportTypeProto_LIVE, nil
+	case DatanodeReportDead:
+		return hdfs.DatanodeReportTypeProto_DEAD, nil
+	case DatanodeReportDecommissioning:
+		return hdfs.DatanodeReportTypeProto_DECOMMISSIONING, nil
+	case DatanodeReportEnteringMaintenance:
+		return hdfs.DatanodeReportTypeProto_ENTERING_MAINTENANCE, nil
+	case DatanodeReportInMaintenance:
+		return hdfs.DatanodeReportTypeProto_IN_MAINTENANCE, nil
+	default:
+		return 0, fmt.Errorf("invalid datanode report type: %d", t)
+	}
+}
+
+func newDatanodeInfo(di *hdfs.DatanodeInfoProto) DatanodeInfo {
+	id := di.GetId()
+	info := DatanodeInfo{
+		Hostname:       id.GetHostName(),
+		IPAddr:         id.GetIpAddr(),
+		Name:           fmt.Sprintf("%s:%d", id.GetIpAddr(), id.GetXferPort()),
+		UUID:           id.GetDatanodeUuid(),
+		XferPort:       int(id.GetXferPort()),
+		InfoPort:       int(id.GetInfoPort()),
+		InfoSecurePort: int(id.GetInfoSecurePort()),
+		IPCPort:        int(id.GetIpcPort()),
+		Rack:           di.GetLocation(),
+		AdminState:     di.GetAdminState().String(),
+		UpgradeDomain:  di.GetUpgradeDomain(),
+		Capacity:       di.GetCapacity(),
+		DfsUsed:        di.GetDfsUsed(),
+		NonDfsUsed:     di.GetNonDfsUsed(),
+		Remaining:      di.GetRemaining(),
+		BlockPoolUsed:  di.GetBlockPoolUsed(),
+		CacheCapacity:  di.GetCacheCapacity(),
+		CacheUsed:      di.GetCacheUsed(),
+		XceiverCount:   int(di.GetXceiverCount()),
+		NumBlocks:      int(di.GetNumBlocks()),
+		LastContact:    msToTime(di.GetLastUpdate()),
+	}
+
+	if di.GetLastBlockReportTime() != 0 {
+		info.LastBlockReport = msToTime(di.GetLastBlockReportTime())
+	}
+
+	return info
+}
+
+func msToTime(ms uint64) time.Time {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond))
+}
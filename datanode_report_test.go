@@ -0,0 +1,58 @@
+package hdfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatanodeReport(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	dns, err := client.DatanodeReport(DatanodeReportLive)
+	require.NoError(t, err)
+	require.NotEmpty(t, dns)
+
+	dn := dns[0]
+	assert.NotEmpty(t, dn.Hostname)
+	assert.NotEmpty(t, dn.UUID)
+	assert.NotZero(t, dn.XferPort)
+	assert.NotZero(t, dn.Capacity)
+	assert.Equal(t, "NORMAL", dn.AdminState)
+	assert.False(t, dn.LastContact.IsZero())
+
+	dead, err := client.DatanodeReport(DatanodeReportDead)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+}
+
+func TestDatanodeReportInvalidType(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	_, err := client.DatanodeReport(DatanodeReportType(0))
+	assert.Error(t, err)
+}
+
+func TestDatanodeReportWithoutPermission(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.DatanodeReport(DatanodeReportAll)
+	assert.Equal(t, os.ErrPermission, err)
+}
+
+func TestDatanodeStorageReport(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	reports, err := client.DatanodeStorageReport(DatanodeReportLive)
+	require.NoError(t, err)
+	require.NotEmpty(t, reports)
+	require.NotEmpty(t, reports[0].Storages)
+
+	storage := reports[0].Storages[0]
+	assert.NotEmpty(t, storage.StorageID)
+	assert.Equal(t, "DISK", storage.StorageType)
+	assert.False(t, storage.Failed)
+	assert.NotZero(t, storage.Capacity)
+}
@@ -0,0 +1,276 @@
+package hdfs
+
+import (
+	"errors"
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// ListOptions represents the configurable options for listing directories
+// with a DirIterator.
+type ListOptions struct {
+	// PageSize limits how many entries the DirIterator turns into os.FileInfo
+	// values at once. The namenode decides how many entries it returns for
+	// each request (according to dfs.ls.limit, which is 1000 by default), so
+	// each response is buffered and handed out PageSize entries at a time,
+	// without requesting any of them again. If zero, each response is handed
+	// out in its entirety.
+	PageSize int
+	// NeedLocation requests the block locations for each file from the
+	// namenode. They are then attached to the struct returned by Sys().
+	NeedLocation bool
+}
+
+// A DirIterator iterates over the contents of one or more directories,
+// fetching entries from the namenode lazily, one page at a time. Unlike
+// ReadDir, it never holds an entire directory in memory, which makes it
+// suitable for directories with millions of entries. It's used like
+// bufio.Scanner:
+//
+//	it := client.ListDir("/foo", hdfs.ListOptions{})
+//	for it.Next() {
+//		fmt.Println(it.Entry().Name())
+//	}
+//
+//	if err := it.Err(); err != nil {
+//		// Handle the error.
+//	}
+//
+// Entries are returned in the order provided by the namenode, which is
+// lexical order for each directory.
+type DirIterator struct {
+	client  *Client
+	dirs    []string
+	options ListOptions
+	batched bool
+
+	// buffered holds the entries fetched from the namenode that haven't been
+	// paged in yet, and bufferedParents the index of each one's directory.
+	buffered        []*hdfs.HdfsFileStatusProto
+	bufferedParents []int
+
+	page    []os.FileInfo
+	parents []int
+	current int
+	dirIdx  int
+
+	startAfter []byte
+	done       bool
+	err        error
+}
+
+// ListDir returns a DirIterator over the contents of the named directory.
+func (c *Client) ListDir(dirname string, options ListOptions) *DirIterator {
+	return &DirIterator{
+		client:  c,
+		dirs:    []string{dirname},
+		options: options,
+		current: -1,
+	}
+}
+
+// ListDirs returns a DirIterator over the contents of all the named
+// directories, using the getBatchedListing call to fetch entries for several
+// directories in each request. Use Dir to find out which directory the
+// current entry belongs to.
+//
+// Namenodes older than Hadoop 3.3 don't support batched listings; in that
+// case, ListDirs falls back to listing each directory in turn.
+func (c *Client) ListDirs(dirnames []string, options ListOptions) *DirIterator {
+	return &DirIterator{
+		client:  c,
+		dirs:    dirnames,
+		options: options,
+		batched: len(dirnames) > 1,
+		current: -1,
+	}
+}
+
+// Next advances the iterator to the next entry, fetching another page from the
+// namenode if necessary. It returns false when there are no more entries, or
+// if an error occurred; use Err to tell the two apart.
+func (it *DirIterator) Next() bool {
+	it.current++
+	for it.current >= len(it.page) {
+		if it.err != nil {
+			return false
+		} else if len(it.buffered) > 0 {
+			it.nextPage()
+			continue
+		} else if it.done {
+			return false
+		}
+
+		var err error
+		if it.batched {
+			err = it.fetchBatch()
+		} else {
+			err = it.fetchPage()
+		}
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	return true
+}
+
+// Entry returns the current entry. It's only valid after a call to Next that
+// returned true.
+func (it *DirIterator) Entry() os.FileInfo {
+	if it.current < 0 || it.current >= len(it.page) {
+		return nil
+	}
+
+	return it.page[it.current]
+}
+
+// Dir returns the name of the directory that contains the current entry.
+func (it *DirIterator) Dir() string {
+	if it.current < 0 || it.current >= len(it.parents) {
+		return ""
+	}
+
+	return it.dirs[it.parents[it.current]]
+}
+
+// Err returns the first error encountered by the iterator, if any.
+func (it *DirIterator) Err() error {
+	return it.err
+}
+
+// nextPage moves up to PageSize buffered entries into the current page.
+func (it *DirIterator) nextPage() {
+	n := len(it.buffered)
+	if it.options.PageSize > 0 && n > it.options.PageSize {
+		n = it.options.PageSize
+	}
+
+	it.page = it.page[:0]
+	it.parents = it.parents[:0]
+	it.current = 0
+	for i, status := range it.buffered[:n] {
+		it.page = append(it.page, newFileInfo(status, ""))
+		it.parents = append(it.parents, it.bufferedParents[i])
+		it.buffered[i] = nil
+	}
+
+	it.buffered = it.buffered[n:]
+	it.bufferedParents = it.bufferedParents[n:]
+}
+
+// fetchPage fetches the next page of entries for a single directory, moving on
+// to the next directory when the current one is exhausted.
+func (it *DirIterator) fetchPage() error {
+	if it.dirIdx >= len(it.dirs) {
+		it.done = true
+		return nil
+	}
+
+	dir := it.dirs[it.dirIdx]
+	list, remaining, err := it.client.getListing(dir, it.startAfter, it.options.NeedLocation)
+	if err != nil {
+		return &os.PathError{"readdir", dir, interpretException(err)}
+	}
+
+	it.buffered = list
+	it.bufferedParents = it.bufferedParents[:0]
+	for range list {
+		it.bufferedParents = append(it.bufferedParents, it.dirIdx)
+	}
+
+	if len(list) > 0 {
+		it.startAfter = list[len(list)-1].GetPath()
+	}
+
+	if remaining == 0 || len(list) == 0 {
+		it.dirIdx++
+		it.startAfter = nil
+	}
+
+	return nil
+}
+
+// fetchBatch fetches the next set of entries for all the directories at once.
+func (it *DirIterator) fetchBatch() error {
+	req := &hdfs.GetBatchedListingRequestProto{
+		Paths:        it.dirs,
+		StartAfter:   it.startAfter,
+		NeedLocation: proto.Bool(it.options.NeedLocation),
+	}
+	if req.StartAfter == nil {
+		req.StartAfter = []byte{}
+	}
+	resp := &hdfs.GetBatchedListingResponseProto{}
+
+	err := it.client.namenode.Execute("getBatchedListing", req, resp)
+	if err != nil {
+		if isNoSuchMethod(err) {
+			it.batched = false
+			return nil
+		}
+
+		return &os.PathError{"readdir", it.dirs[0], interpretException(err)}
+	}
+
+	for _, listing := range resp.GetListings() {
+		idx := int(listing.GetParentIdx())
+		if idx >= len(it.dirs) {
+			return &os.PathError{
+				"readdir",
+				it.dirs[0],
+				errors.New("unexpected response from namenode"),
+			}
+		}
+
+		if exc := listing.GetException(); exc != nil {
+			remoteErr := &remoteException{
+				method:    "getBatchedListing",
+				exception: exc.GetClassName(),
+				message:   exc.GetMessage(),
+			}
+
+			return &os.PathError{"readdir", it.dirs[idx], interpretException(remoteErr)}
+		}
+
+		for _, status := range listing.GetPartialListing() {
+			it.buffered = append(it.buffered, status)
+			it.bufferedParents = append(it.bufferedParents, idx)
+		}
+	}
+
+	it.startAfter = resp.GetStartAfter()
+	if !resp.GetHasMore() {
+		it.done = true
+	}
+
+	return nil
+}
+
+func (c *Client) getListing(name string, startAfter []byte, needLocation bool) ([]*hdfs.HdfsFileStatusProto, int, error) {
+	if startAfter == nil {
+		startAfter = []byte{}
+	}
+
+	req := &hdfs.GetListingRequestProto{
+		Src:          proto.String(name),
+		StartAfter:   startAfter,
+		NeedLocation: proto.Bool(needLocation),
+	}
+	resp := &hdfs.GetListingResponseProto{}
+
+	err := c.namenode.Execute("getListing", req, resp)
+	if err != nil {
+		return nil, 0, err
+	} else if resp.GetDirList() == nil {
+		return nil, 0, os.ErrNotExist
+	}
+
+	list := resp.GetDirList().GetPartialListing()
+	remaining := int(resp.GetDirList().GetRemainingEntries())
+	return list, remaining, nil
+}
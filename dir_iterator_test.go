@@ -0,0 +1,144 @@
+package hdfs
+
+import (
+	"os"
+	"testing"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectNames(t *testing.T, it *DirIterator) []string {
+	var names []string
+	for it.Next() {
+		names = append(names, it.Entry().Name())
+	}
+
+	require.NoError(t, it.Err())
+	return names
+}
+
+func TestListDir(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/listdir")
+	mkdirp(t, "/_test/listdir/dir")
+	touch(t, "/_test/listdir/1")
+	touch(t, "/_test/listdir/2")
+	touch(t, "/_test/listdir/3")
+
+	names := collectNames(t, client.ListDir("/_test/listdir", ListOptions{}))
+	assert.Equal(t, []string{"1", "2", "3", "dir"}, names)
+}
+
+func TestListDirPageSize(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/listdirpaged")
+	touch(t, "/_test/listdirpaged/1")
+	touch(t, "/_test/listdirpaged/2")
+	touch(t, "/_test/listdirpaged/3")
+
+	it := client.ListDir("/_test/listdirpaged", ListOptions{PageSize: 1})
+	names := collectNames(t, it)
+	assert.Equal(t, []string{"1", "2", "3"}, names)
+}
+
+func TestDirIteratorPageSize(t *testing.T) {
+	// A single response from the namenode, which is handed out two entries at
+	// a time.
+	it := &DirIterator{
+		dirs:            []string{"/foo", "/bar"},
+		options:         ListOptions{PageSize: 2},
+		current:         -1,
+		done:            true,
+		bufferedParents: []int{0, 0, 1, 1, 1},
+	}
+
+	for _, name := range []string{"1", "2", "3", "4", "5"} {
+		it.buffered = append(it.buffered, &hdfs.HdfsFileStatusProto{Path: []byte(name)})
+	}
+
+	var names, dirs []string
+	for it.Next() {
+		assert.LessOrEqual(t, len(it.page), 2)
+		names = append(names, it.Entry().Name())
+		dirs = append(dirs, it.Dir())
+	}
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, names)
+	assert.Equal(t, []string{"/foo", "/foo", "/bar", "/bar", "/bar"}, dirs)
+}
+
+func TestListDirEmpty(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/listdirempty")
+
+	it := client.ListDir("/_test/listdirempty", ListOptions{})
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+	assert.Nil(t, it.Entry())
+}
+
+func TestListDirNeedLocation(t *testing.T) {
+	client := getClient(t)
+
+	it := client.ListDir("/_test", ListOptions{NeedLocation: true})
+	for it.Next() {
+		if it.Entry().Name() != "mobydick.txt" {
+			continue
+		}
+
+		status := it.Entry().Sys().(*hdfs.HdfsFileStatusProto)
+		assert.NotEmpty(t, status.GetLocations().GetBlocks())
+	}
+
+	require.NoError(t, it.Err())
+}
+
+func TestListDirNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	it := client.ListDir("/_test/nonexistent", ListOptions{})
+	assert.False(t, it.Next())
+	assertPathError(t, it.Err(), "readdir", "/_test/nonexistent", os.ErrNotExist)
+}
+
+func TestListDirs(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/listdirs/a")
+	mkdirp(t, "/_test/listdirs/b")
+	touch(t, "/_test/listdirs/a/1")
+	touch(t, "/_test/listdirs/a/2")
+	touch(t, "/_test/listdirs/b/3")
+
+	it := client.ListDirs([]string{"/_test/listdirs/a", "/_test/listdirs/b"}, ListOptions{})
+
+	var entries []string
+	for it.Next() {
+		entries = append(entries, it.Dir()+"/"+it.Entry().Name())
+	}
+
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{
+		"/_test/listdirs/a/1",
+		"/_test/listdirs/a/2",
+		"/_test/listdirs/b/3",
+	}, entries)
+}
+
+func TestListDirsNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/listdirs2/a")
+
+	it := client.ListDirs([]string{"/_test/listdirs2/a", "/_test/nonexistent"}, ListOptions{})
+	for it.Next() {
+	}
+
+	assertPathError(t, it.Err(), "readdir", "/_test/nonexistent", os.ErrNotExist)
+}
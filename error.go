@@ -1,19 +1,13 @@
 package hdfs
 
 import (
-	"os"
-	"syscall"
-)
+	"fmt"
 
-const (
-	fileNotFoundException        = "java.io.FileNotFoundException"
-	permissionDeniedException    = "org.apache.hadoop.security.AccessControlException"
-	pathIsNotEmptyDirException   = "org.apache.hadoop.fs.PathIsNotEmptyDirectoryException"
-	fileAlreadyExistsException   = "org.apache.hadoop.fs.FileAlreadyExistsException"
-	alreadyBeingCreatedException = "org.apache.hadoop.hdfs.protocol.AlreadyBeingCreatedException"
-	illegalArgumentException     = "org.apache.hadoop.HadoopIllegalArgumentException"
+	"github.com/colinmarc/hdfs/v2/internal/exception"
 )
 
+const noSuchMethodException = "org.apache.hadoop.ipc.RpcNoSuchMethodException"
+
 // Error represents a remote java exception from an HDFS namenode or datanode.
 type Error interface {
 	// Method returns the RPC method that encountered an error.
@@ -28,32 +22,59 @@ type Error interface {
 	Message() string
 }
 
+// remoteException represents a java exception that the namenode returned as
+// part of an otherwise successful response, rather than as an RPC error. It
+// implements Error.
+type remoteException struct {
+	method    string
+	exception string
+	message   string
+}
+
+func (e *remoteException) Method() string {
+	return e.method
+}
+
+func (e *remoteException) Desc() string {
+	return ""
+}
+
+func (e *remoteException) Exception() string {
+	return e.exception
+}
+
+func (e *remoteException) Message() string {
+	return e.message
+}
+
+func (e *remoteException) Error() string {
+	return fmt.Sprintf("%s call failed (%s)", e.method, e.exception)
+}
+
+// isNoSuchMethod returns true if the error indicates that the namenode doesn't
+// support the called method, usually because it's running an older version of
+// Hadoop.
+func isNoSuchMethod(err error) bool {
+	remoteErr, ok := err.(Error)
+	return ok && remoteErr.Exception() == noSuchMethodException
+}
+
 func interpretCreateException(err error) error {
-	if remoteErr, ok := err.(Error); ok && remoteErr.Exception() == alreadyBeingCreatedException {
-		return os.ErrExist
+	if remoteErr, ok := err.(Error); ok {
+		if interpreted := exception.InterpretCreate(remoteErr.Exception()); interpreted != nil {
+			return interpreted
+		}
 	}
 
-	return interpretException(err)
+	return err
 }
 
 func interpretException(err error) error {
-	var exception string
 	if remoteErr, ok := err.(Error); ok {
-		exception = remoteErr.Exception()
+		if interpreted := exception.Interpret(remoteErr.Exception()); interpreted != nil {
+			return interpreted
+		}
 	}
 
-	switch exception {
-	case fileNotFoundException:
-		return os.ErrNotExist
-	case permissionDeniedException:
-		return os.ErrPermission
-	case pathIsNotEmptyDirException:
-		return syscall.ENOTEMPTY
-	case fileAlreadyExistsException:
-		return os.ErrExist
-	case illegalArgumentException:
-		return os.ErrInvalid
-	default:
-		return err
-	}
+	return err
 }
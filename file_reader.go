@@ -6,11 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 	"github.com/colinmarc/hdfs/v2/internal/transfer"
-	"google.golang.org/protobuf/proto"
 )
 
 // A FileReader represents an existing file or directory in HDFS. It implements
@@ -21,10 +21,14 @@ type FileReader struct {
 	name   string
 	info   os.FileInfo
 
-	blocks      []*hdfs.LocatedBlockProto
-	blockReader *transfer.BlockReader
-	deadline    time.Time
-	offset      int64
+	blocks     []*hdfs.LocatedBlockProto
+	blocksLock sync.Mutex
+
+	blockReader     *transfer.BlockReader
+	readAhead       *readAhead
+	readAheadBudget *readAheadBudget
+	deadline        time.Time
+	offset          int64
 
 	readdirLast string
 
@@ -57,9 +61,11 @@ func (f *FileReader) Stat() os.FileInfo {
 }
 
 // SetDeadline sets the deadline for future Read, ReadAt, and Checksum calls. A
-// zero value for t means those calls will not time out.
+// zero value for t means those calls will not time out. It must not be called
+// concurrently with those calls.
 func (f *FileReader) SetDeadline(t time.Time) error {
 	f.deadline = t
+
 	if f.blockReader != nil {
 		return f.blockReader.SetDeadline(t)
 	}
@@ -82,11 +88,9 @@ func (f *FileReader) Checksum() ([]byte, error) {
 		}
 	}
 
-	if f.blocks == nil {
-		err := f.getBlocks()
-		if err != nil {
-			return nil, err
-		}
+	err := f.getBlocks()
+	if err != nil {
+		return nil, err
 	}
 
 	// Hadoop calculates this by writing the checksums out to a byte array, which
@@ -109,6 +113,7 @@ func (f *FileReader) Checksum() ([]byte, error) {
 			Block:               block,
 			UseDatanodeHostname: f.client.options.UseDatanodeHostname,
 			DialFunc:            d,
+			PeerCache:           f.client.peerCache,
 		}
 
 		err = cr.SetDeadline(f.deadline)
@@ -156,6 +161,11 @@ func (f *FileReader) Seek(offset int64, whence int) (int64, error) {
 		return f.offset, fmt.Errorf("invalid resulting offset: %d", off)
 	}
 
+	if f.readAhead != nil && !f.readAhead.Skip(off-f.offset) {
+		f.readAhead.Close()
+		f.readAhead = nil
+	}
+
 	if f.blockReader != nil {
 		// If the seek is within the next few chunks, it's much more
 		// efficient to throw away a few bytes than to reconnect and start
@@ -195,11 +205,30 @@ func (f *FileReader) Read(b []byte) (int, error) {
 		return 0, nil
 	}
 
-	if f.blocks == nil {
-		err := f.getBlocks()
+	err := f.getBlocks()
+	if err != nil {
+		return 0, err
+	}
+
+	if f.readAhead == nil && f.blockReader == nil && f.client.options.ReadAheadSize > 0 {
+		if f.readAheadBudget == nil {
+			f.readAheadBudget = newReadAheadBudget(f.client.options.ReadAheadSize)
+		}
+
+		f.readAhead = newReadAhead(f, f.readAheadBudget,
+			f.client.options.ReadAheadConcurrency)
+	}
+
+	if f.readAhead != nil {
+		n, err := f.readAhead.Read(b)
+		f.offset += int64(n)
 		if err != nil {
-			return 0, err
+			// Start over at the current offset on the next call.
+			f.readAhead.Close()
+			f.readAhead = nil
 		}
+
+		return n, err
 	}
 
 	for {
@@ -229,7 +258,13 @@ func (f *FileReader) Read(b []byte) (int, error) {
 	}
 }
 
-// ReadAt implements io.ReaderAt.
+// ReadAt implements io.ReaderAt. It doesn't use or change the offset used by
+// Read and Seek, and it's safe to call from multiple goroutines at once.
+//
+// Each call requests exactly the range it needs from a datanode, using a
+// separate connection. Connections are returned to the Client's connection
+// cache afterwards (see ClientOptions.DatanodeConnCacheSize), so that
+// subsequent calls can reuse them.
 func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
 	if f.closed {
 		return 0, io.ErrClosedPipe
@@ -239,22 +274,70 @@ func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
 		return 0, &os.PathError{"readat", f.name, errors.New("negative offset")}
 	}
 
-	_, err := f.Seek(off, 0)
+	if f.info.IsDir() {
+		return 0, &os.PathError{"readat", f.name, errors.New("is a directory")}
+	}
+
+	if off >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	err := f.getBlocks()
 	if err != nil {
 		return 0, err
 	}
 
-	n, err := io.ReadFull(f, b)
+	end := off + int64(len(b))
+	if end > f.info.Size() {
+		end = f.info.Size()
+	}
 
-	// For some reason, os.File.ReadAt returns io.EOF in this case instead of
-	// io.ErrUnexpectedEOF.
-	if err == io.ErrUnexpectedEOF {
+	n, err := f.readRange(b[:end-off], off)
+
+	// Like os.File.ReadAt, return io.EOF for short reads.
+	if err == nil && n < len(b) {
 		err = io.EOF
 	}
 
 	return n, err
 }
 
+// readRange fills b with the data starting at off, which must be within the
+// file. It uses a new block reader for each block, which only requests the
+// bytes that are needed.
+func (f *FileReader) readRange(b []byte, off int64) (int, error) {
+	if f.client.hedgedReads != nil {
+		return f.hedgedReadAt(b, off)
+	}
+
+	n := 0
+	for n < len(b) {
+		br, blockEnd, err := f.newBlockReader(off + int64(n))
+		if err != nil {
+			return n, err
+		}
+
+		length := int64(len(b) - n)
+		if remaining := blockEnd - (off + int64(n)); length > remaining {
+			length = remaining
+		}
+
+		br.Length = length
+		m, err := io.ReadFull(br, b[n:n+int(length)])
+		br.Close()
+		n += m
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
 // Readdir reads the contents of the directory associated with file and returns
 // a slice of up to n os.FileInfo values, as would be returned by Stat, in
 // directory order. Subsequent calls on the same file will yield further
@@ -277,7 +360,9 @@ func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
 // Note that making multiple calls to Readdir with a smallish n (as you might do
 // with the os version) is slower than just requesting everything at once.
 // That's because HDFS has no mechanism for limiting the number of entries
-// returned; whatever extra entries it returns are simply thrown away.
+// returned; whatever extra entries it returns are simply thrown away. To
+// iterate over very large directories without holding every entry in memory,
+// use Client.ListDir instead.
 func (f *FileReader) Readdir(n int) ([]os.FileInfo, error) {
 	if f.closed {
 		return nil, io.ErrClosedPipe
@@ -327,27 +412,16 @@ func (f *FileReader) Readdir(n int) ([]os.FileInfo, error) {
 }
 
 func (f *FileReader) readdir() ([]os.FileInfo, int, error) {
-	req := &hdfs.GetListingRequestProto{
-		Src:          proto.String(f.name),
-		StartAfter:   []byte(f.readdirLast),
-		NeedLocation: proto.Bool(false),
-	}
-	resp := &hdfs.GetListingResponseProto{}
-
-	err := f.client.namenode.Execute("getListing", req, resp)
+	list, remaining, err := f.client.getListing(f.name, []byte(f.readdirLast), false)
 	if err != nil {
 		return nil, 0, err
-	} else if resp.GetDirList() == nil {
-		return nil, 0, os.ErrNotExist
 	}
 
-	list := resp.GetDirList().GetPartialListing()
 	res := make([]os.FileInfo, 0, len(list))
 	for _, status := range list {
 		res = append(res, newFileInfo(status, ""))
 	}
 
-	remaining := int(resp.GetDirList().GetRemainingEntries())
 	return res, remaining, nil
 }
 
@@ -384,6 +458,11 @@ func (f *FileReader) Readdirnames(n int) ([]string, error) {
 func (f *FileReader) Close() error {
 	f.closed = true
 
+	if f.readAhead != nil {
+		f.readAhead.Close()
+		f.readAhead = nil
+	}
+
 	if f.blockReader != nil {
 		return f.blockReader.Close()
 	}
@@ -391,48 +470,68 @@ func (f *FileReader) Close() error {
 	return nil
 }
 
+// getBlocks fetches the block locations for the file, if they haven't been
+// fetched already. It's safe to call concurrently.
 func (f *FileReader) getBlocks() error {
-	req := &hdfs.GetBlockLocationsRequestProto{
-		Src:    proto.String(f.name),
-		Offset: proto.Uint64(0),
-		Length: proto.Uint64(uint64(f.info.Size())),
+	f.blocksLock.Lock()
+	defer f.blocksLock.Unlock()
+
+	if f.blocks != nil {
+		return nil
 	}
-	resp := &hdfs.GetBlockLocationsResponseProto{}
 
-	err := f.client.namenode.Execute("getBlockLocations", req, resp)
+	blocks, err := f.client.getBlockLocations(f.name, 0, f.info.Size())
 	if err != nil {
 		return err
 	}
 
-	f.blocks = resp.GetLocations().GetBlocks()
+	f.blocks = blocks
 	return nil
 }
 
 func (f *FileReader) getNewBlockReader() error {
-	off := uint64(f.offset)
+	br, _, err := f.newBlockReader(f.offset)
+	if err != nil {
+		return err
+	}
+
+	f.blockReader = br
+	return nil
+}
+
+// newBlockReader returns a BlockReader starting at the given offset in the
+// file, along with the offset of the end of the block.
+func (f *FileReader) newBlockReader(off int64) (*transfer.BlockReader, int64, error) {
 	for _, block := range f.blocks {
-		start := block.GetOffset()
-		end := start + block.GetB().GetNumBytes()
+		start := int64(block.GetOffset())
+		end := start + int64(block.GetB().GetNumBytes())
 
 		if start <= off && off < end {
 			dialFunc, err := f.client.wrapDatanodeDial(
 				f.client.options.DatanodeDialFunc,
 				block.GetBlockToken())
 			if err != nil {
-				return err
+				return nil, 0, err
 			}
 
-			f.blockReader = &transfer.BlockReader{
+			br := &transfer.BlockReader{
 				ClientName:          f.client.namenode.ClientName,
 				Block:               block,
-				Offset:              int64(off - start),
+				Offset:              off - start,
 				UseDatanodeHostname: f.client.options.UseDatanodeHostname,
 				DialFunc:            dialFunc,
+				PeerCache:           f.client.peerCache,
+				ShortCircuit:        f.client.shortCircuit,
+			}
+
+			err = br.SetDeadline(f.deadline)
+			if err != nil {
+				return nil, 0, err
 			}
 
-			return f.SetDeadline(f.deadline)
+			return br, end, nil
 		}
 	}
 
-	return errors.New("invalid offset")
+	return nil, 0, errors.New("invalid offset")
 }
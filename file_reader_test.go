@@ -11,6 +11,8 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -205,6 +207,88 @@ func TestFileReadAtEOF(t *testing.T) {
 	assert.Equal(t, io.EOF, err)
 }
 
+func TestFileReadAtOffset(t *testing.T) {
+	client := getClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	buf := make([]byte, len(testStr4))
+	_, err = io.ReadFull(file, buf)
+	require.NoError(t, err)
+
+	buf = make([]byte, len(testStr))
+	_, err = file.ReadAt(buf, testStrOff)
+	require.NoError(t, err)
+	assert.Equal(t, testStr, string(buf))
+
+	// The offset for Read is unchanged.
+	off, err := file.Seek(0, 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(testStr4), off)
+}
+
+func TestFileReadAtConcurrent(t *testing.T) {
+	client := getClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	expected, err := client.ReadFile("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Read a few consecutive chunks, to exercise reusing connections.
+			off := rand.Int63n(int64(len(expected)) - 3*4096)
+			buf := make([]byte, 4096)
+			for j := 0; j < 3; j++ {
+				_, err := file.ReadAt(buf, off)
+				assert.NoError(t, err)
+				assert.Equal(t, expected[off:off+4096], buf)
+				off += 4096
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestFileReadAtReusesConnections(t *testing.T) {
+	options := getClient(t).options
+	dial := options.DatanodeDialFunc
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	var dials int32
+	options.DatanodeDialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return dial(ctx, network, address)
+	}
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	defer client.Close()
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		buf := make([]byte, len(testStr))
+		_, err = file.ReadAt(buf, testStrOff)
+		require.NoError(t, err)
+		assert.Equal(t, testStr, string(buf))
+	}
+
+	// Every read after the first should use the cached connection.
+	assert.EqualValues(t, 1, atomic.LoadInt32(&dials))
+}
+
 func TestFileReadOversizedBuffer(t *testing.T) {
 	client := getClient(t)
 
@@ -286,8 +370,11 @@ func TestFileSeekReadSkip(t *testing.T) {
 	file, err := client.Open("/_test/mobydick.txt")
 	require.NoError(t, err)
 
+	_, err = file.Seek(testStr4Off, 0)
+	require.NoError(t, err)
+
 	buf := make([]byte, len(testStr4))
-	n, err := file.ReadAt(buf, testStr4Off)
+	n, err := io.ReadFull(file, buf)
 	assert.NoError(t, err)
 	assert.Equal(t, len(buf), n)
 	assert.Equal(t, testStr4, string(buf))
@@ -307,6 +394,80 @@ func TestFileSeekReadSkip(t *testing.T) {
 	assert.Equal(t, testStr5, string(buf))
 }
 
+func getReadAheadClient(t *testing.T) *Client {
+	options := getClient(t).options
+	options.ReadAheadSize = 64 * 1024
+	options.ReadAheadConcurrency = 3
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestFileBigReadAhead(t *testing.T) {
+	client := getReadAheadClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	hash := crc32.NewIEEE()
+	copied := 0
+	var n int64
+	for err == nil {
+		n, err = io.CopyN(hash, file, int64(rand.Intn(100000)))
+		copied += int(n)
+	}
+
+	assert.EqualValues(t, io.EOF, err)
+	assert.EqualValues(t, 0x199d1ae6, hash.Sum32())
+	assert.EqualValues(t, copied, 1257276)
+}
+
+func TestFileReadAheadSeek(t *testing.T) {
+	client := getReadAheadClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	buf := make([]byte, len(testStr4))
+	_, err = file.Seek(testStr4Off, 0)
+	require.NoError(t, err)
+	_, err = io.ReadFull(file, buf)
+	require.NoError(t, err)
+	assert.Equal(t, testStr4, string(buf))
+	ra := file.readAhead
+
+	// Seek forward within the buffered data.
+	_, err = file.Seek(testStr5Off, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ra, file.readAhead)
+
+	buf = make([]byte, len(testStr5))
+	_, err = io.ReadFull(file, buf)
+	require.NoError(t, err)
+	assert.Equal(t, testStr5, string(buf))
+
+	// Seek backwards, and then to the end of the file.
+	_, err = file.Seek(testStr4Off, 0)
+	require.NoError(t, err)
+	assert.Nil(t, file.readAhead)
+
+	buf = make([]byte, len(testStr4))
+	_, err = io.ReadFull(file, buf)
+	require.NoError(t, err)
+	assert.Equal(t, testStr4, string(buf))
+
+	_, err = file.Seek(testStr3NegativeOff, 2)
+	require.NoError(t, err)
+
+	buf = make([]byte, len(testStr3))
+	_, err = io.ReadFull(file, buf)
+	require.NoError(t, err)
+	assert.Equal(t, testStr3, string(buf))
+}
+
 func TestFileReadDir(t *testing.T) {
 	client := getClient(t)
 
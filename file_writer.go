@@ -1,10 +1,16 @@
 package hdfs
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
 	"os"
+	"path"
+	"strings"
 	"time"
 
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
 	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 	"github.com/colinmarc/hdfs/v2/internal/transfer"
 	"google.golang.org/protobuf/proto"
@@ -12,6 +18,17 @@ import (
 
 var ErrReplicating = errors.New("replication in progress")
 
+var errErasureCodedWrite = errors.New("writing erasure coded files is not supported")
+
+// replicationPolicyName is the name of the erasure coding policy that actually
+// means a file is replicated.
+const replicationPolicyName = "replication"
+
+// maxBlockWriteRetries is how many times FileWriter allocates a new block,
+// excluding the failed datanodes, when the pipeline for a block can't be set
+// up. It mirrors the Java client's dfs.client.block.write.retries.
+const maxBlockWriteRetries = 3
+
 // IsErrReplicating returns true if the passed error is an os.PathError wrapping
 // ErrReplicating.
 func IsErrReplicating(err error) bool {
@@ -29,8 +46,77 @@ type FileWriter struct {
 	blockSize   int64
 	fileId      *uint64
 
-	blockWriter *transfer.BlockWriter
-	deadline    time.Time
+	blockWriter   *transfer.BlockWriter
+	deadline      time.Time
+	favoredNodes  []string
+	addBlockFlags []hdfs.AddBlockFlagProto
+	checksumType  *hdfs.ChecksumTypeProto
+	persistBlocks bool
+}
+
+const (
+	// ChecksumCRC32C is the default checksum type for new files.
+	ChecksumCRC32C = "CRC32C"
+	// ChecksumCRC32 is the checksum type used by older versions of Hadoop.
+	ChecksumCRC32 = "CRC32"
+	// ChecksumNull disables checksums for the data written.
+	ChecksumNull = "NULL"
+)
+
+// CreateOptions specifies how a file is created by CreateWithOptions. The zero
+// value creates a new file with the namenode's default replication and block
+// size and permissions 0644, and fails if the file already exists.
+type CreateOptions struct {
+	// Overwrite truncates the file if it already exists, rather than failing
+	// with os.ErrExist. The namenode replaces the file atomically.
+	Overwrite bool
+	// CreateParent creates any missing parent directories, rather than
+	// failing with os.ErrNotExist.
+	CreateParent bool
+	// Append opens the file for appending if it already exists, instead of
+	// creating it. It can't be combined with Overwrite.
+	Append bool
+	// NewBlock specifies that when appending, data is written to a new block,
+	// rather than filling up the last block of the file first.
+	NewBlock bool
+	// LazyPersist asks the datanodes to write the file to memory, and only
+	// persist it to disk later. Data may be lost if a datanode restarts before
+	// then, so it's only suitable for data that can be regenerated, usually
+	// with a replication of one.
+	LazyPersist bool
+	// IgnoreClientLocality places blocks on random datanodes, rather than
+	// preferring the datanode on the same host as the client.
+	IgnoreClientLocality bool
+	// NoLocalWrite avoids placing blocks on the datanode on the same host as
+	// the client, unless there's no other choice.
+	NoLocalWrite bool
+	// StoragePolicy is the name of the storage policy for the file, for
+	// example "ALL_SSD". If empty, the policy is inherited from the parent
+	// directory.
+	StoragePolicy string
+	// ECPolicyName is the name of the erasure coding policy for the file. If
+	// empty, the policy is inherited from the parent directory. Writing erasure
+	// coded files isn't supported, so it's mostly useful as "replication", to
+	// create a replicated file in a directory with an erasure coding policy.
+	ECPolicyName string
+	// FavoredNodes sets the datanodes that the namenode should prefer for the
+	// blocks of the file. See FileWriter.SetFavoredNodes.
+	FavoredNodes []string
+	// ChecksumType is the type of checksum to store with the data; one of
+	// ChecksumCRC32C, ChecksumCRC32, or ChecksumNull. If empty, CRC32C is used.
+	ChecksumType string
+	// Replication is the replication factor for the file. If zero, the
+	// namenode's default is used.
+	Replication int
+	// BlockSize is the block size for the file. If zero, the namenode's default
+	// is used.
+	BlockSize int64
+	// Perm is the permissions for the file, before Umask is applied. If zero,
+	// 0644 is used.
+	Perm os.FileMode
+	// Umask is removed from Perm to determine the permissions of the file.
+	// Default ACLs on the parent directory take precedence over it.
+	Umask os.FileMode
 }
 
 // Create opens a new file in HDFS with the default replication, block size,
@@ -71,6 +157,174 @@ func (c *Client) CreateFile(name string, replication int, blockSize int64, perm
 		Replication:  proto.Uint32(uint32(replication)),
 		BlockSize:    proto.Uint64(uint64(blockSize)),
 	}
+
+	return c.create(createReq)
+}
+
+// CreateWithOptions opens a file in HDFS for writing, as specified by opts,
+// and returns an io.WriteCloser for writing to it. Unless opts.Append is set,
+// this creates a new file (or overwrites an existing one, if opts.Overwrite is
+// set). As with CreateFile, it is very important that Close is called after
+// all data has been written.
+//
+// Writing erasure coded files isn't supported, so if the file would be erasure
+// coded (because of opts.ECPolicyName or the policy of its parent directory),
+// an error is returned before anything is created or overwritten.
+func (c *Client) CreateWithOptions(name string, opts CreateOptions) (*FileWriter, error) {
+	if opts.Append && opts.Overwrite {
+		return nil, &os.PathError{"create", name, os.ErrInvalid}
+	}
+
+	checksumType, err := checksumTypeFromString(opts.ChecksumType)
+	if err != nil {
+		return nil, &os.PathError{"create", name, err}
+	}
+
+	var f *FileWriter
+	if opts.Append {
+		flag := uint32(hdfs.CreateFlagProto_APPEND)
+		if opts.NewBlock {
+			flag |= uint32(hdfs.CreateFlagProto_NEW_BLOCK)
+		}
+
+		f, err = c.append(name, &flag)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if f == nil {
+		f, err = c.createWithOptions(name, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.favoredNodes = opts.FavoredNodes
+	f.checksumType = checksumType
+	if f.blockWriter != nil {
+		f.blockWriter.ChecksumType = checksumType
+	}
+
+	if opts.NoLocalWrite {
+		f.addBlockFlags = append(f.addBlockFlags, hdfs.AddBlockFlagProto_NO_LOCAL_WRITE)
+	}
+
+	if opts.IgnoreClientLocality {
+		f.addBlockFlags = append(f.addBlockFlags, hdfs.AddBlockFlagProto_IGNORE_CLIENT_LOCALITY)
+	}
+
+	return f, nil
+}
+
+func (c *Client) createWithOptions(name string, opts CreateOptions) (*FileWriter, error) {
+	replication := opts.Replication
+	blockSize := opts.BlockSize
+	if replication == 0 || blockSize == 0 {
+		defaults, err := c.fetchDefaults()
+		if err != nil {
+			return nil, err
+		}
+
+		if replication == 0 {
+			replication = int(defaults.GetReplication())
+		}
+
+		if blockSize == 0 {
+			blockSize = int64(defaults.GetBlockSize())
+		}
+	}
+
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+
+	flag := uint32(hdfs.CreateFlagProto_CREATE)
+	if opts.Overwrite {
+		flag |= uint32(hdfs.CreateFlagProto_OVERWRITE)
+	}
+
+	if opts.LazyPersist {
+		flag |= uint32(hdfs.CreateFlagProto_LAZY_PERSIST)
+	}
+
+	createReq := &hdfs.CreateRequestProto{
+		Src:          proto.String(name),
+		Masked:       &hdfs.FsPermissionProto{Perm: proto.Uint32(uint32(perm &^ opts.Umask))},
+		Unmasked:     &hdfs.FsPermissionProto{Perm: proto.Uint32(uint32(perm))},
+		ClientName:   proto.String(c.namenode.ClientName),
+		CreateFlag:   proto.Uint32(flag),
+		CreateParent: proto.Bool(opts.CreateParent),
+		Replication:  proto.Uint32(uint32(replication)),
+		BlockSize:    proto.Uint64(uint64(blockSize)),
+	}
+
+	if opts.StoragePolicy != "" {
+		createReq.StoragePolicy = proto.String(opts.StoragePolicy)
+	}
+
+	if opts.ECPolicyName != "" {
+		createReq.EcPolicyName = proto.String(opts.ECPolicyName)
+	}
+
+	err := c.checkErasureCoding(createReq)
+	if err != nil {
+		return nil, &os.PathError{"create", name, err}
+	}
+
+	return c.create(createReq)
+}
+
+// checkErasureCoding returns an error if the file that createReq would create
+// is erasure coded, either because of its EcPolicyName or because it inherits
+// a policy from its parent directory. This has to happen before the file is
+// created, since by then it may have replaced an existing file. Only
+// CreateWithOptions checks, so that CreateFile stays a single RPC.
+func (c *Client) checkErasureCoding(createReq *hdfs.CreateRequestProto) error {
+	if createReq.EcPolicyName != nil {
+		if createReq.GetEcPolicyName() != replicationPolicyName {
+			return errErasureCodedWrite
+		}
+
+		return nil
+	}
+
+	// If the parent doesn't exist, it will be created with the policy of the
+	// closest ancestor that does.
+	dir := path.Dir(createReq.GetSrc())
+	for {
+		req := &hdfs.GetErasureCodingPolicyRequestProto{Src: proto.String(dir)}
+		resp := &hdfs.GetErasureCodingPolicyResponseProto{}
+
+		err := c.namenode.Execute("getErasureCodingPolicy", req, resp)
+		if err == nil {
+			policy := resp.GetEcPolicy()
+			if policy != nil && policy.GetName() != replicationPolicyName {
+				return errErasureCodedWrite
+			}
+
+			return nil
+		} else if isNoSuchMethod(err) {
+			// Erasure coding was added in Hadoop 3.
+			return nil
+		}
+
+		err = interpretException(err)
+		if os.IsNotExist(err) && createReq.GetCreateParent() && dir != "/" {
+			dir = path.Dir(dir)
+			continue
+		} else if os.IsNotExist(err) {
+			// Let create return the error.
+			return nil
+		}
+
+		return err
+	}
+}
+
+func (c *Client) create(createReq *hdfs.CreateRequestProto) (*FileWriter, error) {
+	name := createReq.GetSrc()
 	createResp := &hdfs.CreateResponseProto{}
 
 	err := c.namenode.Execute("create", createReq, createResp)
@@ -81,12 +335,27 @@ func (c *Client) CreateFile(name string, replication int, blockSize int64, perm
 	return &FileWriter{
 		client:      c,
 		name:        name,
-		replication: replication,
-		blockSize:   blockSize,
+		replication: int(createReq.GetReplication()),
+		blockSize:   int64(createReq.GetBlockSize()),
 		fileId:      createResp.Fs.FileId,
 	}, nil
 }
 
+func checksumTypeFromString(s string) (*hdfs.ChecksumTypeProto, error) {
+	switch strings.ToUpper(s) {
+	case "":
+		return nil, nil
+	case ChecksumCRC32C:
+		return hdfs.ChecksumTypeProto_CHECKSUM_CRC32C.Enum(), nil
+	case ChecksumCRC32:
+		return hdfs.ChecksumTypeProto_CHECKSUM_CRC32.Enum(), nil
+	case ChecksumNull:
+		return hdfs.ChecksumTypeProto_CHECKSUM_NULL.Enum(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum type: %s", s)
+	}
+}
+
 // Append opens an existing file in HDFS and returns an io.WriteCloser for
 // writing to it. Because of the way that HDFS writes are buffered and
 // acknowledged asynchronously, it is very important that Close is called after
@@ -97,13 +366,18 @@ func (c *Client) Append(name string) (*FileWriter, error) {
 		return nil, &os.PathError{"append", name, interpretException(err)}
 	}
 
+	return c.append(name, nil)
+}
+
+func (c *Client) append(name string, flag *uint32) (*FileWriter, error) {
 	appendReq := &hdfs.AppendRequestProto{
 		Src:        proto.String(name),
 		ClientName: proto.String(c.namenode.ClientName),
+		Flag:       flag,
 	}
 	appendResp := &hdfs.AppendResponseProto{}
 
-	err = c.namenode.Execute("append", appendReq, appendResp)
+	err := c.namenode.Execute("append", appendReq, appendResp)
 	if err != nil {
 		return nil, &os.PathError{"append", name, interpretException(err)}
 	}
@@ -116,35 +390,21 @@ func (c *Client) Append(name string) (*FileWriter, error) {
 		fileId:      appendResp.Stat.FileId,
 	}
 
-	// This returns nil if there are no blocks (it's an empty file) or if the
-	// last block is full (so we have to start a fresh block).
+	// This returns nil if there are no blocks (it's an empty file), if the
+	// last block is full, or if we asked for a new block (so we have to start
+	// a fresh block).
 	block := appendResp.GetBlock()
 	if block == nil {
 		return f, nil
 	}
 
-	dialFunc, err := f.client.wrapDatanodeDial(
-		f.client.options.DatanodeDialFunc,
-		block.GetBlockToken())
-	if err != nil {
-		return nil, err
-	}
-
-	f.blockWriter = &transfer.BlockWriter{
-		ClientName:          f.client.namenode.ClientName,
-		Block:               block,
-		BlockSize:           f.blockSize,
-		Offset:              int64(block.B.GetNumBytes()),
-		Append:              true,
-		UseDatanodeHostname: f.client.options.UseDatanodeHostname,
-		DialFunc:            dialFunc,
-	}
-
-	err = f.blockWriter.SetDeadline(f.deadline)
+	err = f.setupBlockWriter(block)
 	if err != nil {
 		return nil, err
 	}
 
+	f.blockWriter.Offset = int64(block.B.GetNumBytes())
+	f.blockWriter.Append = true
 	return f, nil
 }
 
@@ -174,6 +434,15 @@ func (f *FileWriter) SetDeadline(t time.Time) error {
 	return nil
 }
 
+// SetFavoredNodes sets the datanodes that the namenode should prefer when it
+// places new blocks for the file, as "host:port" addresses of their data
+// transfer ports. This allows writers to control the locality of their data.
+// The namenode treats it as a hint, and may place blocks elsewhere, for
+// example if the datanodes are full or have failed.
+func (f *FileWriter) SetFavoredNodes(nodes []string) {
+	f.favoredNodes = nodes
+}
+
 // Write implements io.Writer for writing to a file in HDFS. Internally, it
 // writes data to an internal buffer first, and then later out to HDFS. Because
 // of this, it is important that Close is called after all data has been
@@ -205,6 +474,9 @@ func (f *FileWriter) Write(b []byte) (int, error) {
 // Flush flushes any buffered data out to the datanodes. Even immediately after
 // a call to Flush, it is still necessary to call Close once all data has been
 // written.
+//
+// Flush doesn't wait for the datanodes to acknowledge the data, so it makes no
+// guarantees about whether it can be read; for that, see Hflush and Hsync.
 func (f *FileWriter) Flush() error {
 	if f.blockWriter != nil {
 		return f.blockWriter.Flush()
@@ -213,6 +485,73 @@ func (f *FileWriter) Flush() error {
 	return nil
 }
 
+// Hflush flushes any buffered data out to the datanodes, and waits for all of
+// them to acknowledge it. Once Hflush returns, the data is visible to new
+// readers of the file, and will survive the writer crashing. However, it may
+// only be in memory on the datanodes, and can still be lost if they all lose
+// power at once.
+//
+// As with Flush, it is still necessary to call Close once all data has been
+// written.
+func (f *FileWriter) Hflush() error {
+	return f.sync(false, false)
+}
+
+// Hsync is like Hflush, but additionally waits for every datanode to sync the
+// data to disk, so that it survives the datanodes losing power.
+//
+// The length of the file reported by the namenode (for example, by Stat) only
+// includes complete blocks until the file is closed. If updateLength is true,
+// Hsync also updates the namenode with the length of the data written so far.
+func (f *FileWriter) Hsync(updateLength bool) error {
+	return f.sync(true, updateLength)
+}
+
+func (f *FileWriter) sync(syncBlock, updateLength bool) error {
+	if f.blockWriter == nil {
+		return nil
+	}
+
+	var err error
+	if syncBlock {
+		err = f.blockWriter.Hsync()
+	} else {
+		err = f.blockWriter.Hflush()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The namenode also needs to know about any blocks that have been added
+	// since the last sync, so that they're included in the file if the
+	// writer crashes.
+	if !updateLength && !f.persistBlocks {
+		return nil
+	}
+
+	lastBlockLength := int64(-1)
+	if updateLength {
+		lastBlockLength = f.blockWriter.Offset
+	}
+
+	fsyncReq := &hdfs.FsyncRequestProto{
+		Src:             proto.String(f.name),
+		Client:          proto.String(f.client.namenode.ClientName),
+		LastBlockLength: proto.Int64(lastBlockLength),
+		FileId:          f.fileId,
+	}
+	fsyncResp := &hdfs.FsyncResponseProto{}
+
+	err = f.client.namenode.Execute("fsync", fsyncReq, fsyncResp)
+	if err != nil {
+		return &os.PathError{"create", f.name, interpretException(err)}
+	}
+
+	f.persistBlocks = false
+	return nil
+}
+
 // Close closes the file, writing any remaining data out to disk and waiting
 // for acknowledgements from the datanodes. It is important that Close is called
 // after all data has been written.
@@ -227,13 +566,16 @@ func (f *FileWriter) Flush() error {
 func (f *FileWriter) Close() error {
 	var lastBlock *hdfs.ExtendedBlockProto
 	if f.blockWriter != nil {
-		lastBlock = f.blockWriter.Block.GetB()
-
-		// Close the blockWriter, flushing any buffered packets.
+		// Close the blockWriter, flushing any buffered packets. The block may
+		// have a new generation stamp afterwards, if the pipeline had to be
+		// recovered.
+		blockWriter := f.blockWriter
 		err := f.finalizeBlock()
 		if err != nil {
 			return err
 		}
+
+		lastBlock = blockWriter.Block.GetB()
 	}
 
 	completeReq := &hdfs.CompleteRequestProto{
@@ -257,30 +599,91 @@ func (f *FileWriter) Close() error {
 func (f *FileWriter) startNewBlock() error {
 	var previous *hdfs.ExtendedBlockProto
 	if f.blockWriter != nil {
-		previous = f.blockWriter.Block.GetB()
-
 		// TODO: We don't actually need to wait for previous blocks to ack before
 		// continuing.
+		blockWriter := f.blockWriter
 		err := f.finalizeBlock()
 		if err != nil {
 			return err
 		}
+
+		previous = blockWriter.Block.GetB()
 	}
 
+	// If a datanode in the pipeline for the new block fails before we've
+	// written anything, abandon the block, and ask for a new one without that
+	// datanode.
+	var excluded []*hdfs.DatanodeInfoProto
+	for attempt := 0; ; attempt++ {
+		block, err := f.addBlock(previous, excluded)
+		if err != nil {
+			return err
+		}
+
+		err = f.setupBlockWriter(block)
+		if err != nil {
+			return err
+		}
+
+		err = f.blockWriter.Connect()
+		if err == nil {
+			f.persistBlocks = true
+			return nil
+		}
+
+		f.blockWriter = nil
+		abandonErr := f.abandonBlock(block.GetB())
+		if abandonErr != nil {
+			return abandonErr
+		}
+
+		var dnErr *transfer.DatanodeError
+		if !errors.As(err, &dnErr) || attempt >= maxBlockWriteRetries {
+			return err
+		}
+
+		excluded = append(excluded, dnErr.Datanode)
+	}
+}
+
+func (f *FileWriter) addBlock(previous *hdfs.ExtendedBlockProto, excluded []*hdfs.DatanodeInfoProto) (*hdfs.LocatedBlockProto, error) {
 	addBlockReq := &hdfs.AddBlockRequestProto{
-		Src:        proto.String(f.name),
-		ClientName: proto.String(f.client.namenode.ClientName),
-		Previous:   previous,
-		FileId:     f.fileId,
+		Src:          proto.String(f.name),
+		ClientName:   proto.String(f.client.namenode.ClientName),
+		Previous:     previous,
+		ExcludeNodes: excluded,
+		FileId:       f.fileId,
+		FavoredNodes: f.favoredNodes,
+		Flags:        f.addBlockFlags,
 	}
 	addBlockResp := &hdfs.AddBlockResponseProto{}
 
 	err := f.client.namenode.Execute("addBlock", addBlockReq, addBlockResp)
+	if err != nil {
+		return nil, &os.PathError{"create", f.name, interpretException(err)}
+	}
+
+	return addBlockResp.GetBlock(), nil
+}
+
+func (f *FileWriter) abandonBlock(block *hdfs.ExtendedBlockProto) error {
+	abandonReq := &hdfs.AbandonBlockRequestProto{
+		B:      block,
+		Src:    proto.String(f.name),
+		Holder: proto.String(f.client.namenode.ClientName),
+		FileId: f.fileId,
+	}
+	abandonResp := &hdfs.AbandonBlockResponseProto{}
+
+	err := f.client.namenode.Execute("abandonBlock", abandonReq, abandonResp)
 	if err != nil {
 		return &os.PathError{"create", f.name, interpretException(err)}
 	}
 
-	block := addBlockResp.GetBlock()
+	return nil
+}
+
+func (f *FileWriter) setupBlockWriter(block *hdfs.LocatedBlockProto) error {
 	dialFunc, err := f.client.wrapDatanodeDial(
 		f.client.options.DatanodeDialFunc, block.GetBlockToken())
 	if err != nil {
@@ -288,11 +691,16 @@ func (f *FileWriter) startNewBlock() error {
 	}
 
 	f.blockWriter = &transfer.BlockWriter{
-		ClientName:          f.client.namenode.ClientName,
-		Block:               block,
-		BlockSize:           f.blockSize,
-		UseDatanodeHostname: f.client.options.UseDatanodeHostname,
-		DialFunc:            dialFunc,
+		ClientName:                f.client.namenode.ClientName,
+		Block:                     block,
+		BlockSize:                 f.blockSize,
+		UseDatanodeHostname:       f.client.options.UseDatanodeHostname,
+		DialFunc:                  dialFunc,
+		Recovery:                  pipelineRecovery{f},
+		Replication:               f.replication,
+		ReplaceDatanodePolicy:     f.client.replaceDatanodePolicy(),
+		ReplaceDatanodeBestEffort: f.client.options.ReplaceDatanodeOnFailureBestEffort,
+		ChecksumType:              f.checksumType,
 	}
 
 	return f.blockWriter.SetDeadline(f.deadline)
@@ -321,3 +729,86 @@ func (f *FileWriter) finalizeBlock() error {
 	f.blockWriter = nil
 	return nil
 }
+
+// pipelineRecovery implements transfer.PipelineRecovery, so that the
+// BlockWriter for a file can recover from datanode failures.
+type pipelineRecovery struct {
+	f *FileWriter
+}
+
+func (pr pipelineRecovery) GetAdditionalDatanode(block *hdfs.LocatedBlockProto,
+	existing []*hdfs.DatanodeInfoProto, existingStorageIDs []string,
+	excluded []*hdfs.DatanodeInfoProto) (*hdfs.LocatedBlockProto, error) {
+	req := &hdfs.GetAdditionalDatanodeRequestProto{
+		Src:                  proto.String(pr.f.name),
+		Blk:                  block.GetB(),
+		Existings:            existing,
+		Excludes:             excluded,
+		NumAdditionalNodes:   proto.Uint32(1),
+		ClientName:           proto.String(pr.f.client.namenode.ClientName),
+		ExistingStorageUuids: existingStorageIDs,
+		FileId:               pr.f.fileId,
+	}
+	resp := &hdfs.GetAdditionalDatanodeResponseProto{}
+
+	err := pr.f.client.namenode.Execute("getAdditionalDatanode", req, resp)
+	if err != nil {
+		return nil, interpretException(err)
+	}
+
+	return resp.GetBlock(), nil
+}
+
+func (pr pipelineRecovery) UpdateBlockForPipeline(block *hdfs.ExtendedBlockProto) (*hdfs.LocatedBlockProto, error) {
+	req := &hdfs.UpdateBlockForPipelineRequestProto{
+		Block:      block,
+		ClientName: proto.String(pr.f.client.namenode.ClientName),
+	}
+	resp := &hdfs.UpdateBlockForPipelineResponseProto{}
+
+	err := pr.f.client.namenode.Execute("updateBlockForPipeline", req, resp)
+	if err != nil {
+		return nil, interpretException(err)
+	}
+
+	return resp.GetBlock(), nil
+}
+
+func (pr pipelineRecovery) UpdatePipeline(oldBlock, newBlock *hdfs.ExtendedBlockProto,
+	nodes []*hdfs.DatanodeInfoProto, storageIDs []string) error {
+	ids := make([]*hdfs.DatanodeIDProto, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.GetId()
+	}
+
+	req := &hdfs.UpdatePipelineRequestProto{
+		ClientName: proto.String(pr.f.client.namenode.ClientName),
+		OldBlock:   oldBlock,
+		NewBlock:   newBlock,
+		NewNodes:   ids,
+		StorageIDs: storageIDs,
+	}
+	resp := &hdfs.UpdatePipelineResponseProto{}
+
+	err := pr.f.client.namenode.Execute("updatePipeline", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+func (pr pipelineRecovery) DialFunc(token *hadoop.TokenProto) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	return pr.f.client.wrapDatanodeDial(pr.f.client.options.DatanodeDialFunc, token)
+}
+
+func (c *Client) replaceDatanodePolicy() transfer.ReplaceDatanodePolicy {
+	switch strings.ToUpper(c.options.ReplaceDatanodeOnFailure) {
+	case ReplaceDatanodeOnFailureAlways:
+		return transfer.ReplaceDatanodeAlways
+	case ReplaceDatanodeOnFailureNever:
+		return transfer.ReplaceDatanodeNever
+	default:
+		return transfer.ReplaceDatanodeDefault
+	}
+}
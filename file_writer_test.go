@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -236,6 +237,44 @@ func TestFileWriteSmallFlushes(t *testing.T) {
 	assert.Equal(t, expected, string(bytes))
 }
 
+func TestFileWriteHsync(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/create")
+	writer, err := client.Create("/_test/create/9.txt")
+	require.NoError(t, err)
+
+	expected := strings.Repeat("c", 65536+rand.Intn(1024)) + "\n"
+	_, err = writer.Write([]byte(expected))
+	require.NoError(t, err)
+
+	// After an hflush, the data should be readable before the file is closed.
+	err = writer.Hflush()
+	require.NoError(t, err)
+
+	reader, err := client.Open("/_test/create/9.txt")
+	require.NoError(t, err)
+
+	bytes, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(bytes))
+
+	s := strings.Repeat("c", rand.Intn(1024)) + "\n"
+	expected += s
+	_, err = writer.Write([]byte(s))
+	require.NoError(t, err)
+
+	// With updateLength, the namenode should report the new length.
+	err = writer.Hsync(true)
+	require.NoError(t, err)
+
+	fi, err := client.Stat("/_test/create/9.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(expected), fi.Size())
+
+	assertClose(t, writer)
+}
+
 func TestCreateEmptyFile(t *testing.T) {
 	client := getClient(t)
 
@@ -287,6 +326,141 @@ func TestCreateFileAlreadyBeingCreatedException(t *testing.T) {
 	assertPathError(t, err, "create", filePath, os.ErrExist) // org.apache.hadoop.hdfs.protocol.AlreadyBeingCreatedException is received from HDFS
 }
 
+func TestCreateWithOptionsOverwrite(t *testing.T) {
+	const filePath = "/_test/create/overwrite.txt"
+
+	mkdirp(t, filepath.Dir(filePath))
+	client := getClient(t)
+
+	writer, err := client.CreateWithOptions(filePath, CreateOptions{Overwrite: true})
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("foobar\n"))
+	require.NoError(t, err)
+	assertClose(t, writer)
+
+	_, err = client.CreateWithOptions(filePath, CreateOptions{})
+	assertPathError(t, err, "create", filePath, os.ErrExist)
+
+	writer, err = client.CreateWithOptions(filePath, CreateOptions{Overwrite: true, Perm: 0600})
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("baz\n"))
+	require.NoError(t, err)
+	assertClose(t, writer)
+
+	bytes, err := client.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "baz\n", string(bytes))
+
+	fi, err := client.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode())
+}
+
+func TestCreateWithOptionsCreateParent(t *testing.T) {
+	const filePath = "/_test/create/parent/nested/1.txt"
+
+	baleet(t, "/_test/create/parent")
+	client := getClient(t)
+
+	writer, err := client.CreateWithOptions(filePath, CreateOptions{
+		CreateParent: true,
+		Perm:         0666,
+		Umask:        0022,
+		ChecksumType: ChecksumCRC32,
+		Replication:  1,
+	})
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("foobar\n"))
+	require.NoError(t, err)
+	assertClose(t, writer)
+
+	fi, err := client.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode())
+	assert.Equal(t, 1, fi.(*FileInfo).Replication())
+
+	bytes, err := client.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar\n", string(bytes))
+}
+
+func TestCreateWithOptionsErasureCoded(t *testing.T) {
+	const filePath = "/_test/create/ec.txt"
+
+	mkdirp(t, filepath.Dir(filePath))
+	client := getClient(t)
+
+	writer, err := client.CreateWithOptions(filePath, CreateOptions{
+		Overwrite:    true,
+		ECPolicyName: "replication",
+	})
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("foobar\n"))
+	require.NoError(t, err)
+	assertClose(t, writer)
+
+	// The existing file must be left alone.
+	_, err = client.CreateWithOptions(filePath, CreateOptions{
+		Overwrite:    true,
+		ECPolicyName: "RS-6-3-1024k",
+	})
+	assertPathError(t, err, "create", filePath, errErasureCodedWrite)
+
+	bytes, err := client.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar\n", string(bytes))
+}
+
+func TestCreateWithOptionsAppend(t *testing.T) {
+	const filePath = "/_test/create/append.txt"
+
+	baleet(t, filePath)
+	mkdirp(t, filepath.Dir(filePath))
+	client := getClient(t)
+
+	// The file is created if it doesn't exist.
+	writer, err := client.CreateWithOptions(filePath, CreateOptions{Append: true})
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("foo"))
+	require.NoError(t, err)
+	assertClose(t, writer)
+
+	writer, err = client.CreateWithOptions(filePath, CreateOptions{Append: true, NewBlock: true})
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("bar"))
+	require.NoError(t, err)
+	assertClose(t, writer)
+
+	bytes, err := client.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(bytes))
+
+	// With NewBlock, the appended data should be in its own block.
+	blocks, err := client.GetBlockLocations(filePath, 0, 6)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 2)
+
+	_, err = client.CreateWithOptions(filePath, CreateOptions{Append: true, Overwrite: true})
+	assertPathError(t, err, "create", filePath, os.ErrInvalid)
+}
+
+func TestChecksumTypeFromString(t *testing.T) {
+	checksumType, err := checksumTypeFromString("")
+	require.NoError(t, err)
+	assert.Nil(t, checksumType)
+
+	checksumType, err = checksumTypeFromString("crc32")
+	require.NoError(t, err)
+	assert.Equal(t, hdfs.ChecksumTypeProto_CHECKSUM_CRC32, *checksumType)
+
+	checksumType, err = checksumTypeFromString(ChecksumNull)
+	require.NoError(t, err)
+	assert.Equal(t, hdfs.ChecksumTypeProto_CHECKSUM_NULL, *checksumType)
+
+	_, err = checksumTypeFromString("MD5")
+	assert.Error(t, err)
+}
+
 func TestCreateEmptyFileWithoutParent(t *testing.T) {
 	client := getClient(t)
 
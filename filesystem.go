@@ -0,0 +1,97 @@
+package hdfs
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// FileSystem is the set of file operations shared by the native Client and
+// alternative backends, such as webhdfs.Client. Code written against it can
+// talk to HDFS either directly, over RPC, or through an HTTP gateway.
+//
+// Client doesn't implement FileSystem directly, since its methods return
+// concrete types; use Client.FileSystem to get an implementation backed by
+// the Client.
+type FileSystem interface {
+	// Open opens the named file or directory for reading.
+	Open(name string) (ReadableFile, error)
+	// Create creates a new file and opens it for writing. It returns an
+	// error if the file already exists.
+	Create(name string) (WritableFile, error)
+	// Append opens an existing file for writing, at the end of the file.
+	Append(name string) (WritableFile, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	Mkdir(dirname string, perm os.FileMode) error
+	MkdirAll(dirname string, perm os.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	// Rename renames (moves) a file or directory, replacing newpath if it
+	// exists and is a file.
+	Rename(oldpath, newpath string) error
+	Chmod(name string, perm os.FileMode) error
+	Chown(name string, user, group string) error
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+	Close() error
+}
+
+// ReadableFile is a file opened for reading by a FileSystem. It's
+// implemented by FileReader.
+type ReadableFile interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Name() string
+	Stat() os.FileInfo
+	Readdir(n int) ([]os.FileInfo, error)
+}
+
+// WritableFile is a file opened for writing by a FileSystem. It's
+// implemented by FileWriter. As with FileWriter, it's very important to check
+// the error returned by Close.
+type WritableFile interface {
+	io.WriteCloser
+	Flush() error
+}
+
+var (
+	_ ReadableFile = (*FileReader)(nil)
+	_ WritableFile = (*FileWriter)(nil)
+)
+
+// FileSystem returns an implementation of the FileSystem interface backed by
+// the Client.
+func (c *Client) FileSystem() FileSystem {
+	return clientFileSystem{c}
+}
+
+type clientFileSystem struct {
+	*Client
+}
+
+func (fs clientFileSystem) Open(name string) (ReadableFile, error) {
+	f, err := fs.Client.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (fs clientFileSystem) Create(name string) (WritableFile, error) {
+	f, err := fs.Client.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (fs clientFileSystem) Append(name string) (WritableFile, error) {
+	f, err := fs.Client.Append(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
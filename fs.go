@@ -0,0 +1,179 @@
+package hdfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// FS is an implementation of fs.FS backed by a Client, which makes it
+// possible to use HDFS with any package that supports the io/fs interfaces,
+// such as text/template or net/http. It also implements fs.StatFS,
+// fs.ReadDirFS, fs.ReadFileFS, fs.GlobFS and fs.SubFS.
+//
+// Following the io/fs conventions, names are unrooted, slash-separated paths
+// relative to the root of the FS, like "foo/bar.txt", and the root itself is
+// named ".". Glob uses the path.Match syntax rather than Hadoop's (see
+// Client.Glob for the latter).
+type FS struct {
+	client *Client
+	root   string
+}
+
+var (
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.GlobFS     = (*FS)(nil)
+	_ fs.SubFS      = (*FS)(nil)
+)
+
+// FS returns an FS rooted at the root of the filesystem. Use Sub (or fs.Sub)
+// to get one for a subdirectory.
+func (c *Client) FS() *FS {
+	return &FS{client: c, root: "/"}
+}
+
+// Open implements fs.FS. The returned file is an *FSFile, which also
+// implements io.Seeker, io.ReaderAt and fs.ReadDirFile.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	p, err := fsys.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.client.Open(p)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+
+	return &FSFile{FileReader: f, name: name}, nil
+}
+
+// Stat implements fs.StatFS.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	p, err := fsys.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fsys.client.Stat(p)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+
+	return info, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := fsys.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := fsys.client.ReadDir(p)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+
+	return dirEntries(infos), nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	p, err := fsys.resolve("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := fsys.client.ReadFile(p)
+	if err != nil {
+		return nil, fsError(err, name)
+	}
+
+	return b, nil
+}
+
+// Glob implements fs.GlobFS.
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	// Hide our own Glob method, so that fs.Glob doesn't call back into it.
+	return fs.Glob(struct{ fs.ReadDirFS }{fsys}, pattern)
+}
+
+// Sub implements fs.SubFS.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	p, err := fsys.resolve("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FS{client: fsys.client, root: p}, nil
+}
+
+func (fsys *FS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return path.Join(fsys.root, name), nil
+}
+
+// FSFile is the fs.File returned by FS.Open. It wraps a FileReader, so
+// that its methods conform to the io/fs interfaces.
+type FSFile struct {
+	*FileReader
+	name string
+}
+
+// Stat implements fs.File.
+func (f *FSFile) Stat() (fs.FileInfo, error) {
+	return f.FileReader.Stat(), nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *FSFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n > 0 {
+		infos, err := f.Readdir(n)
+		if err != nil && err != io.EOF {
+			err = fsError(err, f.name)
+		}
+
+		return dirEntries(infos), err
+	}
+
+	// FileReader.Readdir starts over if n <= 0, whereas ReadDir is supposed
+	// to return the remaining entries.
+	var res []fs.DirEntry
+	for {
+		infos, err := f.Readdir(1000)
+		res = append(res, dirEntries(infos)...)
+		if err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return res, fsError(err, f.name)
+		}
+	}
+}
+
+func dirEntries(infos []os.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+
+	return entries
+}
+
+// fsError rewrites the path in an *os.PathError to be the name passed to the
+// FS, rather than the absolute path in HDFS.
+func fsError(err error, name string) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+package hdfs
+
+import (
+	"io/fs"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, name, contents string) {
+	client := getClient(t)
+
+	w, err := client.Create(name)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func TestFS(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/iofs")
+	mkdirp(t, "/_test/iofs/dir/subdir")
+	mkdirp(t, "/_test/iofs/empty")
+	writeTestFile(t, "/_test/iofs/foo.txt", "foo")
+	writeTestFile(t, "/_test/iofs/dir/bar.txt", "bar\nbar\n")
+	touch(t, "/_test/iofs/dir/subdir/baz")
+
+	fsys, err := fs.Sub(client.FS(), "_test/iofs")
+	require.NoError(t, err)
+
+	err = fstest.TestFS(fsys, "foo.txt", "dir/bar.txt", "dir/subdir/baz", "empty")
+	assert.NoError(t, err)
+}
+
+func TestFSReadFile(t *testing.T) {
+	client := getClient(t)
+
+	b, err := fs.ReadFile(client.FS(), "_test/foo.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, "bar\n", string(b))
+}
+
+func TestFSNotExistent(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/nonexistent")
+
+	_, err := client.FS().Open("_test/nonexistent")
+	assertPathError(t, err, "open", "_test/nonexistent", fs.ErrNotExist)
+
+	_, err = fs.Stat(client.FS(), "_test/nonexistent")
+	assertPathError(t, err, "stat", "_test/nonexistent", fs.ErrNotExist)
+}
+
+func TestFSInvalidPath(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.FS().Open("/_test/foo.txt")
+	assertPathError(t, err, "open", "/_test/foo.txt", fs.ErrInvalid)
+
+	_, err = client.FS().Sub("../foo")
+	assertPathError(t, err, "sub", "../foo", fs.ErrInvalid)
+}
+
+func TestFSGlob(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/iofsglob")
+	mkdirp(t, "/_test/iofsglob/dir1")
+	mkdirp(t, "/_test/iofsglob/dir2")
+	touch(t, "/_test/iofsglob/dir1/foo")
+	touch(t, "/_test/iofsglob/dir2/bar")
+
+	res, err := fs.Glob(client.FS(), "_test/iofsglob/dir*/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_test/iofsglob/dir1/foo", "_test/iofsglob/dir2/bar"}, res)
+
+	_, err = fs.Glob(client.FS(), "_test/[")
+	assert.Equal(t, path.ErrBadPattern, err)
+}
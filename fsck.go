@@ -0,0 +1,182 @@
+package hdfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/colinmarc/hdfs/v2/internal/transfer"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReplicaChecksum is the checksum of a single replica of a block, as reported
+// by the datanode storing it.
+type ReplicaChecksum struct {
+	// Datanode is the data transfer address (ip:port) of the datanode.
+	Datanode string
+	// Checksum is the MD5 of the replica's CRCs; see FileReader.Checksum. It's
+	// nil if Err is set.
+	Checksum []byte
+	// Err is set if the checksum couldn't be read from the datanode.
+	Err error
+}
+
+// ReplicaVerification is the result of reading a single replica of a block in
+// full with VerifyReplicas.
+type ReplicaVerification struct {
+	// Datanode is the data transfer address (ip:port) of the datanode.
+	Datanode string
+	// Corrupt is true if the replica's data doesn't match its checksums.
+	Corrupt bool
+	// Err is set if the replica couldn't be read in full, including because
+	// it's corrupt.
+	Err error
+}
+
+// ListCorruptFileBlocks returns a page of the files under the named
+// directory which have corrupt blocks, according to the namenode. Pass an
+// empty cookie to fetch the first page, and then the returned cookie to fetch
+// each subsequent one; an empty page means there are no more files.
+//
+// This requires superuser privileges.
+func (c *Client) ListCorruptFileBlocks(dir, cookie string) ([]string, string, error) {
+	req := &hdfs.ListCorruptFileBlocksRequestProto{Path: proto.String(dir)}
+	if cookie != "" {
+		req.Cookie = proto.String(cookie)
+	}
+	resp := &hdfs.ListCorruptFileBlocksResponseProto{}
+
+	err := c.namenode.Execute("listCorruptFileBlocks", req, resp)
+	if err != nil {
+		return nil, "", &os.PathError{"list corrupt file blocks", dir, interpretException(err)}
+	}
+
+	return resp.GetCorrupt().GetFiles(), resp.GetCorrupt().GetCookie(), nil
+}
+
+// ReplicaChecksums reads the checksum of every replica of every block of the
+// named file, asking each datanode individually. The result has one entry
+// per block, in the same order as GetBlockLocations, each with one entry per
+// replica.
+//
+// All the replicas of a block should have the same checksum, so a mismatch
+// indicates that at least one of them is corrupt. Note that datanodes compute
+// the checksum from the CRCs stored alongside the block, so this doesn't
+// detect block data which no longer matches its CRCs; use VerifyReplicas for
+// that.
+func (c *Client) ReplicaChecksums(name string) ([][]ReplicaChecksum, error) {
+	blocks, err := c.replicaBlocks("replica checksums", name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([][]ReplicaChecksum, len(blocks))
+	for i, replicas := range blocks {
+		res[i] = make([]ReplicaChecksum, len(replicas))
+		for j, replica := range replicas {
+			d, err := c.wrapDatanodeDial(c.options.DatanodeDialFunc, replica.GetBlockToken())
+			if err != nil {
+				return nil, err
+			}
+
+			cr := &transfer.ChecksumReader{
+				Block:               replica,
+				UseDatanodeHostname: c.options.UseDatanodeHostname,
+				DialFunc:            d,
+				PeerCache:           c.peerCache,
+			}
+
+			checksum, err := cr.ReadChecksum()
+			res[i][j] = ReplicaChecksum{
+				Datanode: replicaDatanode(replica),
+				Checksum: checksum,
+				Err:      err,
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// VerifyReplicas reads every replica of every block of the named file in
+// full, checking the data against the checksums stored with it. The result has
+// one entry per block, in the same order as GetBlockLocations, each with one
+// entry per replica.
+//
+// Unlike ReplicaChecksums, this detects replicas whose data has been
+// corrupted on disk, but it transfers the entire file from every datanode.
+func (c *Client) VerifyReplicas(name string) ([][]ReplicaVerification, error) {
+	blocks, err := c.replicaBlocks("verify replicas", name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([][]ReplicaVerification, len(blocks))
+	for i, replicas := range blocks {
+		res[i] = make([]ReplicaVerification, len(replicas))
+		for j, replica := range replicas {
+			d, err := c.wrapDatanodeDial(c.options.DatanodeDialFunc, replica.GetBlockToken())
+			if err != nil {
+				return nil, err
+			}
+
+			br := &transfer.BlockReader{
+				ClientName:          c.namenode.ClientName,
+				Block:               replica,
+				UseDatanodeHostname: c.options.UseDatanodeHostname,
+				DialFunc:            d,
+				PeerCache:           c.peerCache,
+			}
+
+			_, err = io.Copy(io.Discard, br)
+			br.Close()
+
+			res[i][j] = ReplicaVerification{
+				Datanode: replicaDatanode(replica),
+				Corrupt:  errors.Is(err, transfer.ErrInvalidChecksum),
+				Err:      err,
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// replicaBlocks returns the blocks of the named file, each split up into one
+// block per replica. Reading one of those is restricted to that replica, since
+// there's no other location to fail over to.
+func (c *Client) replicaBlocks(op, name string) ([][]*hdfs.LocatedBlockProto, error) {
+	info, err := c.getFileInfo(name)
+	if err != nil {
+		return nil, &os.PathError{op, name, interpretException(err)}
+	} else if info.IsDir() {
+		return nil, &os.PathError{op, name, errors.New("is a directory")}
+	}
+
+	blocks, err := c.getBlockLocations(name, 0, info.Size())
+	if err != nil {
+		return nil, &os.PathError{op, name, interpretException(err)}
+	}
+
+	res := make([][]*hdfs.LocatedBlockProto, len(blocks))
+	for i, block := range blocks {
+		for _, loc := range block.GetLocs() {
+			res[i] = append(res[i], &hdfs.LocatedBlockProto{
+				B:          block.GetB(),
+				Offset:     block.Offset,
+				Locs:       []*hdfs.DatanodeInfoProto{loc},
+				Corrupt:    block.Corrupt,
+				BlockToken: block.GetBlockToken(),
+			})
+		}
+	}
+
+	return res, nil
+}
+
+func replicaDatanode(replica *hdfs.LocatedBlockProto) string {
+	id := replica.GetLocs()[0].GetId()
+	return fmt.Sprintf("%s:%d", id.GetIpAddr(), id.GetXferPort())
+}
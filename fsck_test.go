@@ -0,0 +1,79 @@
+package hdfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCorruptFileBlocks(t *testing.T) {
+	client := getClientForSuperUser(t)
+
+	files, _, err := client.ListCorruptFileBlocks("/_test", "")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestListCorruptFileBlocksWithoutPermission(t *testing.T) {
+	client := getClient(t)
+
+	_, _, err := client.ListCorruptFileBlocks("/_test", "")
+	assertPathError(t, err, "list corrupt file blocks", "/_test", os.ErrPermission)
+}
+
+func TestReplicaChecksums(t *testing.T) {
+	client := getClient(t)
+
+	checksums, err := client.ReplicaChecksums("/_test/mobydick.txt")
+	require.NoError(t, err)
+	require.Len(t, checksums, 2)
+
+	for _, replicas := range checksums {
+		require.NotEmpty(t, replicas)
+		for _, replica := range replicas {
+			assert.NoError(t, replica.Err)
+			assert.NotEmpty(t, replica.Datanode)
+			assert.Len(t, replica.Checksum, 16)
+		}
+	}
+}
+
+func TestVerifyReplicas(t *testing.T) {
+	client := getClient(t)
+
+	verified, err := client.VerifyReplicas("/_test/mobydick.txt")
+	require.NoError(t, err)
+	require.Len(t, verified, 2)
+
+	for _, replicas := range verified {
+		require.NotEmpty(t, replicas)
+		for _, replica := range replicas {
+			assert.NoError(t, replica.Err)
+			assert.False(t, replica.Corrupt)
+			assert.NotEmpty(t, replica.Datanode)
+		}
+	}
+}
+
+func TestVerifyReplicasNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.VerifyReplicas("/_test/nonexistent")
+	assertPathError(t, err, "verify replicas", "/_test/nonexistent", os.ErrNotExist)
+}
+
+func TestReplicaChecksumsDir(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.ReplicaChecksums("/_test")
+	assert.Error(t, err)
+}
+
+func TestReplicaChecksumsNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.ReplicaChecksums("/_test/nonexistent")
+	assertPathError(t, err, "replica checksums", "/_test/nonexistent", os.ErrNotExist)
+}
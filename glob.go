@@ -0,0 +1,420 @@
+package hdfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GlobOptions represents the configurable options for Glob.
+type GlobOptions struct {
+	// Recursive enables the special path component "**", which matches zero
+	// or more directories (and files, if it's the last component). Hadoop
+	// doesn't support this, and by default "**" behaves exactly like "*".
+	Recursive bool
+}
+
+// globComponent is a single compiled path component of a glob pattern.
+type globComponent struct {
+	literal   string
+	re        *regexp.Regexp
+	recursive bool
+}
+
+// globCandidate is a path that matches a glob pattern so far. The info is
+// nil if the path was built from literal components, and hasn't been checked
+// for existence yet.
+type globCandidate struct {
+	path string
+	info os.FileInfo
+}
+
+// Glob returns the names of all files matching pattern, which must be an
+// absolute path, in lexical order. If nothing matches, Glob returns nil and no
+// error.
+//
+// The pattern syntax is the same as Hadoop's:
+//
+//	?       matches any single character
+//	*       matches zero or more characters
+//	[abc]   matches a single character from the set
+//	[a-b]   matches a single character from the range
+//	[^a]    matches a single character not in the set or range (as does [!a])
+//	\c      matches the character c literally
+//	{ab,cd} matches either of the comma-separated patterns, which may contain
+//	        other special characters, including slashes
+//
+// Wildcards never match a slash. Path components without any special
+// characters are taken literally, so that only the directories that contain
+// wildcards need to be listed.
+func (c *Client) Glob(pattern string) ([]string, error) {
+	return c.GlobWithOptions(pattern, GlobOptions{})
+}
+
+// GlobWithOptions is like Glob, but takes a GlobOptions.
+func (c *Client) GlobWithOptions(pattern string, options GlobOptions) ([]string, error) {
+	if !path.IsAbs(pattern) {
+		return nil, &os.PathError{"glob", pattern, errors.New("pattern must be absolute")}
+	}
+
+	patterns, err := expandGlobBraces(pattern)
+	if err != nil {
+		return nil, &os.PathError{"glob", pattern, err}
+	}
+
+	seen := make(map[string]bool)
+	var res []string
+	for _, p := range patterns {
+		matches, err := c.glob(p, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				res = append(res, m)
+			}
+		}
+	}
+
+	sort.Strings(res)
+	return res, nil
+}
+
+func (c *Client) glob(pattern string, options GlobOptions) ([]string, error) {
+	var components []globComponent
+	for _, part := range strings.Split(pattern, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+
+		component, err := compileGlobComponent(part, options.Recursive)
+		if err != nil {
+			return nil, &os.PathError{"glob", pattern, err}
+		}
+
+		components = append(components, component)
+	}
+
+	candidates := []globCandidate{{path: "/"}}
+	for i, component := range components {
+		last := i == len(components)-1
+		var next []globCandidate
+
+		// Literal components can be appended without listing anything.
+		if component.re == nil && !component.recursive {
+			for _, candidate := range candidates {
+				if candidate.info != nil && !candidate.info.IsDir() {
+					continue
+				}
+
+				next = append(next, globCandidate{path: path.Join(candidate.path, component.literal)})
+			}
+
+			candidates = next
+			continue
+		}
+
+		for _, candidate := range candidates {
+			if component.recursive {
+				// ** also matches zero directories.
+				next = append(next, candidate)
+			}
+
+			err := c.globList(candidate, func(child globCandidate) error {
+				if component.recursive {
+					if last || child.info.IsDir() {
+						next = append(next, child)
+					}
+
+					return nil
+				}
+
+				if component.re.MatchString(child.info.Name()) {
+					next = append(next, child)
+				}
+
+				return nil
+			}, component.recursive)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		candidates = next
+	}
+
+	var res []string
+	for _, candidate := range candidates {
+		if candidate.info == nil {
+			_, err := c.getFileInfo(candidate.path)
+			if err != nil {
+				err = interpretException(err)
+				if os.IsNotExist(err) {
+					continue
+				}
+
+				return nil, &os.PathError{"glob", candidate.path, err}
+			}
+		}
+
+		res = append(res, candidate.path)
+	}
+
+	return res, nil
+}
+
+// globList calls fn for each child of candidate, or, if recursive is true,
+// each descendant. Candidates that don't exist or aren't directories are
+// skipped.
+func (c *Client) globList(candidate globCandidate, fn func(globCandidate) error, recursive bool) error {
+	if candidate.info == nil {
+		info, err := c.getFileInfo(candidate.path)
+		if err != nil {
+			err = interpretException(err)
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return &os.PathError{"glob", candidate.path, err}
+		}
+
+		candidate.info = info
+	}
+
+	if !candidate.info.IsDir() {
+		return nil
+	}
+
+	it := c.ListDir(candidate.path, ListOptions{})
+	for it.Next() {
+		info := it.Entry()
+		child := globCandidate{path: path.Join(candidate.path, info.Name()), info: info}
+		err := fn(child)
+		if err != nil {
+			return err
+		}
+
+		if recursive && info.IsDir() {
+			err = c.globList(child, fn, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := it.Err()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// compileGlobComponent translates a single path component of a glob pattern
+// into a regexp, following the rules of Hadoop's GlobPattern. If the
+// component doesn't contain any special characters, it's returned as a
+// literal (with any escaping removed) instead.
+func compileGlobComponent(pattern string, recursive bool) (globComponent, error) {
+	if recursive && pattern == "**" {
+		return globComponent{recursive: true}, nil
+	}
+
+	var re, literal strings.Builder
+	wildcard := false
+	inSet := false
+	setStart := false
+	negated := false
+	curlyOpen := 0
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '\\' {
+			i++
+			if i >= len(pattern) {
+				return globComponent{}, errors.New("missing escaped character")
+			}
+
+			c = pattern[i]
+			if c == '-' {
+				re.WriteString(`\-`)
+			} else {
+				re.WriteString(regexp.QuoteMeta(string(c)))
+			}
+
+			literal.WriteByte(c)
+			setStart = false
+			continue
+		}
+
+		if inSet {
+			switch {
+			case setStart && !negated && (c == '!' || c == '^'):
+				// A closing bracket right after the negation is still literal.
+				re.WriteByte('^')
+				negated = true
+				continue
+			case c == ']' && !setStart:
+				re.WriteByte(']')
+				inSet = false
+			case c == '-':
+				re.WriteByte('-')
+			case c == '[':
+				return globComponent{}, errors.New("nested character class")
+			default:
+				re.WriteString(regexp.QuoteMeta(string(c)))
+			}
+
+			setStart = false
+			continue
+		}
+
+		literal.WriteByte(c)
+		switch c {
+		case '*':
+			re.WriteString("[^/]*")
+			wildcard = true
+		case '?':
+			re.WriteString("[^/]")
+			wildcard = true
+		case '[':
+			re.WriteByte('[')
+			inSet = true
+			setStart = true
+			negated = false
+			wildcard = true
+		case '{':
+			re.WriteString("(?:")
+			curlyOpen++
+			wildcard = true
+		case ',':
+			if curlyOpen > 0 {
+				re.WriteByte('|')
+			} else {
+				re.WriteByte(',')
+			}
+		case '}':
+			if curlyOpen > 0 {
+				re.WriteByte(')')
+				curlyOpen--
+			} else {
+				re.WriteString(`\}`)
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if inSet {
+		return globComponent{}, errors.New("unclosed character class")
+	} else if curlyOpen > 0 {
+		return globComponent{}, errors.New("unclosed group")
+	}
+
+	if !wildcard {
+		return globComponent{literal: literal.String()}, nil
+	}
+
+	compiled, err := regexp.Compile("^(?s:" + re.String() + ")$")
+	if err != nil {
+		return globComponent{}, err
+	}
+
+	return globComponent{re: compiled}, nil
+}
+
+// expandGlobBraces expands any alternations in the pattern that contain
+// slashes into separate patterns, since the pattern is otherwise matched one
+// path component at a time. Like Hadoop's GlobExpander, it leaves alone
+// alternations without slashes.
+func expandGlobBraces(pattern string) ([]string, error) {
+	start, end, err := findSlashedGroup(pattern)
+	if err != nil {
+		return nil, err
+	} else if start < 0 {
+		return []string{pattern}, nil
+	}
+
+	prefix, suffix := pattern[:start], pattern[end+1:]
+	var res []string
+	for _, alt := range splitGroup(pattern[start+1 : end]) {
+		expanded, err := expandGlobBraces(prefix + alt + suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, expanded...)
+	}
+
+	return res, nil
+}
+
+// findSlashedGroup returns the indices of the braces around the first
+// outermost alternation group that contains a slash, or -1 if there isn't one.
+func findSlashedGroup(pattern string) (int, int, error) {
+	depth := 0
+	start := -1
+	slashed := false
+	inSet := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inSet:
+			if c == ']' {
+				inSet = false
+			}
+		case c == '[':
+			inSet = true
+		case c == '{':
+			if depth == 0 {
+				start = i
+				slashed = false
+			}
+
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+			if depth == 0 && slashed {
+				return start, i, nil
+			}
+		case c == '/' && depth > 0:
+			slashed = true
+		}
+	}
+
+	if depth > 0 {
+		return -1, -1, errors.New("unclosed group")
+	}
+
+	return -1, -1, nil
+}
+
+// splitGroup splits the contents of an alternation group on the commas at its
+// top level.
+func splitGroup(group string) []string {
+	var res []string
+	depth := 0
+	last := 0
+	for i := 0; i < len(group); i++ {
+		switch group[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				res = append(res, group[last:i])
+				last = i + 1
+			}
+		}
+	}
+
+	return append(res, group[last:])
+}
@@ -0,0 +1,155 @@
+package hdfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileGlobComponent(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*", "foo", true},
+		{"*", "", true},
+		{"f*", "foo", true},
+		{"f*", "bar", false},
+		{"?", "a", true},
+		{"?", "ab", false},
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]x", "bx", false},
+		{"[^a-c]x", "dx", true},
+		{"[]a]", "]", true},
+		{"[!]a]", "b", true},
+		{"[\\-a]", "-", true},
+		{"{foo,bar}", "bar", true},
+		{"{foo,bar}", "baz", false},
+		{"{f*,b?}", "fizz", true},
+		{"{a,{b,c}}d", "cd", true},
+		{"\\**", "*a", true},
+		{"\\**", "a", false},
+		{"a.b*", "axb", false},
+		{"a,b*", "a,bc", true},
+		{"**", "foo", true},
+	}
+
+	for _, tc := range cases {
+		component, err := compileGlobComponent(tc.pattern, false)
+		require.NoError(t, err, tc.pattern)
+		require.NotNil(t, component.re, tc.pattern)
+		assert.Equal(t, tc.match, component.re.MatchString(tc.name), "%s ~ %s", tc.pattern, tc.name)
+	}
+}
+
+func TestCompileGlobComponentLiteral(t *testing.T) {
+	component, err := compileGlobComponent("foo", false)
+	require.NoError(t, err)
+	assert.Nil(t, component.re)
+	assert.Equal(t, "foo", component.literal)
+
+	component, err = compileGlobComponent("f\\*o\\{", false)
+	require.NoError(t, err)
+	assert.Nil(t, component.re)
+	assert.Equal(t, "f*o{", component.literal)
+
+	component, err = compileGlobComponent("**", true)
+	require.NoError(t, err)
+	assert.True(t, component.recursive)
+}
+
+func TestCompileGlobComponentErrors(t *testing.T) {
+	for _, pattern := range []string{"[abc", "{a,b", "foo\\", "[a[b]]"} {
+		_, err := compileGlobComponent(pattern, false)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestExpandGlobBraces(t *testing.T) {
+	expanded, err := expandGlobBraces("/a/{b,c}/d")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/a/{b,c}/d"}, expanded)
+
+	expanded, err = expandGlobBraces("/a/{b/c,d}/e")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/a/b/c/e", "/a/d/e"}, expanded)
+
+	expanded, err = expandGlobBraces("/{a/{b,c},d/e}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/a/{b,c}", "/d/e"}, expanded)
+
+	_, err = expandGlobBraces("/a/{b/c")
+	assert.Error(t, err)
+}
+
+func TestGlob(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/glob")
+	mkdirp(t, "/_test/glob/dir1/dir")
+	mkdirp(t, "/_test/glob/dir2/dir")
+	mkdirp(t, "/_test/glob/dir3")
+	touch(t, "/_test/glob/dir1/foo")
+	touch(t, "/_test/glob/dir1/dir/a")
+	touch(t, "/_test/glob/dir1/dir/b")
+	touch(t, "/_test/glob/dir2/dir/c")
+
+	cases := map[string][]string{
+		"/_test/glob/dir*/dir": {"/_test/glob/dir1/dir", "/_test/glob/dir2/dir"},
+		"/_test/glob/*/*": {
+			"/_test/glob/dir1/dir", "/_test/glob/dir1/foo", "/_test/glob/dir2/dir",
+		},
+		"/_test/glob/dir[12]/dir/?": {
+			"/_test/glob/dir1/dir/a", "/_test/glob/dir1/dir/b", "/_test/glob/dir2/dir/c",
+		},
+		"/_test/glob/dir[!1]/dir/*":     {"/_test/glob/dir2/dir/c"},
+		"/_test/glob/{dir1/foo,dir3}":   {"/_test/glob/dir1/foo", "/_test/glob/dir3"},
+		"/_test/glob/dir{1,3}":          {"/_test/glob/dir1", "/_test/glob/dir3"},
+		"/_test/glob/dir1/foo":          {"/_test/glob/dir1/foo"},
+		"/_test/glob/dir1/foo/*":        nil,
+		"/_test/glob/nonexistent*":      nil,
+		"/_test/glob/nonexistent/*/foo": nil,
+	}
+
+	for pattern, expected := range cases {
+		res, err := client.Glob(pattern)
+		require.NoError(t, err, pattern)
+		assert.Equal(t, expected, res, pattern)
+	}
+}
+
+func TestGlobRecursive(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/globr")
+	mkdirp(t, "/_test/globr/a/b")
+	touch(t, "/_test/globr/x.txt")
+	touch(t, "/_test/globr/a/y.txt")
+	touch(t, "/_test/globr/a/b/z.txt")
+
+	res, err := client.GlobWithOptions("/_test/globr/**/*.txt", GlobOptions{Recursive: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/_test/globr/a/b/z.txt", "/_test/globr/a/y.txt", "/_test/globr/x.txt",
+	}, res)
+
+	// Without the option, ** is the same as *.
+	res, err = client.Glob("/_test/globr/**/*.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/_test/globr/a/y.txt"}, res)
+}
+
+func TestGlobInvalid(t *testing.T) {
+	client := getClient(t)
+
+	_, err := client.Glob("/_test/[abc")
+	assert.Error(t, err)
+
+	_, err = client.Glob("relative/*")
+	assert.IsType(t, &os.PathError{}, err)
+}
@@ -3,7 +3,10 @@ module github.com/colinmarc/hdfs/v2
 require (
 	github.com/jcmturner/gokrb5/v8 v8.4.4
 	github.com/pborman/getopt v1.1.0
+	github.com/pkg/sftp v1.13.7
+	github.com/spf13/afero v1.11.0
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/crypto v0.31.0
 	google.golang.org/protobuf v1.31.0
 )
 
@@ -15,9 +18,11 @@ require (
 	github.com/jcmturner/gofork v1.7.6 // indirect
 	github.com/jcmturner/goidentity/v6 v6.0.1 // indirect
 	github.com/jcmturner/rpc/v2 v2.0.3 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
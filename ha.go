@@ -0,0 +1,248 @@
+package hdfs
+
+import (
+	"errors"
+	"time"
+
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	"github.com/colinmarc/hdfs/v2/internal/rpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// HAServiceState represents the high-availability state of a namenode.
+type HAServiceState int
+
+const (
+	HAServiceInitializing HAServiceState = iota
+	HAServiceActive
+	HAServiceStandby
+	HAServiceObserver
+)
+
+func (s HAServiceState) String() string {
+	switch s {
+	case HAServiceActive:
+		return "active"
+	case HAServiceStandby:
+		return "standby"
+	case HAServiceObserver:
+		return "observer"
+	default:
+		return "initializing"
+	}
+}
+
+// HAServiceStatus represents the status of a namenode, as returned by
+// HAServiceClient.ServiceStatus.
+type HAServiceStatus struct {
+	State HAServiceState
+	// ReadyToBecomeActive indicates whether a standby namenode can currently
+	// transition to active. If it can't, NotReadyReason explains why.
+	ReadyToBecomeActive bool
+	NotReadyReason      string
+}
+
+// HAServiceClient is a client for the HA service protocol, which is used to
+// monitor a specific namenode and to change its high-availability state.
+// Unlike Client, it only ever talks to a single namenode, generally on that
+// namenode's service RPC port (dfs.namenode.servicerpc-address).
+//
+// Most of its methods require superuser privileges.
+type HAServiceClient struct {
+	conn *rpc.NamenodeConnection
+}
+
+// ZKFCClient is a client for the ZooKeeper failover controller (ZKFC)
+// protocol, which is used to coordinate failovers when automatic failover is
+// enabled. The ZKFC runs alongside each namenode, and listens on the port
+// configured by dfs.ha.zkfc.port (8019 by default).
+type ZKFCClient struct {
+	conn *rpc.NamenodeConnection
+}
+
+// NewHAServiceClient returns a connected HAServiceClient for the given options.
+// options.Addresses must contain exactly one address, and the datanode and
+// data transfer options are ignored.
+func NewHAServiceClient(options ClientOptions) (*HAServiceClient, error) {
+	conn, err := newHAConnection(options, rpc.HAServiceProtocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HAServiceClient{conn: conn}, nil
+}
+
+// NewZKFCClient returns a connected ZKFCClient for the given options.
+// options.Addresses must contain exactly one address (that of the ZKFC), and
+// the datanode and data transfer options are ignored.
+func NewZKFCClient(options ClientOptions) (*ZKFCClient, error) {
+	conn, err := newHAConnection(options, rpc.ZKFCProtocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZKFCClient{conn: conn}, nil
+}
+
+func newHAConnection(options ClientOptions, protocol string) (*rpc.NamenodeConnection, error) {
+	if len(options.Addresses) != 1 {
+		return nil, errors.New("exactly one address must be specified")
+	}
+
+	if options.KerberosClient != nil && options.KerberosClient.Credentials == nil {
+		return nil, errors.New("kerberos enabled, but kerberos client is missing credentials")
+	}
+
+	if options.KerberosClient != nil && options.KerberosServicePrincipleName == "" {
+		return nil, errors.New("kerberos enabled, but kerberos namenode SPN is not provided")
+	}
+
+	return rpc.NewNamenodeConnection(
+		rpc.NamenodeConnectionOptions{
+			Addresses:                    options.Addresses,
+			User:                         options.User,
+			DialFunc:                     options.NamenodeDialFunc,
+			KerberosClient:               options.KerberosClient,
+			KerberosServicePrincipleName: options.KerberosServicePrincipleName,
+			Protocol:                     protocol,
+		},
+	)
+}
+
+// MonitorHealth checks the health of the namenode. It returns nil if the
+// namenode is healthy, and an error describing the problem otherwise.
+func (c *HAServiceClient) MonitorHealth() error {
+	req := &hadoop.MonitorHealthRequestProto{}
+	resp := &hadoop.MonitorHealthResponseProto{}
+
+	err := c.conn.Execute("monitorHealth", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// ServiceStatus returns the current high-availability status of the namenode.
+func (c *HAServiceClient) ServiceStatus() (*HAServiceStatus, error) {
+	req := &hadoop.GetServiceStatusRequestProto{}
+	resp := &hadoop.GetServiceStatusResponseProto{}
+
+	err := c.conn.Execute("getServiceStatus", req, resp)
+	if err != nil {
+		return nil, interpretException(err)
+	}
+
+	var state HAServiceState
+	switch resp.GetState() {
+	case hadoop.HAServiceStateProto_ACTIVE:
+		state = HAServiceActive
+	case hadoop.HAServiceStateProto_STANDBY:
+		state = HAServiceStandby
+	case hadoop.HAServiceStateProto_OBSERVER:
+		state = HAServiceObserver
+	default:
+		state = HAServiceInitializing
+	}
+
+	return &HAServiceStatus{
+		State:               state,
+		ReadyToBecomeActive: resp.GetReadyToBecomeActive(),
+		NotReadyReason:      resp.GetNotReadyReason(),
+	}, nil
+}
+
+// TransitionToActive requests that the namenode become active. If automatic
+// failover is enabled, the namenode rejects the request unless forced is
+// true; forcing a transition in that case can cause a split-brain, and should
+// be done with great care.
+func (c *HAServiceClient) TransitionToActive(forced bool) error {
+	req := &hadoop.TransitionToActiveRequestProto{ReqInfo: haRequestInfo(forced)}
+	resp := &hadoop.TransitionToActiveResponseProto{}
+
+	err := c.conn.Execute("transitionToActive", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// TransitionToStandby requests that the namenode become a standby. See
+// TransitionToActive for the meaning of forced.
+func (c *HAServiceClient) TransitionToStandby(forced bool) error {
+	req := &hadoop.TransitionToStandbyRequestProto{ReqInfo: haRequestInfo(forced)}
+	resp := &hadoop.TransitionToStandbyResponseProto{}
+
+	err := c.conn.Execute("transitionToStandby", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// TransitionToObserver requests that the namenode become an observer, which
+// serves reads but is not eligible to become active. See TransitionToActive
+// for the meaning of forced.
+func (c *HAServiceClient) TransitionToObserver(forced bool) error {
+	req := &hadoop.TransitionToObserverRequestProto{ReqInfo: haRequestInfo(forced)}
+	resp := &hadoop.TransitionToObserverResponseProto{}
+
+	err := c.conn.Execute("transitionToObserver", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// Close terminates the connection to the namenode.
+func (c *HAServiceClient) Close() error {
+	return c.conn.Close()
+}
+
+func haRequestInfo(forced bool) *hadoop.HAStateChangeRequestInfoProto {
+	source := hadoop.HARequestSource_REQUEST_BY_USER
+	if forced {
+		source = hadoop.HARequestSource_REQUEST_BY_USER_FORCED
+	}
+
+	return &hadoop.HAStateChangeRequestInfoProto{ReqSource: source.Enum()}
+}
+
+// CedeActive requests that the ZKFC give up the active state for its
+// namenode, if it holds it, and stay out of the election for the given
+// duration.
+func (c *ZKFCClient) CedeActive(d time.Duration) error {
+	req := &hadoop.CedeActiveRequestProto{
+		MillisToCede: proto.Uint32(uint32(d.Milliseconds())),
+	}
+	resp := &hadoop.CedeActiveResponseProto{}
+
+	err := c.conn.Execute("cedeActive", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// GracefulFailover requests that the ZKFC coordinate a failover which makes
+// its namenode active. It returns once the failover is complete.
+func (c *ZKFCClient) GracefulFailover() error {
+	req := &hadoop.GracefulFailoverRequestProto{}
+	resp := &hadoop.GracefulFailoverResponseProto{}
+
+	err := c.conn.Execute("gracefulFailover", req, resp)
+	if err != nil {
+		return interpretException(err)
+	}
+
+	return nil
+}
+
+// Close terminates the connection to the ZKFC.
+func (c *ZKFCClient) Close() error {
+	return c.conn.Close()
+}
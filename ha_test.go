@@ -0,0 +1,65 @@
+package hdfs
+
+import (
+	"os/user"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getHAServiceClient(t *testing.T) *HAServiceClient {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	options := ClientOptionsFromConf(conf)
+	if options.Addresses == nil {
+		t.Fatal("Missing namenode addresses in ambient config")
+	}
+
+	u, err := user.Current()
+	require.NoError(t, err)
+
+	// The HA service protocol is also served on the regular RPC port.
+	options.Addresses = options.Addresses[:1]
+	if options.KerberosClient != nil {
+		options.KerberosClient = getKerberosClient(t, u.Username)
+	} else {
+		options.User = u.Username
+	}
+
+	client, err := NewHAServiceClient(options)
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestHAServiceStatus(t *testing.T) {
+	client := getHAServiceClient(t)
+	defer client.Close()
+
+	status, err := client.ServiceStatus()
+	require.NoError(t, err)
+	assert.Equal(t, HAServiceActive, status.State)
+	assert.Equal(t, "active", status.State.String())
+}
+
+func TestHAMonitorHealth(t *testing.T) {
+	client := getHAServiceClient(t)
+	defer client.Close()
+
+	err := client.MonitorHealth()
+	assert.NoError(t, err)
+}
+
+func TestHAServiceClientRequiresOneAddress(t *testing.T) {
+	_, err := NewHAServiceClient(ClientOptions{
+		Addresses: []string{"nn1:8020", "nn2:8020"},
+		User:      "gohdfs1",
+	})
+
+	assert.Error(t, err)
+}
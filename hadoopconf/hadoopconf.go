@@ -130,3 +130,57 @@ func (conf HadoopConf) Namenodes() []string {
 	sort.Strings(keys)
 	return keys
 }
+
+// Nameservices returns the logical nameservices listed in dfs.nameservices.
+func (conf HadoopConf) Nameservices() []string {
+	return splitList(conf["dfs.nameservices"])
+}
+
+// HANamenodes returns the IDs of the namenodes in the given nameservice, as
+// listed in dfs.ha.namenodes.<nameservice>.
+func (conf HadoopConf) HANamenodes(nameservice string) []string {
+	return splitList(conf["dfs.ha.namenodes."+nameservice])
+}
+
+// NamenodeServiceAddress returns the address of the service RPC server for the
+// given namenode in an HA nameservice. This is the address used by
+// administrative tools and the datanodes, and is determined by
+// dfs.namenode.servicerpc-address.<nameservice>.<namenode>, falling back to
+// dfs.namenode.rpc-address.<nameservice>.<namenode>.
+//
+// If no address is configured, it returns an empty string.
+func (conf HadoopConf) NamenodeServiceAddress(nameservice, namenode string) string {
+	suffix := nameservice + "." + namenode
+	if addr := conf["dfs.namenode.servicerpc-address."+suffix]; addr != "" {
+		return addr
+	}
+
+	return conf["dfs.namenode.rpc-address."+suffix]
+}
+
+// ProxyUsers returns the users that each user is allowed to impersonate, as
+// listed in hadoop.proxyuser.<user>.users. Group-based rules
+// (hadoop.proxyuser.<user>.groups) are ignored.
+func (conf HadoopConf) ProxyUsers() map[string][]string {
+	res := make(map[string][]string)
+	for key, value := range conf {
+		if strings.HasPrefix(key, "hadoop.proxyuser.") && strings.HasSuffix(key, ".users") {
+			user := strings.TrimSuffix(strings.TrimPrefix(key, "hadoop.proxyuser."), ".users")
+			res[user] = splitList(value)
+		}
+	}
+
+	return res
+}
+
+func splitList(value string) []string {
+	var res []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
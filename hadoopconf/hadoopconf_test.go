@@ -35,3 +35,32 @@ func TestConfFallback(t *testing.T) {
 	os.Setenv("HADOOP_HOME", oldHome)
 	os.Setenv("HADOOP_CONF_DIR", oldConfDir)
 }
+
+func TestHANamenodes(t *testing.T) {
+	conf, err := Load("testdata/conf")
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, []string{"tests"}, conf.Nameservices())
+	assert.EqualValues(t, []string{"nn1", "nn2"}, conf.HANamenodes("mycluster"))
+	assert.Nil(t, conf.HANamenodes("tests"))
+
+	assert.Equal(t, "namenode1:8020", conf.NamenodeServiceAddress("mycluster", "nn1"))
+	assert.Equal(t, "namenode2:8020", conf.NamenodeServiceAddress("mycluster", "nn2"))
+	assert.Equal(t, "", conf.NamenodeServiceAddress("mycluster", "nn3"))
+
+	conf["dfs.namenode.servicerpc-address.mycluster.nn1"] = "namenode1:8040"
+	assert.Equal(t, "namenode1:8040", conf.NamenodeServiceAddress("mycluster", "nn1"))
+}
+
+func TestProxyUsers(t *testing.T) {
+	conf := HadoopConf{
+		"hadoop.proxyuser.httpfs.users":  "*",
+		"hadoop.proxyuser.gateway.users": "foo, bar",
+		"hadoop.proxyuser.gateway.hosts": "*",
+	}
+
+	assert.EqualValues(t, map[string][]string{
+		"httpfs":  {"*"},
+		"gateway": {"foo", "bar"},
+	}, conf.ProxyUsers())
+}
@@ -0,0 +1,92 @@
+package hdfs
+
+import (
+	"errors"
+
+	"github.com/colinmarc/hdfs/v2/internal/transfer"
+)
+
+const defaultHedgedReadPoolSize = 16
+
+// HedgedReadMetrics counts the hedged reads performed by a Client. See
+// ClientOptions.HedgedReadThreshold.
+type HedgedReadMetrics struct {
+	// Ops is the number of hedged reads that were started, because a read
+	// took longer than the threshold.
+	Ops int64
+	// Wins is the number of hedged reads that finished before the reads
+	// started before them.
+	Wins int64
+	// Rejected is the number of hedged reads that weren't started, because
+	// HedgedReadPoolSize were already in flight.
+	Rejected int64
+}
+
+// HedgedReadMetrics returns the hedged read counters for the client. They are
+// all zero if hedged reads are disabled.
+func (c *Client) HedgedReadMetrics() HedgedReadMetrics {
+	if c.hedgedReads == nil {
+		return HedgedReadMetrics{}
+	}
+
+	stats := c.hedgedReads.Stats()
+	return HedgedReadMetrics{
+		Ops:      stats.Ops,
+		Wins:     stats.Wins,
+		Rejected: stats.Rejected,
+	}
+}
+
+// hedgedReadAt implements readRange with hedged reads, reading each block's
+// share of b with a separate transfer.HedgedRead.
+func (f *FileReader) hedgedReadAt(b []byte, off int64) (int, error) {
+	end := off + int64(len(b))
+	pos := off
+	for pos < end {
+		var hr *transfer.HedgedRead
+		var start, blockEnd int64
+		for _, block := range f.blocks {
+			start = int64(block.GetOffset())
+			blockEnd = start + int64(block.GetB().GetNumBytes())
+			if start <= pos && pos < blockEnd {
+				hr = &transfer.HedgedRead{
+					ClientName:          f.client.namenode.ClientName,
+					Block:               block,
+					UseDatanodeHostname: f.client.options.UseDatanodeHostname,
+					PeerCache:           f.client.peerCache,
+					ShortCircuit:        f.client.shortCircuit,
+					Threshold:           f.client.options.HedgedReadThreshold,
+					Pool:                f.client.hedgedReads,
+					Deadline:            f.deadline,
+				}
+
+				break
+			}
+		}
+
+		if hr == nil {
+			return int(pos - off), errors.New("invalid offset")
+		}
+
+		dialFunc, err := f.client.wrapDatanodeDial(
+			f.client.options.DatanodeDialFunc,
+			hr.Block.GetBlockToken())
+		if err != nil {
+			return int(pos - off), err
+		}
+
+		hr.DialFunc = dialFunc
+		if blockEnd > end {
+			blockEnd = end
+		}
+
+		_, err = hr.ReadAt(b[pos-off:blockEnd-off], pos-start)
+		if err != nil {
+			return int(pos - off), err
+		}
+
+		pos = blockEnd
+	}
+
+	return len(b), nil
+}
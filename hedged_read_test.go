@@ -0,0 +1,95 @@
+package hdfs
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgedReadOptionsFromConf(t *testing.T) {
+	options := ClientOptionsFromConf(hadoopconf.HadoopConf{})
+	assert.Zero(t, options.HedgedReadThreshold)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.hedged.read.threadpool.size": "4",
+	})
+	assert.Equal(t, 500*time.Millisecond, options.HedgedReadThreshold)
+	assert.Equal(t, 4, options.HedgedReadPoolSize)
+
+	options = ClientOptionsFromConf(hadoopconf.HadoopConf{
+		"dfs.client.hedged.read.threadpool.size":  "4",
+		"dfs.client.hedged.read.threshold.millis": "50",
+	})
+	assert.Equal(t, 50*time.Millisecond, options.HedgedReadThreshold)
+}
+
+func getHedgedReadClient(t *testing.T, dialDelay time.Duration) *Client {
+	options := getClient(t).options
+	options.HedgedReadThreshold = 10 * time.Millisecond
+
+	dial := options.DatanodeDialFunc
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	// Delay the first connection, so that a hedged read is started if there
+	// is another replica.
+	var dialed int32
+	options.DatanodeDialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if atomic.CompareAndSwapInt32(&dialed, 0, 1) {
+			time.Sleep(dialDelay)
+		}
+
+		return dial(ctx, network, address)
+	}
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestFileHedgedReadAt(t *testing.T) {
+	client := getHedgedReadClient(t, 100*time.Millisecond)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	buf := make([]byte, len(testStr))
+	n, err := file.ReadAt(buf, testStrOff)
+	require.NoError(t, err)
+	assert.Equal(t, len(testStr), n)
+	assert.Equal(t, testStr, string(buf))
+
+	buf = make([]byte, len(testStr3))
+	n, err = file.ReadAt(buf, testStr3Off)
+	require.NoError(t, err)
+	assert.Equal(t, len(testStr3), n)
+	assert.Equal(t, testStr3, string(buf))
+
+	// The offset for Read is unchanged.
+	off, err := file.Seek(0, 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, off)
+}
+
+func TestFileHedgedReadAtEOF(t *testing.T) {
+	client := getHedgedReadClient(t, 0)
+
+	file, err := client.Open("/_test/foo.txt")
+	require.NoError(t, err)
+
+	buf := make([]byte, 10)
+	n, err := file.ReadAt(buf, 1)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "ar\n", string(buf[:n]))
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,233 @@
+// Package clientcache implements the cache of per-user clients shared by the
+// gateways (WebHDFS, S3 and SFTP), which act on behalf of many HDFS users at
+// once.
+package clientcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+const (
+	// DefaultCapacity is the default number of clients kept by a Cache.
+	DefaultCapacity = 64
+	// DefaultExpiry is the default time an unused client is kept for.
+	DefaultExpiry = 10 * time.Minute
+)
+
+var errClosed = errors.New("client cache is closed")
+
+// Cache keeps an hdfs.Client for each user, so that each request doesn't have
+// to connect to the namenode again.
+//
+// Clients that are in use are never closed. Once a client is released by
+// every caller, it's closed after it has been idle for the expiry, or earlier,
+// oldest first, if the cache holds more than its capacity. Eviction happens
+// as the cache is used, rather than in the background.
+//
+// Cache is safe for concurrent use.
+type Cache struct {
+	options  hdfs.ClientOptions
+	capacity int
+	expiry   time.Duration
+
+	clients map[string]*entry
+	closed  bool
+	lock    sync.Mutex
+}
+
+type entry struct {
+	client    *hdfs.Client
+	refs      int
+	idleSince time.Time
+
+	// ready is closed once the client has been created, or creating it has
+	// failed with err.
+	ready chan struct{}
+	err   error
+}
+
+// New returns a Cache that creates clients with the given options, keeping up
+// to capacity clients, each for up to expiry after it was last used.
+//
+// If options.KerberosClient is set, each Client authenticates as the kerberos
+// principal and impersonates the user with ProxyUser, so the principal must be
+// allowed to do that by the namenode. Otherwise, User is simply set to the
+// name of the user.
+func New(options hdfs.ClientOptions, capacity int, expiry time.Duration) *Cache {
+	return &Cache{
+		options:  options,
+		capacity: capacity,
+		expiry:   expiry,
+		clients:  make(map[string]*entry),
+	}
+}
+
+// Get returns a Client acting as the given user, creating it if necessary.
+// The caller must call release once it's done with the client, and must not
+// use the client afterwards.
+//
+// Clients are created and closed without holding the cache's lock, so that a
+// slow namenode connection for one user doesn't hold up the others. Callers
+// that want the same user's client while it's being created wait for it.
+func (cc *Cache) Get(user string) (client *hdfs.Client, release func(), err error) {
+	cc.lock.Lock()
+	if cc.closed {
+		cc.lock.Unlock()
+		return nil, nil, errClosed
+	}
+
+	evicted := cc.evict(time.Now())
+	e, ok := cc.clients[user]
+	if !ok {
+		e = &entry{ready: make(chan struct{})}
+		cc.clients[user] = e
+	}
+
+	e.refs++
+	cc.lock.Unlock()
+	closeClients(evicted)
+
+	if !ok {
+		cc.create(user, e)
+	} else {
+		<-e.ready
+	}
+
+	if e.err != nil {
+		cc.release(e)
+		return nil, nil, e.err
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() { cc.release(e) })
+	}
+
+	return e.client, release, nil
+}
+
+// create creates the client for a new entry, and removes the entry again if
+// that fails.
+func (cc *Cache) create(user string, e *entry) {
+	defer close(e.ready)
+
+	options := cc.options
+	if options.KerberosClient != nil {
+		if user != options.KerberosClient.Credentials.UserName() {
+			options.ProxyUser = user
+		}
+	} else {
+		options.User = user
+	}
+
+	c, err := hdfs.NewClient(options)
+
+	cc.lock.Lock()
+	if err == nil && cc.closed {
+		defer c.Close()
+		err = errClosed
+	}
+
+	if err != nil {
+		e.err = err
+		if cc.clients[user] == e {
+			delete(cc.clients, user)
+		}
+	} else {
+		e.client = c
+	}
+
+	cc.lock.Unlock()
+}
+
+func (cc *Cache) release(e *entry) {
+	cc.lock.Lock()
+	now := time.Now()
+	e.refs--
+	e.idleSince = now
+	evicted := cc.evict(now)
+	cc.lock.Unlock()
+
+	closeClients(evicted)
+}
+
+// evict removes the clients that have expired, and then the idle clients that
+// have been unused the longest, until the cache is within its capacity. It
+// returns the removed clients, which the caller should close after unlocking
+// the cache.
+func (cc *Cache) evict(now time.Time) []*hdfs.Client {
+	var evicted []*hdfs.Client
+	for user, e := range cc.clients {
+		if e.refs == 0 && now.Sub(e.idleSince) >= cc.expiry {
+			evicted = append(evicted, e.client)
+			delete(cc.clients, user)
+		}
+	}
+
+	for len(cc.clients) > cc.capacity {
+		var oldest string
+		var oldestEntry *entry
+		for user, e := range cc.clients {
+			if e.refs == 0 && (oldestEntry == nil || e.idleSince.Before(oldestEntry.idleSince)) {
+				oldest = user
+				oldestEntry = e
+			}
+		}
+
+		// Every client is in use.
+		if oldestEntry == nil {
+			break
+		}
+
+		evicted = append(evicted, oldestEntry.client)
+		delete(cc.clients, oldest)
+	}
+
+	return evicted
+}
+
+func closeClients(clients []*hdfs.Client) {
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+// Len returns the number of clients in the cache, including those still being
+// created.
+func (cc *Cache) Len() int {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	return len(cc.clients)
+}
+
+// Close closes all the clients in the cache, including those still in use.
+// Get fails afterwards, as does any Get still waiting for a client to be
+// created.
+func (cc *Cache) Close() error {
+	cc.lock.Lock()
+	var clients []*hdfs.Client
+	for user, e := range cc.clients {
+		if e.client != nil {
+			clients = append(clients, e.client)
+		}
+
+		delete(cc.clients, user)
+	}
+
+	cc.closed = true
+	cc.lock.Unlock()
+
+	var firstErr error
+	for _, c := range clients {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,158 @@
+package clientcache
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOptions returns client options for a fake namenode, which accepts the
+// connection handshake and then ignores everything.
+func testOptions() hdfs.ClientOptions {
+	return hdfs.ClientOptions{
+		Addresses: []string{"namenode:8020"},
+		NamenodeDialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go io.Copy(io.Discard, server)
+			return client, nil
+		},
+		DatanodeConnCacheSize: -1,
+	}
+}
+
+func TestCacheReusesClients(t *testing.T) {
+	cc := New(testOptions(), 2, time.Hour)
+	defer cc.Close()
+
+	c1, release1, err := cc.Get("foo")
+	require.NoError(t, err)
+	release1()
+	release1()
+
+	c2, release2, err := cc.Get("foo")
+	require.NoError(t, err)
+	defer release2()
+
+	assert.Same(t, c1, c2)
+	assert.Equal(t, "foo", c1.User())
+	assert.Equal(t, 1, cc.Len())
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cc := New(testOptions(), 2, time.Hour)
+	defer cc.Close()
+
+	for _, user := range []string{"foo", "bar", "baz"} {
+		_, release, err := cc.Get(user)
+		require.NoError(t, err)
+		release()
+	}
+
+	assert.Equal(t, 2, cc.Len())
+	assert.NotContains(t, cc.clients, "foo")
+}
+
+func TestCacheKeepsClientsInUse(t *testing.T) {
+	cc := New(testOptions(), 1, 0)
+	defer cc.Close()
+
+	foo, releaseFoo, err := cc.Get("foo")
+	require.NoError(t, err)
+
+	_, releaseBar, err := cc.Get("bar")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cc.Len())
+
+	releaseBar()
+	assert.Equal(t, 1, cc.Len())
+
+	foo2, releaseFoo2, err := cc.Get("foo")
+	require.NoError(t, err)
+	assert.Same(t, foo, foo2)
+
+	releaseFoo()
+	releaseFoo2()
+	assert.Equal(t, 0, cc.Len())
+}
+
+func TestCacheExpiresIdleClients(t *testing.T) {
+	cc := New(testOptions(), 10, time.Millisecond)
+	defer cc.Close()
+
+	_, release, err := cc.Get("foo")
+	require.NoError(t, err)
+	release()
+
+	time.Sleep(5 * time.Millisecond)
+	_, release, err = cc.Get("bar")
+	require.NoError(t, err)
+	defer release()
+
+	assert.NotContains(t, cc.clients, "foo")
+	assert.Equal(t, 1, cc.Len())
+}
+
+func TestCacheCreatesClientsConcurrently(t *testing.T) {
+	options := testOptions()
+	dial := options.NamenodeDialFunc
+	dialing := make(chan struct{})
+	unblock := make(chan struct{})
+	var once sync.Once
+	options.NamenodeDialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		first := false
+		once.Do(func() { first = true })
+		if first {
+			close(dialing)
+			<-unblock
+		}
+
+		return dial(ctx, network, addr)
+	}
+
+	cc := New(options, 10, time.Hour)
+	defer cc.Close()
+
+	// The first client blocks connecting to the namenode.
+	slow := make(chan *hdfs.Client, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			c, release, err := cc.Get("slow")
+			if err == nil {
+				defer release()
+			}
+
+			slow <- c
+		}()
+	}
+
+	<-dialing
+	_, release, err := cc.Get("fast")
+	require.NoError(t, err)
+	release()
+
+	close(unblock)
+	c1, c2 := <-slow, <-slow
+	require.NotNil(t, c1)
+	assert.Same(t, c1, c2)
+	assert.Equal(t, 2, cc.Len())
+}
+
+func TestCacheClosed(t *testing.T) {
+	cc := New(testOptions(), 1, time.Hour)
+
+	_, release, err := cc.Get("foo")
+	require.NoError(t, err)
+
+	require.NoError(t, cc.Close())
+	release()
+
+	_, _, err = cc.Get("foo")
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+// Package exception maps the java exceptions returned by HDFS, over RPC or
+// WebHDFS, to Go errors, so that both clients report them the same way.
+package exception
+
+import (
+	"os"
+	"syscall"
+)
+
+// The java exception classes that have a Go equivalent.
+const (
+	FileNotFound          = "java.io.FileNotFoundException"
+	AccessControl         = "org.apache.hadoop.security.AccessControlException"
+	PathIsNotEmptyDir     = "org.apache.hadoop.fs.PathIsNotEmptyDirectoryException"
+	FileAlreadyExists     = "org.apache.hadoop.fs.FileAlreadyExistsException"
+	AlreadyBeingCreated   = "org.apache.hadoop.hdfs.protocol.AlreadyBeingCreatedException"
+	HadoopIllegalArgument = "org.apache.hadoop.HadoopIllegalArgumentException"
+)
+
+// Interpret returns the Go error for the given java exception class, or nil
+// if there isn't one.
+func Interpret(class string) error {
+	switch class {
+	case FileNotFound:
+		return os.ErrNotExist
+	case AccessControl:
+		return os.ErrPermission
+	case PathIsNotEmptyDir:
+		return syscall.ENOTEMPTY
+	case FileAlreadyExists:
+		return os.ErrExist
+	case HadoopIllegalArgument:
+		return os.ErrInvalid
+	default:
+		return nil
+	}
+}
+
+// InterpretCreate is like Interpret, but for errors from creating or
+// appending to a file. A file that is already open for writing is reported
+// as os.ErrExist.
+func InterpretCreate(class string) error {
+	if class == AlreadyBeingCreated {
+		return os.ErrExist
+	}
+
+	return Interpret(class)
+}
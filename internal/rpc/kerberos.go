@@ -74,6 +74,7 @@ func (c *NamenodeConnection) doKerberosHandshake() error {
 			c.transport = &saslTransport{
 				basicTransport: basicTransport{
 					clientID: c.ClientID,
+					protocol: c.protocol,
 				},
 				sessionKey: sessionKey,
 				privacy:    qop == sasl.QopPrivacy,
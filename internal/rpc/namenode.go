@@ -19,12 +19,18 @@ const (
 	serviceClass          byte = 0x0
 	noneAuthProtocol      byte = 0x0
 	saslAuthProtocol      byte = 0xdf
-	protocolClass              = "org.apache.hadoop.hdfs.protocol.ClientProtocol"
 	protocolClassVersion       = 1
 	handshakeCallID            = -3
 	standbyExceptionClass      = "org.apache.hadoop.ipc.StandbyException"
 )
 
+// These are the RPC protocols that a NamenodeConnection can speak.
+const (
+	ClientProtocol    = "org.apache.hadoop.hdfs.protocol.ClientProtocol"
+	HAServiceProtocol = "org.apache.hadoop.ha.HAServiceProtocol"
+	ZKFCProtocol      = "org.apache.hadoop.ha.ZKFCProtocol"
+)
+
 const (
 	backoffDuration    = 5 * time.Second
 	leaseRenewInterval = 1 * time.Second
@@ -36,6 +42,8 @@ type NamenodeConnection struct {
 	ClientName string
 	User       string
 
+	protocol         string
+	realUser         string
 	currentRequestID int32
 
 	kerberosClient               *krb.Client
@@ -75,6 +83,15 @@ type NamenodeConnectionOptions struct {
 	// setup (for example: 'nn/_HOST@EXAMPLE.COM'). It is required if
 	// KerberosClient is provided.
 	KerberosServicePrincipleName string
+	// ProxyUser specifies a user to impersonate. If set, the connection
+	// authenticates as User (or the kerberos principal), but acts as
+	// ProxyUser. The namenode must be configured to allow this, using the
+	// hadoop.proxyuser.* properties.
+	ProxyUser string
+	// Protocol specifies the RPC protocol to speak, for example
+	// HAServiceProtocol. If empty, ClientProtocol is used. File leases are only
+	// renewed for connections using ClientProtocol.
+	Protocol string
 }
 
 type namenodeHost struct {
@@ -102,6 +119,17 @@ func NewNamenodeConnection(options NamenodeConnectionOptions) (*NamenodeConnecti
 		return nil, errors.New("user not specified")
 	}
 
+	var realUser string
+	if options.ProxyUser != "" {
+		realUser = user
+		user = options.ProxyUser
+	}
+
+	protocol := options.Protocol
+	if protocol == "" {
+		protocol = ClientProtocol
+	}
+
 	// The ClientID is reused here both in the RPC headers (which requires a
 	// "globally unique" ID) and as the "client name" in various requests.
 	clientId := newClientID()
@@ -110,13 +138,16 @@ func NewNamenodeConnection(options NamenodeConnectionOptions) (*NamenodeConnecti
 		ClientName: "go-hdfs-" + string(clientId),
 		User:       user,
 
+		protocol: protocol,
+		realUser: realUser,
+
 		kerberosClient:               options.KerberosClient,
 		kerberosServicePrincipleName: options.KerberosServicePrincipleName,
 		kerberosRealm:                realm,
 
 		dialFunc:  options.DialFunc,
 		hostList:  hostList,
-		transport: &basicTransport{clientID: clientId},
+		transport: &basicTransport{clientID: clientId, protocol: protocol},
 
 		done: make(chan struct{}),
 	}
@@ -127,7 +158,9 @@ func NewNamenodeConnection(options NamenodeConnectionOptions) (*NamenodeConnecti
 	}
 
 	// Periodically renew any file leases.
-	go c.renewLeases()
+	if protocol == ClientProtocol {
+		go c.renewLeases()
+	}
 
 	return c, nil
 }
@@ -268,7 +301,7 @@ func (c *NamenodeConnection) doNamenodeHandshake() error {
 	}
 
 	rrh := newRPCRequestHeader(handshakeCallID, c.ClientID)
-	cc := newConnectionContext(c.User, c.kerberosRealm)
+	cc := newConnectionContext(c.User, c.realUser, c.kerberosRealm, c.protocol)
 	packet, err := makeRPCPacket(rrh, cc)
 	if err != nil {
 		return err
@@ -321,23 +354,35 @@ func newRPCRequestHeader(id int32, clientID []byte) *hadoop.RpcRequestHeaderProt
 	}
 }
 
-func newRequestHeader(methodName string) *hadoop.RequestHeaderProto {
+func newRequestHeader(methodName, protocol string) *hadoop.RequestHeaderProto {
 	return &hadoop.RequestHeaderProto{
 		MethodName:                 proto.String(methodName),
-		DeclaringClassProtocolName: proto.String(protocolClass),
+		DeclaringClassProtocolName: proto.String(protocol),
 		ClientProtocolVersion:      proto.Uint64(uint64(protocolClassVersion)),
 	}
 }
 
-func newConnectionContext(user, kerberosRealm string) *hadoop.IpcConnectionContextProto {
-	if kerberosRealm != "" {
-		user = user + "@" + kerberosRealm
+func newConnectionContext(user, realUser, kerberosRealm, protocol string) *hadoop.IpcConnectionContextProto {
+	// When impersonating another user, the kerberos principal belongs to the
+	// real user.
+	userInfo := &hadoop.UserInformationProto{}
+	if realUser != "" {
+		if kerberosRealm != "" {
+			realUser = realUser + "@" + kerberosRealm
+		}
+
+		userInfo.EffectiveUser = proto.String(user)
+		userInfo.RealUser = proto.String(realUser)
+	} else {
+		if kerberosRealm != "" {
+			user = user + "@" + kerberosRealm
+		}
+
+		userInfo.EffectiveUser = proto.String(user)
 	}
 
 	return &hadoop.IpcConnectionContextProto{
-		UserInfo: &hadoop.UserInformationProto{
-			EffectiveUser: proto.String(user),
-		},
-		Protocol: proto.String(protocolClass),
+		UserInfo: userInfo,
+		Protocol: proto.String(protocol),
 	}
 }
@@ -0,0 +1,28 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConnectionContext(t *testing.T) {
+	cc := newConnectionContext("foo", "", "", ClientProtocol)
+	assert.Equal(t, "foo", cc.GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "", cc.GetUserInfo().GetRealUser())
+	assert.Equal(t, ClientProtocol, cc.GetProtocol())
+
+	cc = newConnectionContext("foo", "", "EXAMPLE.COM", ClientProtocol)
+	assert.Equal(t, "foo@EXAMPLE.COM", cc.GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "", cc.GetUserInfo().GetRealUser())
+}
+
+func TestNewConnectionContextProxyUser(t *testing.T) {
+	cc := newConnectionContext("foo", "bar", "", ClientProtocol)
+	assert.Equal(t, "foo", cc.GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "bar", cc.GetUserInfo().GetRealUser())
+
+	cc = newConnectionContext("foo", "bar", "EXAMPLE.COM", ClientProtocol)
+	assert.Equal(t, "foo", cc.GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "bar@EXAMPLE.COM", cc.GetUserInfo().GetRealUser())
+}
@@ -19,6 +19,8 @@ type transport interface {
 type basicTransport struct {
 	// clientID is the client ID of this writer.
 	clientID []byte
+	// protocol is the RPC protocol named in each request.
+	protocol string
 }
 
 // writeRequest writes an RPC message.
@@ -35,7 +37,7 @@ type basicTransport struct {
 // +-----------------------------------------------------------+
 func (t *basicTransport) writeRequest(w io.Writer, method string, requestID int32, req proto.Message) error {
 	rrh := newRPCRequestHeader(requestID, t.clientID)
-	rh := newRequestHeader(method)
+	rh := newRequestHeader(method, t.protocol)
 
 	reqBytes, err := makeRPCPacket(rrh, rh, req)
 	if err != nil {
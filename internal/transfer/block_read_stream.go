@@ -12,7 +12,9 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-var errInvalidChecksum = errors.New("invalid checksum")
+// ErrInvalidChecksum is returned when data read from a datanode doesn't match
+// its checksums.
+var ErrInvalidChecksum = errors.New("invalid checksum")
 
 // blockReadStream implements io.Reader for reading a packet stream for a single
 // block from a single datanode.
@@ -135,7 +137,7 @@ func (s *blockReadStream) validateChecksum(b []byte) error {
 
 	crc := crc32.Checksum(b, s.checksumTab)
 	if crc != checksum {
-		return errInvalidChecksum
+		return ErrInvalidChecksum
 	}
 
 	return nil
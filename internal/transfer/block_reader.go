@@ -25,18 +25,41 @@ type BlockReader struct {
 	Block *hdfs.LocatedBlockProto
 	// Offset is the current read offset in the block.
 	Offset int64
+	// Length is the number of bytes to read, starting at the initial Offset.
+	// If zero, the read continues to the end of the block. Requesting only
+	// what's needed means the datanode doesn't send data that would be thrown
+	// away.
+	Length int64
 	// UseDatanodeHostname specifies whether the datanodes should be connected to
 	// via their hostnames (if true) or IP addresses (if false).
 	UseDatanodeHostname bool
 	// DialFunc is used to connect to the datanodes. If nil, then
 	// (&net.Dialer{}).DialContext is used.
 	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
-
-	datanodes *datanodeFailover
-	stream    *blockReadStream
-	conn      net.Conn
-	deadline  time.Time
-	closed    bool
+	// PeerCache, if set, is checked for an idle connection to each datanode
+	// before dialing a new one. Once the requested range has been read in
+	// full, the connection is returned to it.
+	PeerCache *PeerCache
+	// ShortCircuit, if set, is used to read the block directly from the files
+	// of a datanode on the same host, if there is one. If that fails, the
+	// block is read over the network instead.
+	ShortCircuit *ShortCircuit
+
+	// register, if set, is called with each connection taken from the
+	// PeerCache before it's used, so that the caller can close it to cancel
+	// the read, as it can with connections from DialFunc. If it returns an
+	// error, the connection is closed instead.
+	register func(net.Conn) error
+
+	datanodes  *datanodeFailover
+	local      *localReplica
+	triedLocal bool
+	address    string
+	end        int64
+	stream     *blockReadStream
+	conn       net.Conn
+	deadline   time.Time
+	closed     bool
 }
 
 const maxSkip = 65536
@@ -65,9 +88,26 @@ func (br *BlockReader) SetDeadline(t time.Time) error {
 func (br *BlockReader) Read(b []byte) (int, error) {
 	if br.closed {
 		return 0, io.ErrClosedPipe
-	} else if uint64(br.Offset) >= br.Block.GetB().GetNumBytes() {
+	}
+
+	if br.end == 0 {
+		br.end = int64(br.Block.GetB().GetNumBytes())
+		if br.Length > 0 && br.Offset+br.Length < br.end {
+			br.end = br.Offset + br.Length
+		}
+	}
+
+	if br.Offset >= br.end {
 		br.Close()
 		return 0, io.EOF
+	} else if remaining := br.end - br.Offset; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+
+	if br.stream == nil {
+		if n, ok := br.readLocal(b); ok {
+			return n, nil
+		}
 	}
 
 	if br.datanodes == nil {
@@ -126,10 +166,15 @@ func (br *BlockReader) Skip(n int64) error {
 	if n == 0 {
 		return nil
 	}
-	blockSize := int64(br.Block.GetB().GetNumBytes())
 	resultingOffset := br.Offset + n
 
-	if br.stream == nil || n < 0 || n > maxSkip || resultingOffset >= blockSize {
+	// Skipping is free for a local replica.
+	if br.local != nil && n > 0 && resultingOffset < br.end {
+		br.Offset = resultingOffset
+		return nil
+	}
+
+	if br.stream == nil || n < 0 || n > maxSkip || resultingOffset >= br.end {
 		return errors.New("unable to skip")
 	}
 
@@ -141,26 +186,134 @@ func (br *BlockReader) Skip(n int64) error {
 
 		br.stream = nil
 		br.datanodes.recordFailure(err)
+		return err
 	}
 
-	return err
+	br.Offset = resultingOffset
+	return nil
 }
 
 // Close implements io.Closer.
 func (br *BlockReader) Close() error {
+	if br.closed {
+		return nil
+	}
+
 	br.closed = true
+	if br.local != nil {
+		br.local.Close()
+		br.local = nil
+	}
+
 	if br.conn != nil {
-		br.conn.Close()
+		if br.stream == nil || br.Offset < br.end || !br.release() {
+			br.conn.Close()
+		}
+
+		br.conn = nil
 	}
 
 	return nil
 }
 
+// release finishes a read that has reached the end of the requested range,
+// and returns the connection to the PeerCache. It returns false if the
+// connection can't be reused, in which case it should be closed.
+func (br *BlockReader) release() bool {
+	if br.PeerCache == nil {
+		return false
+	}
+
+	// Discard the rest of the last chunk, if we didn't need all of it, and the
+	// empty packet that marks the end of the stream.
+	buf := make([]byte, br.stream.chunkSize)
+	discarded := 0
+	for {
+		n, err := br.stream.Read(buf)
+		discarded += n
+		if err == io.EOF {
+			break
+		} else if err != nil || discarded > maxSkip {
+			return false
+		}
+	}
+
+	// The datanode only keeps the connection open for another operation if we
+	// tell it how the read went.
+	status := hdfs.Status_CHECKSUM_OK
+	if br.stream.checksumTab == nil {
+		status = hdfs.Status_SUCCESS
+	}
+
+	msg, err := makePrefixedMessage(&hdfs.ClientReadStatusProto{Status: status.Enum()})
+	if err != nil {
+		return false
+	}
+
+	_, err = br.conn.Write(msg)
+	if err != nil {
+		return false
+	}
+
+	br.PeerCache.Put(br.address, br.conn)
+	return true
+}
+
+// readLocal tries to read from a local replica of the block, opening it on
+// the first call. It returns false if the block should be read over the
+// network instead, either because there is no local replica, or because
+// reading it failed.
+func (br *BlockReader) readLocal(b []byte) (int, bool) {
+	if br.local == nil {
+		if br.ShortCircuit == nil || br.triedLocal {
+			return 0, false
+		}
+
+		br.triedLocal = true
+		local, err := br.ShortCircuit.open(br.Block)
+		if err != nil {
+			return 0, false
+		}
+
+		br.local = local
+	}
+
+	n, err := br.local.ReadAt(b, br.Offset)
+	if err != nil {
+		br.local.Close()
+		br.local = nil
+		return 0, false
+	}
+
+	br.Offset += int64(n)
+	return n, true
+}
+
 // connectNext pops a datanode from the list based on previous failures, and
 // connects to it.
 func (br *BlockReader) connectNext() error {
 	address := br.datanodes.next()
 
+	if conn := br.PeerCache.Get(address); conn != nil {
+		var err error
+		if br.register != nil {
+			err = br.register(conn)
+		}
+
+		if err == nil {
+			err = br.startRead(conn)
+		}
+
+		if err == nil {
+			br.address = address
+			return nil
+		}
+
+		// The datanode may have closed the connection while it was idle, so
+		// try again with a new one.
+		conn.Close()
+	}
+
 	if br.DialFunc == nil {
 		br.DialFunc = (&net.Dialer{}).DialContext
 	}
@@ -170,6 +323,24 @@ func (br *BlockReader) connectNext() error {
 		return err
 	}
 
+	err = br.startRead(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	br.address = address
+	return nil
+}
+
+// startRead sends the read request on the connection, and sets up the stream
+// to read the response.
+func (br *BlockReader) startRead(conn net.Conn) error {
+	err := conn.SetDeadline(br.deadline)
+	if err != nil {
+		return err
+	}
+
 	err = br.writeBlockReadRequest(conn)
 	if err != nil {
 		return err
@@ -216,18 +387,12 @@ func (br *BlockReader) connectNext() error {
 				err = io.ErrUnexpectedEOF
 			}
 
-			conn.Close()
 			return err
 		}
 	}
 
 	br.stream = stream
 	br.conn = conn
-	err = br.conn.SetDeadline(br.deadline)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -240,7 +405,7 @@ func (br *BlockReader) connectNext() error {
 // |  varint length + OpReadBlockProto                         |
 // +-----------------------------------------------------------+
 func (br *BlockReader) writeBlockReadRequest(w io.Writer) error {
-	needed := br.Block.GetB().GetNumBytes() - uint64(br.Offset)
+	needed := uint64(br.end - br.Offset)
 	op := &hdfs.OpReadBlockProto{
 		Header: &hdfs.ClientOperationHeaderProto{
 			BaseHeader: &hdfs.BaseHeaderProto{
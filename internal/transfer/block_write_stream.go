@@ -55,6 +55,10 @@ type blockWriteStream struct {
 	offset int64
 	closed bool
 
+	checksumType hdfs.ChecksumTypeProto
+	checksumTab  *crc32.Table
+	checksumSize int
+
 	packets chan int
 	seqno   int
 
@@ -62,14 +66,29 @@ type blockWriteStream struct {
 	acksDone        chan struct{}
 	lastPacketSeqno int
 
-	heartbeats chan struct{}
-	writeLock  sync.Mutex
+	// unacked holds the packets that have been sent but not yet acked, so
+	// that they can be sent again to a new pipeline if this one fails.
+	// ackedOffset is the offset in the block up to which packets have been
+	// acked. acked is signaled whenever a packet is acked, or acking stops
+	// because of an error.
+	unacked     []outboundPacket
+	ackedOffset int64
+	lastSent    bool
+	ackStopped  bool
+	ackLock     sync.Mutex
+	acked       *sync.Cond
+
+	heartbeats        chan struct{}
+	heartbeatsStopped bool
+	packetsClosed     bool
+	writeLock         sync.Mutex
 }
 
 type outboundPacket struct {
 	seqno     int
 	offset    int64
 	last      bool
+	syncBlock bool
 	checksums []byte
 	data      []byte
 }
@@ -86,14 +105,26 @@ func (ae ackError) Error() string {
 
 var ErrInvalidSeqno = errors.New("invalid ack sequence number")
 
-func newBlockWriteStream(conn io.ReadWriter, offset int64) *blockWriteStream {
+func newBlockWriteStream(conn io.ReadWriter, offset int64, checksumType hdfs.ChecksumTypeProto) *blockWriteStream {
 	s := &blockWriteStream{
-		conn:       conn,
-		offset:     offset,
-		seqno:      1,
-		packets:    make(chan int, maxPacketsInQueue),
-		acksDone:   make(chan struct{}),
-		heartbeats: make(chan struct{}),
+		conn:         conn,
+		offset:       offset,
+		ackedOffset:  offset,
+		seqno:        1,
+		packets:      make(chan int, maxPacketsInQueue),
+		acksDone:     make(chan struct{}),
+		heartbeats:   make(chan struct{}),
+		checksumType: checksumType,
+	}
+	s.acked = sync.NewCond(&s.ackLock)
+
+	switch checksumType {
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32:
+		s.checksumTab = crc32.IEEETable
+		s.checksumSize = 4
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32C:
+		s.checksumTab = crc32.MakeTable(crc32.Castagnoli)
+		s.checksumSize = 4
 	}
 
 	// Send idle heartbeats every 30 seconds.
@@ -102,25 +133,37 @@ func newBlockWriteStream(conn io.ReadWriter, offset int64) *blockWriteStream {
 	// Ack packets in the background.
 	go func() {
 		s.ackPackets()
+		s.stopAcks()
 		close(s.acksDone)
 	}()
 
 	return s
 }
 
-// func newBlockWriteStreamForRecovery(conn io.ReadWriter, oldWriteStream *blockWriteStream) {
-// 	s := &blockWriteStream{
-// 		conn: conn,
-// 		buf: oldWriteStream.buf,
-// 		packets: oldWriteStream.packets,
-// 		offset: oldWriteStream.offset,
-// 		seqno: oldWriteStream.seqno,
-// 		packets
-// 	}
+// newBlockWriteStreamForRecovery creates a stream on a new pipeline, to take
+// over from one that failed. It sends any packets that weren't acked on the
+// old pipeline again, and carries over any buffered data. If the returned
+// error is non-nil, the returned stream has also failed, and can itself be
+// recovered.
+func newBlockWriteStreamForRecovery(conn io.ReadWriter, old *blockWriteStream) (*blockWriteStream, error) {
+	s := newBlockWriteStream(conn, old.offset, old.checksumType)
+	s.seqno = old.seqno
+	s.ackedOffset = old.ackedOffset
+	s.buf.Write(old.buf.Bytes())
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	for _, packet := range old.unacked {
+		s.enqueue(packet)
+		err := s.writePacket(packet)
+		if err != nil {
+			return s, err
+		}
+	}
 
-// 	go s.ackPackets()
-// 	return s
-// }
+	return s, nil
+}
 
 func (s *blockWriteStream) Write(b []byte) (int, error) {
 	if s.closed {
@@ -145,33 +188,38 @@ func (s *blockWriteStream) finish() error {
 	s.closed = true
 
 	// Stop sending heartbeats.
-	close(s.heartbeats)
+	s.stopHeartbeats()
 
 	if err := s.getAckError(); err != nil {
 		return err
 	}
 
-	if err := s.flush(true); err != nil {
-		return err
-	}
+	// If this stream is recovering a pipeline that failed while it was
+	// finishing, the last packet has already been sent again.
+	if !s.lastSent {
+		if err := s.flush(true); err != nil {
+			return err
+		}
 
-	// The last packet has no data; it's just a marker that the block is finished.
-	lastPacket := outboundPacket{
-		seqno:     s.seqno,
-		offset:    s.offset,
-		last:      true,
-		checksums: []byte{},
-		data:      []byte{},
-	}
-	s.packets <- lastPacket.seqno
+		// The last packet has no data; it's just a marker that the block is
+		// finished.
+		lastPacket := outboundPacket{
+			seqno:     s.seqno,
+			offset:    s.offset,
+			last:      true,
+			checksums: []byte{},
+			data:      []byte{},
+		}
+		s.enqueue(lastPacket)
 
-	err := s.writePacket(lastPacket)
-	if err != nil {
-		return err
+		err := s.writePacket(lastPacket)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Wait for the ack loop to finish.
-	close(s.packets)
+	s.closePackets()
 	<-s.acksDone
 
 	// Check one more time for any ack errors.
@@ -182,6 +230,40 @@ func (s *blockWriteStream) finish() error {
 	return nil
 }
 
+// abort stops the stream after a failure, once its connection has been
+// closed. Afterwards, unacked holds the packets that need to be sent again.
+func (s *blockWriteStream) abort() {
+	s.closed = true
+	s.stopHeartbeats()
+	s.closePackets()
+	<-s.acksDone
+}
+
+func (s *blockWriteStream) stopHeartbeats() {
+	if !s.heartbeatsStopped {
+		s.heartbeatsStopped = true
+		close(s.heartbeats)
+	}
+}
+
+func (s *blockWriteStream) closePackets() {
+	if !s.packetsClosed {
+		s.packetsClosed = true
+		close(s.packets)
+	}
+}
+
+// enqueue records that a packet is about to be sent, so that the ack loop
+// expects an ack for it.
+func (s *blockWriteStream) enqueue(p outboundPacket) {
+	s.ackLock.Lock()
+	s.unacked = append(s.unacked, p)
+	s.lastSent = s.lastSent || p.last
+	s.ackLock.Unlock()
+
+	s.packets <- p.seqno
+}
+
 // flush parcels out the buffered bytes into packets, which it then flushes to
 // the datanode. We keep around a reference to the packet, in case the ack
 // fails, and we need to send it again later.
@@ -190,20 +272,99 @@ func (s *blockWriteStream) flush(force bool) error {
 	defer s.writeLock.Unlock()
 
 	for s.buf.Len() > 0 && (force || s.buf.Len() >= outboundPacketSize) {
+		err := s.sendPacket(s.makePacket())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sync flushes all the buffered bytes, and then waits for every packet sent
+// so far to be acked. If syncBlock is true, the last packet asks the
+// datanodes to sync the block to disk before acking it; if there are no
+// buffered bytes, an empty packet is sent for that purpose.
+func (s *blockWriteStream) sync(syncBlock bool) error {
+	if s.closed {
+		return io.ErrClosedPipe
+	}
+
+	if err := s.getAckError(); err != nil {
+		return err
+	}
+
+	s.writeLock.Lock()
+	sent := false
+	for s.buf.Len() > 0 {
 		packet := s.makePacket()
-		s.packets <- packet.seqno
-		s.offset += int64(len(packet.data))
-		s.seqno++
+		packet.syncBlock = syncBlock && s.buf.Len() == 0
+		err := s.sendPacket(packet)
+		if err != nil {
+			s.writeLock.Unlock()
+			return err
+		}
 
-		err := s.writePacket(packet)
+		sent = true
+	}
+
+	if syncBlock && !sent {
+		err := s.sendPacket(outboundPacket{
+			seqno:     s.seqno,
+			offset:    s.offset,
+			syncBlock: true,
+			checksums: []byte{},
+			data:      []byte{},
+		})
 		if err != nil {
+			s.writeLock.Unlock()
 			return err
 		}
 	}
+	s.writeLock.Unlock()
+
+	return s.waitForAcks()
+}
+
+// sendPacket writes the packet out to the datanode, advancing the offset and
+// seqno past it. It must be called with writeLock held.
+func (s *blockWriteStream) sendPacket(p outboundPacket) error {
+	s.enqueue(p)
+	s.offset += int64(len(p.data))
+	s.seqno++
+
+	return s.writePacket(p)
+}
+
+// waitForAcks blocks until every packet sent so far has been acked, or the
+// ack loop has failed.
+func (s *blockWriteStream) waitForAcks() error {
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+
+	for len(s.unacked) > 0 {
+		if s.ackStopped {
+			if s.ackError != nil {
+				return s.ackError
+			}
+
+			return io.ErrClosedPipe
+		}
+
+		s.acked.Wait()
+	}
 
 	return nil
 }
 
+// stopAcks wakes up anything waiting for acks once the ack loop has stopped.
+func (s *blockWriteStream) stopAcks() {
+	s.ackLock.Lock()
+	s.ackStopped = true
+	s.acked.Broadcast()
+	s.ackLock.Unlock()
+}
+
 func (s *blockWriteStream) makePacket() outboundPacket {
 	packetLength := outboundPacketSize
 	if s.buf.Len() < outboundPacketSize {
@@ -219,17 +380,23 @@ func (s *blockWriteStream) makePacket() outboundPacket {
 		packetLength = outboundChunkSize - alignment
 	}
 
+	// The packet is kept until it's acked, so it needs its own copy of the
+	// data; the slice returned by Next is only valid until the next write.
 	numChunks := int(math.Ceil(float64(packetLength) / float64(outboundChunkSize)))
 	packet := outboundPacket{
 		seqno:     s.seqno,
 		offset:    s.offset,
 		last:      false,
-		checksums: make([]byte, numChunks*4),
-		data:      s.buf.Next(packetLength),
+		checksums: make([]byte, numChunks*s.checksumSize),
+		data:      make([]byte, packetLength),
+	}
+	copy(packet.data, s.buf.Next(packetLength))
+
+	if s.checksumTab == nil {
+		return packet
 	}
 
 	// Fill in the checksum for each chunk of data.
-	tab := crc32.MakeTable(crc32.Castagnoli)
 	for i := 0; i < numChunks; i++ {
 		chunkOff := i * outboundChunkSize
 		chunkEnd := chunkOff + outboundChunkSize
@@ -237,7 +404,7 @@ func (s *blockWriteStream) makePacket() outboundPacket {
 			chunkEnd = len(packet.data)
 		}
 
-		checksum := crc32.Checksum(packet.data[chunkOff:chunkEnd], tab)
+		checksum := crc32.Checksum(packet.data[chunkOff:chunkEnd], s.checksumTab)
 		binary.BigEndian.PutUint32(packet.checksums[i*4:], checksum)
 	}
 
@@ -286,11 +453,19 @@ Acks:
 			s.ackError = ErrInvalidSeqno
 			break Acks
 		}
+
+		s.ackLock.Lock()
+		acked := s.unacked[0]
+		s.unacked = s.unacked[1:]
+		s.ackedOffset = acked.offset + int64(len(acked.data))
+		s.acked.Broadcast()
+		s.ackLock.Unlock()
 	}
 
 	// Once we've seen an error, just keep reading packets off the channel (but
 	// not off the socket) until the writing thread figures it out. If we don't,
 	// the upstream thread could deadlock waiting for the channel to have space.
+	s.stopAcks()
 	for range s.packets {
 	}
 }
@@ -327,6 +502,10 @@ func (s *blockWriteStream) writePacket(p outboundPacket) error {
 		DataLen:           proto.Int32(int32(len(p.data))),
 	}
 
+	if p.syncBlock {
+		headerInfo.SyncBlock = proto.Bool(true)
+	}
+
 	// Don't ask me why this doesn't include the header proto...
 	totalLength := len(p.data) + len(p.checksums) + 4
 
@@ -8,6 +8,7 @@ import (
 	"net"
 	"time"
 
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
 	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 	"google.golang.org/protobuf/proto"
 )
@@ -21,7 +22,9 @@ type BlockWriter struct {
 	// ClientName is the unique ID used by the NamenodeConnection to initialize
 	// the block.
 	ClientName string
-	// Block is the block location provided by the namenode.
+	// Block is the block location provided by the namenode. If the pipeline is
+	// recovered after a datanode failure, it's replaced with the block's new
+	// generation stamp and locations.
 	Block *hdfs.LocatedBlockProto
 	// BlockSize is the target size of the new block (or the existing one, if
 	// appending). The represents the configured value, not the actual number
@@ -37,11 +40,109 @@ type BlockWriter struct {
 	// DialFunc is used to connect to the datanodes. If nil, then
 	// (&net.Dialer{}).DialContext is used.
 	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Recovery is used to recover the pipeline if a datanode fails while
+	// writing. If nil, any failure fails the write.
+	Recovery PipelineRecovery
+	// Replication is the target replication for the block, which determines
+	// whether failed datanodes are replaced.
+	Replication int
+	// ReplaceDatanodePolicy determines when a failed datanode is replaced with
+	// a new one, rather than continuing with the remaining datanodes.
+	ReplaceDatanodePolicy ReplaceDatanodePolicy
+	// ReplaceDatanodeBestEffort specifies that if a failed datanode can't be
+	// replaced, writing should continue with the remaining datanodes, rather
+	// than failing.
+	ReplaceDatanodeBestEffort bool
+	// ChecksumType is the type of checksum sent along with the data. If nil,
+	// CRC32C is used.
+	ChecksumType *hdfs.ChecksumTypeProto
+
+	conn        net.Conn
+	deadline    time.Time
+	stream      *blockWriteStream
+	closed      bool
+	flushed     bool
+	failed      []*hdfs.DatanodeInfoProto
+	streamed    bool
+	recovering  bool
+	closing     bool
+	newGenStamp uint64
+	// sentOffset is the offset in the block up to which data had been sent to
+	// the failed pipeline, which is the most any datanode can have received.
+	sentOffset int64
+}
+
+// PipelineRecovery performs the namenode operations a BlockWriter needs to
+// recover its pipeline after a datanode fails.
+type PipelineRecovery interface {
+	// GetAdditionalDatanode asks the namenode for a datanode to add to the
+	// pipeline, other than the existing and excluded ones. It returns the
+	// block with the new pipeline, including the new datanode.
+	GetAdditionalDatanode(block *hdfs.LocatedBlockProto, existing []*hdfs.DatanodeInfoProto, existingStorageIDs []string, excluded []*hdfs.DatanodeInfoProto) (*hdfs.LocatedBlockProto, error)
+	// UpdateBlockForPipeline asks the namenode for a new generation stamp and
+	// access token for the block. Only the generation stamp and token of the
+	// returned block are used.
+	UpdateBlockForPipeline(block *hdfs.ExtendedBlockProto) (*hdfs.LocatedBlockProto, error)
+	// UpdatePipeline tells the namenode about the new pipeline and generation
+	// stamp for the block, once the datanodes have accepted them.
+	UpdatePipeline(oldBlock, newBlock *hdfs.ExtendedBlockProto, nodes []*hdfs.DatanodeInfoProto, storageIDs []string) error
+	// DialFunc returns the function used to connect to the datanodes with the
+	// given access token.
+	DialFunc(token *hadoop.TokenProto) (func(ctx context.Context, network, addr string) (net.Conn, error), error)
+}
+
+// ReplaceDatanodePolicy determines when BlockWriter replaces a failed datanode
+// in the pipeline. The policies mirror the Java client's
+// dfs.client.block.write.replace-datanode-on-failure.policy.
+type ReplaceDatanodePolicy int
+
+const (
+	// ReplaceDatanodeDefault replaces a failed datanode if the replication is
+	// at least three, and either half the datanodes have failed, or the block
+	// is being appended to or has been flushed.
+	ReplaceDatanodeDefault ReplaceDatanodePolicy = iota
+	// ReplaceDatanodeNever never replaces failed datanodes.
+	ReplaceDatanodeNever
+	// ReplaceDatanodeAlways always replaces failed datanodes.
+	ReplaceDatanodeAlways
+)
+
+const (
+	// maxPipelineRecoveries is how many times BlockWriter tries to set up a
+	// new pipeline after a failure, before giving up.
+	maxPipelineRecoveries = 5
+	// maxReplaceDatanodeAttempts is how many new datanodes BlockWriter tries
+	// to add to the pipeline when replacing a failed one.
+	maxReplaceDatanodeAttempts = 3
+	// abortAckTimeout is how long abort waits for acks that may already be on
+	// their way from the pipeline.
+	abortAckTimeout = time.Second
+)
+
+// DatanodeError is returned by BlockWriter.Connect if a datanode in the
+// pipeline for a new block fails.
+type DatanodeError struct {
+	Datanode *hdfs.DatanodeInfoProto
+	Err      error
+}
+
+func (e *DatanodeError) Error() string {
+	return fmt.Sprintf("datanode %s: %s", getDatanodeAddress(e.Datanode.GetId(), false), e.Err)
+}
+
+func (e *DatanodeError) Unwrap() error {
+	return e.Err
+}
 
-	conn     net.Conn
-	deadline time.Time
-	stream   *blockWriteStream
-	closed   bool
+// pipelineSetupError is returned if a datanode refuses to set up a pipeline.
+type pipelineSetupError struct {
+	status       hdfs.Status
+	message      string
+	firstBadLink string
+}
+
+func (e *pipelineSetupError) Error() string {
+	return fmt.Sprintf("write failed: %s (%s)", e.status.String(), e.message)
 }
 
 // SetDeadline sets the deadline for future Write, Flush, and Close calls. A
@@ -58,11 +159,12 @@ func (bw *BlockWriter) SetDeadline(t time.Time) error {
 
 // Write implements io.Writer.
 //
-// Unlike BlockReader, BlockWriter currently has no ability to recover from
-// write failures (timeouts, datanode failure, etc). Once it returns an error
-// from Write or Close, it may be in an invalid state.
-//
-// This will hopefully be fixed in a future release.
+// If a datanode fails while writing and Recovery is set, the BlockWriter
+// removes it from the pipeline (replacing it, depending on the
+// ReplaceDatanodePolicy), sets up a new pipeline with the remaining datanodes,
+// and continues from the last acked packet. Once all the datanodes have
+// failed, or recovery fails for some other reason, it returns an error, and
+// may be in an invalid state.
 func (bw *BlockWriter) Write(b []byte) (int, error) {
 	var blockFull bool
 	if bw.Offset >= bw.BlockSize {
@@ -73,15 +175,24 @@ func (bw *BlockWriter) Write(b []byte) (int, error) {
 	}
 
 	if bw.stream == nil {
-		err := bw.connectNext()
-		// TODO: handle failures, set up recovery pipeline
+		err := bw.Connect()
 		if err != nil {
 			return 0, err
 		}
 	}
 
-	// TODO: handle failures, set up recovery pipeline
 	n, err := bw.stream.Write(b)
+	for err != nil {
+		err = bw.recover(err)
+		if err != nil || n == len(b) {
+			break
+		}
+
+		var m int
+		m, err = bw.stream.Write(b[n:])
+		n += m
+	}
+
 	bw.Offset += int64(n)
 	if err == nil && blockFull {
 		err = ErrEndOfBlock
@@ -90,13 +201,83 @@ func (bw *BlockWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Connect sets up the pipeline for the block. The first Write does this if it
+// hasn't been done already, but calling Connect first allows a failure to be
+// handled before any data is written.
+//
+// If the pipeline for a new block can't be set up, the returned error is a
+// *DatanodeError identifying the datanode that caused the failure. In that
+// case, the block should be abandoned, and a new one allocated without that
+// datanode.
+func (bw *BlockWriter) Connect() error {
+	if bw.stream != nil {
+		return nil
+	}
+
+	err := bw.connectNext()
+	if err == nil {
+		return nil
+	} else if bw.Append {
+		return bw.recover(err)
+	}
+
+	// A new block can't be recovered, since no datanode has any of it yet.
+	return &DatanodeError{
+		Datanode: bw.currentPipeline()[bw.badNode(err)],
+		Err:      err,
+	}
+}
+
 // Flush flushes any unwritten packets out to the datanode.
 func (bw *BlockWriter) Flush() error {
-	if bw.stream != nil {
-		return bw.stream.flush(true)
+	if bw.stream == nil {
+		return nil
 	}
 
-	return nil
+	bw.flushed = true
+	err := bw.stream.flush(true)
+	for err != nil {
+		err = bw.recover(err)
+		if err != nil {
+			break
+		}
+
+		err = bw.stream.flush(true)
+	}
+
+	return err
+}
+
+// Hflush flushes any unwritten packets out to the datanodes, like Flush, and
+// then waits for every datanode in the pipeline to ack them. Once it returns,
+// the data is in the memory of each datanode, and is visible to new readers.
+func (bw *BlockWriter) Hflush() error {
+	return bw.sync(false)
+}
+
+// Hsync is like Hflush, but the datanodes also sync the block to disk before
+// acking it, so that the data survives them losing power.
+func (bw *BlockWriter) Hsync() error {
+	return bw.sync(true)
+}
+
+func (bw *BlockWriter) sync(syncBlock bool) error {
+	if bw.stream == nil {
+		return nil
+	}
+
+	bw.flushed = true
+	err := bw.stream.sync(syncBlock)
+	for err != nil {
+		err = bw.recover(err)
+		if err != nil {
+			break
+		}
+
+		err = bw.stream.sync(syncBlock)
+	}
+
+	return err
 }
 
 // Close implements io.Closer. It flushes any unwritten packets out to the
@@ -104,39 +285,369 @@ func (bw *BlockWriter) Flush() error {
 // block must still be finalized with the namenode.
 func (bw *BlockWriter) Close() error {
 	bw.closed = true
-	if bw.conn != nil {
-		defer bw.conn.Close()
+	if bw.stream == nil {
+		return nil
 	}
 
-	if bw.stream != nil {
-		// TODO: handle failures, set up recovery pipeline
-		err := bw.stream.finish()
+	err := bw.stream.finish()
+	for err != nil {
+		err = bw.recover(err)
 		if err != nil {
-			return err
+			break
 		}
+
+		err = bw.stream.finish()
 	}
 
-	return nil
+	if bw.conn != nil {
+		bw.conn.Close()
+		bw.conn = nil
+	}
+
+	return err
+}
+
+func (bw *BlockWriter) checksumType() hdfs.ChecksumTypeProto {
+	if bw.ChecksumType == nil {
+		return hdfs.ChecksumTypeProto_CHECKSUM_CRC32C
+	}
+
+	return *bw.ChecksumType
 }
 
 func (bw *BlockWriter) connectNext() error {
+	conn, err := bw.connectPipeline()
+	if err != nil {
+		return err
+	}
+
+	bw.conn = conn
+	bw.stream = newBlockWriteStream(conn, bw.Offset, bw.checksumType())
+	bw.streamed = true
+	return nil
+}
+
+// connectPipeline connects to the first datanode in the pipeline, and sets up
+// the pipeline for writing.
+func (bw *BlockWriter) connectPipeline() (net.Conn, error) {
 	address := getDatanodeAddress(bw.currentPipeline()[0].GetId(), bw.UseDatanodeHostname)
 
 	if bw.DialFunc == nil {
 		bw.DialFunc = (&net.Dialer{}).DialContext
 	}
 
+	conn, err := bw.DialFunc(context.Background(), "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SetDeadline(bw.deadline)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = bw.writeBlockWriteRequest(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := readBlockOpResponse(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		conn.Close()
+		return nil, &pipelineSetupError{
+			status:       resp.GetStatus(),
+			message:      resp.GetMessage(),
+			firstBadLink: resp.GetFirstBadLink(),
+		}
+	}
+
+	return conn, nil
+}
+
+// recover sets up a new pipeline after a failure, and resumes writing from
+// the last acked packet. It returns an error if that isn't possible, in which
+// case the write has failed.
+//
+// See: https://github.com/apache/hadoop/blob/6314843881b4c67d08215e60293f8b33242b9416/hadoop-hdfs-project/hadoop-hdfs-client/src/main/java/org/apache/hadoop/hdfs/DataStreamer.java#L1503
+func (bw *BlockWriter) recover(failure error) error {
+	if bw.Recovery == nil {
+		return failure
+	}
+
+	old := bw.abort()
+	if old != nil {
+		// The ack error, if there is one, says which datanode failed.
+		var ae ackError
+		if errors.As(old.ackError, &ae) {
+			failure = ae
+		}
+	}
+
+	bw.recovering = true
+	for i := 0; i < maxPipelineRecoveries; i++ {
+		// Each datanode left in the pipeline has at least the acked bytes.
+		ackedBytes := bw.Block.GetB().GetNumBytes()
+		bw.sentOffset = int64(ackedBytes)
+		if old != nil {
+			ackedBytes = uint64(old.ackedOffset)
+			bw.sentOffset = old.offset
+			bw.closing = old.lastSent
+		}
+
+		bw.Block = proto.Clone(bw.Block).(*hdfs.LocatedBlockProto)
+		bw.Block.B.NumBytes = proto.Uint64(ackedBytes)
+
+		bad := bw.badNode(failure)
+		bw.failed = append(bw.failed, bw.Block.Locs[bad])
+		bw.removeNode(bad)
+		if len(bw.Block.Locs) == 0 {
+			return fmt.Errorf("all datanodes in the pipeline failed: %w", failure)
+		}
+
+		if bw.shouldReplaceDatanode() {
+			err := bw.replaceDatanode(ackedBytes)
+			if err != nil && !bw.ReplaceDatanodeBestEffort {
+				return fmt.Errorf("replacing failed datanode: %w", err)
+			}
+		}
+
+		updated, err := bw.Recovery.UpdateBlockForPipeline(bw.Block.GetB())
+		if err != nil {
+			return err
+		}
+
+		bw.newGenStamp = updated.GetB().GetGenerationStamp()
+		bw.Block.BlockToken = updated.GetBlockToken()
+		bw.DialFunc, err = bw.Recovery.DialFunc(bw.Block.GetBlockToken())
+		if err != nil {
+			return err
+		}
+
+		conn, err := bw.connectPipeline()
+		if err != nil {
+			failure = err
+			continue
+		}
+
+		newBlock := proto.Clone(bw.Block.GetB()).(*hdfs.ExtendedBlockProto)
+		newBlock.GenerationStamp = proto.Uint64(bw.newGenStamp)
+		err = bw.Recovery.UpdatePipeline(bw.Block.GetB(), newBlock,
+			bw.Block.GetLocs(), bw.Block.GetStorageIDs())
+		if err != nil {
+			conn.Close()
+			return err
+		}
+
+		bw.Block.B = newBlock
+		bw.conn = conn
+		if old == nil {
+			// The pipeline failed while it was being set up for an append.
+			bw.stream = newBlockWriteStream(conn, bw.Offset, bw.checksumType())
+			bw.streamed = true
+			return nil
+		}
+
+		bw.stream, err = newBlockWriteStreamForRecovery(conn, old)
+		if err == nil {
+			return nil
+		}
+
+		failure = err
+		old = bw.abort()
+	}
+
+	return failure
+}
+
+// abort closes the connection to the current pipeline, and returns the
+// stream, if there was one.
+//
+// If the failure was noticed while writing, the datanodes may already have
+// sent acks for earlier packets, and the ack saying which datanode failed, so
+// those are read before the connection is closed. Otherwise, recovery would
+// resend packets that were acked, and blame the wrong datanode.
+func (bw *BlockWriter) abort() *blockWriteStream {
+	old := bw.stream
+	if old != nil {
+		if bw.conn != nil {
+			bw.conn.SetReadDeadline(time.Now().Add(abortAckTimeout))
+		}
+
+		old.abort()
+		bw.stream = nil
+	}
+
+	if bw.conn != nil {
+		bw.conn.Close()
+		bw.conn = nil
+	}
+
+	return old
+}
+
+// badNode returns the index in the pipeline of the datanode that caused an
+// error. If the error doesn't point to a particular datanode, it's blamed on
+// the first one, since that's the one we're connected to.
+func (bw *BlockWriter) badNode(err error) int {
+	var ae ackError
+	var se *pipelineSetupError
+	if errors.As(err, &ae) && ae.pipelineIndex < len(bw.Block.GetLocs()) {
+		return ae.pipelineIndex
+	} else if errors.As(err, &se) && se.firstBadLink != "" {
+		for i, dn := range bw.Block.GetLocs() {
+			if getDatanodeAddress(dn.GetId(), false) == se.firstBadLink ||
+				getDatanodeAddress(dn.GetId(), true) == se.firstBadLink {
+				return i
+			}
+		}
+	}
+
+	return 0
+}
+
+func (bw *BlockWriter) removeNode(i int) {
+	bw.Block.Locs = append(bw.Block.Locs[:i:i], bw.Block.Locs[i+1:]...)
+
+	// The storage IDs and types, if present, correspond to the datanodes.
+	if ids := bw.Block.GetStorageIDs(); len(ids) > i {
+		bw.Block.StorageIDs = append(ids[:i:i], ids[i+1:]...)
+	}
+
+	if types := bw.Block.GetStorageTypes(); len(types) > i {
+		bw.Block.StorageTypes = append(types[:i:i], types[i+1:]...)
+	}
+}
+
+// shouldReplaceDatanode returns true if a failed datanode should be replaced,
+// according to the ReplaceDatanodePolicy.
+func (bw *BlockWriter) shouldReplaceDatanode() bool {
+	n := len(bw.Block.GetLocs())
+	if n >= bw.Replication {
+		return false
+	}
+
+	switch bw.ReplaceDatanodePolicy {
+	case ReplaceDatanodeNever:
+		return false
+	case ReplaceDatanodeAlways:
+		return true
+	default:
+		return bw.Replication >= 3 && (n <= bw.Replication/2 || bw.Append || bw.flushed)
+	}
+}
+
+// replaceDatanode adds a new datanode to the pipeline, copying the data
+// written so far to it from one of the existing ones.
+func (bw *BlockWriter) replaceDatanode(ackedBytes uint64) error {
+	var err error
+	for i := 0; i < maxReplaceDatanodeAttempts; i++ {
+		var lb *hdfs.LocatedBlockProto
+		lb, err = bw.Recovery.GetAdditionalDatanode(bw.Block, bw.Block.GetLocs(),
+			bw.Block.GetStorageIDs(), bw.failed)
+		if err != nil {
+			return err
+		}
+
+		added := bw.findNewDatanode(lb.GetLocs())
+		if added < 0 {
+			return errors.New("namenode didn't add a datanode to the pipeline")
+		}
+
+		// A new block has nothing to copy.
+		if ackedBytes > 0 {
+			src := lb.GetLocs()[0]
+			if added == 0 {
+				src = lb.GetLocs()[1]
+			}
+
+			err = bw.transferBlock(src, lb, added)
+			if err != nil {
+				bw.failed = append(bw.failed, lb.GetLocs()[added])
+				continue
+			}
+		}
+
+		bw.Block.Locs = lb.GetLocs()
+		bw.Block.StorageIDs = lb.GetStorageIDs()
+		bw.Block.StorageTypes = lb.GetStorageTypes()
+		return nil
+	}
+
+	return err
+}
+
+func (bw *BlockWriter) findNewDatanode(locs []*hdfs.DatanodeInfoProto) int {
+	if len(locs) <= len(bw.Block.GetLocs()) {
+		return -1
+	}
+
+	existing := make(map[string]bool, len(bw.Block.GetLocs()))
+	for _, dn := range bw.Block.GetLocs() {
+		existing[dn.GetId().GetDatanodeUuid()] = true
+	}
+
+	for i, dn := range locs {
+		if !existing[dn.GetId().GetDatanodeUuid()] {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// A request to copy a replica to another datanode:
+// +-----------------------------------------------------------+
+// |  Data Transfer Protocol Version, int16                    |
+// +-----------------------------------------------------------+
+// |  Op code, 1 byte (TRANSFER_BLOCK = 0x56)                  |
+// +-----------------------------------------------------------+
+// |  varint length + OpTransferBlockProto                     |
+// +-----------------------------------------------------------+
+//
+// The source datanode responds with a BlockOpResponseProto once the copy is
+// done.
+func (bw *BlockWriter) transferBlock(src *hdfs.DatanodeInfoProto, lb *hdfs.LocatedBlockProto, target int) error {
+	if bw.DialFunc == nil {
+		bw.DialFunc = (&net.Dialer{}).DialContext
+	}
+
+	address := getDatanodeAddress(src.GetId(), bw.UseDatanodeHostname)
 	conn, err := bw.DialFunc(context.Background(), "tcp", address)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
 	err = conn.SetDeadline(bw.deadline)
 	if err != nil {
 		return err
 	}
 
-	err = bw.writeBlockWriteRequest(conn)
+	op := &hdfs.OpTransferBlockProto{
+		Header: &hdfs.ClientOperationHeaderProto{
+			BaseHeader: &hdfs.BaseHeaderProto{
+				Block: bw.Block.GetB(),
+				Token: bw.Block.GetBlockToken(),
+			},
+			ClientName: proto.String(bw.ClientName),
+		},
+		Targets: []*hdfs.DatanodeInfoProto{lb.GetLocs()[target]},
+	}
+
+	if types := lb.GetStorageTypes(); len(types) > target {
+		op.TargetStorageTypes = []hdfs.StorageTypeProto{types[target]}
+	}
+
+	if ids := lb.GetStorageIDs(); len(ids) > target {
+		op.TargetStorageIds = []string{ids[target]}
+	}
+
+	err = writeBlockOpRequest(conn, transferBlockOp, op)
 	if err != nil {
 		return err
 	}
@@ -145,44 +656,35 @@ func (bw *BlockWriter) connectNext() error {
 	if err != nil {
 		return err
 	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
-		return fmt.Errorf("write failed: %s (%s)", resp.GetStatus().String(), resp.GetMessage())
+		return fmt.Errorf("transfer failed: %s (%s)", resp.GetStatus().String(), resp.GetMessage())
 	}
 
-	bw.conn = conn
-	bw.stream = newBlockWriteStream(conn, bw.Offset)
 	return nil
 }
 
 func (bw *BlockWriter) currentPipeline() []*hdfs.DatanodeInfoProto {
-	// TODO: we need to be able to reconfigure the pipeline when a node fails.
-	//
-	// targets := make([]*hdfs.DatanodeInfoProto, 0, len(br.pipeline))
-	// for _, loc := range s.block.GetLocs() {
-	// 	addr := getDatanodeAddress(loc)
-	// 	for _, pipelineAddr := range br.pipeline {
-	// 		if ipAddr == addr {
-	// 			append(targets, loc)
-	// 		}
-	// 	}
-	// }
-	//
-	// return targets
-
 	return bw.Block.GetLocs()
 }
 
 func (bw *BlockWriter) currentStage() hdfs.OpWriteBlockProto_BlockConstructionStage {
-	// TODO: this should be PIPELINE_SETUP_STREAMING_RECOVERY or
-	// PIPELINE_SETUP_APPEND_RECOVERY for recovery.
-	if bw.Append {
+	switch {
+	case bw.recovering && bw.closing:
+		return hdfs.OpWriteBlockProto_PIPELINE_CLOSE_RECOVERY
+	case bw.recovering && bw.Append && !bw.streamed:
+		return hdfs.OpWriteBlockProto_PIPELINE_SETUP_APPEND_RECOVERY
+	case bw.recovering:
+		return hdfs.OpWriteBlockProto_PIPELINE_SETUP_STREAMING_RECOVERY
+	case bw.Append:
 		return hdfs.OpWriteBlockProto_PIPELINE_SETUP_APPEND
+	default:
+		return hdfs.OpWriteBlockProto_PIPELINE_SETUP_CREATE
 	}
-
-	return hdfs.OpWriteBlockProto_PIPELINE_SETUP_CREATE
 }
 
 func (bw *BlockWriter) generationTimestamp() int64 {
-	if bw.Append {
+	if bw.recovering {
+		return int64(bw.newGenStamp)
+	} else if bw.Append {
 		return int64(bw.Block.B.GetGenerationStamp())
 	}
 
@@ -196,12 +698,18 @@ func (bw *BlockWriter) generationTimestamp() int64 {
 //
 // The field "MinBytesRcvd" below is used during append operation and should be
 // the block's expected size. The field "MaxBytesRcvd" is used only in the case
-// of PIPELINE_SETUP_STREAMING_RECOVERY.
+// of PIPELINE_SETUP_STREAMING_RECOVERY, and must be at least the number of
+// bytes each datanode received, so it's the offset sent up to rather than the
+// offset written up to; the two differ if the pipeline fails during a Write.
 //
 // See: https://github.com/apache/hadoop/blob/6314843881b4c67d08215e60293f8b33242b9416/hadoop-hdfs-project/hadoop-hdfs/src/main/java/org/apache/hadoop/hdfs/server/datanode/BlockReceiver.java#L216
 // And: https://github.com/apache/hadoop/blob/6314843881b4c67d08215e60293f8b33242b9416/hadoop-hdfs-project/hadoop-hdfs/src/main/java/org/apache/hadoop/hdfs/server/datanode/fsdataset/impl/FsDatasetImpl.java#L1462
 func (bw *BlockWriter) writeBlockWriteRequest(w io.Writer) error {
 	targets := bw.currentPipeline()[1:]
+	maxBytesRcvd := bw.Offset
+	if bw.recovering {
+		maxBytesRcvd = bw.sentOffset
+	}
 
 	op := &hdfs.OpWriteBlockProto{
 		Header: &hdfs.ClientOperationHeaderProto{
@@ -215,10 +723,10 @@ func (bw *BlockWriter) writeBlockWriteRequest(w io.Writer) error {
 		Stage:                 bw.currentStage().Enum(),
 		PipelineSize:          proto.Uint32(uint32(len(targets))),
 		MinBytesRcvd:          proto.Uint64(bw.Block.GetB().GetNumBytes()),
-		MaxBytesRcvd:          proto.Uint64(uint64(bw.Offset)),
+		MaxBytesRcvd:          proto.Uint64(uint64(maxBytesRcvd)),
 		LatestGenerationStamp: proto.Uint64(uint64(bw.generationTimestamp())),
 		RequestedChecksum: &hdfs.ChecksumProto{
-			Type:             hdfs.ChecksumTypeProto_CHECKSUM_CRC32C.Enum(),
+			Type:             bw.checksumType().Enum(),
 			BytesPerChecksum: proto.Uint32(outboundChunkSize),
 		},
 	}
@@ -1,9 +1,22 @@
 package transfer
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
 	"testing"
 
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestPacketSize(t *testing.T) {
@@ -31,3 +44,536 @@ func TestPacketSizeAlignment(t *testing.T) {
 
 	assert.EqualValues(t, outboundChunkSize-5, len(packet.data))
 }
+
+// fakeWriteDatanode accepts writes for every datanode in a pipeline, and can
+// fail an ack on behalf of one of them.
+type fakeWriteDatanode struct {
+	t        *testing.T
+	listener net.Listener
+
+	// failAt is the block offset of the first packet that the datanode at
+	// failIndex in the pipeline fails to ack, the first time it's sent.
+	failAt    int64
+	failIndex int
+	// badLink, if set, is returned as the first bad link when setting up the
+	// pipeline, instead of accepting the write.
+	badLink string
+
+	lock      sync.Mutex
+	data      []byte
+	received  int64
+	ops       []*hdfs.OpWriteBlockProto
+	transfers []*hdfs.OpTransferBlockProto
+	syncs     []int64
+	failed    bool
+}
+
+func newFakeWriteDatanode(t *testing.T) *fakeWriteDatanode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	dn := &fakeWriteDatanode{t: t, listener: listener, failAt: -1}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go dn.handle(conn)
+		}
+	}()
+
+	return dn
+}
+
+func (dn *fakeWriteDatanode) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	return net.Dial("tcp", dn.listener.Addr().String())
+}
+
+func (dn *fakeWriteDatanode) handle(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, 3)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return
+	}
+
+	switch header[2] {
+	case writeBlockOp:
+		op := &hdfs.OpWriteBlockProto{}
+		require.NoError(dn.t, readPrefixedMessageExact(conn, op))
+		dn.lock.Lock()
+		dn.ops = append(dn.ops, op)
+		dn.lock.Unlock()
+
+		if dn.badLink != "" {
+			dn.writeResponse(conn, &hdfs.BlockOpResponseProto{
+				Status:       hdfs.Status_ERROR.Enum(),
+				FirstBadLink: proto.String(dn.badLink),
+			})
+			return
+		}
+
+		// Like recoverRbw, reject recovery if we've received more than the
+		// client thinks it sent.
+		dn.lock.Lock()
+		received := dn.received
+		dn.lock.Unlock()
+		if op.GetStage() == hdfs.OpWriteBlockProto_PIPELINE_SETUP_STREAMING_RECOVERY &&
+			int64(op.GetMaxBytesRcvd()) < received {
+			dn.writeResponse(conn, &hdfs.BlockOpResponseProto{
+				Status:  hdfs.Status_ERROR.Enum(),
+				Message: proto.String("Unmatched length replica"),
+			})
+			return
+		}
+
+		dn.writeResponse(conn, &hdfs.BlockOpResponseProto{
+			Status:       hdfs.Status_SUCCESS.Enum(),
+			FirstBadLink: proto.String(""),
+		})
+		dn.receivePackets(conn, op)
+	case transferBlockOp:
+		op := &hdfs.OpTransferBlockProto{}
+		require.NoError(dn.t, readPrefixedMessageExact(conn, op))
+		dn.lock.Lock()
+		dn.transfers = append(dn.transfers, op)
+		dn.lock.Unlock()
+
+		dn.writeResponse(conn, &hdfs.BlockOpResponseProto{
+			Status:  hdfs.Status_SUCCESS.Enum(),
+			Message: proto.String("transferred"),
+		})
+	default:
+		dn.t.Errorf("unexpected op: %x", header[2])
+	}
+}
+
+func (dn *fakeWriteDatanode) receivePackets(conn net.Conn, op *hdfs.OpWriteBlockProto) {
+	pipelineSize := len(op.GetTargets()) + 1
+	checksum := op.GetRequestedChecksum()
+	var checksumTab *crc32.Table
+	switch checksum.GetType() {
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32:
+		checksumTab = crc32.IEEETable
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32C:
+		checksumTab = crc32.MakeTable(crc32.Castagnoli)
+	}
+
+	for {
+		lengths := make([]byte, 6)
+		_, err := io.ReadFull(conn, lengths)
+		if err != nil {
+			return
+		}
+
+		packetLength := int(binary.BigEndian.Uint32(lengths))
+		headerBytes := make([]byte, binary.BigEndian.Uint16(lengths[4:]))
+		payload := make([]byte, packetLength-4)
+		_, err = io.ReadFull(conn, headerBytes)
+		require.NoError(dn.t, err)
+		_, err = io.ReadFull(conn, payload)
+		require.NoError(dn.t, err)
+
+		packet := &hdfs.PacketHeaderProto{}
+		require.NoError(dn.t, proto.Unmarshal(headerBytes, packet))
+		if packet.GetSeqno() == heartbeatSeqno {
+			continue
+		}
+
+		reply := make([]hdfs.Status, pipelineSize)
+		dn.lock.Lock()
+		if end := packet.GetOffsetInBlock() + int64(packet.GetDataLen()); end > dn.received {
+			dn.received = end
+		}
+
+		if !dn.failed && dn.failAt >= 0 && packet.GetOffsetInBlock() >= dn.failAt {
+			dn.failed = true
+			reply[dn.failIndex] = hdfs.Status_ERROR
+		} else {
+			data := payload[len(payload)-int(packet.GetDataLen()):]
+			if checksumTab != nil {
+				dn.verifyChecksums(payload[:len(payload)-len(data)], data,
+					int(checksum.GetBytesPerChecksum()), checksumTab)
+			} else {
+				assert.Len(dn.t, payload, len(data))
+			}
+
+			end := int(packet.GetOffsetInBlock()) + len(data)
+			if end > len(dn.data) {
+				dn.data = append(dn.data, make([]byte, end-len(dn.data))...)
+			}
+
+			copy(dn.data[packet.GetOffsetInBlock():], data)
+			if packet.GetSyncBlock() {
+				dn.syncs = append(dn.syncs, int64(end))
+			}
+		}
+		dn.lock.Unlock()
+
+		dn.writeResponse(conn, &hdfs.PipelineAckProto{
+			Seqno: packet.Seqno,
+			Reply: reply,
+		})
+
+		if reply[dn.failIndex] != hdfs.Status_SUCCESS || packet.GetLastPacketInBlock() {
+			return
+		}
+	}
+}
+
+func (dn *fakeWriteDatanode) verifyChecksums(checksums, data []byte, chunkSize int, tab *crc32.Table) {
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		expected := crc32.Checksum(data[i*chunkSize:end], tab)
+		if !assert.Greater(dn.t, len(checksums), i*4+3) {
+			return
+		}
+
+		assert.Equal(dn.t, expected, binary.BigEndian.Uint32(checksums[i*4:]), "chunk %d", i)
+	}
+}
+
+func (dn *fakeWriteDatanode) writeResponse(conn net.Conn, msg proto.Message) {
+	b, err := makePrefixedMessage(msg)
+	require.NoError(dn.t, err)
+	conn.Write(b)
+}
+
+// fakePipelineRecovery implements PipelineRecovery, recording the calls made
+// to it.
+type fakePipelineRecovery struct {
+	dn              *fakeWriteDatanode
+	additional      int
+	updatedBlocks   []*hdfs.ExtendedBlockProto
+	updatedNodes    [][]*hdfs.DatanodeInfoProto
+	generationStamp uint64
+}
+
+func (r *fakePipelineRecovery) GetAdditionalDatanode(block *hdfs.LocatedBlockProto, existing []*hdfs.DatanodeInfoProto, existingStorageIDs []string, excluded []*hdfs.DatanodeInfoProto) (*hdfs.LocatedBlockProto, error) {
+	r.additional++
+	lb := proto.Clone(block).(*hdfs.LocatedBlockProto)
+	lb.Locs = append(existing[:len(existing):len(existing)], newTestDatanode(fmt.Sprintf("new%d", r.additional)))
+	return lb, nil
+}
+
+func (r *fakePipelineRecovery) UpdateBlockForPipeline(block *hdfs.ExtendedBlockProto) (*hdfs.LocatedBlockProto, error) {
+	r.generationStamp++
+	b := proto.Clone(block).(*hdfs.ExtendedBlockProto)
+	b.GenerationStamp = proto.Uint64(r.generationStamp)
+	return &hdfs.LocatedBlockProto{B: b}, nil
+}
+
+func (r *fakePipelineRecovery) UpdatePipeline(oldBlock, newBlock *hdfs.ExtendedBlockProto, nodes []*hdfs.DatanodeInfoProto, storageIDs []string) error {
+	r.updatedBlocks = append(r.updatedBlocks, newBlock)
+	r.updatedNodes = append(r.updatedNodes, nodes)
+	return nil
+}
+
+func (r *fakePipelineRecovery) DialFunc(token *hadoop.TokenProto) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	return r.dn.dial, nil
+}
+
+func newTestDatanode(uuid string) *hdfs.DatanodeInfoProto {
+	return &hdfs.DatanodeInfoProto{
+		Id: &hdfs.DatanodeIDProto{
+			IpAddr:       proto.String("127.0.0.1"),
+			HostName:     proto.String(uuid),
+			DatanodeUuid: proto.String(uuid),
+			XferPort:     proto.Uint32(50010),
+			InfoPort:     proto.Uint32(50075),
+			IpcPort:      proto.Uint32(50020),
+		},
+	}
+}
+
+func newTestBlockWriter(dn *fakeWriteDatanode, recovery PipelineRecovery) *BlockWriter {
+	return &BlockWriter{
+		ClientName: "test",
+		Block: &hdfs.LocatedBlockProto{
+			B: &hdfs.ExtendedBlockProto{
+				PoolId:          proto.String("pool"),
+				BlockId:         proto.Uint64(1),
+				GenerationStamp: proto.Uint64(1000),
+				NumBytes:        proto.Uint64(0),
+			},
+			Offset:  proto.Uint64(0),
+			Corrupt: proto.Bool(false),
+			Locs: []*hdfs.DatanodeInfoProto{
+				newTestDatanode("dn1"), newTestDatanode("dn2"), newTestDatanode("dn3"),
+			},
+		},
+		BlockSize:   128 * 1024 * 1024,
+		Replication: 3,
+		DialFunc:    dn.dial,
+		Recovery:    recovery,
+	}
+}
+
+func writeTestBlock(t *testing.T, bw *BlockWriter, size int) ([]byte, error) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for off := 0; off < len(data); off += 10000 {
+		end := off + 10000
+		if end > len(data) {
+			end = len(data)
+		}
+
+		_, err := bw.Write(data[off:end])
+		if err != nil {
+			return data, err
+		}
+	}
+
+	return data, bw.Close()
+}
+
+func TestBlockWriterRecovery(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.failAt = 5 * outboundPacketSize
+	dn.failIndex = 1
+
+	recovery := &fakePipelineRecovery{dn: dn, generationStamp: 1000}
+	bw := newTestBlockWriter(dn, recovery)
+	data, err := writeTestBlock(t, bw, 1024*1024)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, dn.data)
+	assert.Equal(t, 0, recovery.additional)
+	require.Len(t, recovery.updatedNodes, 1)
+	assert.Equal(t, "dn1", recovery.updatedNodes[0][0].GetId().GetDatanodeUuid())
+	assert.Equal(t, "dn3", recovery.updatedNodes[0][1].GetId().GetDatanodeUuid())
+	assert.Len(t, bw.Block.GetLocs(), 2)
+	assert.EqualValues(t, 1001, bw.Block.GetB().GetGenerationStamp())
+
+	require.Len(t, dn.ops, 2)
+	recoveryOp := dn.ops[1]
+	assert.Equal(t, hdfs.OpWriteBlockProto_PIPELINE_SETUP_STREAMING_RECOVERY, recoveryOp.GetStage())
+	assert.EqualValues(t, 1001, recoveryOp.GetLatestGenerationStamp())
+	assert.EqualValues(t, 1000, recoveryOp.GetHeader().GetBaseHeader().GetBlock().GetGenerationStamp())
+	assert.EqualValues(t, 5*outboundPacketSize, recoveryOp.GetMinBytesRcvd())
+	assert.Len(t, recoveryOp.GetTargets(), 1)
+}
+
+func TestBlockWriterRecoveryDuringWrite(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.failAt = 5 * outboundPacketSize
+	dn.failIndex = 1
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// The ack fails halfway through a single Write, so the datanodes have
+	// received more than the BlockWriter's offset.
+	recovery := &fakePipelineRecovery{dn: dn, generationStamp: 1000}
+	bw := newTestBlockWriter(dn, recovery)
+	n, err := bw.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	require.NoError(t, bw.Close())
+
+	assert.Equal(t, data, dn.data)
+	require.Len(t, dn.ops, 2)
+	recoveryOp := dn.ops[1]
+	assert.Equal(t, hdfs.OpWriteBlockProto_PIPELINE_SETUP_STREAMING_RECOVERY, recoveryOp.GetStage())
+	assert.EqualValues(t, 5*outboundPacketSize, recoveryOp.GetMinBytesRcvd())
+	assert.Greater(t, recoveryOp.GetMaxBytesRcvd(), recoveryOp.GetMinBytesRcvd())
+	assert.Len(t, bw.Block.GetLocs(), 2)
+}
+
+func TestBlockWriterRecoveryReplaceDatanode(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.failAt = 5 * outboundPacketSize
+	dn.failIndex = 2
+
+	recovery := &fakePipelineRecovery{dn: dn, generationStamp: 1000}
+	bw := newTestBlockWriter(dn, recovery)
+	bw.ReplaceDatanodePolicy = ReplaceDatanodeAlways
+	data, err := writeTestBlock(t, bw, 1024*1024)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, dn.data)
+	assert.Equal(t, 1, recovery.additional)
+	require.Len(t, recovery.updatedNodes, 1)
+	assert.Len(t, recovery.updatedNodes[0], 3)
+	assert.Equal(t, "new1", recovery.updatedNodes[0][2].GetId().GetDatanodeUuid())
+
+	// The data acked so far should have been copied to the new datanode.
+	require.Len(t, dn.transfers, 1)
+	transfer := dn.transfers[0]
+	assert.Equal(t, "new1", transfer.GetTargets()[0].GetId().GetDatanodeUuid())
+	assert.EqualValues(t, 5*outboundPacketSize, transfer.GetHeader().GetBaseHeader().GetBlock().GetNumBytes())
+}
+
+func TestBlockWriterRecoveryDuringClose(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.failAt = 1000
+	dn.failIndex = 0
+
+	recovery := &fakePipelineRecovery{dn: dn, generationStamp: 1000}
+	bw := newTestBlockWriter(dn, recovery)
+	data, err := writeTestBlock(t, bw, 1000)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, dn.data)
+	require.Len(t, dn.ops, 2)
+	assert.Equal(t, hdfs.OpWriteBlockProto_PIPELINE_CLOSE_RECOVERY, dn.ops[1].GetStage())
+	assert.Equal(t, "dn2", recovery.updatedNodes[0][0].GetId().GetDatanodeUuid())
+}
+
+func TestBlockWriterWithoutRecovery(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.failAt = 5 * outboundPacketSize
+	dn.failIndex = 1
+
+	bw := newTestBlockWriter(dn, nil)
+	_, err := writeTestBlock(t, bw, 1024*1024)
+	assert.Error(t, err)
+}
+
+func TestBlockWriterConnectBadLink(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.badLink = "dn2:50010"
+
+	bw := newTestBlockWriter(dn, &fakePipelineRecovery{dn: dn, generationStamp: 1000})
+	bw.UseDatanodeHostname = true
+	err := bw.Connect()
+
+	var dnErr *DatanodeError
+	require.ErrorAs(t, err, &dnErr)
+	assert.Equal(t, "dn2", dnErr.Datanode.GetId().GetDatanodeUuid())
+
+	// The pipeline for a new block shouldn't be recovered.
+	assert.Len(t, dn.ops, 1)
+	assert.Len(t, bw.Block.GetLocs(), 3)
+}
+
+func TestBlockWriterConnectDialFailure(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	bw := newTestBlockWriter(dn, nil)
+	bw.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	err := bw.Connect()
+
+	var dnErr *DatanodeError
+	require.ErrorAs(t, err, &dnErr)
+	assert.Equal(t, "dn1", dnErr.Datanode.GetId().GetDatanodeUuid())
+	assert.EqualError(t, err, "datanode 127.0.0.1:50010: connection refused")
+}
+
+func TestBlockWriterSync(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	bw := newTestBlockWriter(dn, nil)
+
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	_, err := bw.Write(data[:70000])
+	require.NoError(t, err)
+
+	// Once Hflush returns, all the data should have been acked.
+	require.NoError(t, bw.Hflush())
+	dn.lock.Lock()
+	assert.Equal(t, data[:70000], dn.data)
+	assert.Empty(t, dn.syncs)
+	dn.lock.Unlock()
+
+	_, err = bw.Write(data[70000:])
+	require.NoError(t, err)
+	require.NoError(t, bw.Hsync())
+	dn.lock.Lock()
+	assert.Equal(t, data, dn.data)
+	assert.Equal(t, []int64{100000}, dn.syncs)
+	dn.lock.Unlock()
+
+	// With nothing buffered, an empty packet is sent to sync the block.
+	require.NoError(t, bw.Hsync())
+	dn.lock.Lock()
+	assert.Equal(t, []int64{100000, 100000}, dn.syncs)
+	dn.lock.Unlock()
+
+	require.NoError(t, bw.Close())
+	assert.Equal(t, data, dn.data)
+}
+
+func TestBlockWriterSyncRecovery(t *testing.T) {
+	dn := newFakeWriteDatanode(t)
+	dn.failAt = 50000
+	dn.failIndex = 1
+
+	recovery := &fakePipelineRecovery{dn: dn, generationStamp: 1000}
+	bw := newTestBlockWriter(dn, recovery)
+
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	_, err := bw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, bw.Hsync())
+
+	dn.lock.Lock()
+	assert.Equal(t, data, dn.data)
+	assert.Contains(t, dn.syncs, int64(100000))
+	dn.lock.Unlock()
+	assert.Len(t, recovery.updatedNodes, 1)
+
+	require.NoError(t, bw.Close())
+}
+
+func TestBlockWriterChecksumType(t *testing.T) {
+	for _, checksumType := range []hdfs.ChecksumTypeProto{
+		hdfs.ChecksumTypeProto_CHECKSUM_CRC32,
+		hdfs.ChecksumTypeProto_CHECKSUM_CRC32C,
+		hdfs.ChecksumTypeProto_CHECKSUM_NULL,
+	} {
+		t.Run(checksumType.String(), func(t *testing.T) {
+			dn := newFakeWriteDatanode(t)
+			bw := newTestBlockWriter(dn, nil)
+			bw.ChecksumType = checksumType.Enum()
+
+			data, err := writeTestBlock(t, bw, 100000)
+			require.NoError(t, err)
+			assert.Equal(t, data, dn.data)
+
+			require.Len(t, dn.ops, 1)
+			assert.Equal(t, checksumType, dn.ops[0].GetRequestedChecksum().GetType())
+		})
+	}
+}
+
+func TestShouldReplaceDatanode(t *testing.T) {
+	tests := []struct {
+		policy      ReplaceDatanodePolicy
+		replication int
+		remaining   int
+		flushed     bool
+		expected    bool
+	}{
+		{ReplaceDatanodeDefault, 3, 2, false, false},
+		{ReplaceDatanodeDefault, 3, 2, true, true},
+		{ReplaceDatanodeDefault, 3, 1, false, true},
+		{ReplaceDatanodeDefault, 2, 1, true, false},
+		{ReplaceDatanodeAlways, 2, 1, false, true},
+		{ReplaceDatanodeAlways, 3, 3, false, false},
+		{ReplaceDatanodeNever, 3, 1, true, false},
+	}
+
+	for _, tt := range tests {
+		bw := &BlockWriter{
+			Block:                 &hdfs.LocatedBlockProto{Locs: make([]*hdfs.DatanodeInfoProto, tt.remaining)},
+			Replication:           tt.replication,
+			ReplaceDatanodePolicy: tt.policy,
+			flushed:               tt.flushed,
+		}
+
+		assert.Equal(t, tt.expected, bw.shouldReplaceDatanode(), "%+v", tt)
+	}
+}
@@ -3,6 +3,7 @@ package transfer
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"time"
@@ -21,6 +22,9 @@ type ChecksumReader struct {
 	UseDatanodeHostname bool
 	// DialFunc is used to connect to the datanodes. If nil, then (&net.Dialer{}).DialContext is used
 	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+	// PeerCache, if set, is checked for an idle connection to each datanode
+	// before dialing a new one, and connections are returned to it afterwards.
+	PeerCache *PeerCache
 
 	deadline  time.Time
 	datanodes *datanodeFailover
@@ -67,6 +71,18 @@ func (cr *ChecksumReader) ReadChecksum() ([]byte, error) {
 }
 
 func (cr *ChecksumReader) readChecksum(address string) ([]byte, error) {
+	if conn := cr.PeerCache.Get(address); conn != nil {
+		checksum, err := cr.readChecksumFrom(conn)
+		if err == nil {
+			cr.PeerCache.Put(address, conn)
+			return checksum, nil
+		}
+
+		// The datanode may have closed the connection while it was idle, so
+		// try again with a new one.
+		conn.Close()
+	}
+
 	if cr.DialFunc == nil {
 		cr.DialFunc = (&net.Dialer{}).DialContext
 	}
@@ -76,7 +92,18 @@ func (cr *ChecksumReader) readChecksum(address string) ([]byte, error) {
 		return nil, err
 	}
 
-	err = conn.SetDeadline(cr.deadline)
+	checksum, err := cr.readChecksumFrom(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	cr.PeerCache.Put(address, conn)
+	return checksum, nil
+}
+
+func (cr *ChecksumReader) readChecksumFrom(conn net.Conn) ([]byte, error) {
+	err := conn.SetDeadline(cr.deadline)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +116,8 @@ func (cr *ChecksumReader) readChecksum(address string) ([]byte, error) {
 	resp, err := cr.readBlockChecksumResponse(conn)
 	if err != nil {
 		return nil, err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return nil, fmt.Errorf("checksum failed: %s (%s)", resp.GetStatus().String(), resp.GetMessage())
 	}
 
 	return resp.GetChecksumResponse().GetBlockChecksum(), nil
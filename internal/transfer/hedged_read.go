@@ -0,0 +1,283 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// HedgedReadPool limits the number of hedged reads that can be in flight at
+// once, and keeps statistics about them. It's safe to share between
+// goroutines.
+type HedgedReadPool struct {
+	slots    chan struct{}
+	ops      atomic.Int64
+	wins     atomic.Int64
+	rejected atomic.Int64
+}
+
+// HedgedReadStats are the statistics kept by a HedgedReadPool.
+type HedgedReadStats struct {
+	// Ops is the number of hedged reads that were started.
+	Ops int64
+	// Wins is the number of hedged reads that finished before the read (or
+	// reads) started before them.
+	Wins int64
+	// Rejected is the number of hedged reads that weren't started because
+	// the pool was full.
+	Rejected int64
+}
+
+// NewHedgedReadPool returns a HedgedReadPool that allows size hedged reads to
+// be in flight at once.
+func NewHedgedReadPool(size int) *HedgedReadPool {
+	return &HedgedReadPool{slots: make(chan struct{}, size)}
+}
+
+// Stats returns the current statistics for the pool.
+func (p *HedgedReadPool) Stats() HedgedReadStats {
+	return HedgedReadStats{
+		Ops:      p.ops.Load(),
+		Wins:     p.wins.Load(),
+		Rejected: p.rejected.Load(),
+	}
+}
+
+func (p *HedgedReadPool) acquire() bool {
+	select {
+	case p.slots <- struct{}{}:
+		p.ops.Add(1)
+		return true
+	default:
+		p.rejected.Add(1)
+		return false
+	}
+}
+
+func (p *HedgedReadPool) release() {
+	<-p.slots
+}
+
+// HedgedRead reads a range of a block. If the read from one datanode hasn't
+// finished after Threshold, the same read is started on another datanode,
+// and so on, and whichever finishes first is used. The others are cancelled,
+// and since they were slower, recorded as failures so that subsequent reads
+// prefer other datanodes.
+//
+// If a read fails outright, it's retried on the next datanode immediately,
+// like BlockReader does.
+type HedgedRead struct {
+	// ClientName is the unique ID used by the NamenodeConnection to locate the
+	// block.
+	ClientName string
+	// Block is the block location provided by the namenode.
+	Block *hdfs.LocatedBlockProto
+	// UseDatanodeHostname specifies whether the datanodes should be connected to
+	// via their hostnames (if true) or IP addresses (if false).
+	UseDatanodeHostname bool
+	// DialFunc is used to connect to the datanodes. If nil, then
+	// (&net.Dialer{}).DialContext is used.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+	// PeerCache, if set, is checked for an idle connection to each datanode
+	// before dialing a new one, and connections are returned to it once a read
+	// has finished. Connections for reads that are cancelled are closed
+	// instead.
+	PeerCache *PeerCache
+	// ShortCircuit, if set, is used by the first read to read the block
+	// directly from the files of a datanode on the same host, if there is one.
+	ShortCircuit *ShortCircuit
+	// Threshold is how long to wait for a read before starting another one.
+	Threshold time.Duration
+	// Pool limits how many reads can be started because of the Threshold.
+	Pool *HedgedReadPool
+	// Deadline is the deadline for the whole read. A zero value means the
+	// read will not time out.
+	Deadline time.Time
+}
+
+// hedgedAttempt is a read from a single datanode.
+type hedgedAttempt struct {
+	address string
+	hedged  bool
+	local   bool
+	buf     []byte
+	err     error
+
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+	conn      net.Conn
+	cancelled bool
+	lock      sync.Mutex
+}
+
+// ReadAt reads len(b) bytes starting at offset off in the block. It either
+// fills b or returns an error.
+func (hr *HedgedRead) ReadAt(b []byte, off int64) (int, error) {
+	locs := hr.Block.GetLocs()
+	datanodes := make([]string, len(locs))
+	for i, loc := range locs {
+		datanodes[i] = getDatanodeAddress(loc.GetId(), hr.UseDatanodeHostname)
+	}
+
+	df := newDatanodeFailover(datanodes)
+	results := make(chan *hedgedAttempt, len(datanodes))
+	var attempts []*hedgedAttempt
+	defer func() {
+		for _, a := range attempts {
+			a.cancel()
+		}
+	}()
+
+	start := func(hedged bool) {
+		a := &hedgedAttempt{
+			address: df.next(),
+			hedged:  hedged,
+			local:   len(attempts) == 0,
+			buf:     make([]byte, len(b)),
+		}
+
+		a.ctx, a.cancelCtx = context.WithCancel(context.Background())
+		attempts = append(attempts, a)
+		go hr.read(a, off, results)
+	}
+
+	if df.numRemaining() == 0 {
+		return 0, errors.New("no available datanodes")
+	}
+
+	start(false)
+	outstanding := 1
+
+	timer := time.NewTimer(hr.Threshold)
+	defer timer.Stop()
+
+	var err error
+	for outstanding > 0 {
+		select {
+		case a := <-results:
+			outstanding--
+			if a.err == nil {
+				if a.hedged {
+					hr.Pool.wins.Add(1)
+				}
+
+				copy(b, a.buf)
+				return len(b), nil
+			}
+
+			// The BlockReader has already recorded the failure.
+			err = a.err
+			if outstanding == 0 && df.numRemaining() > 0 {
+				start(false)
+				outstanding++
+			}
+		case <-timer.C:
+			if df.numRemaining() > 0 {
+				if hr.Pool.acquire() {
+					start(true)
+					outstanding++
+				}
+
+				timer.Reset(hr.Threshold)
+			}
+		}
+	}
+
+	return 0, err
+}
+
+func (hr *HedgedRead) read(a *hedgedAttempt, off int64, results chan<- *hedgedAttempt) {
+	if a.hedged {
+		defer hr.Pool.release()
+	}
+
+	br := &BlockReader{
+		ClientName:          hr.ClientName,
+		Block:               hr.Block,
+		Offset:              off,
+		Length:              int64(len(a.buf)),
+		UseDatanodeHostname: hr.UseDatanodeHostname,
+		DialFunc:            a.dial(hr.DialFunc),
+		PeerCache:           hr.PeerCache,
+		register:            a.register,
+		datanodes:           newDatanodeFailover([]string{a.address}),
+	}
+
+	if a.local {
+		br.ShortCircuit = hr.ShortCircuit
+	}
+
+	br.SetDeadline(hr.Deadline)
+	_, err := io.ReadFull(br, a.buf)
+
+	// Once the read has finished, the connection either goes back to the
+	// PeerCache, so cancel must no longer close it, or it was cancelled, and
+	// shouldn't be reused.
+	a.lock.Lock()
+	if a.cancelled {
+		br.PeerCache = nil
+	}
+
+	a.conn = nil
+	a.lock.Unlock()
+	br.Close()
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	a.err = err
+	results <- a
+}
+
+// dial wraps a DialFunc such that the connection can be closed by cancel.
+func (a *hedgedAttempt) dial(dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dialFunc == nil {
+		dialFunc = (&net.Dialer{}).DialContext
+	}
+
+	return func(_ context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialFunc(a.ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		err = a.register(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// register makes cancel close conn, which is either a new connection or one
+// from the PeerCache.
+func (a *hedgedAttempt) register(conn net.Conn) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.cancelled {
+		return context.Canceled
+	}
+
+	a.conn = conn
+	return nil
+}
+
+func (a *hedgedAttempt) cancel() {
+	a.cancelCtx()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.cancelled = true
+	if a.conn != nil {
+		a.conn.Close()
+	}
+}
@@ -0,0 +1,260 @@
+package transfer
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHedgedReadPool(t *testing.T) {
+	p := NewHedgedReadPool(2)
+
+	assert.True(t, p.acquire())
+	assert.True(t, p.acquire())
+	assert.False(t, p.acquire())
+
+	p.release()
+	assert.True(t, p.acquire())
+
+	p.wins.Add(1)
+	assert.Equal(t, HedgedReadStats{Ops: 3, Wins: 1, Rejected: 1}, p.Stats())
+}
+
+// fakeReadDatanode serves reads of a single block over net.Pipe connections.
+// If stall is set, it never answers, and instead waits for the client to
+// close the connection. Otherwise, it waits for delay before answering each
+// read.
+type fakeReadDatanode struct {
+	t     *testing.T
+	data  []byte
+	stall bool
+	delay time.Duration
+
+	lock     sync.Mutex
+	dials    int
+	requests int
+	closed   chan struct{}
+}
+
+func newFakeReadDatanode(t *testing.T, data []byte) *fakeReadDatanode {
+	return &fakeReadDatanode{t: t, data: data, closed: make(chan struct{})}
+}
+
+func (dn *fakeReadDatanode) dial() net.Conn {
+	client, server := net.Pipe()
+	dn.t.Cleanup(func() { server.Close() })
+
+	dn.lock.Lock()
+	dn.dials++
+	dn.lock.Unlock()
+
+	go dn.handle(server)
+	return client
+}
+
+func (dn *fakeReadDatanode) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		header := make([]byte, 3)
+		_, err := io.ReadFull(conn, header)
+		if err != nil {
+			return
+		}
+
+		op := &hdfs.OpReadBlockProto{}
+		require.NoError(dn.t, readPrefixedMessageExact(conn, op))
+		dn.lock.Lock()
+		dn.requests++
+		dn.lock.Unlock()
+
+		if dn.stall {
+			io.Copy(io.Discard, conn)
+			close(dn.closed)
+			return
+		}
+
+		time.Sleep(dn.delay)
+		off := int64(op.GetOffset())
+		end := off + int64(op.GetLen())
+		dn.writeResponse(conn, &hdfs.BlockOpResponseProto{
+			Status: hdfs.Status_SUCCESS.Enum(),
+			ReadOpChecksumInfo: &hdfs.ReadOpChecksumInfoProto{
+				Checksum: &hdfs.ChecksumProto{
+					Type:             hdfs.ChecksumTypeProto_CHECKSUM_NULL.Enum(),
+					BytesPerChecksum: proto.Uint32(512),
+				},
+				ChunkOffset: proto.Uint64(uint64(off)),
+			},
+		})
+
+		if !dn.writePacket(conn, off, dn.data[off:end], false) ||
+			!dn.writePacket(conn, end, nil, true) {
+			return
+		}
+
+		// The client finishes a read by sending its status, and then may reuse
+		// the connection.
+		status := &hdfs.ClientReadStatusProto{}
+		if readPrefixedMessageExact(conn, status) != nil {
+			return
+		}
+	}
+}
+
+func (dn *fakeReadDatanode) writeResponse(conn net.Conn, msg proto.Message) {
+	b, err := makePrefixedMessage(msg)
+	require.NoError(dn.t, err)
+	conn.Write(b)
+}
+
+func (dn *fakeReadDatanode) writePacket(conn net.Conn, off int64, data []byte, last bool) bool {
+	header, err := proto.Marshal(&hdfs.PacketHeaderProto{
+		OffsetInBlock:     proto.Int64(off),
+		Seqno:             proto.Int64(0),
+		LastPacketInBlock: proto.Bool(last),
+		DataLen:           proto.Int32(int32(len(data))),
+	})
+	require.NoError(dn.t, err)
+
+	b := make([]byte, 6, 6+len(header)+len(data))
+	binary.BigEndian.PutUint32(b, uint32(4+len(data)))
+	binary.BigEndian.PutUint16(b[4:], uint16(len(header)))
+	b = append(b, header...)
+	b = append(b, data...)
+
+	_, err = conn.Write(b)
+	return err == nil
+}
+
+func (dn *fakeReadDatanode) stats() (dials, requests int) {
+	dn.lock.Lock()
+	defer dn.lock.Unlock()
+
+	return dn.dials, dn.requests
+}
+
+// newTestHedgedRead returns a HedgedRead for a block with a replica on each
+// of the given datanodes, in order. Since datanode failures are recorded
+// globally, any failures left over from earlier tests are cleared.
+func newTestHedgedRead(datanodes map[string]*fakeReadDatanode, order []string, size int) *HedgedRead {
+	var locs []*hdfs.DatanodeInfoProto
+	for _, name := range order {
+		datanodeFailuresLock.Lock()
+		delete(datanodeFailures, name+":50010")
+		datanodeFailuresLock.Unlock()
+
+		locs = append(locs, &hdfs.DatanodeInfoProto{
+			Id: &hdfs.DatanodeIDProto{
+				IpAddr:   proto.String(name),
+				HostName: proto.String(name),
+				XferPort: proto.Uint32(50010),
+			},
+		})
+	}
+
+	return &HedgedRead{
+		ClientName: "test",
+		Block: &hdfs.LocatedBlockProto{
+			B: &hdfs.ExtendedBlockProto{
+				PoolId:          proto.String("pool"),
+				BlockId:         proto.Uint64(1),
+				GenerationStamp: proto.Uint64(1),
+				NumBytes:        proto.Uint64(uint64(size)),
+			},
+			Locs: locs,
+		},
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(addr)
+			return datanodes[host].dial(), nil
+		},
+		Threshold: 10 * time.Millisecond,
+	}
+}
+
+func makeTestHedgedReadData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	return data
+}
+
+func TestHedgedRead(t *testing.T) {
+	data := makeTestHedgedReadData(1000)
+	slow := newFakeReadDatanode(t, data)
+	slow.stall = true
+	fast := newFakeReadDatanode(t, data)
+
+	pc := NewPeerCache(4, time.Minute)
+	defer pc.Close()
+
+	datanodes := map[string]*fakeReadDatanode{"hedge-slow": slow, "hedge-fast": fast}
+	hr := newTestHedgedRead(datanodes, []string{"hedge-slow", "hedge-fast"}, len(data))
+	hr.Pool = NewHedgedReadPool(1)
+	hr.PeerCache = pc
+
+	b := make([]byte, 600)
+	n, err := hr.ReadAt(b, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 600, n)
+	assert.Equal(t, data[100:700], b)
+	assert.Equal(t, HedgedReadStats{Ops: 1, Wins: 1}, hr.Pool.Stats())
+
+	// The slower read is cancelled by closing its connection.
+	select {
+	case <-slow.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slower read wasn't cancelled")
+	}
+
+	_, requests := slow.stats()
+	assert.Equal(t, 1, requests)
+
+	// The connection used by the hedged read is reused.
+	hr.Block.Locs = hr.Block.Locs[1:]
+	b = make([]byte, 100)
+	_, err = hr.ReadAt(b, 0)
+	require.NoError(t, err)
+	assert.Equal(t, data[:100], b)
+	assert.Equal(t, HedgedReadStats{Ops: 1, Wins: 1}, hr.Pool.Stats())
+
+	dials, requests := fast.stats()
+	assert.Equal(t, 1, dials)
+	assert.Equal(t, 2, requests)
+}
+
+func TestHedgedReadRejected(t *testing.T) {
+	data := makeTestHedgedReadData(1000)
+	slow := newFakeReadDatanode(t, data)
+	slow.delay = 50 * time.Millisecond
+	fast := newFakeReadDatanode(t, data)
+
+	datanodes := map[string]*fakeReadDatanode{"rejected-slow": slow, "rejected-fast": fast}
+	hr := newTestHedgedRead(datanodes, []string{"rejected-slow", "rejected-fast"}, len(data))
+	hr.Pool = NewHedgedReadPool(0)
+
+	// With no room in the pool, the read waits for the first datanode.
+	b := make([]byte, 500)
+	_, err := hr.ReadAt(b, 0)
+	require.NoError(t, err)
+	assert.Equal(t, data[:500], b)
+
+	stats := hr.Pool.Stats()
+	assert.EqualValues(t, 0, stats.Ops)
+	assert.EqualValues(t, 0, stats.Wins)
+	assert.Greater(t, stats.Rejected, int64(0))
+
+	_, requests := fast.stats()
+	assert.Equal(t, 0, requests)
+}
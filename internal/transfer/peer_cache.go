@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// PeerCache keeps idle connections to datanodes, after an operation on them
+// has finished cleanly, so that they can be reused for the next operation
+// against the same datanode. That saves a TCP handshake and, if data transfer
+// protection is enabled, a SASL handshake.
+//
+// Datanodes close idle connections after dfs.datanode.socket.reuse.keepalive
+// (four seconds, by default), so the expiry should be shorter than that. Even
+// so, a cached connection may turn out to be closed when it's used, so
+// callers should retry on a new connection if an operation fails on a cached
+// one.
+//
+// A nil *PeerCache is valid, and never caches anything. PeerCache is safe for
+// concurrent use.
+type PeerCache struct {
+	capacity int
+	expiry   time.Duration
+
+	peers  map[string][]idlePeer
+	size   int
+	closed bool
+	lock   sync.Mutex
+}
+
+type idlePeer struct {
+	conn      net.Conn
+	idleSince time.Time
+}
+
+// NewPeerCache returns a PeerCache that keeps up to capacity idle connections,
+// each for up to expiry.
+func NewPeerCache(capacity int, expiry time.Duration) *PeerCache {
+	return &PeerCache{
+		capacity: capacity,
+		expiry:   expiry,
+		peers:    make(map[string][]idlePeer),
+	}
+}
+
+// Get returns an idle connection to the given address, or nil if there isn't
+// one. Expired connections are closed and skipped.
+func (pc *PeerCache) Get(address string) net.Conn {
+	if pc == nil {
+		return nil
+	}
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	pc.evictExpired(time.Now())
+
+	// Take the most recently used connection, since it's the least likely to
+	// have been closed by the datanode.
+	peers := pc.peers[address]
+	if len(peers) == 0 {
+		return nil
+	}
+
+	peer := peers[len(peers)-1]
+	pc.remove(address, len(peers)-1)
+	return peer.conn
+}
+
+// Put adds an idle connection to the given address to the cache, and clears
+// its deadline. If the cache is full, the oldest connection in it is closed to
+// make room.
+func (pc *PeerCache) Put(address string, conn net.Conn) {
+	if pc == nil || pc.capacity <= 0 {
+		conn.Close()
+		return
+	}
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.closed || conn.SetDeadline(time.Time{}) != nil {
+		conn.Close()
+		return
+	}
+
+	now := time.Now()
+	pc.evictExpired(now)
+	if pc.size >= pc.capacity {
+		pc.evictOldest()
+	}
+
+	pc.peers[address] = append(pc.peers[address], idlePeer{conn: conn, idleSince: now})
+	pc.size++
+}
+
+// Close closes all the idle connections in the cache. Connections put into
+// the cache afterwards are closed immediately.
+func (pc *PeerCache) Close() error {
+	if pc == nil {
+		return nil
+	}
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	for address, peers := range pc.peers {
+		for _, peer := range peers {
+			peer.conn.Close()
+		}
+
+		delete(pc.peers, address)
+	}
+
+	pc.size = 0
+	pc.closed = true
+	return nil
+}
+
+func (pc *PeerCache) evictExpired(now time.Time) {
+	for address, peers := range pc.peers {
+		// Peers are appended in order, so the expired ones are at the front.
+		i := 0
+		for i < len(peers) && now.Sub(peers[i].idleSince) >= pc.expiry {
+			peers[i].conn.Close()
+			i++
+		}
+
+		if i > 0 {
+			pc.size -= i
+			if i == len(peers) {
+				delete(pc.peers, address)
+			} else {
+				pc.peers[address] = peers[i:]
+			}
+		}
+	}
+}
+
+func (pc *PeerCache) evictOldest() {
+	var oldestAddress string
+	var oldest time.Time
+	for address, peers := range pc.peers {
+		if oldest.IsZero() || peers[0].idleSince.Before(oldest) {
+			oldestAddress = address
+			oldest = peers[0].idleSince
+		}
+	}
+
+	if oldestAddress != "" {
+		pc.peers[oldestAddress][0].conn.Close()
+		pc.remove(oldestAddress, 0)
+	}
+}
+
+func (pc *PeerCache) remove(address string, i int) {
+	peers := pc.peers[address]
+	peers = append(peers[:i:i], peers[i+1:]...)
+	if len(peers) == 0 {
+		delete(pc.peers, address)
+	} else {
+		pc.peers[address] = peers
+	}
+
+	pc.size--
+}
@@ -0,0 +1,83 @@
+package transfer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConn(t *testing.T) net.Conn {
+	a, b := net.Pipe()
+	t.Cleanup(func() { b.Close() })
+	return a
+}
+
+func isClosed(conn net.Conn) bool {
+	return conn.SetDeadline(time.Time{}) != nil
+}
+
+func TestPeerCacheGetPut(t *testing.T) {
+	pc := NewPeerCache(4, time.Minute)
+	assert.Nil(t, pc.Get("foo:6000"))
+
+	conn1 := newTestConn(t)
+	conn2 := newTestConn(t)
+	pc.Put("foo:6000", conn1)
+	pc.Put("foo:6000", conn2)
+
+	assert.Nil(t, pc.Get("bar:6000"))
+	assert.Equal(t, conn2, pc.Get("foo:6000"))
+	assert.Equal(t, conn1, pc.Get("foo:6000"))
+	assert.Nil(t, pc.Get("foo:6000"))
+	assert.False(t, isClosed(conn1))
+}
+
+func TestPeerCacheCapacity(t *testing.T) {
+	pc := NewPeerCache(2, time.Minute)
+
+	conns := []net.Conn{newTestConn(t), newTestConn(t), newTestConn(t)}
+	pc.Put("foo:6000", conns[0])
+	pc.Put("bar:6000", conns[1])
+	pc.Put("bar:6000", conns[2])
+
+	assert.True(t, isClosed(conns[0]))
+	assert.Nil(t, pc.Get("foo:6000"))
+	assert.Equal(t, conns[2], pc.Get("bar:6000"))
+	assert.Equal(t, conns[1], pc.Get("bar:6000"))
+}
+
+func TestPeerCacheExpiry(t *testing.T) {
+	pc := NewPeerCache(2, time.Millisecond)
+
+	conn := newTestConn(t)
+	pc.Put("foo:6000", conn)
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Nil(t, pc.Get("foo:6000"))
+	assert.True(t, isClosed(conn))
+}
+
+func TestPeerCacheClose(t *testing.T) {
+	pc := NewPeerCache(2, time.Minute)
+
+	conn1 := newTestConn(t)
+	pc.Put("foo:6000", conn1)
+	pc.Close()
+	assert.True(t, isClosed(conn1))
+
+	conn2 := newTestConn(t)
+	pc.Put("foo:6000", conn2)
+	assert.True(t, isClosed(conn2))
+	assert.Nil(t, pc.Get("foo:6000"))
+}
+
+func TestNilPeerCache(t *testing.T) {
+	var pc *PeerCache
+
+	conn := newTestConn(t)
+	pc.Put("foo:6000", conn)
+	assert.True(t, isClosed(conn))
+	assert.Nil(t, pc.Get("foo:6000"))
+}
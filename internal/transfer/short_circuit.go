@@ -0,0 +1,601 @@
+package transfer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// shortCircuitDisableInterval is how long short-circuit reads are disabled
+	// for a datanode after they fail in a way that suggests they won't work
+	// for any block, like the socket being missing. It mirrors
+	// dfs.domain.socket.disable.interval.seconds.
+	shortCircuitDisableInterval = 10 * time.Minute
+	// shortCircuitTimeout is the deadline for each request over the domain
+	// socket.
+	shortCircuitTimeout = 30 * time.Second
+	// maxLocalRead limits how much a single read from a local replica buffers
+	// for checksum verification.
+	maxLocalRead = 1024 * 1024
+
+	blockMetaVersion    = 1
+	blockMetaHeaderSize = 7
+)
+
+var (
+	errNoLocalReplica      = errors.New("no replica on a local datanode")
+	errShortCircuitOff     = errors.New("short-circuit reads are temporarily disabled for the datanode")
+	errReplicaInvalidated  = errors.New("short-circuit replica was invalidated by the datanode")
+	errShortCircuitClosed  = errors.New("short-circuit reads have been shut down")
+	errShortCircuitNoFiles = errors.New("datanode didn't send any file descriptors")
+)
+
+// ShortCircuit implements short-circuit local reads, which read blocks
+// directly from the files of a datanode running on the same host, instead of
+// over TCP. The files are passed over a UNIX domain socket, along with a slot
+// in a segment of shared memory, which the datanode uses to tell us if the
+// replica becomes invalid, for example because the block was deleted.
+//
+// It's used by BlockReader, which falls back to a normal read if the block
+// has no local replica or the short-circuit read fails for some other reason.
+// Short-circuit reads are only supported on Linux.
+//
+// ShortCircuit is safe for concurrent use, and should be shared by all the
+// reads for a client.
+type ShortCircuit struct {
+	// SocketPath is the path of the datanodes' UNIX domain socket, as
+	// configured with dfs.domain.socket.path. The special string '_PORT' is
+	// replaced with the data transfer port of the datanode.
+	SocketPath string
+	// ClientName is the unique ID used by the NamenodeConnection.
+	ClientName string
+	// SkipChecksum disables checksum verification for short-circuit reads.
+	SkipChecksum bool
+
+	segments map[string][]*shmSegment
+	disabled map[string]time.Time
+	closed   bool
+	lock     sync.Mutex
+}
+
+// shortCircuitError is returned if a datanode refuses a request over the
+// domain socket.
+type shortCircuitError struct {
+	status  hdfs.Status
+	message string
+}
+
+func (e *shortCircuitError) Error() string {
+	return fmt.Sprintf("short-circuit request failed: %s (%s)", e.status, e.message)
+}
+
+// Close releases all the shared memory segments. Replicas which are still
+// open keep working, and their segments are released once they're closed.
+func (sc *ShortCircuit) Close() error {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.closed = true
+	for path, segments := range sc.segments {
+		for _, seg := range segments {
+			seg.close()
+		}
+
+		delete(sc.segments, path)
+	}
+
+	return nil
+}
+
+// open requests the files for a local replica of the block.
+func (sc *ShortCircuit) open(block *hdfs.LocatedBlockProto) (*localReplica, error) {
+	dn := localDatanode(block)
+	if dn == nil {
+		return nil, errNoLocalReplica
+	}
+
+	path := strings.ReplaceAll(sc.SocketPath, "_PORT", strconv.Itoa(int(dn.GetXferPort())))
+	if !sc.enabled(path) {
+		return nil, errShortCircuitOff
+	}
+
+	replica, err := sc.requestReplica(path, block)
+	if err != nil {
+		// Errors specific to the block (like an expired token) don't mean that
+		// other blocks would fail too.
+		var scErr *shortCircuitError
+		if !errors.As(err, &scErr) || scErr.status == hdfs.Status_ERROR_UNSUPPORTED {
+			sc.disable(path)
+		}
+
+		return nil, err
+	}
+
+	return replica, nil
+}
+
+func (sc *ShortCircuit) enabled(path string) bool {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	disabledAt, ok := sc.disabled[path]
+	return !ok || time.Since(disabledAt) > shortCircuitDisableInterval
+}
+
+func (sc *ShortCircuit) disable(path string) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if sc.disabled == nil {
+		sc.disabled = make(map[string]time.Time)
+	}
+
+	sc.disabled[path] = time.Now()
+}
+
+// A request for short-circuit access to a block:
+// +-----------------------------------------------------------+
+// |  Data Transfer Protocol Version, int16                    |
+// +-----------------------------------------------------------+
+// |  Op code, 1 byte (REQUEST_SHORT_CIRCUIT_FDS = 0x57)       |
+// +-----------------------------------------------------------+
+// |  varint length + OpRequestShortCircuitAccessProto         |
+// +-----------------------------------------------------------+
+//
+// The datanode responds with a varint-prefixed BlockOpResponseProto, and then
+// sends the block and meta files as file descriptors, along with a single
+// byte that says whether it wants a byte back to confirm they arrived.
+func (sc *ShortCircuit) requestReplica(path string, block *hdfs.LocatedBlockProto) (*localReplica, error) {
+	slot, err := sc.allocSlot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialDomainSocket(path)
+	if err != nil {
+		sc.freeSlot(slot)
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(shortCircuitTimeout))
+	if err != nil {
+		sc.freeSlot(slot)
+		return nil, err
+	}
+
+	op := &hdfs.OpRequestShortCircuitAccessProto{
+		Header: &hdfs.BaseHeaderProto{
+			Block: block.GetB(),
+			Token: block.GetBlockToken(),
+		},
+		MaxVersion:                  proto.Uint32(blockMetaVersion),
+		SlotId:                      slot.proto(),
+		SupportsReceiptVerification: proto.Bool(true),
+	}
+
+	err = writeBlockOpRequest(conn, requestShortCircuitFdsOp, op)
+	if err != nil {
+		sc.freeSlot(slot)
+		return nil, err
+	}
+
+	resp := &hdfs.BlockOpResponseProto{}
+	err = readPrefixedMessageExact(conn, resp)
+	if err != nil {
+		sc.freeSlot(slot)
+		return nil, err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		sc.freeSlot(slot)
+		return nil, &shortCircuitError{resp.GetStatus(), resp.GetMessage()}
+	}
+
+	// From here on, the datanode has registered the slot, so it has to be
+	// released rather than just freed.
+	files, b, err := receiveFiles(conn, 2)
+	if err == nil && len(files) != 2 {
+		closeFiles(files)
+		err = errShortCircuitNoFiles
+	}
+
+	if err == nil && b == byte(hdfs.ShortCircuitFdResponse_USE_RECEIPT_VERIFICATION) {
+		_, err = conn.Write([]byte{0})
+		if err != nil {
+			closeFiles(files)
+		}
+	}
+
+	if err != nil {
+		sc.releaseSlot(path, slot)
+		return nil, err
+	}
+
+	replica, err := newLocalReplica(files[0], files[1],
+		int64(block.GetB().GetNumBytes()), sc.SkipChecksum)
+	if err != nil {
+		closeFiles(files)
+		sc.releaseSlot(path, slot)
+		return nil, err
+	}
+
+	replica.slot = slot
+	replica.release = func() { sc.releaseSlot(path, slot) }
+	return replica, nil
+}
+
+// allocSlot allocates a slot in a shared memory segment for the datanode,
+// requesting a new segment if there isn't one with free slots.
+func (sc *ShortCircuit) allocSlot(path string) (*shmSlot, error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if sc.closed {
+		return nil, errShortCircuitClosed
+	}
+
+	var live []*shmSegment
+	for _, seg := range sc.segments[path] {
+		if seg.disconnected() {
+			seg.close()
+		} else {
+			live = append(live, seg)
+		}
+	}
+
+	for _, seg := range live {
+		if slot := seg.allocSlot(); slot != nil {
+			sc.segments[path] = live
+			return slot, nil
+		}
+	}
+
+	seg, err := requestShm(path, sc.ClientName)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc.segments == nil {
+		sc.segments = make(map[string][]*shmSegment)
+	}
+
+	sc.segments[path] = append(live, seg)
+	return seg.allocSlot(), nil
+}
+
+// freeSlot frees a slot that the datanode doesn't know about.
+func (sc *ShortCircuit) freeSlot(slot *shmSlot) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	slot.segment.freeSlot(slot)
+}
+
+// A request to release a shared memory slot:
+// +-----------------------------------------------------------+
+// |  Data Transfer Protocol Version, int16                    |
+// +-----------------------------------------------------------+
+// |  Op code, 1 byte (RELEASE_SHORT_CIRCUIT_FDS = 0x58)       |
+// +-----------------------------------------------------------+
+// |  varint length + ReleaseShortCircuitAccessRequestProto    |
+// +-----------------------------------------------------------+
+//
+// The datanode responds with a varint-prefixed
+// ReleaseShortCircuitAccessResponseProto.
+func (sc *ShortCircuit) releaseSlot(path string, slot *shmSlot) {
+	slot.makeInvalid()
+
+	err := sc.sendRelease(path, slot)
+	if err != nil {
+		// If the datanode doesn't know that the slot was released, reusing it
+		// would fail, so it's better to leak it.
+		return
+	}
+
+	sc.freeSlot(slot)
+}
+
+func (sc *ShortCircuit) sendRelease(path string, slot *shmSlot) error {
+	conn, err := dialDomainSocket(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(shortCircuitTimeout))
+	if err != nil {
+		return err
+	}
+
+	req := &hdfs.ReleaseShortCircuitAccessRequestProto{SlotId: slot.proto()}
+	err = writeBlockOpRequest(conn, releaseShortCircuitFdsOp, req)
+	if err != nil {
+		return err
+	}
+
+	resp := &hdfs.ReleaseShortCircuitAccessResponseProto{}
+	err = readPrefixedMessageExact(conn, resp)
+	if err != nil {
+		return err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return &shortCircuitError{resp.GetStatus(), resp.GetError()}
+	}
+
+	return nil
+}
+
+// A request for a shared memory segment:
+// +-----------------------------------------------------------+
+// |  Data Transfer Protocol Version, int16                    |
+// +-----------------------------------------------------------+
+// |  Op code, 1 byte (REQUEST_SHORT_CIRCUIT_SHM = 0x59)       |
+// +-----------------------------------------------------------+
+// |  varint length + ShortCircuitShmRequestProto              |
+// +-----------------------------------------------------------+
+//
+// The datanode responds with a varint-prefixed ShortCircuitShmResponseProto,
+// and then sends the segment as a file descriptor. The connection has to stay
+// open for as long as the segment is used; the datanode frees the segment
+// when it's closed.
+func requestShm(path, clientName string) (*shmSegment, error) {
+	conn, err := dialDomainSocket(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seg, err := requestShmOn(conn, clientName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+func requestShmOn(conn *net.UnixConn, clientName string) (*shmSegment, error) {
+	err := conn.SetDeadline(time.Now().Add(shortCircuitTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	req := &hdfs.ShortCircuitShmRequestProto{ClientName: proto.String(clientName)}
+	err = writeBlockOpRequest(conn, requestShortCircuitShmOp, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &hdfs.ShortCircuitShmResponseProto{}
+	err = readPrefixedMessageExact(conn, resp)
+	if err != nil {
+		return nil, err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return nil, &shortCircuitError{resp.GetStatus(), resp.GetError()}
+	}
+
+	files, _, err := receiveFiles(conn, 1)
+	if err != nil {
+		return nil, err
+	} else if len(files) != 1 {
+		closeFiles(files)
+		return nil, errShortCircuitNoFiles
+	}
+
+	// The file can be closed once it's mapped.
+	defer files[0].Close()
+	mem, err := mapShm(files[0])
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		unmapShm(mem)
+		return nil, err
+	}
+
+	return newShmSegment(resp.GetId(), mem, conn), nil
+}
+
+// localDatanode returns the first datanode with a replica of the block that's
+// running on this host, or nil if there isn't one.
+func localDatanode(block *hdfs.LocatedBlockProto) *hdfs.DatanodeIDProto {
+	for _, loc := range block.GetLocs() {
+		if isLocalAddress(loc.GetId().GetIpAddr()) {
+			return loc.GetId()
+		}
+	}
+
+	return nil
+}
+
+var (
+	localAddresses     map[string]bool
+	localAddressesOnce sync.Once
+)
+
+func isLocalAddress(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	} else if ip.IsLoopback() {
+		return true
+	}
+
+	localAddressesOnce.Do(func() {
+		localAddresses = make(map[string]bool)
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return
+		}
+
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				localAddresses[ipNet.IP.String()] = true
+			}
+		}
+	})
+
+	return localAddresses[ip.String()]
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// localReplica reads a block from the files of a local datanode.
+type localReplica struct {
+	data        *os.File
+	meta        *os.File
+	length      int64
+	checksumTab *crc32.Table
+	chunkSize   int64
+
+	slot    *shmSlot
+	release func()
+}
+
+// The meta file for a block starts with a header:
+// +-----------------------------------------------------------+
+// |  Version, int16                                           |
+// +-----------------------------------------------------------+
+// |  Checksum type, 1 byte                                    |
+// +-----------------------------------------------------------+
+// |  Bytes per checksum, int32                                |
+// +-----------------------------------------------------------+
+//
+// Followed by the checksum for each chunk of the block.
+func newLocalReplica(data, meta *os.File, length int64, skipChecksum bool) (*localReplica, error) {
+	header := make([]byte, blockMetaHeaderSize)
+	_, err := meta.ReadAt(header, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading block meta header: %w", err)
+	}
+
+	version := binary.BigEndian.Uint16(header[0:2])
+	if version != blockMetaVersion {
+		return nil, fmt.Errorf("unsupported block meta version: %d", version)
+	}
+
+	r := &localReplica{
+		data:      data,
+		meta:      meta,
+		length:    length,
+		chunkSize: int64(binary.BigEndian.Uint32(header[3:7])),
+	}
+
+	switch hdfs.ChecksumTypeProto(header[2]) {
+	case hdfs.ChecksumTypeProto_CHECKSUM_NULL:
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32:
+		r.checksumTab = crc32.IEEETable
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32C:
+		r.checksumTab = crc32.MakeTable(crc32.Castagnoli)
+	default:
+		return nil, fmt.Errorf("unsupported checksum type: %d", header[2])
+	}
+
+	if r.chunkSize <= 0 {
+		return nil, errors.New("invalid block meta header")
+	} else if skipChecksum {
+		r.checksumTab = nil
+	}
+
+	return r, nil
+}
+
+// ReadAt reads from the block at off, verifying the checksums of the data it
+// reads. It reads at most maxLocalRead bytes, and never past the end of the
+// block, but otherwise fills b.
+func (r *localReplica) ReadAt(b []byte, off int64) (int, error) {
+	if r.slot != nil && !r.slot.valid() {
+		return 0, errReplicaInvalidated
+	}
+
+	if len(b) > maxLocalRead {
+		b = b[:maxLocalRead]
+	}
+
+	if remaining := r.length - off; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+
+	if r.checksumTab == nil {
+		return r.readData(b, off)
+	}
+
+	// Checksums cover whole chunks, so read from the start of the first one to
+	// the end of the last one.
+	start := off - off%r.chunkSize
+	end := off + int64(len(b))
+	if rem := end % r.chunkSize; rem != 0 {
+		end += r.chunkSize - rem
+	}
+
+	if end > r.length {
+		end = r.length
+	}
+
+	buf := make([]byte, end-start)
+	_, err := r.readData(buf, start)
+	if err != nil {
+		return 0, err
+	}
+
+	numChunks := (int64(len(buf)) + r.chunkSize - 1) / r.chunkSize
+	checksums := make([]byte, numChunks*4)
+	_, err = r.meta.ReadAt(checksums, blockMetaHeaderSize+(start/r.chunkSize)*4)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i := int64(0); i < numChunks; i++ {
+		chunkEnd := (i + 1) * r.chunkSize
+		if chunkEnd > int64(len(buf)) {
+			chunkEnd = int64(len(buf))
+		}
+
+		crc := crc32.Checksum(buf[i*r.chunkSize:chunkEnd], r.checksumTab)
+		if crc != binary.BigEndian.Uint32(checksums[i*4:]) {
+			return 0, ErrInvalidChecksum
+		}
+	}
+
+	return copy(b, buf[off-start:]), nil
+}
+
+func (r *localReplica) readData(b []byte, off int64) (int, error) {
+	n, err := r.data.ReadAt(b, off)
+	if err == io.EOF {
+		// The block is shorter than the namenode said it was.
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// Close closes the files, and releases the shared memory slot.
+func (r *localReplica) Close() error {
+	r.data.Close()
+	r.meta.Close()
+	if r.release != nil {
+		r.release()
+	}
+
+	return nil
+}
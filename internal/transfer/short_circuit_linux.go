@@ -0,0 +1,69 @@
+//go:build linux
+
+package transfer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// maxReceivedFiles is the most file descriptors the datanode sends at once.
+const maxReceivedFiles = 2
+
+func dialDomainSocket(path string) (*net.UnixConn, error) {
+	return net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+}
+
+// receiveFiles reads a single byte from the connection, along with up to n
+// file descriptors passed alongside it.
+func receiveFiles(conn *net.UnixConn, n int) ([]*os.File, byte, error) {
+	b := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(maxReceivedFiles*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(b, oob)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var files []*os.File
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			closeFiles(files)
+			return nil, 0, err
+		}
+
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "short-circuit"))
+		}
+	}
+
+	if len(files) > n {
+		closeFiles(files)
+		return nil, 0, errors.New("datanode sent too many file descriptors")
+	}
+
+	return files, b[0], nil
+}
+
+func mapShm(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	} else if info.Size() < shmSlotSize {
+		return nil, errors.New("shared memory segment is too small")
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(info.Size()),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func unmapShm(mem []byte) {
+	syscall.Munmap(mem)
+}
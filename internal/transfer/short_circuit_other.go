@@ -0,0 +1,25 @@
+//go:build !linux
+
+package transfer
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+var errShortCircuitUnsupported = errors.New("short-circuit reads are only supported on Linux")
+
+func dialDomainSocket(path string) (*net.UnixConn, error) {
+	return nil, errShortCircuitUnsupported
+}
+
+func receiveFiles(conn *net.UnixConn, n int) ([]*os.File, byte, error) {
+	return nil, 0, errShortCircuitUnsupported
+}
+
+func mapShm(f *os.File) ([]byte, error) {
+	return nil, errShortCircuitUnsupported
+}
+
+func unmapShm(mem []byte) {}
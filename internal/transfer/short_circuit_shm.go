@@ -0,0 +1,139 @@
+package transfer
+
+import (
+	"net"
+	"sync/atomic"
+	"unsafe"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// shmSlotSize is the size of each slot in a shared memory segment. Only
+	// the first eight bytes, which hold the flags, are used by the client.
+	shmSlotSize = 64
+
+	shmSlotValidFlag = uint64(1) << 63
+)
+
+// shmSegment is a segment of memory shared with a datanode, split into slots.
+// Each open local replica uses a slot, which the datanode clears to tell us
+// the replica is no longer valid.
+//
+// The segment stays registered with the datanode for as long as the
+// connection it was requested on is open. Access to the slot allocations
+// is synchronized by ShortCircuit.
+type shmSegment struct {
+	id    *hdfs.ShortCircuitShmIdProto
+	mem   []byte
+	conn  net.Conn
+	used  []bool
+	inUse int
+
+	dead   atomic.Bool
+	closed bool
+}
+
+// shmSlot is a single slot in a shmSegment.
+type shmSlot struct {
+	segment *shmSegment
+	index   int
+}
+
+func newShmSegment(id *hdfs.ShortCircuitShmIdProto, mem []byte, conn net.Conn) *shmSegment {
+	seg := &shmSegment{
+		id:   id,
+		mem:  mem,
+		conn: conn,
+		used: make([]bool, len(mem)/shmSlotSize),
+	}
+
+	// The datanode never sends anything else on the connection, so a read
+	// only returns once it's closed.
+	go func() {
+		b := make([]byte, 1)
+		for {
+			_, err := conn.Read(b)
+			if err != nil {
+				seg.dead.Store(true)
+				return
+			}
+		}
+	}()
+
+	return seg
+}
+
+// disconnected returns true if the datanode closed the connection for the
+// segment, which means it's no longer usable for new slots.
+func (seg *shmSegment) disconnected() bool {
+	return seg.dead.Load()
+}
+
+func (seg *shmSegment) allocSlot() *shmSlot {
+	if seg.closed || seg.disconnected() {
+		return nil
+	}
+
+	for i, used := range seg.used {
+		if !used {
+			seg.used[i] = true
+			seg.inUse++
+
+			slot := &shmSlot{segment: seg, index: i}
+			atomic.StoreUint64(slot.flags(), shmSlotValidFlag)
+			return slot
+		}
+	}
+
+	return nil
+}
+
+func (seg *shmSegment) freeSlot(slot *shmSlot) {
+	atomic.StoreUint64(slot.flags(), 0)
+	seg.used[slot.index] = false
+	seg.inUse--
+
+	if seg.closed && seg.inUse == 0 {
+		unmapShm(seg.mem)
+	}
+}
+
+// close unregisters the segment with the datanode. The memory is unmapped
+// once all the slots in it have been freed.
+func (seg *shmSegment) close() {
+	if seg.closed {
+		return
+	}
+
+	seg.closed = true
+	seg.conn.Close()
+	if seg.inUse == 0 {
+		unmapShm(seg.mem)
+	}
+}
+
+func (slot *shmSlot) flags() *uint64 {
+	return (*uint64)(unsafe.Pointer(&slot.segment.mem[slot.index*shmSlotSize]))
+}
+
+func (slot *shmSlot) valid() bool {
+	return atomic.LoadUint64(slot.flags())&shmSlotValidFlag != 0
+}
+
+func (slot *shmSlot) makeInvalid() {
+	for {
+		flags := atomic.LoadUint64(slot.flags())
+		if atomic.CompareAndSwapUint64(slot.flags(), flags, flags&^shmSlotValidFlag) {
+			return
+		}
+	}
+}
+
+func (slot *shmSlot) proto() *hdfs.ShortCircuitShmSlotProto {
+	return &hdfs.ShortCircuitShmSlotProto{
+		ShmId:   slot.segment.id,
+		SlotIdx: proto.Int32(int32(slot.index)),
+	}
+}
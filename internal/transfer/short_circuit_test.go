@@ -0,0 +1,339 @@
+//go:build linux
+
+package transfer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+const testShmSize = 4096
+
+var errTestDial = errors.New("dialed datanode")
+
+// fakeShortCircuitDatanode implements the datanode's side of short-circuit
+// reads, serving a single block from files in a temporary directory.
+type fakeShortCircuitDatanode struct {
+	t          *testing.T
+	socketPath string
+	data       *os.File
+	meta       *os.File
+	shm        *os.File
+	shmMem     []byte
+	status     hdfs.Status
+
+	requests atomic.Int64
+	releases atomic.Int64
+	wg       sync.WaitGroup
+}
+
+func newFakeShortCircuitDatanode(t *testing.T, data []byte) *fakeShortCircuitDatanode {
+	dir := t.TempDir()
+	dn := &fakeShortCircuitDatanode{
+		t:          t,
+		socketPath: filepath.Join(dir, "dn_socket._PORT"),
+		status:     hdfs.Status_SUCCESS,
+	}
+
+	var err error
+	dn.data, err = os.Create(filepath.Join(dir, "blk_1"))
+	require.NoError(t, err)
+	_, err = dn.data.Write(data)
+	require.NoError(t, err)
+
+	dn.meta, err = os.Create(filepath.Join(dir, "blk_1.meta"))
+	require.NoError(t, err)
+	_, err = dn.meta.Write(makeTestBlockMeta(data, 512))
+	require.NoError(t, err)
+
+	dn.shm, err = os.Create(filepath.Join(dir, "shm"))
+	require.NoError(t, err)
+	require.NoError(t, dn.shm.Truncate(testShmSize))
+	dn.shmMem, err = mapShm(dn.shm)
+	require.NoError(t, err)
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{
+		Name: filepath.Join(dir, "dn_socket.50010"),
+		Net:  "unix",
+	})
+	require.NoError(t, err)
+
+	dn.wg.Add(1)
+	go dn.serve(listener)
+	t.Cleanup(func() {
+		listener.Close()
+		dn.wg.Wait()
+		unmapShm(dn.shmMem)
+		dn.data.Close()
+		dn.meta.Close()
+		dn.shm.Close()
+	})
+
+	return dn
+}
+
+func makeTestBlockMeta(data []byte, chunkSize int) []byte {
+	meta := make([]byte, blockMetaHeaderSize)
+	binary.BigEndian.PutUint16(meta[0:2], blockMetaVersion)
+	meta[2] = byte(hdfs.ChecksumTypeProto_CHECKSUM_CRC32C)
+	binary.BigEndian.PutUint32(meta[3:7], uint32(chunkSize))
+
+	tab := crc32.MakeTable(crc32.Castagnoli)
+	for off := 0; off < len(data); off += chunkSize {
+		end := off + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		meta = binary.BigEndian.AppendUint32(meta, crc32.Checksum(data[off:end], tab))
+	}
+
+	return meta
+}
+
+func (dn *fakeShortCircuitDatanode) serve(listener *net.UnixListener) {
+	defer dn.wg.Done()
+	for {
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+
+		dn.wg.Add(1)
+		go func() {
+			defer dn.wg.Done()
+			defer conn.Close()
+			dn.handle(conn)
+		}()
+	}
+}
+
+func (dn *fakeShortCircuitDatanode) handle(conn *net.UnixConn) {
+	header := make([]byte, 3)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return
+	}
+
+	switch header[2] {
+	case requestShortCircuitShmOp:
+		req := &hdfs.ShortCircuitShmRequestProto{}
+		require.NoError(dn.t, readPrefixedMessageExact(conn, req))
+		dn.writeResponse(conn, &hdfs.ShortCircuitShmResponseProto{
+			Status: hdfs.Status_SUCCESS.Enum(),
+			Id:     &hdfs.ShortCircuitShmIdProto{Hi: proto.Int64(1), Lo: proto.Int64(2)},
+		})
+		dn.sendFiles(conn, 0, dn.shm)
+
+		// Hold the connection open until the client closes it.
+		io.Copy(io.Discard, conn)
+	case requestShortCircuitFdsOp:
+		dn.requests.Add(1)
+		req := &hdfs.OpRequestShortCircuitAccessProto{}
+		require.NoError(dn.t, readPrefixedMessageExact(conn, req))
+		assert.Equal(dn.t, uint64(1), req.GetHeader().GetBlock().GetBlockId())
+
+		dn.writeResponse(conn, &hdfs.BlockOpResponseProto{Status: dn.status.Enum()})
+		if dn.status != hdfs.Status_SUCCESS {
+			return
+		}
+
+		dn.sendFiles(conn, byte(hdfs.ShortCircuitFdResponse_USE_RECEIPT_VERIFICATION), dn.data, dn.meta)
+		b := make([]byte, 1)
+		_, err := io.ReadFull(conn, b)
+		assert.NoError(dn.t, err)
+	case releaseShortCircuitFdsOp:
+		dn.releases.Add(1)
+		req := &hdfs.ReleaseShortCircuitAccessRequestProto{}
+		require.NoError(dn.t, readPrefixedMessageExact(conn, req))
+		dn.writeResponse(conn, &hdfs.ReleaseShortCircuitAccessResponseProto{
+			Status: hdfs.Status_SUCCESS.Enum(),
+		})
+	default:
+		dn.t.Errorf("unexpected op: %x", header[2])
+	}
+}
+
+func (dn *fakeShortCircuitDatanode) writeResponse(conn net.Conn, msg proto.Message) {
+	b, err := makePrefixedMessage(msg)
+	require.NoError(dn.t, err)
+	_, err = conn.Write(b)
+	require.NoError(dn.t, err)
+}
+
+func (dn *fakeShortCircuitDatanode) sendFiles(conn *net.UnixConn, b byte, files ...*os.File) {
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+
+	_, _, err := conn.WriteMsgUnix([]byte{b}, syscall.UnixRights(fds...), nil)
+	require.NoError(dn.t, err)
+}
+
+// invalidate clears the valid flag of the first slot, as the datanode would
+// if the replica was deleted.
+func (dn *fakeShortCircuitDatanode) invalidate() {
+	slot := &shmSlot{segment: &shmSegment{mem: dn.shmMem}}
+	slot.makeInvalid()
+}
+
+func newTestShortCircuitBlockReader(sc *ShortCircuit, length int, dials *atomic.Int64) *BlockReader {
+	return &BlockReader{
+		ClientName: "test",
+		Block: &hdfs.LocatedBlockProto{
+			B: &hdfs.ExtendedBlockProto{
+				PoolId:          proto.String("pool"),
+				BlockId:         proto.Uint64(1),
+				GenerationStamp: proto.Uint64(1),
+				NumBytes:        proto.Uint64(uint64(length)),
+			},
+			Locs: []*hdfs.DatanodeInfoProto{{
+				Id: &hdfs.DatanodeIDProto{
+					IpAddr:   proto.String("127.0.0.1"),
+					HostName: proto.String("localhost"),
+					XferPort: proto.Uint32(50010),
+				},
+			}},
+		},
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return nil, errTestDial
+		},
+		ShortCircuit: sc,
+	}
+}
+
+func makeTestBlockData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func TestShortCircuitRead(t *testing.T) {
+	data := makeTestBlockData(3*maxLocalRead + 1000)
+	dn := newFakeShortCircuitDatanode(t, data)
+	sc := &ShortCircuit{SocketPath: dn.socketPath, ClientName: "test"}
+	defer sc.Close()
+
+	var dials atomic.Int64
+	br := newTestShortCircuitBlockReader(sc, len(data), &dials)
+	br.Offset = 1000
+	b, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data[1000:], b)
+
+	br.Close()
+	assert.EqualValues(t, 0, dials.Load())
+	assert.EqualValues(t, 1, dn.requests.Load())
+	assert.EqualValues(t, 1, dn.releases.Load())
+
+	// The slot should be reused for the next replica.
+	br = newTestShortCircuitBlockReader(sc, len(data), &dials)
+	br.Length = 100
+	b, err = io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data[:100], b)
+
+	// Skipping doesn't need a connection.
+	br = newTestShortCircuitBlockReader(sc, len(data), &dials)
+	b = make([]byte, 10)
+	_, err = io.ReadFull(br, b)
+	require.NoError(t, err)
+	require.NoError(t, br.Skip(1024*1024))
+	_, err = io.ReadFull(br, b)
+	require.NoError(t, err)
+	assert.Equal(t, data[1024*1024+10:1024*1024+20], b)
+	br.Close()
+
+	assert.EqualValues(t, 0, dials.Load())
+}
+
+func TestShortCircuitChecksumFailure(t *testing.T) {
+	data := makeTestBlockData(10000)
+	dn := newFakeShortCircuitDatanode(t, data)
+	_, err := dn.data.WriteAt([]byte{data[5000] + 1}, 5000)
+	require.NoError(t, err)
+
+	sc := &ShortCircuit{SocketPath: dn.socketPath, ClientName: "test"}
+	defer sc.Close()
+
+	var dials atomic.Int64
+	br := newTestShortCircuitBlockReader(sc, len(data), &dials)
+	_, err = io.ReadAll(br)
+	assert.Equal(t, errTestDial, err)
+	assert.EqualValues(t, 1, dials.Load())
+	assert.EqualValues(t, 1, dn.releases.Load())
+
+	sc.SkipChecksum = true
+	br = newTestShortCircuitBlockReader(sc, len(data), &dials)
+	b, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data[:5000], b[:5000])
+	assert.EqualValues(t, 1, dials.Load())
+}
+
+func TestShortCircuitInvalidated(t *testing.T) {
+	data := makeTestBlockData(10000)
+	dn := newFakeShortCircuitDatanode(t, data)
+	sc := &ShortCircuit{SocketPath: dn.socketPath, ClientName: "test"}
+	defer sc.Close()
+
+	var dials atomic.Int64
+	br := newTestShortCircuitBlockReader(sc, len(data), &dials)
+	b := make([]byte, 1000)
+	_, err := io.ReadFull(br, b)
+	require.NoError(t, err)
+	assert.Equal(t, data[:1000], b)
+
+	dn.invalidate()
+	_, err = io.ReadFull(br, b)
+	assert.Equal(t, errTestDial, err)
+	assert.EqualValues(t, 1, dials.Load())
+}
+
+func TestShortCircuitUnsupported(t *testing.T) {
+	data := makeTestBlockData(10000)
+	dn := newFakeShortCircuitDatanode(t, data)
+	dn.status = hdfs.Status_ERROR_UNSUPPORTED
+	sc := &ShortCircuit{SocketPath: dn.socketPath, ClientName: "test"}
+	defer sc.Close()
+
+	var dials atomic.Int64
+	for i := 0; i < 2; i++ {
+		br := newTestShortCircuitBlockReader(sc, len(data), &dials)
+		_, err := io.ReadAll(br)
+		assert.Equal(t, errTestDial, err)
+	}
+
+	// After the first failure, the socket shouldn't be tried again.
+	assert.EqualValues(t, 1, dn.requests.Load())
+	assert.EqualValues(t, 2, dials.Load())
+}
+
+func TestShortCircuitNoSocket(t *testing.T) {
+	sc := &ShortCircuit{SocketPath: filepath.Join(t.TempDir(), "missing"), ClientName: "test"}
+	defer sc.Close()
+
+	var dials atomic.Int64
+	br := newTestShortCircuitBlockReader(sc, 1000, &dials)
+	_, err := io.ReadAll(br)
+	assert.Equal(t, errTestDial, err)
+	assert.EqualValues(t, 1, dials.Load())
+}
@@ -16,6 +16,11 @@ const (
 	writeBlockOp        = 0x50
 	readBlockOp         = 0x51
 	checksumBlockOp     = 0x55
+	transferBlockOp     = 0x56
+
+	requestShortCircuitFdsOp = 0x57
+	releaseShortCircuitFdsOp = 0x58
+	requestShortCircuitShmOp = 0x59
 )
 
 var errInvalidResponse = errors.New("invalid response from datanode")
@@ -64,6 +69,42 @@ func readPrefixedMessage(r io.Reader, msg proto.Message) error {
 	return proto.Unmarshal(respBytes, msg)
 }
 
+// readPrefixedMessageExact is like readPrefixedMessage, but it reads the
+// varint one byte at a time, so that it never reads past the end of the
+// message. That matters when the message is followed by something that isn't
+// part of the byte stream, like file descriptors passed over a UNIX domain
+// socket, or when the message is short and nothing follows it.
+func readPrefixedMessageExact(r io.Reader, msg proto.Message) error {
+	var varintBytes []byte
+	b := make([]byte, 1)
+	for {
+		_, err := io.ReadFull(r, b)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+
+		varintBytes = append(varintBytes, b[0])
+		if b[0] < 0x80 {
+			break
+		} else if len(varintBytes) == binary.MaxVarintLen32 {
+			return errInvalidResponse
+		}
+	}
+
+	respLength, _ := binary.Uvarint(varintBytes)
+	respBytes := make([]byte, respLength)
+	_, err := io.ReadFull(r, respBytes)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(respBytes, msg)
+}
+
 // A op request to a datanode:
 // +-----------------------------------------------------------+
 // |  Data Transfer Protocol Version, int16                    |
@@ -0,0 +1,281 @@
+package hdfs
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/colinmarc/hdfs/v2/internal/transfer"
+)
+
+const defaultReadAheadConcurrency = 4
+
+// readAhead prefetches a file for sequential reads. The file is split into
+// ranges which never cross a block boundary, and up to a fixed number of them
+// are fetched concurrently, each from its own BlockReader, into buffers that
+// are handed to Read in order.
+type readAhead struct {
+	f         *FileReader
+	budget    *readAheadBudget
+	rangeSize int64
+	maxRanges int
+
+	// next is the offset of the first byte that hasn't been scheduled yet.
+	next int64
+	// ranges are the scheduled ranges, in file order. The first one is the one
+	// currently being read from, at pos.
+	ranges []*prefetchRange
+	pos    int64
+}
+
+// readAheadBudget limits the memory used for read-ahead by a FileReader to
+// ReadAheadSize. A range's buffer counts against it until the range has been
+// both read (or discarded) and fetched (or cancelled), so that abandoned
+// fetches still count until they exit.
+type readAheadBudget struct {
+	size int64
+	used int64
+	cond *sync.Cond
+}
+
+type prefetchRange struct {
+	budget *readAheadBudget
+	buf    []byte
+	err    error
+	done   chan struct{}
+	// refs is two while the range is both scheduled and being fetched. The
+	// buffer is returned to the budget once it reaches zero.
+	refs int32
+
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+	conn      net.Conn
+	cancelled bool
+	lock      sync.Mutex
+}
+
+func newReadAheadBudget(size int64) *readAheadBudget {
+	return &readAheadBudget{size: size, cond: sync.NewCond(&sync.Mutex{})}
+}
+
+// acquire reserves n bytes. If block is true, it waits for enough bytes to be
+// released; otherwise, it returns false if there aren't enough. A request for
+// more than the whole budget succeeds once nothing else is outstanding.
+func (b *readAheadBudget) acquire(n int64, block bool) bool {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	for b.used > 0 && b.used+n > b.size {
+		if !block {
+			return false
+		}
+
+		b.cond.Wait()
+	}
+
+	b.used += n
+	return true
+}
+
+func (b *readAheadBudget) release(n int64) {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+func newReadAhead(f *FileReader, budget *readAheadBudget, concurrency int) *readAhead {
+	if concurrency <= 0 {
+		concurrency = defaultReadAheadConcurrency
+	}
+
+	rangeSize := budget.size / int64(concurrency)
+	if rangeSize <= 0 {
+		rangeSize = 1
+	}
+
+	return &readAhead{
+		f:         f,
+		budget:    budget,
+		rangeSize: rangeSize,
+		maxRanges: concurrency,
+		next:      f.offset,
+	}
+}
+
+// Read reads from the current offset of the FileReader, which must be the
+// offset the readAhead was created at plus everything read so far.
+func (ra *readAhead) Read(b []byte) (int, error) {
+	err := ra.schedule()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ra.ranges) == 0 {
+		return 0, io.EOF
+	}
+
+	r := ra.ranges[0]
+	<-r.done
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n := copy(b, r.buf[ra.pos:])
+	ra.pos += int64(n)
+	if ra.pos == int64(len(r.buf)) {
+		ra.pop()
+	}
+
+	return n, nil
+}
+
+// Skip discards n bytes, if they have already been scheduled. It returns
+// false if the skip isn't possible, in which case the readAhead should be
+// discarded.
+func (ra *readAhead) Skip(n int64) bool {
+	if n < 0 {
+		return false
+	}
+
+	for len(ra.ranges) > 0 {
+		r := ra.ranges[0]
+		remaining := int64(len(r.buf)) - ra.pos
+		if n < remaining {
+			ra.pos += n
+			return true
+		}
+
+		n -= remaining
+		ra.pop()
+	}
+
+	return n == 0
+}
+
+// pop discards the first range, cancelling it if it's still being fetched.
+func (ra *readAhead) pop() {
+	r := ra.ranges[0]
+	r.cancel()
+	r.unref()
+
+	ra.ranges[0] = nil
+	ra.ranges = ra.ranges[1:]
+	ra.pos = 0
+}
+
+// schedule starts fetching ranges until either the maximum number are
+// scheduled, the budget is used up, or the end of the file is reached. If
+// nothing is scheduled, it waits for the budget to schedule one range, since
+// the budget can only be used up by fetches that are being cancelled.
+func (ra *readAhead) schedule() error {
+	size := ra.f.info.Size()
+	for len(ra.ranges) < ra.maxRanges && ra.next < size {
+		br, blockEnd, err := ra.f.newBlockReader(ra.next)
+		if err != nil {
+			return err
+		}
+
+		end := ra.next + ra.rangeSize
+		if end > blockEnd {
+			end = blockEnd
+		}
+
+		length := end - ra.next
+		if !ra.budget.acquire(length, len(ra.ranges) == 0) {
+			break
+		}
+
+		r := &prefetchRange{
+			budget: ra.budget,
+			buf:    make([]byte, length),
+			done:   make(chan struct{}),
+			refs:   2,
+		}
+
+		r.ctx, r.cancelCtx = context.WithCancel(context.Background())
+
+		// Connections from the PeerCache can't be cancelled, since they don't
+		// go through DialFunc. The ranges are large enough that reusing a
+		// connection wouldn't save much anyway.
+		br.Length = length
+		br.DialFunc = r.dial(br.DialFunc)
+		br.PeerCache = nil
+
+		go r.fetch(br)
+		ra.ranges = append(ra.ranges, r)
+		ra.next = end
+	}
+
+	return nil
+}
+
+func (r *prefetchRange) fetch(br *transfer.BlockReader) {
+	defer r.unref()
+	defer close(r.done)
+	defer br.Close()
+
+	_, err := io.ReadFull(br, r.buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	r.err = err
+}
+
+// dial wraps a DialFunc such that the connection can be closed by cancel,
+// like a hedged read does.
+func (r *prefetchRange) dial(dialFunc dialContext) dialContext {
+	if dialFunc == nil {
+		dialFunc = (&net.Dialer{}).DialContext
+	}
+
+	return func(_ context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialFunc(r.ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.cancelled {
+			conn.Close()
+			return nil, context.Canceled
+		}
+
+		r.conn = conn
+		return conn, nil
+	}
+}
+
+// cancel interrupts the fetch, if it's still running, by closing its
+// connection. Reads from a local replica aren't interrupted, but those are
+// fast anyway.
+func (r *prefetchRange) cancel() {
+	r.cancelCtx()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cancelled = true
+	if r.conn != nil {
+		r.conn.Close()
+	}
+}
+
+func (r *prefetchRange) unref() {
+	if atomic.AddInt32(&r.refs, -1) == 0 {
+		r.budget.release(int64(len(r.buf)))
+	}
+}
+
+// Close cancels any outstanding fetches, by closing their connections. Their
+// buffers count against the budget until they have exited.
+func (ra *readAhead) Close() {
+	for len(ra.ranges) > 0 {
+		ra.pop()
+	}
+}
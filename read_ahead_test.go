@@ -0,0 +1,78 @@
+package hdfs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAheadBudget(t *testing.T) {
+	b := newReadAheadBudget(10)
+
+	assert.True(t, b.acquire(6, false))
+	assert.False(t, b.acquire(6, false))
+	assert.True(t, b.acquire(4, false))
+
+	acquired := make(chan struct{})
+	go func() {
+		b.acquire(6, true)
+		close(acquired)
+	}()
+
+	b.release(4)
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than the budget")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	b.release(6)
+	<-acquired
+
+	// A range bigger than the whole budget can still be fetched on its own.
+	b.release(6)
+	assert.True(t, b.acquire(20, false))
+}
+
+func TestPrefetchRangeCancel(t *testing.T) {
+	b := newReadAheadBudget(10)
+	require.True(t, b.acquire(5, false))
+
+	r := &prefetchRange{budget: b, buf: make([]byte, 5), refs: 2}
+	r.ctx, r.cancelCtx = context.WithCancel(context.Background())
+
+	var server net.Conn
+	dial := r.dial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var client net.Conn
+		client, server = net.Pipe()
+		return client, nil
+	})
+
+	conn, err := dial(context.Background(), "tcp", "datanode:9866")
+	require.NoError(t, err)
+
+	// Cancelling closes the connection, which interrupts a blocked read.
+	read := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	r.cancel()
+	assert.Error(t, <-read)
+	server.Close()
+
+	_, err = dial(context.Background(), "tcp", "datanode:9866")
+	assert.Equal(t, context.Canceled, err)
+
+	// The buffer is only returned to the budget once both the reader and the
+	// fetch are done with it.
+	r.unref()
+	assert.EqualValues(t, 5, b.used)
+	r.unref()
+	assert.EqualValues(t, 0, b.used)
+}
@@ -0,0 +1,177 @@
+package hdfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	// vectoredReadMaxGap is the largest gap between two ranges that
+	// ReadVectored will coalesce. Reading and discarding that much data is
+	// cheaper than another round trip to a datanode.
+	vectoredReadMaxGap = 64 * 1024
+	// vectoredReadMaxSize limits the size of coalesced ranges, so that large
+	// reads can still be done concurrently.
+	vectoredReadMaxSize = 8 * 1024 * 1024
+	// vectoredReadConcurrency limits how many reads ReadVectored does at once.
+	vectoredReadConcurrency = 8
+)
+
+// A FileRange is a range of a file to read with FileReader.ReadVectored.
+type FileRange struct {
+	// Offset is the offset in the file to start reading at.
+	Offset int64
+	// Data is filled with the len(Data) bytes starting at Offset.
+	Data []byte
+}
+
+// vectoredRead is a single read of a contiguous part of the file, which
+// covers one or more FileRanges.
+type vectoredRead struct {
+	off, end int64
+	ranges   []*FileRange
+}
+
+// ReadVectored reads several ranges of the file, filling the Data of each
+// one. It's intended for formats like Parquet and ORC, where readers need
+// many small ranges of a file at once.
+//
+// Ranges that are close together in the same block are coalesced into a
+// single read, and the reads are done concurrently, each with its own
+// connection to a datanode. Ranges may be passed in any order, and may
+// overlap. Like ReadAt, it doesn't use or change the offset used by Read and
+// Seek, and it's safe to call from multiple goroutines at once.
+//
+// If any of the ranges extends past the end of the file, nothing is read,
+// and an error wrapping io.ErrUnexpectedEOF is returned. Otherwise, either
+// all the ranges are filled, or an error is returned.
+func (f *FileReader) ReadVectored(ranges []FileRange) error {
+	if f.closed {
+		return io.ErrClosedPipe
+	}
+
+	if f.info.IsDir() {
+		return &os.PathError{"readvectored", f.name, errors.New("is a directory")}
+	}
+
+	sorted := make([]*FileRange, 0, len(ranges))
+	for i := range ranges {
+		r := &ranges[i]
+		if r.Offset < 0 {
+			return &os.PathError{"readvectored", f.name, errors.New("negative offset")}
+		} else if r.Offset+int64(len(r.Data)) > f.info.Size() {
+			return &os.PathError{"readvectored", f.name, io.ErrUnexpectedEOF}
+		} else if len(r.Data) > 0 {
+			sorted = append(sorted, r)
+		}
+	}
+
+	if len(sorted) == 0 {
+		return nil
+	}
+
+	err := f.getBlocks()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	reads := f.coalesce(sorted)
+
+	var wg sync.WaitGroup
+	var firstErr error
+	var errLock sync.Mutex
+	sem := make(chan struct{}, vectoredReadConcurrency)
+	for _, read := range reads {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(read *vectoredRead) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := f.readVectored(read)
+			if err != nil {
+				errLock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errLock.Unlock()
+			}
+		}(read)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// coalesce groups the sorted ranges into reads. A range is added to the
+// previous read if the gap between them is small enough, the result isn't
+// too big, and the range starts in the same block as the read.
+func (f *FileReader) coalesce(sorted []*FileRange) []*vectoredRead {
+	var reads []*vectoredRead
+	var cur *vectoredRead
+	var curBlockEnd int64
+	for _, r := range sorted {
+		end := r.Offset + int64(len(r.Data))
+		if cur != nil && r.Offset <= cur.end+vectoredReadMaxGap &&
+			r.Offset < curBlockEnd {
+			newEnd := cur.end
+			if end > newEnd {
+				newEnd = end
+			}
+
+			if newEnd-cur.off <= vectoredReadMaxSize {
+				cur.end = newEnd
+				cur.ranges = append(cur.ranges, r)
+				continue
+			}
+		}
+
+		cur = &vectoredRead{off: r.Offset, end: end, ranges: []*FileRange{r}}
+		curBlockEnd = f.blockEnd(r.Offset)
+		reads = append(reads, cur)
+	}
+
+	return reads
+}
+
+// blockEnd returns the offset of the end of the block containing off.
+func (f *FileReader) blockEnd(off int64) int64 {
+	for _, block := range f.blocks {
+		start := int64(block.GetOffset())
+		end := start + int64(block.GetB().GetNumBytes())
+		if start <= off && off < end {
+			return end
+		}
+	}
+
+	return f.info.Size()
+}
+
+// readVectored does a single coalesced read, and copies the data into each of
+// the ranges it covers.
+func (f *FileReader) readVectored(read *vectoredRead) error {
+	r := read.ranges[0]
+	if len(read.ranges) == 1 && r.Offset == read.off && int64(len(r.Data)) == read.end-read.off {
+		_, err := f.readRange(r.Data, read.off)
+		return err
+	}
+
+	buf := make([]byte, read.end-read.off)
+	_, err := f.readRange(buf, read.off)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range read.ranges {
+		copy(r.Data, buf[r.Offset-read.off:])
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package hdfs
+
+import (
+	"io"
+	"testing"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCoalesceRanges(t *testing.T) {
+	const blockSize = 1 << 20
+	f := &FileReader{}
+	for i := 0; i < 4; i++ {
+		f.blocks = append(f.blocks, &hdfs.LocatedBlockProto{
+			Offset: proto.Uint64(uint64(i * blockSize)),
+			B:      &hdfs.ExtendedBlockProto{NumBytes: proto.Uint64(blockSize)},
+		})
+	}
+
+	ranges := []*FileRange{
+		{Offset: 0, Data: make([]byte, 100)},
+		{Offset: 50, Data: make([]byte, 100)},
+		{Offset: 1000, Data: make([]byte, 100)},
+		// This one is too far away from the previous one.
+		{Offset: blockSize - 300, Data: make([]byte, 100)},
+		// This one spans two blocks, but starts in the same block as the
+		// previous one.
+		{Offset: blockSize - 100, Data: make([]byte, 200)},
+		// This one starts in the next block, so it can't be coalesced.
+		{Offset: blockSize + 100, Data: make([]byte, 100)},
+	}
+
+	reads := f.coalesce(ranges)
+	require.Len(t, reads, 3)
+
+	assert.EqualValues(t, 0, reads[0].off)
+	assert.EqualValues(t, 1100, reads[0].end)
+	assert.Equal(t, ranges[:3], reads[0].ranges)
+
+	assert.EqualValues(t, blockSize-300, reads[1].off)
+	assert.EqualValues(t, blockSize+100, reads[1].end)
+	assert.Equal(t, ranges[3:5], reads[1].ranges)
+
+	assert.EqualValues(t, blockSize+100, reads[2].off)
+	assert.Equal(t, ranges[5:], reads[2].ranges)
+}
+
+func TestFileReadVectored(t *testing.T) {
+	client := getClient(t)
+
+	expected, err := client.ReadFile("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	ranges := []FileRange{
+		{Offset: testStr3Off, Data: make([]byte, len(testStr3))},
+		{Offset: testStrOff, Data: make([]byte, len(testStr))},
+		{Offset: testStr2Off, Data: make([]byte, len(testStr2))},
+		{Offset: 0, Data: make([]byte, 300000)},
+		{Offset: 200000, Data: make([]byte, 900000)},
+		{Offset: 5, Data: nil},
+	}
+
+	err = file.ReadVectored(ranges)
+	require.NoError(t, err)
+
+	assert.Equal(t, testStr3, string(ranges[0].Data))
+	assert.Equal(t, testStr, string(ranges[1].Data))
+	assert.Equal(t, testStr2, string(ranges[2].Data))
+	assert.Equal(t, expected[:300000], ranges[3].Data)
+	assert.Equal(t, expected[200000:1100000], ranges[4].Data)
+}
+
+func TestFileReadVectoredPastEOF(t *testing.T) {
+	client := getClient(t)
+
+	file, err := client.Open("/_test/foo.txt")
+	require.NoError(t, err)
+
+	err = file.ReadVectored([]FileRange{{Offset: 2, Data: make([]byte, 10)}})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
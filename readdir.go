@@ -7,6 +7,9 @@ import "os"
 //
 // The os.FileInfo values returned will not have block location attached to
 // the struct returned by Sys().
+//
+// ReadDir holds the entire listing in memory; for very large directories, use
+// ListDir instead.
 func (c *Client) ReadDir(dirname string) ([]os.FileInfo, error) {
 	f, err := c.Open(dirname)
 	if err != nil {
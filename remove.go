@@ -8,14 +8,15 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// Remove removes the named file or (empty) directory.
+// Remove removes the named file or (empty) directory. It bypasses the trash;
+// use MoveToTrash for that.
 func (c *Client) Remove(name string) error {
 	return delete(c, name, false)
 }
 
 // RemoveAll removes path and any children it contains. It removes everything it
 // can but returns the first error it encounters. If the path does not exist,
-// RemoveAll returns nil (no error).
+// RemoveAll returns nil (no error). Like Remove, it bypasses the trash.
 func (c *Client) RemoveAll(name string) error {
 	err := delete(c, name, true)
 	if os.IsNotExist(err) {
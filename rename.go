@@ -7,8 +7,28 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// Rename renames (moves) a file.
+// RenameOptions specifies how a file is renamed by RenameWithOptions. The zero
+// value fails if the destination already exists.
+type RenameOptions struct {
+	// Overwrite replaces the destination if it already exists, rather than
+	// failing with os.ErrExist. A directory can only be replaced if it's empty.
+	Overwrite bool
+}
+
+// Rename renames (moves) a file, replacing the destination if it already
+// exists.
 func (c *Client) Rename(oldpath, newpath string) error {
+	return c.rename(oldpath, newpath, true)
+}
+
+// RenameWithOptions renames (moves) a file, as specified by opts. Unlike
+// checking for the destination before calling Rename, the namenode checks and
+// renames atomically.
+func (c *Client) RenameWithOptions(oldpath, newpath string, opts RenameOptions) error {
+	return c.rename(oldpath, newpath, opts.Overwrite)
+}
+
+func (c *Client) rename(oldpath, newpath string, overwrite bool) error {
 	_, err := c.getFileInfo(newpath)
 	err = interpretException(err)
 	if err != nil && !os.IsNotExist(err) {
@@ -18,7 +38,7 @@ func (c *Client) Rename(oldpath, newpath string) error {
 	req := &hdfs.Rename2RequestProto{
 		Src:           proto.String(oldpath),
 		Dst:           proto.String(newpath),
-		OverwriteDest: proto.Bool(true),
+		OverwriteDest: proto.Bool(overwrite),
 	}
 	resp := &hdfs.Rename2ResponseProto{}
 
@@ -45,6 +45,19 @@ func TestRenameDestExists(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestRenameWithOptionsDestExists(t *testing.T) {
+	client := getClient(t)
+
+	touch(t, "/_test/tomove5")
+	touch(t, "/_test/tomovedest5")
+
+	err := client.RenameWithOptions("/_test/tomove5", "/_test/tomovedest5", RenameOptions{})
+	assertPathError(t, err, "rename", "/_test/tomove5", os.ErrExist)
+
+	err = client.RenameWithOptions("/_test/tomove5", "/_test/tomovedest5", RenameOptions{Overwrite: true})
+	require.NoError(t, err)
+}
+
 func TestRenameWithoutPermissionForSrc(t *testing.T) {
 	client2 := getClientForUser(t, "gohdfs2")
 
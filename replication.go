@@ -0,0 +1,41 @@
+package hdfs
+
+import (
+	"errors"
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// SetReplication changes the target replication factor for the named file.
+// The namenode schedules the creation or removal of replicas in the
+// background, so this returns as soon as the new target is recorded; use
+// GetBlockLocations to check on the progress.
+func (c *Client) SetReplication(name string, replication int) error {
+	info, err := c.getFileInfo(name)
+	if err != nil {
+		return &os.PathError{"setrep", name, interpretException(err)}
+	} else if info.IsDir() {
+		return &os.PathError{"setrep", name, errors.New("is a directory")}
+	}
+
+	req := &hdfs.SetReplicationRequestProto{
+		Src:         proto.String(name),
+		Replication: proto.Uint32(uint32(replication)),
+	}
+	resp := &hdfs.SetReplicationResponseProto{}
+
+	err = c.namenode.Execute("setReplication", req, resp)
+	if err != nil {
+		return &os.PathError{"setrep", name, interpretException(err)}
+	} else if !resp.GetResult() {
+		return &os.PathError{
+			"setrep",
+			name,
+			errors.New("replication could not be set"),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package hdfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetReplication(t *testing.T) {
+	client := getClient(t)
+
+	touch(t, "/_test/setrep")
+
+	err := client.SetReplication("/_test/setrep", 2)
+	require.NoError(t, err)
+
+	fi, err := client.Stat("/_test/setrep")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, fi.(*FileInfo).Replication())
+	assert.NotZero(t, fi.(*FileInfo).BlockSize())
+}
+
+func TestSetReplicationNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/nonexistent")
+
+	err := client.SetReplication("/_test/nonexistent", 2)
+	assertPathError(t, err, "setrep", "/_test/nonexistent", os.ErrNotExist)
+}
+
+func TestSetReplicationDir(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/setrepdir")
+
+	err := client.SetReplication("/_test/setrepdir", 2)
+	assertPathError(t, err, "setrep", "/_test/setrepdir", errors.New("is a directory"))
+}
+
+func TestSetReplicationWithoutPermission(t *testing.T) {
+	client2 := getClientForUser(t, "gohdfs2")
+
+	mkdirp(t, "/_test/accessdenied")
+	touchMask(t, "/_test/accessdenied/setrep", 0600)
+
+	err := client2.SetReplication("/_test/accessdenied/setrep", 2)
+	assertPathError(t, err, "setrep", "/_test/accessdenied/setrep", os.ErrPermission)
+}
@@ -0,0 +1,577 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signatureAlgorithm = "AWS4-HMAC-SHA256"
+	chunkAlgorithm     = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzDateFormat      = "20060102T150405Z"
+	maxClockSkew       = 15 * time.Minute
+	maxPresignExpiry   = 7 * 24 * 60 * 60
+
+	unsignedPayload        = "UNSIGNED-PAYLOAD"
+	streamingPayload       = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrail = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	emptySHA256            = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var (
+	errAccessDenied = &s3Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	errSignature    = &s3Error{http.StatusForbidden, "SignatureDoesNotMatch",
+		"The request signature we calculated does not match the signature you provided"}
+	errContentSHA256 = &s3Error{http.StatusBadRequest, "XAmzContentSHA256Mismatch",
+		"The provided 'x-amz-content-sha256' header does not match what was computed"}
+	errBadDigest = &s3Error{http.StatusBadRequest, "BadDigest",
+		"The Content-MD5 you specified did not match what we received"}
+	errIncompleteBody = &s3Error{http.StatusBadRequest, "IncompleteBody",
+		"The request body terminated unexpectedly"}
+)
+
+func malformedAuth(message string) error {
+	return &s3Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", message}
+}
+
+// signature represents a verified AWS Signature Version 4.
+type signature struct {
+	accessKey     string
+	date          time.Time
+	scope         string
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	key           []byte
+}
+
+// authenticate verifies the signature on a request, and returns it along with
+// the matching credential.
+func (s *Server) authenticate(r *http.Request) (*signature, Credential, error) {
+	var sig *signature
+	var err error
+	if isPresigned(r) {
+		sig, err = s.parsePresigned(r)
+	} else if auth := r.Header.Get("Authorization"); auth != "" {
+		sig, err = s.parseAuthorization(r, auth)
+	} else {
+		return nil, Credential{}, errAccessDenied
+	}
+
+	if err != nil {
+		return nil, Credential{}, err
+	}
+
+	cred, ok := s.options.Credentials[sig.accessKey]
+	if !ok {
+		return nil, Credential{}, &s3Error{http.StatusForbidden, "InvalidAccessKeyId",
+			"The AWS Access Key Id you provided does not exist in our records"}
+	}
+
+	// The scope is <date>/<region>/<service>/aws4_request.
+	parts := strings.Split(sig.scope, "/")
+	sig.key = signingKey(cred.SecretKey, parts[0], parts[1], parts[2])
+
+	canonical := canonicalRequest(r, sig.signedHeaders, sig.payloadHash)
+	expected := hex.EncodeToString(hmacSHA256(sig.key, stringToSign(signatureAlgorithm, sig.date, sig.scope,
+		hashHex([]byte(canonical)))))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return nil, Credential{}, errSignature
+	}
+
+	return sig, cred, nil
+}
+
+func isPresigned(r *http.Request) bool {
+	return r.URL.Query().Has("X-Amz-Algorithm")
+}
+
+// parseAuthorization parses a signature from an Authorization header, which
+// looks like this:
+//
+//	AWS4-HMAC-SHA256 Credential=<key>/<scope>, SignedHeaders=<headers>, Signature=<sig>
+func (s *Server) parseAuthorization(r *http.Request, auth string) (*signature, error) {
+	algorithm, rest, _ := strings.Cut(auth, " ")
+	if algorithm != signatureAlgorithm {
+		return nil, &s3Error{http.StatusBadRequest, "InvalidRequest",
+			"The authorization mechanism you have provided is not supported. Please use " +
+				signatureAlgorithm + "."}
+	}
+
+	var credential, signedHeaders, sigHex string
+	for _, field := range strings.Split(rest, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			signedHeaders = v
+		case "Signature":
+			sigHex = v
+		}
+	}
+
+	date := r.Header.Get("x-amz-date")
+	if date == "" {
+		date = r.Header.Get("Date")
+	}
+
+	sig, err := newSignature(credential, signedHeaders, sigHex, date)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	if sig.date.Before(now.Add(-maxClockSkew)) || sig.date.After(now.Add(maxClockSkew)) {
+		return nil, &s3Error{http.StatusForbidden, "RequestTimeTooSkewed",
+			"The difference between the request time and the current time is too large"}
+	}
+
+	sig.payloadHash = r.Header.Get("x-amz-content-sha256")
+	if sig.payloadHash == "" {
+		return nil, &s3Error{http.StatusBadRequest, "InvalidRequest",
+			"Missing required header for this request: x-amz-content-sha256"}
+	}
+
+	return sig, nil
+}
+
+// parsePresigned parses a signature from the query parameters of a presigned
+// URL.
+func (s *Server) parsePresigned(r *http.Request) (*signature, error) {
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") != signatureAlgorithm {
+		return nil, &s3Error{http.StatusBadRequest, "AuthorizationQueryParametersError",
+			"X-Amz-Algorithm only supports \"" + signatureAlgorithm + "\""}
+	}
+
+	sig, err := newSignature(q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders"),
+		q.Get("X-Amz-Signature"), q.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, err
+	}
+
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || expires > maxPresignExpiry {
+		return nil, &s3Error{http.StatusBadRequest, "AuthorizationQueryParametersError",
+			"X-Amz-Expires must be a number between 0 and 604800 seconds"}
+	}
+
+	now := s.now()
+	if now.After(sig.date.Add(time.Duration(expires) * time.Second)) {
+		return nil, &s3Error{http.StatusForbidden, "AccessDenied", "Request has expired"}
+	} else if sig.date.After(now.Add(maxClockSkew)) {
+		return nil, &s3Error{http.StatusForbidden, "AccessDenied", "Request is not valid yet"}
+	}
+
+	sig.payloadHash = q.Get("X-Amz-Content-Sha256")
+	if sig.payloadHash == "" {
+		sig.payloadHash = unsignedPayload
+	}
+
+	return sig, nil
+}
+
+func newSignature(credential, signedHeaders, sig, date string) (*signature, error) {
+	if credential == "" || signedHeaders == "" || sig == "" {
+		return nil, malformedAuth("The authorization header is malformed")
+	}
+
+	// The credential is <access key>/<date>/<region>/<service>/aws4_request.
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return nil, malformedAuth("The credential is malformed: " + credential)
+	}
+
+	t, err := parseDate(date)
+	if err != nil {
+		return nil, &s3Error{http.StatusForbidden, "AccessDenied",
+			"AWS authentication requires a valid Date or x-amz-date header"}
+	} else if t.Format("20060102") != parts[1] {
+		return nil, malformedAuth("The credential date does not match the request date")
+	}
+
+	headers := strings.Split(signedHeaders, ";")
+	hasHost := false
+	for _, h := range headers {
+		if h == "host" {
+			hasHost = true
+		}
+	}
+
+	if !hasHost {
+		return nil, malformedAuth("The host header must be signed")
+	}
+
+	return &signature{
+		accessKey:     parts[0],
+		date:          t,
+		scope:         strings.Join(parts[1:], "/"),
+		signedHeaders: headers,
+		signature:     sig,
+	}, nil
+}
+
+func parseDate(date string) (time.Time, error) {
+	t, err := time.Parse(amzDateFormat, date)
+	if err == nil {
+		return t, nil
+	}
+
+	return http.ParseTime(date)
+}
+
+// canonicalRequest builds the canonical form of a request, which is what
+// the signature covers.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	b.WriteString(uriEncode(r.URL.Path, false))
+	b.WriteByte('\n')
+	b.WriteString(canonicalQuery(r.URL.RawQuery))
+	b.WriteByte('\n')
+
+	for _, h := range signedHeaders {
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(canonicalHeaderValue(r, h))
+		b.WriteByte('\n')
+	}
+
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(signedHeaders, ";"))
+	b.WriteByte('\n')
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+func canonicalQuery(rawQuery string) string {
+	q, _ := url.ParseQuery(rawQuery)
+	delete(q, "X-Amz-Signature")
+
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "content-length":
+		values = r.Header.Values(name)
+		if len(values) == 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	case "transfer-encoding":
+		values = r.TransferEncoding
+	default:
+		values = r.Header.Values(name)
+	}
+
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.Join(strings.Fields(v), " ")
+	}
+
+	return strings.Join(trimmed, ",")
+}
+
+// uriEncode escapes everything but the unreserved characters, as described
+// in the SigV4 specification.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func stringToSign(algorithm string, date time.Time, scope string, rest ...string) []byte {
+	parts := append([]string{algorithm, date.UTC().Format(amzDateFormat), scope}, rest...)
+	return []byte(strings.Join(parts, "\n"))
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), []byte(date))
+	key = hmacSHA256(key, []byte(region))
+	key = hmacSHA256(key, []byte(service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// body returns a reader for the payload of a request, which decodes
+// aws-chunked encoding and verifies the payload hashes as it goes. The
+// returned reader returns an error instead of io.EOF if the payload doesn't
+// match what was signed. It also computes the MD5 of the payload, which is
+// returned by sum once the body is read.
+func (req *request) body() (*payloadReader, error) {
+	p := &payloadReader{md5: md5.New()}
+	if contentMD5 := req.r.Header.Get("Content-MD5"); contentMD5 != "" {
+		want, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(want) != md5.Size {
+			return nil, &s3Error{http.StatusBadRequest, "InvalidDigest",
+				"The Content-MD5 you specified was invalid"}
+		}
+
+		p.wantMD5 = want
+	}
+
+	switch hash := req.sig.payloadHash; hash {
+	case unsignedPayload:
+		p.r = req.r.Body
+	case streamingPayload:
+		p.r = newChunkedReader(req.r.Body, req.sig)
+	case streamingUnsignedTrail:
+		p.r = newChunkedReader(req.r.Body, nil)
+	default:
+		want, err := hex.DecodeString(hash)
+		if err != nil || len(want) != sha256.Size {
+			return nil, &s3Error{http.StatusBadRequest, "InvalidArgument",
+				"x-amz-content-sha256 must be UNSIGNED-PAYLOAD, " + streamingPayload +
+					", " + streamingUnsignedTrail + " or a valid sha256 value"}
+		}
+
+		p.r = req.r.Body
+		p.sha256 = sha256.New()
+		p.wantSHA256 = want
+	}
+
+	return p, nil
+}
+
+// payloadReader hashes a request body as it's read, and checks the hashes
+// at the end.
+type payloadReader struct {
+	r          io.Reader
+	md5        hash.Hash
+	wantMD5    []byte
+	sha256     hash.Hash
+	wantSHA256 []byte
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.md5.Write(b[:n])
+	if p.sha256 != nil {
+		p.sha256.Write(b[:n])
+	}
+
+	if err == io.EOF {
+		if p.wantMD5 != nil && !bytes.Equal(p.md5.Sum(nil), p.wantMD5) {
+			return n, errBadDigest
+		} else if p.sha256 != nil && !bytes.Equal(p.sha256.Sum(nil), p.wantSHA256) {
+			return n, errContentSHA256
+		}
+	} else if err == io.ErrUnexpectedEOF {
+		err = errIncompleteBody
+	}
+
+	return n, err
+}
+
+// etag returns the quoted hex MD5 of everything read so far.
+func (p *payloadReader) etag() string {
+	return `"` + hex.EncodeToString(p.md5.Sum(nil)) + `"`
+}
+
+// chunkedReader decodes a body with aws-chunked content encoding, where each
+// chunk is prefixed by its size in hex and (unless the payload is unsigned)
+// a signature:
+//
+//	<size>;chunk-signature=<signature>\r\n<data>\r\n
+//
+// The last chunk has a size of zero, and may be followed by trailing headers.
+// Each chunk signature covers the chunk data and the previous signature,
+// starting with the signature of the request itself.
+type chunkedReader struct {
+	r         *bufio.Reader
+	sig       *signature
+	prevSig   string
+	chunkSig  string
+	hash      hash.Hash
+	remaining int64
+	done      bool
+	err       error
+}
+
+var errChunkSignature = &s3Error{http.StatusForbidden, "SignatureDoesNotMatch",
+	"The chunk signature we calculated does not match the signature you provided"}
+
+func newChunkedReader(r io.Reader, sig *signature) *chunkedReader {
+	c := &chunkedReader{r: bufio.NewReader(r), sig: sig}
+	if sig != nil {
+		c.prevSig = sig.signature
+		c.hash = sha256.New()
+	}
+
+	return c
+}
+
+func (c *chunkedReader) Read(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+
+	n, err := c.r.Read(b)
+	c.remaining -= int64(n)
+	if c.hash != nil {
+		c.hash.Write(b[:n])
+	}
+
+	if err == io.EOF {
+		err = errIncompleteBody
+	} else if err == nil && c.remaining == 0 {
+		err = c.endChunk()
+	}
+
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads the header of the next chunk.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 {
+		return errIncompleteBody
+	}
+
+	if c.sig != nil {
+		if !strings.HasPrefix(ext, "chunk-signature=") {
+			return errChunkSignature
+		}
+
+		c.chunkSig = strings.TrimPrefix(ext, "chunk-signature=")
+	}
+
+	c.remaining = size
+	if size > 0 {
+		return nil
+	}
+
+	// The last chunk is followed by optional trailers and an empty line.
+	c.done = true
+	if err := c.verifyChunk(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		} else if line == "" {
+			return nil
+		}
+	}
+}
+
+// endChunk reads the CRLF after the data in a chunk, and checks the chunk
+// signature.
+func (c *chunkedReader) endChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	} else if line != "" {
+		return errIncompleteBody
+	}
+
+	return c.verifyChunk()
+}
+
+func (c *chunkedReader) verifyChunk() error {
+	if c.sig == nil {
+		return nil
+	}
+
+	sts := stringToSign(chunkAlgorithm, c.sig.date, c.sig.scope, c.prevSig, emptySHA256,
+		hex.EncodeToString(c.hash.Sum(nil)))
+	expected := hex.EncodeToString(hmacSHA256(c.sig.key, sts))
+	if !hmac.Equal([]byte(expected), []byte(c.chunkSig)) {
+		return errChunkSignature
+	}
+
+	c.prevSig = c.chunkSig
+	c.hash.Reset()
+	return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err == io.EOF || err == bufio.ErrBufferFull {
+		return "", errIncompleteBody
+	} else if err != nil {
+		return "", err
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", errIncompleteBody
+	}
+
+	return string(line[:len(line)-2]), nil
+}
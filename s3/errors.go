@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// s3Error is an error with a specific HTTP status and S3 error code.
+type s3Error struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *s3Error) Error() string {
+	return e.code + ": " + e.message
+}
+
+var (
+	errNotImplemented = &s3Error{http.StatusNotImplemented, "NotImplemented",
+		"A header or query parameter you provided implies functionality that is not implemented"}
+	errMethodNotAllowed = &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed",
+		"The specified method is not allowed against this resource"}
+	errNoSuchKey = &s3Error{http.StatusNotFound, "NoSuchKey",
+		"The specified key does not exist"}
+	errNoSuchUpload = &s3Error{http.StatusNotFound, "NoSuchUpload",
+		"The specified multipart upload does not exist"}
+	errMalformedXML = &s3Error{http.StatusBadRequest, "MalformedXML",
+		"The XML you provided was not well-formed or did not validate against our published schema"}
+)
+
+func invalidArgument(message string) *s3Error {
+	return &s3Error{http.StatusBadRequest, "InvalidArgument", message}
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestID string `xml:"RequestId"`
+}
+
+// writeError writes an S3 error response for err.
+func writeError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	s3Err := toS3Error(err)
+	writeXML(w, s3Err.status, &errorResponse{
+		Code:      s3Err.code,
+		Message:   s3Err.message,
+		Resource:  r.URL.Path,
+		RequestID: id,
+	})
+}
+
+func toS3Error(err error) *s3Error {
+	var s3Err *s3Error
+	switch {
+	case errors.As(err, &s3Err):
+		return s3Err
+	case errors.Is(err, os.ErrNotExist):
+		return errNoSuchKey
+	case errors.Is(err, os.ErrPermission):
+		return &s3Error{http.StatusForbidden, "AccessDenied", err.Error()}
+	case errors.Is(err, os.ErrExist), errors.Is(err, syscall.ENOTEMPTY):
+		return &s3Error{http.StatusConflict, "OperationAborted", err.Error()}
+	case errors.Is(err, os.ErrInvalid):
+		return invalidArgument(err.Error())
+	default:
+		return &s3Error{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
@@ -0,0 +1,341 @@
+package s3
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxKeys = 1000
+
+func (s *Server) listBuckets(req *request) error {
+	names := make([]string, 0, len(s.options.Buckets))
+	for name := range s.options.Buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	user := req.client.User()
+	res := &listAllMyBucketsResult{
+		Xmlns: xmlns,
+		Owner: ownerXML{ID: user, DisplayName: user},
+	}
+
+	for _, name := range names {
+		var created time.Time
+		if info, err := req.client.Stat(s.options.Buckets[name]); err == nil {
+			created = info.ModTime()
+		}
+
+		res.Buckets = append(res.Buckets, bucketXML{
+			Name:         name,
+			CreationDate: formatTimestamp(created),
+		})
+	}
+
+	writeXML(req.w, http.StatusOK, res)
+	return nil
+}
+
+func (s *Server) headBucket(req *request) error {
+	info, err := req.client.Stat(req.root)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return &s3Error{http.StatusNotFound, "NoSuchBucket",
+			"The specified bucket does not exist"}
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) getBucketLocation(req *request) error {
+	writeXML(req.w, http.StatusOK, &locationConstraint{Xmlns: xmlns})
+	return nil
+}
+
+// listObjects implements version 1 of ListObjects, which paginates with a
+// marker.
+func (s *Server) listObjects(req *request) error {
+	q := req.r.URL.Query()
+	l, err := newLister(req, q.Get("marker"))
+	if err != nil {
+		return err
+	}
+
+	err = l.list()
+	if err != nil {
+		return err
+	}
+
+	marker := q.Get("marker")
+	res := l.result()
+	res.Marker = &marker
+	if l.truncated {
+		res.NextMarker = l.last()
+	}
+
+	if q.Get("encoding-type") == "url" {
+		res.encodeKeys()
+	}
+
+	writeXML(req.w, http.StatusOK, res)
+	return nil
+}
+
+// listObjectsV2 implements version 2 of ListObjects, which paginates with an
+// opaque continuation token. The token we use is just the last key returned,
+// encoded with base64.
+func (s *Server) listObjectsV2(req *request) error {
+	q := req.r.URL.Query()
+	marker := q.Get("start-after")
+	token := q.Get("continuation-token")
+	if token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return invalidArgument("The continuation token provided is incorrect")
+		}
+
+		marker = string(b)
+	}
+
+	l, err := newLister(req, marker)
+	if err != nil {
+		return err
+	}
+
+	err = l.list()
+	if err != nil {
+		return err
+	}
+
+	res := l.result()
+	res.StartAfter = q.Get("start-after")
+	res.ContinuationToken = token
+	keyCount := len(l.entries)
+	res.KeyCount = &keyCount
+	if l.truncated {
+		res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(l.last()))
+	}
+
+	if q.Get("encoding-type") == "url" {
+		res.encodeKeys()
+	}
+
+	writeXML(req.w, http.StatusOK, res)
+	return nil
+}
+
+// listEntry is either an object or a common prefix in a listing.
+type listEntry struct {
+	key  string
+	info os.FileInfo
+}
+
+// lister walks the directory tree under a bucket, collecting objects in key
+// order.
+//
+// HDFS lists each directory in lexical order, but that isn't necessarily key
+// order: the key "a-b" sorts before "a/c", for example, even though the
+// directory "a" sorts before "a-b". So entries are sorted as if directories
+// had a trailing slash, after which a depth-first walk returns keys in order.
+type lister struct {
+	req       *request
+	prefix    string
+	delimiter string
+	marker    string
+	maxKeys   int
+
+	entries   []listEntry
+	truncated bool
+}
+
+var errListFull = errors.New("listing is full")
+
+func newLister(req *request, marker string) (*lister, error) {
+	q := req.r.URL.Query()
+	l := &lister{
+		req:       req,
+		prefix:    q.Get("prefix"),
+		delimiter: q.Get("delimiter"),
+		marker:    marker,
+		maxKeys:   maxKeys,
+	}
+
+	if s := q.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, invalidArgument("Provided max-keys not an integer or within integer range")
+		} else if n < maxKeys {
+			l.maxKeys = n
+		}
+	}
+
+	return l, nil
+}
+
+func (l *lister) list() error {
+	dir := l.prefix[:strings.LastIndex(l.prefix, "/")+1]
+	if dir == stagingDir+"/" || strings.HasPrefix(dir, stagingDir+"/") {
+		return nil
+	}
+
+	p := path.Join(l.req.root, dir)
+	info, err := l.req.client.Stat(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return nil
+	}
+
+	err = l.walk(p, dir)
+	if err == errListFull {
+		return nil
+	}
+
+	return err
+}
+
+func (l *lister) walk(dir, keyPrefix string) error {
+	infos, err := l.req.client.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return sortKey(infos[i]) < sortKey(infos[j])
+	})
+
+	for _, info := range infos {
+		if keyPrefix == "" && info.Name() == stagingDir {
+			continue
+		}
+
+		key := keyPrefix + sortKey(info)
+		if !strings.HasPrefix(key, l.prefix) {
+			// Descend into directories that contain the prefix, like "a/" for
+			// the prefix "a/b".
+			if info.IsDir() && strings.HasPrefix(l.prefix, key) {
+				err := l.walk(path.Join(dir, info.Name()), key)
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		if cp := l.commonPrefix(key); cp != "" {
+			// All the keys with the same common prefix are adjacent, so only
+			// the last entry needs to be checked for duplicates.
+			if cp > l.marker && (len(l.entries) == 0 || l.last() != cp) {
+				err := l.add(listEntry{key: cp})
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		if info.IsDir() {
+			// Skip directories where every key sorts before the marker.
+			if l.marker >= key && !strings.HasPrefix(l.marker, key) {
+				continue
+			}
+
+			err := l.walk(path.Join(dir, info.Name()), key)
+			if err != nil {
+				return err
+			}
+		} else if key > l.marker {
+			err := l.add(listEntry{key: key, info: info})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// commonPrefix returns the common prefix for a key, which is everything up to
+// and including the first delimiter after the prefix, or "" if there is no
+// delimiter.
+func (l *lister) commonPrefix(key string) string {
+	if l.delimiter == "" {
+		return ""
+	}
+
+	i := strings.Index(key[len(l.prefix):], l.delimiter)
+	if i == -1 {
+		return ""
+	}
+
+	return key[:len(l.prefix)+i+len(l.delimiter)]
+}
+
+func (l *lister) add(entry listEntry) error {
+	if len(l.entries) >= l.maxKeys {
+		l.truncated = true
+		return errListFull
+	}
+
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *lister) last() string {
+	if len(l.entries) == 0 {
+		return l.marker
+	}
+
+	return l.entries[len(l.entries)-1].key
+}
+
+func (l *lister) result() *listBucketResult {
+	res := &listBucketResult{
+		Xmlns:       xmlns,
+		Name:        l.req.bucket,
+		Prefix:      l.prefix,
+		MaxKeys:     l.maxKeys,
+		Delimiter:   l.delimiter,
+		IsTruncated: l.truncated,
+	}
+
+	for _, entry := range l.entries {
+		if entry.info == nil {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefixXML{Prefix: entry.key})
+			continue
+		}
+
+		res.Contents = append(res.Contents, objectXML{
+			Key:          entry.key,
+			LastModified: formatTimestamp(entry.info.ModTime()),
+			ETag:         derivedETag(entry.info),
+			Size:         entry.info.Size(),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	return res
+}
+
+// sortKey returns the name of a file, with a trailing slash if it's a
+// directory.
+func sortKey(info os.FileInfo) string {
+	if info.IsDir() {
+		return info.Name() + "/"
+	}
+
+	return info.Name()
+}
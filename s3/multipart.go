@@ -0,0 +1,266 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const maxPartNumber = 10000
+
+var (
+	errInvalidPart = &s3Error{http.StatusBadRequest, "InvalidPart",
+		"One or more of the specified parts could not be found"}
+	errInvalidPartOrder = &s3Error{http.StatusBadRequest, "InvalidPartOrder",
+		"The list of parts was not in ascending order"}
+)
+
+// Each multipart upload is staged in its own directory, which contains a file
+// called "key" with the key of the object, and one file for each part.
+func uploadDirName(id string) string {
+	return "upload-" + id
+}
+
+func partName(n int) string {
+	return fmt.Sprintf("part-%05d", n)
+}
+
+// uploadDir returns the staging directory for an upload, checking that it
+// exists and that it's for the requested key.
+func (req *request) uploadDir(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", errNoSuchUpload
+	}
+
+	dir := path.Join(req.root, stagingDir, uploadDirName(id))
+	key, err := req.client.ReadFile(path.Join(dir, "key"))
+	if os.IsNotExist(err) {
+		return "", errNoSuchUpload
+	} else if err != nil {
+		return "", err
+	} else if string(key) != req.key {
+		return "", errNoSuchUpload
+	}
+
+	return dir, nil
+}
+
+func (s *Server) createMultipartUpload(req *request) error {
+	if _, err := req.objectPath(req.key); err != nil {
+		return err
+	} else if isDirKey(req.key) {
+		return invalidArgument("Directory markers can't be uploaded in parts")
+	}
+
+	staging, err := req.makeStagingDir()
+	if err != nil {
+		return err
+	}
+
+	id := newID(16)
+	dir := path.Join(staging, uploadDirName(id))
+	err = req.client.Mkdir(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = req.writeFile(path.Join(dir, "key"), strings.NewReader(req.key))
+	if err != nil {
+		req.client.RemoveAll(dir)
+		return err
+	}
+
+	writeXML(req.w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    xmlns,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		UploadID: id,
+	})
+	return nil
+}
+
+func (s *Server) uploadPart(req *request) error {
+	q := req.r.URL.Query()
+	n, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || n < 1 || n > maxPartNumber {
+		return invalidArgument("Part number must be an integer between 1 and 10000, inclusive")
+	}
+
+	dir, err := req.uploadDir(q.Get("uploadId"))
+	if err != nil {
+		return err
+	}
+
+	body, err := req.body()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, in case the part is being replaced.
+	part := path.Join(dir, partName(n))
+	tmp := part + "." + newID(4)
+	err = req.writeFile(tmp, body)
+	if err != nil {
+		return err
+	}
+
+	// Store the ETag with the part, so that completeMultipartUpload can check
+	// the ones the client sends. If that fails, partSum falls back to reading
+	// the part.
+	etag := body.etag()
+	req.client.SetXAttr(tmp, etagXAttr, etag)
+
+	err = req.client.Rename(tmp, part)
+	if err != nil {
+		req.client.Remove(tmp)
+		return err
+	}
+
+	req.w.Header().Set("ETag", etag)
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// completeMultipartUpload assembles the parts with Concat. HDFS doesn't allow
+// concatenating empty files, so those are skipped. The part ETags that the
+// client sends must match the parts, and the ETag of the object is computed
+// from them the same way as S3 does.
+func (s *Server) completeMultipartUpload(req *request) error {
+	p, err := req.objectPath(req.key)
+	if err != nil {
+		return err
+	}
+
+	dir, err := req.uploadDir(req.r.URL.Query().Get("uploadId"))
+	if err != nil {
+		return err
+	}
+
+	body, err := req.body()
+	if err != nil {
+		return err
+	}
+
+	var complete completeMultipartUpload
+	err = decodeXML(body, &complete)
+	if err != nil {
+		return err
+	} else if len(complete.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	var srcs []string
+	var sums []byte
+	for i, part := range complete.Parts {
+		if i > 0 && part.PartNumber <= complete.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		} else if part.PartNumber < 1 || part.PartNumber > maxPartNumber {
+			return errInvalidPart
+		}
+
+		sum, err := hex.DecodeString(strings.Trim(part.ETag, `"`))
+		if err != nil || len(sum) != md5.Size {
+			return errInvalidPart
+		}
+
+		sums = append(sums, sum...)
+		partPath := path.Join(dir, partName(part.PartNumber))
+		info, err := req.client.Stat(partPath)
+		if os.IsNotExist(err) {
+			return errInvalidPart
+		} else if err != nil {
+			return err
+		}
+
+		actual, err := req.partSum(partPath)
+		if err != nil {
+			return err
+		} else if !bytes.Equal(sum, actual) {
+			return errInvalidPart
+		}
+
+		if info.Size() > 0 {
+			srcs = append(srcs, partPath)
+		}
+	}
+
+	var target string
+	if len(srcs) == 0 {
+		target = path.Join(dir, "empty")
+		err = req.client.CreateEmptyFile(target)
+	} else {
+		target = srcs[0]
+		if len(srcs) > 1 {
+			err = req.client.Concat(target, srcs[1:])
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	etag := fmt.Sprintf(`"%x-%d"`, md5.Sum(sums), len(complete.Parts))
+	err = req.commit(target, p, etag)
+	if err != nil {
+		return err
+	}
+
+	req.client.RemoveAll(dir)
+	writeXML(req.w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    xmlns,
+		Location: "/" + req.bucket + "/" + req.key,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		ETag:     etag,
+	})
+	return nil
+}
+
+// partSum returns the MD5 of an uploaded part. It's usually stored in an
+// xattr by uploadPart; if it isn't, for example because xattrs are disabled,
+// the part is read back to compute it.
+func (req *request) partSum(p string) ([]byte, error) {
+	xattrs, err := req.client.GetXAttrs(p, etagXAttr)
+	if err == nil {
+		sum, err := hex.DecodeString(strings.Trim(xattrs[etagXAttr], `"`))
+		if err == nil && len(sum) == md5.Size {
+			return sum, nil
+		}
+	}
+
+	f, err := req.client.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+func (s *Server) abortMultipartUpload(req *request) error {
+	dir, err := req.uploadDir(req.r.URL.Query().Get("uploadId"))
+	if err != nil {
+		return err
+	}
+
+	err = req.client.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,381 @@
+package s3
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// etagXAttr is the extended attribute in which we store the ETag of objects
+// uploaded through the gateway.
+const etagXAttr = "user.s3.etag"
+
+// emptyETag is the MD5 ETag of an empty object.
+const emptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+// maxXMLBody limits the size of the XML documents that clients can send.
+const maxXMLBody = 2 << 20
+
+var errInvalidRange = &s3Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange",
+	"The requested range is not satisfiable"}
+
+// objectPath returns the path in HDFS for a key. Keys ending in a slash are
+// directory markers, and map to directories.
+func (req *request) objectPath(key string) (string, error) {
+	for i, segment := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." || (i == 0 && segment == stagingDir) {
+			return "", &s3Error{http.StatusBadRequest, "InvalidArgument",
+				"Object keys can't contain empty, . or .. path segments: " + key}
+		}
+	}
+
+	return path.Join(req.root, key), nil
+}
+
+func isDirKey(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+func (s *Server) getObject(req *request) error {
+	p, err := req.objectPath(req.key)
+	if err != nil {
+		return err
+	}
+
+	if isDirKey(req.key) {
+		return s.headObject(req)
+	}
+
+	f, err := req.client.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info := f.Stat()
+	if info.IsDir() {
+		return errNoSuchKey
+	}
+
+	start, length, partial, err := parseRange(req.r.Header.Get("Range"), info.Size())
+	if err != nil {
+		return err
+	}
+
+	// The object is read sequentially, rather than with ReadAt, which would
+	// start a new block read for every chunk copied.
+	_, err = f.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	setObjectHeaders(req.w, info, req.etag(p, info))
+	req.w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if partial {
+		req.w.Header().Set("Content-Range",
+			fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, info.Size()))
+		req.w.WriteHeader(http.StatusPartialContent)
+	} else {
+		req.w.WriteHeader(http.StatusOK)
+	}
+
+	// Once the headers are written, there's no way to report an error other
+	// than hanging up early.
+	io.CopyN(req.w, f, length)
+	return nil
+}
+
+func (s *Server) headObject(req *request) error {
+	p, err := req.objectPath(req.key)
+	if err != nil {
+		return err
+	}
+
+	info, err := req.client.Stat(p)
+	if err != nil {
+		return err
+	} else if info.IsDir() != isDirKey(req.key) {
+		return errNoSuchKey
+	}
+
+	etag := emptyETag
+	size := int64(0)
+	if !info.IsDir() {
+		etag = req.etag(p, info)
+		size = info.Size()
+	}
+
+	setObjectHeaders(req.w, info, etag)
+	req.w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func setObjectHeaders(w http.ResponseWriter, info os.FileInfo, etag string) {
+	h := w.Header()
+	h.Set("Content-Type", "binary/octet-stream")
+	h.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	h.Set("ETag", etag)
+	h.Set("Accept-Ranges", "bytes")
+}
+
+// parseRange parses a Range header with a single byte range, and returns the
+// offset and length to read. As with S3, invalid or multiple ranges are
+// ignored, and the whole object is returned.
+func parseRange(header string, size int64) (int64, int64, bool, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if header == "" || spec == header || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, nil
+	}
+
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, false, nil
+		} else if n <= 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		} else if n > size {
+			n = size
+		}
+
+		return size - n, n, true, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, nil
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, size, false, nil
+		} else if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+
+	return start, end - start + 1, true, nil
+}
+
+// etag returns the ETag for an object, which is either the one we stored when
+// it was uploaded, or derivedETag if there isn't one.
+func (req *request) etag(p string, info os.FileInfo) string {
+	xattrs, err := req.client.GetXAttrs(p, etagXAttr)
+	if err == nil && xattrs[etagXAttr] != "" {
+		return xattrs[etagXAttr]
+	}
+
+	return derivedETag(info)
+}
+
+// derivedETag returns an ETag for a file that wasn't uploaded through the
+// gateway (or for which we don't want to spend an RPC looking it up). It
+// changes whenever the file does, and includes a part count suffix so that
+// clients don't mistake it for an MD5 of the contents.
+func derivedETag(info os.FileInfo) string {
+	var id uint64
+	if fs, ok := info.Sys().(*hdfs.FileStatus); ok {
+		id = fs.GetFileId()
+	}
+
+	sum := md5.Sum([]byte(fmt.Sprintf("%d:%d:%d", id, info.Size(), info.ModTime().UnixNano())))
+	return fmt.Sprintf(`"%x-1"`, sum)
+}
+
+func (s *Server) putObject(req *request) error {
+	p, err := req.objectPath(req.key)
+	if err != nil {
+		return err
+	}
+
+	body, err := req.body()
+	if err != nil {
+		return err
+	}
+
+	if isDirKey(req.key) {
+		n, err := io.Copy(io.Discard, body)
+		if err != nil {
+			return err
+		} else if n > 0 {
+			return invalidArgument("Directory markers must be empty")
+		}
+
+		err = req.client.MkdirAll(p, 0755)
+		if err != nil {
+			return err
+		}
+
+		req.w.Header().Set("ETag", emptyETag)
+		req.w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	staging, err := req.makeStagingDir()
+	if err != nil {
+		return err
+	}
+
+	staged := path.Join(staging, "put-"+newID(8))
+	err = req.writeFile(staged, body)
+	if err != nil {
+		return err
+	}
+
+	etag := body.etag()
+	err = req.commit(staged, p, etag)
+	if err != nil {
+		return err
+	}
+
+	req.w.Header().Set("ETag", etag)
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// makeStagingDir creates the staging directory for the bucket, if it doesn't
+// exist already. Like /tmp, it's world-writable with the sticky bit set, so
+// that it can be shared by all users.
+func (req *request) makeStagingDir() (string, error) {
+	dir := path.Join(req.root, stagingDir)
+	_, err := req.client.Stat(dir)
+	if os.IsNotExist(err) {
+		err = req.client.Mkdir(dir, 0777)
+		if err == nil {
+			err = req.client.Chmod(dir, 01777)
+		} else if os.IsExist(err) {
+			err = nil
+		}
+	}
+
+	return dir, err
+}
+
+// writeFile writes r to a new file, removing it again if anything goes wrong.
+func (req *request) writeFile(name string, r io.Reader) error {
+	w, err := req.client.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	closeErr := w.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		req.client.Remove(name)
+		return err
+	}
+
+	return nil
+}
+
+// commit moves a staged file into place, replacing any existing object.
+func (req *request) commit(staged, p, etag string) error {
+	// Failing to store the ETag isn't fatal; it just means we'll return a
+	// derived one instead. That happens if xattrs are disabled, for example.
+	req.client.SetXAttr(staged, etagXAttr, etag)
+
+	err := req.client.MkdirAll(path.Dir(p), 0755)
+	if err == nil {
+		err = req.client.Rename(staged, p)
+	}
+
+	if err != nil {
+		req.client.Remove(staged)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) deleteObject(req *request) error {
+	err := req.removeKey(req.key)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// removeKey removes the object with the given key. As with S3, it's not an
+// error if the object doesn't exist. Directory markers are only removed if
+// the directory is empty.
+func (req *request) removeKey(key string) error {
+	p, err := req.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	info, err := req.client.Stat(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if info.IsDir() != isDirKey(key) {
+		return nil
+	}
+
+	err = req.client.Remove(p)
+	if errors.Is(err, syscall.ENOTEMPTY) || os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Server) deleteObjects(req *request) error {
+	body, err := req.body()
+	if err != nil {
+		return err
+	}
+
+	var del deleteRequest
+	err = decodeXML(body, &del)
+	if err != nil {
+		return err
+	} else if len(del.Objects) > maxKeys {
+		return errMalformedXML
+	}
+
+	res := &deleteResult{Xmlns: xmlns}
+	for _, obj := range del.Objects {
+		err := req.removeKey(obj.Key)
+		if err != nil {
+			s3Err := toS3Error(err)
+			res.Errors = append(res.Errors, deleteErrorXML{
+				Key:     obj.Key,
+				Code:    s3Err.code,
+				Message: s3Err.message,
+			})
+		} else if !del.Quiet {
+			res.Deleted = append(res.Deleted, deletedXML{Key: obj.Key})
+		}
+	}
+
+	writeXML(req.w, http.StatusOK, res)
+	return nil
+}
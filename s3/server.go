@@ -0,0 +1,243 @@
+// Package s3 implements a gateway that serves a subset of the Amazon S3 REST
+// API, backed by HDFS. This makes it possible for tools that only speak S3 to
+// read and write data stored in HDFS.
+//
+// Each bucket is mapped to a directory in HDFS, and each object key to a path
+// relative to that directory, with "/" as the separator. Only path-style
+// requests (http://host/bucket/key) are supported. The following operations
+// are implemented:
+//
+//   - ListBuckets, HeadBucket and GetBucketLocation
+//   - ListObjects and ListObjectsV2, with prefix, delimiter and pagination
+//   - GetObject (including Range requests), HeadObject, PutObject,
+//     DeleteObject and DeleteObjects
+//   - CreateMultipartUpload, UploadPart, CompleteMultipartUpload and
+//     AbortMultipartUpload
+//
+// Requests must be signed with AWS Signature Version 4, either in the
+// Authorization header or in the query string (presigned URLs). Each access
+// key maps to an HDFS user, which the request is performed as.
+//
+// Objects are written to a staging directory in the bucket first, and then
+// renamed into place, so that readers never see a partial object. Multipart
+// uploads are staged the same way, with one file per part, and then assembled
+// with Client.Concat, without copying any data.
+//
+// HDFS doesn't store content types or user metadata, so every object has the
+// content type binary/octet-stream. The MD5 ETag of an uploaded object is
+// stored in the user.s3.etag extended attribute; files written by other
+// means, and all files in listings, get an opaque ETag derived from the file
+// ID, size and modification time instead.
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/internal/clientcache"
+)
+
+// stagingDir is the name of the directory, relative to the root of each
+// bucket, in which uploads are staged. It's hidden from listings.
+const stagingDir = ".s3-staging"
+
+// Credential is the secret key and HDFS user for an access key.
+type Credential struct {
+	// SecretKey is the secret key used to sign requests.
+	SecretKey string
+	// User is the HDFS user that requests signed with this key are performed
+	// as.
+	User string
+}
+
+// ServerOptions represents the configurable options for a Server.
+type ServerOptions struct {
+	// ClientOptions is used to connect to HDFS. The Server creates one Client
+	// for each user it sees, and closes it again once it has been idle for a
+	// while. If KerberosClient is set, each Client
+	// authenticates as the kerberos principal and impersonates the user with
+	// ProxyUser, so the principal must be allowed to do that by the namenode.
+	// Otherwise, User is simply set to the name of the user.
+	ClientOptions hdfs.ClientOptions
+	// Buckets maps each bucket name to the absolute path of a directory in
+	// HDFS.
+	Buckets map[string]string
+	// Credentials maps each access key to its secret key and user.
+	Credentials map[string]Credential
+}
+
+// Server is an http.Handler that serves the S3 API.
+type Server struct {
+	options ServerOptions
+	now     func() time.Time
+	clients *clientcache.Cache
+}
+
+// NewServer returns a new Server with the given options.
+func NewServer(options ServerOptions) (*Server, error) {
+	for bucket, root := range options.Buckets {
+		if bucket == "" || strings.Contains(bucket, "/") {
+			return nil, fmt.Errorf("invalid bucket name: %q", bucket)
+		} else if !path.IsAbs(root) {
+			return nil, fmt.Errorf("root for bucket %s is not an absolute path: %s", bucket, root)
+		}
+
+		options.Buckets[bucket] = path.Clean(root)
+	}
+
+	return &Server{
+		options: options,
+		now:     time.Now,
+		clients: clientcache.New(options.ClientOptions,
+			clientcache.DefaultCapacity, clientcache.DefaultExpiry),
+	}, nil
+}
+
+// request holds the state for a single S3 request.
+type request struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	id     string
+	sig    *signature
+	client *hdfs.Client
+
+	bucket string
+	root   string
+	key    string
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := newID(8)
+	w.Header().Set("x-amz-request-id", id)
+
+	err := s.serve(w, r, id)
+	if err != nil {
+		writeError(w, r, id, err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, id string) error {
+	sig, cred, err := s.authenticate(r)
+	if err != nil {
+		return err
+	}
+
+	client, release, err := s.clients.Get(cred.User)
+	if err != nil {
+		return &s3Error{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+	defer release()
+
+	req := &request{w: w, r: r, id: id, sig: sig, client: client}
+	req.bucket, req.key, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if req.bucket == "" {
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+
+		return s.listBuckets(req)
+	}
+
+	root, ok := s.options.Buckets[req.bucket]
+	if !ok {
+		return &s3Error{http.StatusNotFound, "NoSuchBucket",
+			"The specified bucket does not exist"}
+	}
+
+	req.root = root
+	if req.key == "" {
+		return s.serveBucket(req)
+	}
+
+	return s.serveObject(req)
+}
+
+func (s *Server) serveBucket(req *request) error {
+	q := req.r.URL.Query()
+	switch req.r.Method {
+	case http.MethodGet:
+		switch {
+		case q.Has("location"):
+			return s.getBucketLocation(req)
+		case q.Has("uploads"), q.Has("versions"), q.Has("acl"), q.Has("policy"):
+			return errNotImplemented
+		case q.Get("list-type") == "2":
+			return s.listObjectsV2(req)
+		default:
+			return s.listObjects(req)
+		}
+	case http.MethodHead:
+		return s.headBucket(req)
+	case http.MethodPost:
+		if q.Has("delete") {
+			return s.deleteObjects(req)
+		}
+
+		return errNotImplemented
+	case http.MethodPut, http.MethodDelete:
+		return errNotImplemented
+	default:
+		return errMethodNotAllowed
+	}
+}
+
+func (s *Server) serveObject(req *request) error {
+	q := req.r.URL.Query()
+	switch req.r.Method {
+	case http.MethodGet:
+		if q.Has("acl") || q.Has("tagging") || q.Has("uploadId") {
+			return errNotImplemented
+		}
+
+		return s.getObject(req)
+	case http.MethodHead:
+		return s.headObject(req)
+	case http.MethodPut:
+		if q.Has("uploadId") {
+			return s.uploadPart(req)
+		} else if req.r.Header.Get("x-amz-copy-source") != "" || q.Has("acl") || q.Has("tagging") {
+			return errNotImplemented
+		}
+
+		return s.putObject(req)
+	case http.MethodPost:
+		if q.Has("uploads") {
+			return s.createMultipartUpload(req)
+		} else if q.Has("uploadId") {
+			return s.completeMultipartUpload(req)
+		}
+
+		return errNotImplemented
+	case http.MethodDelete:
+		if q.Has("uploadId") {
+			return s.abortMultipartUpload(req)
+		}
+
+		return s.deleteObject(req)
+	default:
+		return errMethodNotAllowed
+	}
+}
+
+// Close closes all the clients opened by the Server.
+func (s *Server) Close() error {
+	return s.clients.Close()
+}
+
+// newID returns a random hex string, used for request and upload IDs.
+func newID(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,331 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKey = "gohdfs1key"
+	testSecretKey = "gohdfs1secret"
+	testRoot      = "/_test/s3"
+)
+
+func getTestServer(t *testing.T) (*httptest.Server, *hdfs.Client) {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	options := hdfs.ClientOptionsFromConf(conf)
+	if options.Addresses == nil {
+		t.Fatal("Missing namenode addresses in ambient config")
+	} else if options.KerberosClient != nil {
+		t.Skip("Kerberos isn't supported by these tests")
+	}
+
+	options.User = "gohdfs1"
+	client, err := hdfs.NewClient(options)
+	require.NoError(t, err)
+
+	err = client.RemoveAll(testRoot)
+	require.NoError(t, err)
+	err = client.MkdirAll(testRoot, 0755)
+	require.NoError(t, err)
+
+	s, err := NewServer(ServerOptions{
+		ClientOptions: options,
+		Buckets:       map[string]string{"test": testRoot},
+		Credentials: map[string]Credential{
+			testAccessKey: {SecretKey: testSecretKey, User: "gohdfs1"},
+		},
+	})
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+		client.Close()
+	})
+
+	return ts, client
+}
+
+// doRequest sends a request signed with the test credentials.
+func doRequest(t *testing.T, ts *httptest.Server, method, target string, body []byte, headers ...string) *http.Response {
+	r, err := http.NewRequest(method, ts.URL+target, bytes.NewReader(body))
+	require.NoError(t, err)
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+
+	sum := sha256.Sum256(body)
+	signRequest(r, hex.EncodeToString(sum[:]))
+
+	resp, err := ts.Client().Do(r)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func signRequest(r *http.Request, payloadHash string) {
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	scope := date + "/us-east-1/s3/aws4_request"
+
+	r.Header.Set("x-amz-date", now.Format(amzDateFormat))
+	r.Header.Set("x-amz-content-sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonical := canonicalRequest(r, signed, payloadHash)
+
+	key := signingKey(testSecretKey, date, "us-east-1", "s3")
+	sig := hmacSHA256(key, stringToSign(signatureAlgorithm, now, scope, hashHex([]byte(canonical))))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s,SignedHeaders=%s,Signature=%x",
+		signatureAlgorithm, testAccessKey, scope, strings.Join(signed, ";"), sig))
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func assertErrorCode(t *testing.T, resp *http.Response, status int, code string) {
+	var e errorResponse
+	err := xml.NewDecoder(resp.Body).Decode(&e)
+	require.NoError(t, err)
+
+	assert.Equal(t, status, resp.StatusCode)
+	assert.Equal(t, code, e.Code)
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		start   int64
+		length  int64
+		partial bool
+		err     error
+	}{
+		{"", 0, 100, false, nil},
+		{"bytes=0-9", 0, 10, true, nil},
+		{"bytes=90-", 90, 10, true, nil},
+		{"bytes=90-200", 90, 10, true, nil},
+		{"bytes=-10", 90, 10, true, nil},
+		{"bytes=-200", 0, 100, true, nil},
+		{"bytes=100-", 0, 0, false, errInvalidRange},
+		{"bytes=-0", 0, 0, false, errInvalidRange},
+		{"bytes=5-4", 0, 100, false, nil},
+		{"bytes=0-1,5-6", 0, 100, false, nil},
+		{"items=0-9", 0, 100, false, nil},
+	}
+
+	for _, tt := range tests {
+		start, length, partial, err := parseRange(tt.header, 100)
+		assert.Equal(t, tt.err, err, tt.header)
+		assert.Equal(t, tt.start, start, tt.header)
+		assert.Equal(t, tt.length, length, tt.header)
+		assert.Equal(t, tt.partial, partial, tt.header)
+	}
+}
+
+func TestPutAndGetObject(t *testing.T) {
+	ts, client := getTestServer(t)
+
+	resp := doRequest(t, ts, "PUT", "/test/dir/foo.txt", []byte("hello, world\n"))
+	require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+	assert.Equal(t, `"22c3683b094136c3398391ae71b20f04"`, resp.Header.Get("ETag"))
+
+	b, err := client.ReadFile(testRoot + "/dir/foo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world\n", string(b))
+
+	resp = doRequest(t, ts, "GET", "/test/dir/foo.txt", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello, world\n", readBody(t, resp))
+	assert.Equal(t, `"22c3683b094136c3398391ae71b20f04"`, resp.Header.Get("ETag"))
+
+	resp = doRequest(t, ts, "GET", "/test/dir/foo.txt", nil, "Range", "bytes=7-11")
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "world", readBody(t, resp))
+	assert.Equal(t, "bytes 7-11/13", resp.Header.Get("Content-Range"))
+
+	resp = doRequest(t, ts, "HEAD", "/test/dir/foo.txt", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 13, resp.ContentLength)
+}
+
+func TestPutObjectBadHash(t *testing.T) {
+	ts, client := getTestServer(t)
+
+	r, err := http.NewRequest("PUT", ts.URL+"/test/bad.txt", strings.NewReader("foo"))
+	require.NoError(t, err)
+	signRequest(r, emptySHA256)
+
+	resp, err := ts.Client().Do(r)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assertErrorCode(t, resp, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+
+	_, err = client.Stat(testRoot + "/bad.txt")
+	assert.Error(t, err)
+}
+
+func TestGetObjectNonexistent(t *testing.T) {
+	ts, _ := getTestServer(t)
+
+	resp := doRequest(t, ts, "GET", "/test/nonexistent", nil)
+	assertErrorCode(t, resp, http.StatusNotFound, "NoSuchKey")
+
+	resp = doRequest(t, ts, "GET", "/nonexistent/foo", nil)
+	assertErrorCode(t, resp, http.StatusNotFound, "NoSuchBucket")
+}
+
+func TestListObjects(t *testing.T) {
+	ts, _ := getTestServer(t)
+
+	for _, key := range []string{"a/b.txt", "a/c/d.txt", "a-b.txt", "e.txt"} {
+		resp := doRequest(t, ts, "PUT", "/test/"+key, []byte(key))
+		require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+	}
+
+	var res listBucketResult
+	resp := doRequest(t, ts, "GET", "/test?list-type=2", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&res))
+
+	var keys []string
+	for _, obj := range res.Contents {
+		keys = append(keys, obj.Key)
+	}
+
+	assert.Equal(t, []string{"a-b.txt", "a/b.txt", "a/c/d.txt", "e.txt"}, keys)
+	assert.False(t, res.IsTruncated)
+
+	res = listBucketResult{}
+	resp = doRequest(t, ts, "GET", "/test?list-type=2&prefix=a/&delimiter=/", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&res))
+
+	require.Len(t, res.Contents, 1)
+	assert.Equal(t, "a/b.txt", res.Contents[0].Key)
+	assert.Equal(t, []commonPrefixXML{{Prefix: "a/c/"}}, res.CommonPrefixes)
+}
+
+func TestListObjectsPaginated(t *testing.T) {
+	ts, _ := getTestServer(t)
+
+	for _, key := range []string{"a/b.txt", "a/c/d.txt", "a-b.txt", "e.txt"} {
+		resp := doRequest(t, ts, "PUT", "/test/"+key, []byte(key))
+		require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+	}
+
+	var keys []string
+	token := ""
+	for i := 0; i < 10; i++ {
+		var res listBucketResult
+		resp := doRequest(t, ts, "GET", "/test?list-type=2&max-keys=1&continuation-token="+token, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(&res))
+
+		for _, obj := range res.Contents {
+			keys = append(keys, obj.Key)
+		}
+
+		if !res.IsTruncated {
+			break
+		}
+
+		token = res.NextContinuationToken
+	}
+
+	assert.Equal(t, []string{"a-b.txt", "a/b.txt", "a/c/d.txt", "e.txt"}, keys)
+}
+
+func TestDeleteObject(t *testing.T) {
+	ts, client := getTestServer(t)
+
+	resp := doRequest(t, ts, "PUT", "/test/delete.txt", []byte("foo"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "DELETE", "/test/delete.txt", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, err := client.Stat(testRoot + "/delete.txt")
+	assert.Error(t, err)
+
+	resp = doRequest(t, ts, "DELETE", "/test/delete.txt", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ts, client := getTestServer(t)
+
+	resp := doRequest(t, ts, "POST", "/test/multipart.txt?uploads", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+
+	var initiate initiateMultipartUploadResult
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&initiate))
+
+	var complete bytes.Buffer
+	complete.WriteString("<CompleteMultipartUpload>")
+	for i, part := range []string{"foo\n", "bar\n", "baz\n"} {
+		resp = doRequest(t, ts, "PUT", fmt.Sprintf("/test/multipart.txt?partNumber=%d&uploadId=%s",
+			i+1, initiate.UploadID), []byte(part))
+		require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+
+		fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>",
+			i+1, resp.Header.Get("ETag"))
+	}
+	complete.WriteString("</CompleteMultipartUpload>")
+
+	resp = doRequest(t, ts, "POST", "/test/multipart.txt?uploadId="+initiate.UploadID, complete.Bytes())
+	require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+
+	b, err := client.ReadFile(testRoot + "/multipart.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "foo\nbar\nbaz\n", string(b))
+
+	resp = doRequest(t, ts, "DELETE", "/test/multipart.txt?uploadId="+initiate.UploadID, nil)
+	assertErrorCode(t, resp, http.StatusNotFound, "NoSuchUpload")
+}
+
+func TestMultipartUploadWrongETag(t *testing.T) {
+	ts, _ := getTestServer(t)
+
+	resp := doRequest(t, ts, "POST", "/test/multipart-etag.txt?uploads", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+
+	var initiate initiateMultipartUploadResult
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&initiate))
+
+	resp = doRequest(t, ts, "PUT", "/test/multipart-etag.txt?partNumber=1&uploadId="+initiate.UploadID,
+		[]byte("foo\n"))
+	require.Equal(t, http.StatusOK, resp.StatusCode, readBody(t, resp))
+
+	// This is the ETag of "bar\n".
+	complete := "<CompleteMultipartUpload><Part><PartNumber>1</PartNumber>" +
+		`<ETag>"c157a79031e1c40f85931829bc5fc552"</ETag></Part></CompleteMultipartUpload>`
+	resp = doRequest(t, ts, "POST", "/test/multipart-etag.txt?uploadId="+initiate.UploadID, []byte(complete))
+	assertErrorCode(t, resp, http.StatusBadRequest, "InvalidPart")
+
+	resp = doRequest(t, ts, "DELETE", "/test/multipart-etag.txt?uploadId="+initiate.UploadID, nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode, readBody(t, resp))
+}
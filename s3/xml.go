@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// timestampFormat is the format S3 uses for timestamps in response bodies.
+const timestampFormat = "2006-01-02T15:04:05.000Z"
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+type ownerXML struct {
+	ID          string
+	DisplayName string
+}
+
+type bucketXML struct {
+	Name         string
+	CreationDate string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Owner   ownerXML    `xml:"Owner"`
+	Buckets []bucketXML `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+type objectXML struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefixXML struct {
+	Prefix string
+}
+
+// listBucketResult is the response to both versions of ListObjects. Fields
+// that only appear in one version are omitted when empty.
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Marker                *string `xml:",omitempty"`
+	NextMarker            string  `xml:",omitempty"`
+	StartAfter            string  `xml:",omitempty"`
+	ContinuationToken     string  `xml:",omitempty"`
+	NextContinuationToken string  `xml:",omitempty"`
+	KeyCount              *int    `xml:",omitempty"`
+	MaxKeys               int
+	Delimiter             string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	IsTruncated           bool
+	Contents              []objectXML
+	CommonPrefixes        []commonPrefixXML
+}
+
+// encodeKeys applies encoding-type=url to all the keys in the result.
+func (l *listBucketResult) encodeKeys() {
+	l.EncodingType = "url"
+	l.Prefix = url.QueryEscape(l.Prefix)
+	l.Delimiter = url.QueryEscape(l.Delimiter)
+	l.StartAfter = url.QueryEscape(l.StartAfter)
+	l.NextMarker = url.QueryEscape(l.NextMarker)
+	if l.Marker != nil {
+		m := url.QueryEscape(*l.Marker)
+		l.Marker = &m
+	}
+
+	for i := range l.Contents {
+		l.Contents[i].Key = url.QueryEscape(l.Contents[i].Key)
+	}
+
+	for i := range l.CommonPrefixes {
+		l.CommonPrefixes[i].Prefix = url.QueryEscape(l.CommonPrefixes[i].Prefix)
+	}
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type deletedXML struct {
+	Key string
+}
+
+type deleteErrorXML struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+type deleteResult struct {
+	XMLName xml.Name         `xml:"DeleteResult"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Deleted []deletedXML     `xml:"Deleted"`
+	Errors  []deleteErrorXML `xml:"Error"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// decodeXML decodes an XML request body, returning MalformedXML if it's
+// invalid.
+func decodeXML(r io.Reader, v interface{}) error {
+	err := xml.NewDecoder(io.LimitReader(r, maxXMLBody)).Decode(v)
+	if err != nil {
+		var s3Err *s3Error
+		if errors.As(err, &s3Err) {
+			return err
+		}
+
+		return errMalformedXML
+	}
+
+	return nil
+}
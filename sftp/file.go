@@ -0,0 +1,146 @@
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxPendingBytes limits how much out-of-order data a fileWriter buffers.
+// Clients usually have at most a few megabytes of writes in flight.
+const maxPendingBytes = 64 << 20
+
+var errOverwrite = errors.New("files in HDFS can only be written sequentially")
+
+// fileWriter adapts a sequential writer to io.WriterAt. Writes past the
+// current offset are buffered until the writes before them arrive.
+type fileWriter struct {
+	w            io.WriteCloser
+	offset       int64
+	pending      map[int64][]byte
+	pendingBytes int
+	err          error
+	lock         sync.Mutex
+}
+
+func newFileWriter(w io.WriteCloser, offset int64) *fileWriter {
+	return &fileWriter{
+		w:       w,
+		offset:  offset,
+		pending: make(map[int64][]byte),
+	}
+}
+
+func (w *fileWriter) WriteAt(b []byte, off int64) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	switch {
+	case off < w.offset:
+		return 0, errOverwrite
+	case off > w.offset:
+		if w.pendingBytes+len(b) > maxPendingBytes {
+			w.err = fmt.Errorf("too many out-of-order writes (waiting for offset %d)", w.offset)
+			return 0, w.err
+		}
+
+		// pkg/sftp reuses the buffer, so it has to be copied.
+		w.pending[off] = append([]byte(nil), b...)
+		w.pendingBytes += len(b)
+		return len(b), nil
+	}
+
+	n, err := w.write(b)
+	if err != nil {
+		return n, err
+	}
+
+	for {
+		next, ok := w.pending[w.offset]
+		if !ok {
+			break
+		}
+
+		delete(w.pending, w.offset)
+		w.pendingBytes -= len(next)
+		if _, err := w.write(next); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (w *fileWriter) write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+func (w *fileWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	err := w.w.Close()
+	if w.err != nil {
+		return w.err
+	} else if len(w.pending) > 0 {
+		return fmt.Errorf("incomplete write: missing data at offset %d", w.offset)
+	}
+
+	return err
+}
+
+// fileReader adapts a file to io.ReaderAt. Clients read files in order, a
+// chunk at a time, so reads at the current offset are served by continuing
+// the same sequential read (and thus the same datanode connection and
+// read-ahead), rather than starting a new one for each chunk as
+// FileReader.ReadAt would. Reads at any other offset seek first.
+type fileReader struct {
+	r      io.ReadSeekCloser
+	offset int64
+	lock   sync.Mutex
+}
+
+func newFileReader(r io.ReadSeekCloser) *fileReader {
+	return &fileReader{r: r}
+}
+
+func (r *fileReader) ReadAt(b []byte, off int64) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if off != r.offset {
+		_, err := r.r.Seek(off, io.SeekStart)
+		if err != nil {
+			r.offset = -1
+			return 0, err
+		}
+
+		r.offset = off
+	}
+
+	n, err := io.ReadFull(r.r, b)
+	r.offset += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	} else if err != nil && err != io.EOF {
+		// The position of the underlying reader is unknown.
+		r.offset = -1
+	}
+
+	return n, err
+}
+
+func (r *fileReader) Close() error {
+	return r.r.Close()
+}
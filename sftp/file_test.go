@@ -0,0 +1,150 @@
+package sftp
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestFileWriterOutOfOrder(t *testing.T) {
+	buf := &bufferCloser{}
+	w := newFileWriter(buf, 0)
+
+	for _, off := range []int64{6, 3, 0} {
+		b := []byte("foobarbaz")[off : off+3]
+		n, err := w.WriteAt(b, off)
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+	}
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, "foobarbaz", buf.String())
+	assert.True(t, buf.closed)
+}
+
+func TestFileWriterReusedBuffer(t *testing.T) {
+	buf := &bufferCloser{}
+	w := newFileWriter(buf, 0)
+
+	b := []byte("bar")
+	_, err := w.WriteAt(b, 3)
+	require.NoError(t, err)
+
+	copy(b, "foo")
+	_, err = w.WriteAt(b, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, "foobar", buf.String())
+}
+
+func TestFileWriterAppend(t *testing.T) {
+	buf := &bufferCloser{}
+	w := newFileWriter(buf, 10)
+
+	_, err := w.WriteAt([]byte("foo"), 0)
+	assert.Equal(t, errOverwrite, err)
+
+	_, err = w.WriteAt([]byte("foo"), 10)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "foo", buf.String())
+}
+
+func TestFileWriterGap(t *testing.T) {
+	buf := &bufferCloser{}
+	w := newFileWriter(buf, 0)
+
+	_, err := w.WriteAt([]byte("foo"), 0)
+	require.NoError(t, err)
+	_, err = w.WriteAt([]byte("baz"), 6)
+	require.NoError(t, err)
+
+	assert.Error(t, w.Close())
+	assert.Equal(t, "foo", buf.String())
+}
+
+func TestListerAt(t *testing.T) {
+	l := listerAt{nil, nil, nil}
+
+	ls := make([]os.FileInfo, 2)
+	n, err := l.ListAt(ls, 0)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, err)
+
+	n, err = l.ListAt(ls, 2)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, io.EOF, err)
+
+	n, err = l.ListAt(ls, 3)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}
+
+type seekCounter struct {
+	*bytes.Reader
+	seeks int
+}
+
+func (s *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	s.seeks++
+	return s.Reader.Seek(offset, whence)
+}
+
+func (s *seekCounter) Close() error {
+	return nil
+}
+
+func TestFileReaderSequential(t *testing.T) {
+	sc := &seekCounter{Reader: bytes.NewReader([]byte("foobarbaz"))}
+	r := newFileReader(sc)
+
+	b := make([]byte, 3)
+	for _, off := range []int64{0, 3, 6} {
+		n, err := r.ReadAt(b, off)
+		require.NoError(t, err)
+		assert.Equal(t, "foobarbaz"[off:off+3], string(b[:n]))
+	}
+
+	assert.Equal(t, 0, sc.seeks)
+
+	n, err := r.ReadAt(b, 9)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, sc.seeks)
+}
+
+func TestFileReaderSeeks(t *testing.T) {
+	sc := &seekCounter{Reader: bytes.NewReader([]byte("foobarbaz"))}
+	r := newFileReader(sc)
+
+	b := make([]byte, 3)
+	n, err := r.ReadAt(b, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b[:n]))
+	assert.Equal(t, 1, sc.seeks)
+
+	n, err = r.ReadAt(b, 7)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "az", string(b[:n]))
+	assert.Equal(t, 2, sc.seeks)
+
+	n, err = r.ReadAt(b, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b[:n]))
+	assert.Equal(t, 3, sc.seeks)
+}
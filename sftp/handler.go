@@ -0,0 +1,211 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	pkgsftp "github.com/pkg/sftp"
+)
+
+// handler implements the pkg/sftp request server handlers on top of a
+// Client, for a single session.
+type handler struct {
+	client *hdfs.Client
+	root   string
+}
+
+var _ pkgsftp.PosixRenameFileCmder = (*handler)(nil)
+
+func (h *handler) path(r *pkgsftp.Request) string {
+	return path.Join(h.root, r.Filepath)
+}
+
+func (h *handler) target(r *pkgsftp.Request) string {
+	return path.Join(h.root, r.Target)
+}
+
+// Fileread implements pkgsftp.FileReader.
+func (h *handler) Fileread(r *pkgsftp.Request) (io.ReaderAt, error) {
+	f, err := h.client.Open(h.path(r))
+	if err != nil {
+		return nil, translateError(err)
+	} else if f.Stat().IsDir() {
+		f.Close()
+		return nil, &os.PathError{"open", r.Filepath, syscall.EISDIR}
+	}
+
+	return newFileReader(f), nil
+}
+
+// Filewrite implements pkgsftp.FileWriter.
+func (h *handler) Filewrite(r *pkgsftp.Request) (io.WriterAt, error) {
+	p := h.path(r)
+	flags := r.Pflags()
+
+	info, err := h.client.Stat(p)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, translateError(err)
+	}
+
+	switch {
+	case exists && info.IsDir():
+		return nil, &os.PathError{"open", r.Filepath, syscall.EISDIR}
+	case exists && flags.Creat && flags.Excl:
+		return nil, &os.PathError{"open", r.Filepath, os.ErrExist}
+	case !exists && !flags.Creat:
+		return nil, &os.PathError{"open", r.Filepath, os.ErrNotExist}
+	case exists && !flags.Trunc:
+		w, err := h.client.Append(p)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		return newFileWriter(w, info.Size()), nil
+	case exists:
+		w, err := h.client.CreateWithOptions(p, hdfs.CreateOptions{Overwrite: true})
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		return newFileWriter(w, 0), nil
+	}
+
+	w, err := h.client.Create(p)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return newFileWriter(w, 0), nil
+}
+
+// Filecmd implements pkgsftp.FileCmder.
+func (h *handler) Filecmd(r *pkgsftp.Request) error {
+	p := h.path(r)
+
+	var err error
+	switch r.Method {
+	case "Setstat":
+		err = h.setstat(p, r)
+	case "Rename":
+		// Unlike POSIX rename, SFTP rename fails (with os.ErrExist) if the
+		// target exists.
+		err = h.client.RenameWithOptions(p, h.target(r), hdfs.RenameOptions{})
+	case "Rmdir":
+		err = h.remove(p, true)
+	case "Remove":
+		err = h.remove(p, false)
+	case "Mkdir":
+		err = h.client.Mkdir(p, 0755)
+	default:
+		return pkgsftp.ErrSSHFxOpUnsupported
+	}
+
+	return translateError(err)
+}
+
+// PosixRename implements pkgsftp.PosixRenameFileCmder.
+func (h *handler) PosixRename(r *pkgsftp.Request) error {
+	return translateError(h.client.Rename(h.path(r), h.target(r)))
+}
+
+// setstat applies the attributes in a Setstat request. Ownership changes are
+// ignored, since SFTP specifies owners as numeric IDs, which HDFS doesn't
+// have.
+func (h *handler) setstat(p string, r *pkgsftp.Request) error {
+	flags := r.AttrFlags()
+	attrs := r.Attributes()
+
+	if flags.Size {
+		_, err := h.client.Truncate(p, int64(attrs.Size))
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.Permissions {
+		err := h.client.Chmod(p, os.FileMode(attrs.Mode&07777))
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.Acmodtime {
+		err := h.client.Chtimes(p, time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *handler) remove(p string, dir bool) error {
+	info, err := h.client.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if dir && !info.IsDir() {
+		return &os.PathError{"rmdir", p, syscall.ENOTDIR}
+	} else if !dir && info.IsDir() {
+		return &os.PathError{"remove", p, syscall.EISDIR}
+	}
+
+	return h.client.Remove(p)
+}
+
+// Filelist implements pkgsftp.FileLister.
+func (h *handler) Filelist(r *pkgsftp.Request) (pkgsftp.ListerAt, error) {
+	p := h.path(r)
+	switch r.Method {
+	case "List":
+		infos, err := h.client.ReadDir(p)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		return listerAt(infos), nil
+	case "Stat":
+		info, err := h.client.Stat(p)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		return listerAt{info}, nil
+	default:
+		return nil, pkgsftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// listerAt implements pkgsftp.ListerAt for a slice of entries.
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// translateError converts errors that pkg/sftp doesn't recognize into ones
+// that it does, so that clients get the right status code. It already
+// handles os.ErrNotExist and syscall errors.
+func translateError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return pkgsftp.ErrSSHFxPermissionDenied
+	}
+
+	return err
+}
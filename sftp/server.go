@@ -0,0 +1,211 @@
+// Package sftp implements an SFTP server backed by HDFS, so that files can
+// be uploaded to and downloaded from HDFS with any SFTP client.
+//
+// Users authenticate with a public key, and each key maps to an HDFS user,
+// which all the operations in the session are performed as. The SSH login
+// name is ignored.
+//
+// Uploads are streamed straight into HDFS. Since HDFS files can only be
+// written sequentially, writes must be at the end of the file; SFTP clients
+// usually send several writes at once, so writes that arrive out of order
+// are buffered until the gap before them is filled. Existing files can be
+// appended to (which is how most clients resume an upload) or truncated and
+// replaced, but not overwritten in place.
+package sftp
+
+import (
+	"errors"
+	"net"
+	"path"
+	"sync"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/internal/clientcache"
+	pkgsftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// userExtension is the key in ssh.Permissions.Extensions that we store the
+// HDFS user under, after authenticating a connection.
+const userExtension = "hdfs-user"
+
+// AuthorizedKey is a public key that is allowed to log in, along with the
+// HDFS user it maps to.
+type AuthorizedKey struct {
+	Key  ssh.PublicKey
+	User string
+}
+
+// ServerOptions represents the configurable options for a Server.
+type ServerOptions struct {
+	// ClientOptions is used to connect to HDFS. The Server creates one Client
+	// for each user it sees, and closes it again once it has been idle for a
+	// while. If KerberosClient is set, each Client
+	// authenticates as the kerberos principal and impersonates the user with
+	// ProxyUser, so the principal must be allowed to do that by the namenode.
+	// Otherwise, User is simply set to the name of the user.
+	ClientOptions hdfs.ClientOptions
+	// HostKeys are the private keys that the server uses to identify itself.
+	// At least one is required.
+	HostKeys []ssh.Signer
+	// AuthorizedKeys lists the public keys that are allowed to log in.
+	AuthorizedKeys []AuthorizedKey
+	// Root is the directory in HDFS that clients see as /. If empty, it
+	// defaults to the root of the filesystem.
+	Root string
+}
+
+// Server is an SFTP server backed by HDFS.
+type Server struct {
+	options ServerOptions
+	config  *ssh.ServerConfig
+	keys    map[string]string
+	clients *clientcache.Cache
+}
+
+// NewServer returns a new Server with the given options.
+func NewServer(options ServerOptions) (*Server, error) {
+	if len(options.HostKeys) == 0 {
+		return nil, errors.New("at least one host key is required")
+	}
+
+	if options.Root == "" {
+		options.Root = "/"
+	} else if !path.IsAbs(options.Root) {
+		return nil, errors.New("root must be an absolute path: " + options.Root)
+	}
+
+	s := &Server{
+		options: options,
+		keys:    make(map[string]string, len(options.AuthorizedKeys)),
+		clients: clientcache.New(options.ClientOptions,
+			clientcache.DefaultCapacity, clientcache.DefaultExpiry),
+	}
+
+	for _, key := range options.AuthorizedKeys {
+		s.keys[string(key.Key.Marshal())] = key.User
+	}
+
+	s.config = &ssh.ServerConfig{PublicKeyCallback: s.authenticate}
+	for _, key := range options.HostKeys {
+		s.config.AddHostKey(key)
+	}
+
+	return s, nil
+}
+
+func (s *Server) authenticate(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	user, ok := s.keys[string(key.Marshal())]
+	if !ok {
+		return nil, errors.New("unknown public key for " + conn.User())
+	}
+
+	return &ssh.Permissions{Extensions: map[string]string{userExtension: user}}, nil
+}
+
+// ListenAndServe listens on the TCP network address addr and then calls
+// Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and serves each one in a new
+// goroutine. It only returns if Accept fails, for example because the
+// listener was closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn performs the SSH handshake on a single connection, and then
+// serves SFTP sessions on it until it's closed.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return err
+	}
+	defer sconn.Close()
+
+	go ssh.DiscardRequests(reqs)
+	client, release, err := s.clients.Get(sconn.Permissions.Extensions[userExtension])
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Wait for the sessions to finish before releasing the client.
+	var sessions sync.WaitGroup
+	defer sessions.Wait()
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			s.serveSession(ch, requests, client)
+		}()
+	}
+
+	return nil
+}
+
+// serveSession waits for a request to start the sftp subsystem, and then
+// serves it. Everything else, like shell and exec requests, is refused.
+func (s *Server) serveSession(ch ssh.Channel, requests <-chan *ssh.Request, client *hdfs.Client) {
+	defer ch.Close()
+
+	for req := range requests {
+		// The payload is the subsystem name, prefixed by its length.
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				req.Reply(false, nil)
+			}
+		}()
+
+		h := &handler{client: client, root: s.options.Root}
+		server := pkgsftp.NewRequestServer(ch, pkgsftp.Handlers{
+			FileGet:  h,
+			FilePut:  h,
+			FileCmd:  h,
+			FileList: h,
+		})
+
+		server.Serve()
+		server.Close()
+		return
+	}
+}
+
+// Close closes all the clients opened by the Server. It doesn't close any
+// listeners passed to Serve.
+func (s *Server) Close() error {
+	return s.clients.Close()
+}
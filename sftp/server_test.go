@@ -0,0 +1,206 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	pkgsftp "github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+const testRoot = "/_test/sftp"
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestAuthenticate(t *testing.T) {
+	authorized := newSigner(t)
+	s, err := NewServer(ServerOptions{
+		HostKeys:       []ssh.Signer{newSigner(t)},
+		AuthorizedKeys: []AuthorizedKey{{Key: authorized.PublicKey(), User: "gohdfs1"}},
+	})
+	require.NoError(t, err)
+
+	perms, err := s.authenticate(nil, authorized.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, "gohdfs1", perms.Extensions[userExtension])
+}
+
+func TestNewServerWithoutHostKey(t *testing.T) {
+	_, err := NewServer(ServerOptions{})
+	assert.Error(t, err)
+}
+
+// getTestClient starts a server on a random port, and returns an SFTP client
+// connected to it, along with an HDFS client for checking the results.
+func getTestClient(t *testing.T) (*pkgsftp.Client, *hdfs.Client) {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	options := hdfs.ClientOptionsFromConf(conf)
+	if options.Addresses == nil {
+		t.Fatal("Missing namenode addresses in ambient config")
+	} else if options.KerberosClient != nil {
+		t.Skip("Kerberos isn't supported by these tests")
+	}
+
+	options.User = "gohdfs1"
+	client, err := hdfs.NewClient(options)
+	require.NoError(t, err)
+
+	err = client.RemoveAll(testRoot)
+	require.NoError(t, err)
+	err = client.MkdirAll(testRoot, 0755)
+	require.NoError(t, err)
+
+	userKey := newSigner(t)
+	s, err := NewServer(ServerOptions{
+		ClientOptions:  options,
+		HostKeys:       []ssh.Signer{newSigner(t)},
+		AuthorizedKeys: []AuthorizedKey{{Key: userKey.PublicKey(), User: "gohdfs1"}},
+		Root:           testRoot,
+	})
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+
+	conn, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "partner",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(userKey)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+
+	sc, err := pkgsftp.NewClient(conn)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		sc.Close()
+		conn.Close()
+		l.Close()
+		s.Close()
+		client.Close()
+	})
+
+	return sc, client
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	sc, client := getTestClient(t)
+
+	f, err := sc.Create("/upload.txt")
+	require.NoError(t, err)
+
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	_, err = f.ReadFrom(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b, err := client.ReadFile(testRoot + "/upload.txt")
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	f, err = sc.Open("/upload.txt")
+	require.NoError(t, err)
+	defer f.Close()
+
+	b, err = io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestResumeUpload(t *testing.T) {
+	sc, client := getTestClient(t)
+
+	f, err := sc.Create("/resume.txt")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	f, err = sc.OpenFile("/resume.txt", os.O_WRONLY)
+	require.NoError(t, err)
+	_, err = f.Seek(3, io.SeekStart)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b, err := client.ReadFile(testRoot + "/resume.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(b))
+}
+
+func TestDirectoryOperations(t *testing.T) {
+	sc, client := getTestClient(t)
+
+	require.NoError(t, sc.Mkdir("/dir"))
+	for _, name := range []string{"/dir/a", "/dir/b"} {
+		f, err := sc.Create(name)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	infos, err := sc.ReadDir("/dir")
+	require.NoError(t, err)
+
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	err = sc.Rename("/dir/a", "/dir/b")
+	assert.Error(t, err)
+
+	require.NoError(t, sc.Rename("/dir/a", "/dir/c"))
+	require.NoError(t, sc.Remove("/dir/b"))
+	require.NoError(t, sc.Remove("/dir/c"))
+	require.NoError(t, sc.RemoveDirectory("/dir"))
+
+	_, err = client.Stat(testRoot + "/dir")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStatNonexistent(t *testing.T) {
+	sc, _ := getTestClient(t)
+
+	_, err := sc.Stat("/nonexistent")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChmod(t *testing.T) {
+	sc, client := getTestClient(t)
+
+	f, err := sc.Create("/chmod.txt")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, sc.Chmod("/chmod.txt", 0600))
+
+	info, err := client.Stat(testRoot + "/chmod.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0600, info.Mode().Perm())
+}
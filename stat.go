@@ -106,3 +106,15 @@ func (fi *FileInfo) OwnerGroup() string {
 func (fi *FileInfo) AccessTime() time.Time {
 	return time.Unix(int64(fi.status.GetAccessTime())/1000, 0)
 }
+
+// Replication returns the replication factor of the file. It's not part of the
+// os.FileInfo interface, and is always zero for directories.
+func (fi *FileInfo) Replication() int {
+	return int(fi.status.GetBlockReplication())
+}
+
+// BlockSize returns the block size of the file. It's not part of the
+// os.FileInfo interface, and is always zero for directories.
+func (fi *FileInfo) BlockSize() int64 {
+	return int64(fi.status.GetBlocksize())
+}
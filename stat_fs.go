@@ -15,8 +15,39 @@ type FsInfo struct {
 	MissingReplOneBlocks  uint64
 	BlocksInFuture        uint64
 	PendingDeletionBlocks uint64
+
+	// ReplicatedBlocks and ECBlockGroups break the block statistics down by
+	// replicated and erasure coded files, respectively. They are only
+	// available from namenodes running Hadoop 3 or later, and are left empty
+	// otherwise.
+	ReplicatedBlocks ReplicatedBlockStats
+	ECBlockGroups    ECBlockGroupStats
+}
+
+// ReplicatedBlockStats provides block statistics for replicated files.
+type ReplicatedBlockStats struct {
+	LowRedundancy                      uint64
+	CorruptBlocks                      uint64
+	MissingBlocks                      uint64
+	MissingReplOneBlocks               uint64
+	BlocksInFuture                     uint64
+	PendingDeletionBlocks              uint64
+	HighestPriorityLowRedundancyBlocks uint64
 }
 
+// ECBlockGroupStats provides block group statistics for erasure coded files.
+type ECBlockGroupStats struct {
+	LowRedundancy                      uint64
+	CorruptBlocks                      uint64
+	MissingBlocks                      uint64
+	BlocksInFuture                     uint64
+	PendingDeletionBlocks              uint64
+	HighestPriorityLowRedundancyBlocks uint64
+}
+
+// StatFs returns information about the filesystem. If the namenode is too old
+// to break the block statistics down into ReplicatedBlocks and ECBlockGroups,
+// those fields are left empty.
 func (c *Client) StatFs() (FsInfo, error) {
 	req := &hdfs.GetFsStatusRequestProto{}
 	resp := &hdfs.GetFsStatsResponseProto{}
@@ -37,5 +68,54 @@ func (c *Client) StatFs() (FsInfo, error) {
 	fs.BlocksInFuture = resp.GetBlocksInFuture()
 	fs.PendingDeletionBlocks = resp.GetPendingDeletionBlocks()
 
+	fs.ReplicatedBlocks, err = c.replicatedBlockStats()
+	if err != nil && !isNoSuchMethod(err) {
+		return FsInfo{}, err
+	}
+
+	fs.ECBlockGroups, err = c.ecBlockGroupStats()
+	if err != nil && !isNoSuchMethod(err) {
+		return FsInfo{}, err
+	}
+
 	return fs, nil
 }
+
+func (c *Client) replicatedBlockStats() (ReplicatedBlockStats, error) {
+	req := &hdfs.GetFsReplicatedBlockStatsRequestProto{}
+	resp := &hdfs.GetFsReplicatedBlockStatsResponseProto{}
+
+	err := c.namenode.Execute("getFsReplicatedBlockStats", req, resp)
+	if err != nil {
+		return ReplicatedBlockStats{}, err
+	}
+
+	return ReplicatedBlockStats{
+		LowRedundancy:                      resp.GetLowRedundancy(),
+		CorruptBlocks:                      resp.GetCorruptBlocks(),
+		MissingBlocks:                      resp.GetMissingBlocks(),
+		MissingReplOneBlocks:               resp.GetMissingReplOneBlocks(),
+		BlocksInFuture:                     resp.GetBlocksInFuture(),
+		PendingDeletionBlocks:              resp.GetPendingDeletionBlocks(),
+		HighestPriorityLowRedundancyBlocks: resp.GetHighestPrioLowRedundancyBlocks(),
+	}, nil
+}
+
+func (c *Client) ecBlockGroupStats() (ECBlockGroupStats, error) {
+	req := &hdfs.GetFsECBlockGroupStatsRequestProto{}
+	resp := &hdfs.GetFsECBlockGroupStatsResponseProto{}
+
+	err := c.namenode.Execute("getFsECBlockGroupStats", req, resp)
+	if err != nil {
+		return ECBlockGroupStats{}, err
+	}
+
+	return ECBlockGroupStats{
+		LowRedundancy:                      resp.GetLowRedundancy(),
+		CorruptBlocks:                      resp.GetCorruptBlocks(),
+		MissingBlocks:                      resp.GetMissingBlocks(),
+		BlocksInFuture:                     resp.GetBlocksInFuture(),
+		PendingDeletionBlocks:              resp.GetPendingDeletionBlocks(),
+		HighestPriorityLowRedundancyBlocks: resp.GetHighestPrioLowRedundancyBlocks(),
+	}, nil
+}
@@ -0,0 +1,370 @@
+package hdfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	trashDir     = ".Trash"
+	trashCurrent = "Current"
+	trashPerm    = 0700
+
+	// trashCheckpointFormat is the format of checkpoint names, yyMMddHHmmss in
+	// java parlance.
+	trashCheckpointFormat = "060102150405"
+)
+
+var (
+	// ErrTrashDisabled is returned by MoveToTrash if neither the namenode nor
+	// the client has a trash interval configured.
+	ErrTrashDisabled = errors.New("trash is disabled")
+	// ErrAlreadyInTrash is returned by MoveToTrash if the file is already in
+	// the trash.
+	ErrAlreadyInTrash = errors.New("already in the trash")
+)
+
+// TrashInterval returns how long files are kept in the trash before being
+// deleted. This is the interval set on the namenode, if there is one, and
+// otherwise ClientOptions.TrashInterval. A zero value means the trash is
+// disabled.
+func (c *Client) TrashInterval() (time.Duration, error) {
+	defaults, err := c.fetchDefaults()
+	if err != nil {
+		return 0, err
+	}
+
+	if minutes := defaults.GetTrashInterval(); minutes > 0 {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+
+	return c.options.TrashInterval, nil
+}
+
+// TrashRoot returns the trash directory for the named file or directory.
+// This is generally /user/<user>/.Trash, but files in an encryption zone
+// can't be moved out of it, so they have a trash root inside the zone, at
+// <zone>/.Trash/<user>.
+func (c *Client) TrashRoot(name string) (string, error) {
+	name = path.Clean(name)
+	ez, err := c.encryptionZone(path.Dir(name))
+	if err != nil {
+		return "", &os.PathError{"trash root", name, interpretException(err)}
+	} else if ez != "" {
+		return path.Join(ez, trashDir, c.User()), nil
+	}
+
+	return path.Join("/user", c.User(), trashDir), nil
+}
+
+// TrashRoots returns all the existing trash directories for the current user,
+// including those inside encryption zones. If allUsers is true, it returns the
+// trash directories of all users instead.
+//
+// Listing the trash directories inside encryption zones requires superuser
+// privileges; for other users, only the home trash directories are returned.
+func (c *Client) TrashRoots(allUsers bool) ([]string, error) {
+	var homes []string
+	if allUsers {
+		users, err := c.ReadDir("/user")
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, u := range users {
+			if u.IsDir() {
+				homes = append(homes, path.Join("/user", u.Name()))
+			}
+		}
+	} else {
+		homes = []string{path.Join("/user", c.User())}
+	}
+
+	var roots []string
+	for _, home := range homes {
+		root := path.Join(home, trashDir)
+		if ok, err := c.isDir(root); err != nil {
+			return nil, err
+		} else if ok {
+			roots = append(roots, root)
+		}
+	}
+
+	zones, err := c.encryptionZones()
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return roots, nil
+		}
+
+		return nil, err
+	}
+
+	for _, zone := range zones {
+		zoneTrash := path.Join(zone, trashDir)
+		if allUsers {
+			users, err := c.ReadDir(zoneTrash)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			for _, u := range users {
+				if u.IsDir() {
+					roots = append(roots, path.Join(zoneTrash, u.Name()))
+				}
+			}
+		} else {
+			root := path.Join(zoneTrash, c.User())
+			if ok, err := c.isDir(root); err != nil {
+				return nil, err
+			} else if ok {
+				roots = append(roots, root)
+			}
+		}
+	}
+
+	return roots, nil
+}
+
+// MoveToTrash moves the named file or directory to the Current directory of
+// its trash root (see TrashRoot), preserving its absolute path, and returns the
+// new location. If something already exists at that location, a timestamp is
+// appended to the name.
+//
+// Files in the trash are deleted by ExpungeTrash once they're older than the
+// trash interval. If the trash is disabled, or the file is already in the
+// trash, MoveToTrash returns an *os.PathError wrapping ErrTrashDisabled or
+// ErrAlreadyInTrash respectively, and the file is left untouched.
+func (c *Client) MoveToTrash(name string) (string, error) {
+	name = path.Clean(name)
+	interval, err := c.TrashInterval()
+	if err != nil {
+		return "", &os.PathError{"trash", name, interpretException(err)}
+	} else if interval == 0 {
+		return "", &os.PathError{"trash", name, ErrTrashDisabled}
+	}
+
+	_, err = c.getFileInfo(name)
+	if err != nil {
+		return "", &os.PathError{"trash", name, interpretException(err)}
+	}
+
+	root, err := c.TrashRoot(name)
+	if err != nil {
+		return "", err
+	}
+
+	if name == root || strings.HasPrefix(name, root+"/") {
+		return "", &os.PathError{"trash", name, ErrAlreadyInTrash}
+	} else if name == "/" || strings.HasPrefix(root, name+"/") {
+		return "", &os.PathError{"trash", name, errors.New("contains the trash")}
+	}
+
+	dest := path.Join(root, trashCurrent, name)
+	err = c.MkdirAll(path.Dir(dest), trashPerm)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.rename(name, dest, false)
+	if os.IsExist(err) {
+		dest = dest + strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		err = c.rename(name, dest, false)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+// CheckpointTrash renames the Current directory in each of the user's trash
+// roots to a checkpoint named after the current time. Checkpoints are
+// deleted by ExpungeTrash once they're older than the trash interval.
+func (c *Client) CheckpointTrash() error {
+	roots, err := c.TrashRoots(false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, root := range roots {
+		err = c.createTrashCheckpoint(root, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExpungeTrash deletes all the checkpoints in the user's trash roots that
+// are older than the trash interval, and then checkpoints the Current
+// directory of each one; this is the equivalent of 'hadoop fs -expunge'.
+// If immediate is true, it instead deletes everything in the trash,
+// regardless of age.
+func (c *Client) ExpungeTrash(immediate bool) error {
+	interval, err := c.TrashInterval()
+	if err != nil {
+		return err
+	}
+
+	roots, err := c.TrashRoots(false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, root := range roots {
+		err = c.deleteTrashCheckpoints(root, now, interval, immediate)
+		if err != nil {
+			return err
+		}
+
+		err = c.createTrashCheckpoint(root, now)
+		if err != nil {
+			return err
+		}
+
+		if immediate {
+			err = c.deleteTrashCheckpoints(root, now, interval, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) createTrashCheckpoint(root string, t time.Time) error {
+	current := path.Join(root, trashCurrent)
+	if ok, err := c.isDir(current); err != nil || !ok {
+		return err
+	}
+
+	base := path.Join(root, t.Format(trashCheckpointFormat))
+	checkpoint := base
+	for attempt := 1; ; attempt++ {
+		err := c.rename(current, checkpoint, false)
+		if err == nil {
+			return nil
+		} else if !os.IsExist(err) || attempt > 1000 {
+			return err
+		}
+
+		checkpoint = fmt.Sprintf("%s-%d", base, attempt)
+	}
+}
+
+func (c *Client) deleteTrashCheckpoints(root string, now time.Time, interval time.Duration, all bool) error {
+	entries, err := c.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == trashCurrent {
+			continue
+		}
+
+		// Anything that doesn't look like a checkpoint is left alone.
+		name := entry.Name()
+		if i := strings.IndexByte(name, '-'); i >= 0 {
+			name = name[:i]
+		}
+
+		t, err := time.ParseInLocation(trashCheckpointFormat, name, time.Local)
+		if err != nil {
+			continue
+		}
+
+		if all || now.Sub(t) >= interval {
+			err = c.RemoveAll(path.Join(root, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) isDir(name string) (bool, error) {
+	info, err := c.getFileInfo(name)
+	if err != nil {
+		err = interpretException(err)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, &os.PathError{"stat", name, err}
+	}
+
+	return info.IsDir(), nil
+}
+
+// encryptionZone returns the root of the encryption zone containing the named
+// path, or an empty string if it isn't in one or the cluster doesn't have
+// encryption enabled.
+func (c *Client) encryptionZone(name string) (string, error) {
+	if ok, err := c.encryptionEnabled(); err != nil || !ok {
+		return "", err
+	}
+
+	req := &hdfs.GetEZForPathRequestProto{Src: proto.String(name)}
+	resp := &hdfs.GetEZForPathResponseProto{}
+
+	err := c.namenode.Execute("getEZForPath", req, resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.GetZone().GetPath(), nil
+}
+
+// encryptionZones returns the roots of all the encryption zones in the
+// cluster, if encryption is enabled.
+func (c *Client) encryptionZones() ([]string, error) {
+	if ok, err := c.encryptionEnabled(); err != nil || !ok {
+		return nil, err
+	}
+
+	var zones []string
+	var id int64
+	for {
+		req := &hdfs.ListEncryptionZonesRequestProto{Id: proto.Int64(id)}
+		resp := &hdfs.ListEncryptionZonesResponseProto{}
+
+		err := c.namenode.Execute("listEncryptionZones", req, resp)
+		if err != nil {
+			return nil, interpretException(err)
+		}
+
+		for _, zone := range resp.GetZones() {
+			zones = append(zones, zone.GetPath())
+			id = zone.GetId()
+		}
+
+		if !resp.GetHasMore() || len(resp.GetZones()) == 0 {
+			return zones, nil
+		}
+	}
+}
+
+func (c *Client) encryptionEnabled() (bool, error) {
+	defaults, err := c.fetchDefaults()
+	if err != nil {
+		return false, err
+	}
+
+	return defaults.GetKeyProviderUri() != "", nil
+}
@@ -0,0 +1,127 @@
+package hdfs
+
+import (
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getClientWithTrash(t *testing.T) *Client {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	u, err := user.Current()
+	require.NoError(t, err)
+
+	options := ClientOptionsFromConf(conf)
+	options.TrashInterval = time.Hour
+	if options.KerberosClient != nil {
+		options.KerberosClient = getKerberosClient(t, u.Username)
+	} else {
+		options.User = u.Username
+	}
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestMoveToTrash(t *testing.T) {
+	client := getClientWithTrash(t)
+	defer client.Close()
+
+	root, err := client.TrashRoot("/_test/totrash")
+	require.NoError(t, err)
+	assert.Equal(t, path.Join("/user", client.User(), ".Trash"), root)
+
+	baleet(t, path.Join(root, "Current/_test/totrash"))
+	touch(t, "/_test/totrash")
+
+	dest, err := client.MoveToTrash("/_test/totrash")
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(root, "Current/_test/totrash"), dest)
+
+	_, err = client.Stat("/_test/totrash")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = client.Stat(dest)
+	assert.NoError(t, err)
+
+	// Trashing a file with the same name again should add a suffix.
+	touch(t, "/_test/totrash")
+
+	dest2, err := client.MoveToTrash("/_test/totrash")
+	require.NoError(t, err)
+	assert.NotEqual(t, dest, dest2)
+	assert.True(t, strings.HasPrefix(dest2, dest))
+
+	_, err = client.MoveToTrash(dest)
+	assertPathError(t, err, "trash", dest, ErrAlreadyInTrash)
+}
+
+func TestMoveToTrashNonexistent(t *testing.T) {
+	client := getClientWithTrash(t)
+	defer client.Close()
+
+	_, err := client.MoveToTrash("/_test/nonexistent")
+	assertPathError(t, err, "trash", "/_test/nonexistent", os.ErrNotExist)
+}
+
+func TestMoveToTrashDisabled(t *testing.T) {
+	client := getClient(t)
+
+	touch(t, "/_test/totrash_disabled")
+
+	_, err := client.MoveToTrash("/_test/totrash_disabled")
+	assertPathError(t, err, "trash", "/_test/totrash_disabled", ErrTrashDisabled)
+
+	_, err = client.Stat("/_test/totrash_disabled")
+	assert.NoError(t, err)
+}
+
+func TestExpungeTrash(t *testing.T) {
+	client := getClientWithTrash(t)
+	defer client.Close()
+
+	touch(t, "/_test/toexpunge")
+	dest, err := client.MoveToTrash("/_test/toexpunge")
+	require.NoError(t, err)
+
+	root, err := client.TrashRoot("/_test/toexpunge")
+	require.NoError(t, err)
+
+	roots, err := client.TrashRoots(false)
+	require.NoError(t, err)
+	assert.Contains(t, roots, root)
+
+	// The checkpoint is newer than the trash interval, so it's kept.
+	err = client.ExpungeTrash(false)
+	require.NoError(t, err)
+
+	_, err = client.Stat(dest)
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := client.ReadDir(root)
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.NotEqual(t, "Current", entry.Name())
+	}
+
+	err = client.ExpungeTrash(true)
+	require.NoError(t, err)
+
+	entries, err = client.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
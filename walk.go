@@ -3,25 +3,25 @@ package hdfs
 import (
 	"os"
 	"path/filepath"
-	"sort"
 )
 
 // Walk walks the file tree rooted at root, calling walkFn for each file or
 // directory in the tree, including root. All errors that arise visiting files
 // and directories are filtered by walkFn. The files are walked in lexical
-// order, which makes the output deterministic but means that for very large
-// directories Walk can be inefficient. Walk does not follow symbolic links.
+// order, which makes the output deterministic. Directory listings are fetched
+// lazily, a page at a time, so Walk can handle very large directories without
+// holding them in memory. Walk does not follow symbolic links.
 func (c *Client) Walk(root string, walkFn filepath.WalkFunc) error {
-	return c.walk(root, walkFn)
-}
-
-func (c *Client) walk(path string, walkFn filepath.WalkFunc) error {
-	file, err := c.Open(path)
+	file, err := c.Open(root)
 	var info os.FileInfo
 	if file != nil {
 		info = file.Stat()
 	}
 
+	return c.walk(root, info, err, walkFn)
+}
+
+func (c *Client) walk(path string, info os.FileInfo, err error, walkFn filepath.WalkFunc) error {
 	err = walkFn(path, info, err)
 	if err != nil {
 		if info != nil && info.IsDir() && err == filepath.SkipDir {
@@ -35,18 +35,20 @@ func (c *Client) walk(path string, walkFn filepath.WalkFunc) error {
 		return nil
 	}
 
-	names, err := file.Readdirnames(0)
-	if err != nil {
-		return walkFn(path, info, err)
-	}
-
-	sort.Strings(names)
-	for _, name := range names {
-		err = c.walk(filepath.ToSlash(filepath.Join(path, name)), walkFn)
+	// The namenode returns entries in lexical order, so there's no need to
+	// sort them here.
+	it := c.ListDir(path, ListOptions{})
+	for it.Next() {
+		child := it.Entry()
+		err = c.walk(filepath.ToSlash(filepath.Join(path, child.Name())), child, nil, walkFn)
 		if err != nil {
 			return err
 		}
 	}
 
+	if err := it.Err(); err != nil {
+		return walkFn(path, info, err)
+	}
+
 	return nil
 }
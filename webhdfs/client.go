@@ -0,0 +1,487 @@
+package webhdfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/internal/exception"
+	krb "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+const maxRedirects = 10
+
+// ClientOptions represents the configurable options for a Client.
+type ClientOptions struct {
+	// Address is the base URL of the WebHDFS or HttpFS server, for example
+	// http://namenode:9870 or https://httpfs:14000. PathPrefix is added to it.
+	Address string
+	// User is passed as the user.name parameter, for servers using Hadoop's
+	// simple authentication. It's ignored if KerberosClient or
+	// DelegationToken is set.
+	User string
+	// ProxyUser, if set, is passed as the doAs parameter, to act as another
+	// user.
+	ProxyUser string
+	// DelegationToken is used to authenticate each request, if set. It takes
+	// precedence over KerberosClient.
+	DelegationToken string
+	// KerberosClient is used to authenticate with SPNEGO, for kerberized
+	// clusters.
+	KerberosClient *krb.Client
+	// KerberosServicePrincipleName specifies the Service Principle Name of the
+	// server, for SPNEGO. If empty, HTTP/<host> is used.
+	KerberosServicePrincipleName string
+	// HTTPClient is used to make requests. If nil, a new http.Client is used.
+	// Its CheckRedirect function is ignored, since the Client follows
+	// redirects itself.
+	HTTPClient *http.Client
+}
+
+// Client is a WebHDFS client. It implements hdfs.FileSystem, so it can be used
+// interchangeably with the native client, for example when only the HTTP port
+// of a cluster (or of an HttpFS gateway) is reachable.
+//
+// Reads and writes follow the redirects issued by the server, which means
+// that data is transferred directly to and from the datanodes when talking to
+// the namenode, and through the gateway when talking to HttpFS.
+type Client struct {
+	options ClientOptions
+	base    *url.URL
+	http    *http.Client
+}
+
+var _ hdfs.FileSystem = (*Client)(nil)
+
+// NewClient returns a new Client with the given options. It doesn't contact
+// the server.
+func NewClient(options ClientOptions) (*Client, error) {
+	base, err := url.Parse(options.Address)
+	if err != nil {
+		return nil, err
+	} else if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid WebHDFS address: %s", options.Address)
+	}
+
+	if options.User == "" && options.KerberosClient == nil && options.DelegationToken == "" {
+		return nil, errors.New("user not specified")
+	}
+
+	var httpClient http.Client
+	if options.HTTPClient != nil {
+		httpClient = *options.HTTPClient
+	}
+
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Client{
+		options: options,
+		base:    base,
+		http:    &httpClient,
+	}, nil
+}
+
+// User returns the user that the Client is acting as, if known.
+func (c *Client) User() string {
+	if c.options.ProxyUser != "" {
+		return c.options.ProxyUser
+	} else if c.options.KerberosClient != nil {
+		return c.options.KerberosClient.Credentials.UserName()
+	}
+
+	return c.options.User
+}
+
+// Close closes any idle connections.
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func (c *Client) url(name, op string, params url.Values) string {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+
+	q.Set("op", op)
+	if c.options.DelegationToken != "" {
+		q.Set("delegation", c.options.DelegationToken)
+	} else if c.options.KerberosClient == nil {
+		q.Set("user.name", c.options.User)
+	}
+
+	if c.options.ProxyUser != "" {
+		q.Set("doas", c.options.ProxyUser)
+	}
+
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + PathPrefix + path.Clean("/"+name)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// do sends a request, adding a SPNEGO header if necessary. It doesn't follow
+// redirects.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	// Redirects to the datanodes carry a delegation token, in which case
+	// SPNEGO isn't necessary (or possible).
+	if c.options.KerberosClient != nil && req.URL.Query().Get("delegation") == "" {
+		err := spnego.SetSPNEGOHeader(c.options.KerberosClient, req, c.options.KerberosServicePrincipleName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.http.Do(req)
+}
+
+// get sends a GET request, following any redirects.
+func (c *Client) get(u string) (*http.Response, error) {
+	for i := 0; i < maxRedirects; i++ {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, err := redirectLocation(resp)
+		if err != nil {
+			return nil, err
+		} else if loc == "" {
+			return resp, nil
+		}
+
+		u = loc
+	}
+
+	return nil, errors.New("too many redirects")
+}
+
+// call performs a metadata operation and decodes the JSON response into v,
+// if v isn't nil.
+func (c *Client) call(method, name, op string, params url.Values, v interface{}) error {
+	u := c.url(name, op, params)
+
+	var resp *http.Response
+	var err error
+	if method == http.MethodGet {
+		resp, err = c.get(u)
+	} else {
+		var req *http.Request
+		req, err = http.NewRequest(method, u, nil)
+		if err == nil {
+			resp, err = c.do(req)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(op, resp)
+	} else if v == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func redirectLocation(resp *http.Response) (string, error) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return "", nil
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	loc, err := resp.Location()
+	if err != nil {
+		return "", err
+	}
+
+	return loc.String(), nil
+}
+
+// remoteError represents a RemoteException returned by the server. It
+// implements hdfs.Error.
+type remoteError struct {
+	method    string
+	exception string
+	message   string
+}
+
+func (e *remoteError) Method() string {
+	return e.method
+}
+
+func (e *remoteError) Desc() string {
+	return ""
+}
+
+func (e *remoteError) Exception() string {
+	return e.exception
+}
+
+func (e *remoteError) Message() string {
+	return e.message
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("%s call failed with %s: %s", e.method, e.exception, e.message)
+}
+
+// responseError converts an error response into an error, interpreting
+// exceptions the same way the native client does.
+func responseError(op string, resp *http.Response) error {
+	var remote remoteExceptionJSON
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(b, &remote) != nil || remote.RemoteException.JavaClassName == "" {
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return os.ErrNotExist
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return os.ErrPermission
+		}
+
+		return fmt.Errorf("%s call failed with status %s", op, resp.Status)
+	}
+
+	interpret := exception.Interpret
+	if op == "CREATE" {
+		interpret = exception.InterpretCreate
+	}
+
+	if err := interpret(remote.RemoteException.JavaClassName); err != nil {
+		return err
+	}
+
+	return &remoteError{
+		method:    op,
+		exception: remote.RemoteException.JavaClassName,
+		message:   remote.RemoteException.Message,
+	}
+}
+
+// Stat returns an os.FileInfo describing the named file or directory.
+func (c *Client) Stat(name string) (os.FileInfo, error) {
+	var resp fileStatusResponse
+	err := c.call(http.MethodGet, name, "GETFILESTATUS", nil, &resp)
+	if err != nil {
+		return nil, &os.PathError{"stat", name, err}
+	}
+
+	return newFileInfo(resp.FileStatus, path.Base(name)), nil
+}
+
+// ReadDir reads the directory named by dirname and returns a list of sorted
+// directory entries.
+func (c *Client) ReadDir(dirname string) ([]os.FileInfo, error) {
+	var resp fileStatusesResponse
+	err := c.call(http.MethodGet, dirname, "LISTSTATUS", nil, &resp)
+	if err != nil {
+		return nil, &os.PathError{"readdir", dirname, err}
+	}
+
+	res := make([]os.FileInfo, len(resp.FileStatuses.FileStatus))
+	for i, status := range resp.FileStatuses.FileStatus {
+		res[i] = newFileInfo(status, status.PathSuffix)
+	}
+
+	return res, nil
+}
+
+// Mkdir creates a new directory with the specified name and permission bits.
+// Since WebHDFS always creates missing parents, this first checks that the
+// parent exists and the directory doesn't.
+func (c *Client) Mkdir(dirname string, perm os.FileMode) error {
+	info, err := c.Stat(path.Dir(dirname))
+	if err != nil {
+		return &os.PathError{"mkdir", dirname, errors.Unwrap(err)}
+	} else if !info.IsDir() {
+		return &os.PathError{"mkdir", dirname, errors.New("parent is not a directory")}
+	}
+
+	_, err = c.Stat(dirname)
+	if err == nil {
+		return &os.PathError{"mkdir", dirname, os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return c.mkdirs(dirname, perm)
+}
+
+// MkdirAll creates a directory for dirname, along with any necessary parents.
+func (c *Client) MkdirAll(dirname string, perm os.FileMode) error {
+	return c.mkdirs(dirname, perm)
+}
+
+func (c *Client) mkdirs(dirname string, perm os.FileMode) error {
+	var resp booleanResponse
+	params := url.Values{"permission": {strconv.FormatUint(uint64(perm.Perm()), 8)}}
+	err := c.call(http.MethodPut, dirname, "MKDIRS", params, &resp)
+	if err != nil {
+		return &os.PathError{"mkdir", dirname, err}
+	} else if !resp.Boolean {
+		return &os.PathError{"mkdir", dirname, errors.New("mkdirs returned false")}
+	}
+
+	return nil
+}
+
+// Remove removes the named file or (empty) directory.
+func (c *Client) Remove(name string) error {
+	return c.delete(name, false)
+}
+
+// RemoveAll removes path and any children it contains. If the path does not
+// exist, RemoveAll returns nil (no error).
+func (c *Client) RemoveAll(name string) error {
+	err := c.delete(name, true)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *Client) delete(name string, recursive bool) error {
+	var resp booleanResponse
+	params := url.Values{"recursive": {strconv.FormatBool(recursive)}}
+	err := c.call(http.MethodDelete, name, "DELETE", params, &resp)
+	if err != nil {
+		return &os.PathError{"remove", name, err}
+	} else if !resp.Boolean {
+		return &os.PathError{"remove", name, os.ErrNotExist}
+	}
+
+	return nil
+}
+
+// Rename renames (moves) a file, replacing newpath if it exists.
+func (c *Client) Rename(oldpath, newpath string) error {
+	params := url.Values{
+		"destination":   {path.Clean("/" + newpath)},
+		"renameoptions": {"OVERWRITE"},
+	}
+
+	err := c.call(http.MethodPut, oldpath, "RENAME", params, nil)
+	if err != nil {
+		return &os.PathError{"rename", oldpath, err}
+	}
+
+	return nil
+}
+
+// Chmod changes the mode of the named file to mode.
+func (c *Client) Chmod(name string, perm os.FileMode) error {
+	params := url.Values{"permission": {strconv.FormatUint(uint64(perm), 8)}}
+	err := c.call(http.MethodPut, name, "SETPERMISSION", params, nil)
+	if err != nil {
+		return &os.PathError{"chmod", name, err}
+	}
+
+	return nil
+}
+
+// Chown changes the user and group of the file. If an empty string is passed
+// for user or group, that field will not be changed.
+func (c *Client) Chown(name string, user, group string) error {
+	params := url.Values{}
+	if user != "" {
+		params.Set("owner", user)
+	}
+
+	if group != "" {
+		params.Set("group", group)
+	}
+
+	err := c.call(http.MethodPut, name, "SETOWNER", params, nil)
+	if err != nil {
+		return &os.PathError{"chown", name, err}
+	}
+
+	return nil
+}
+
+// Chtimes changes the access and modification times of the named file.
+func (c *Client) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	params := url.Values{
+		"accesstime":       {strconv.FormatInt(toMillis(atime), 10)},
+		"modificationtime": {strconv.FormatInt(toMillis(mtime), 10)},
+	}
+
+	err := c.call(http.MethodPut, name, "SETTIMES", params, nil)
+	if err != nil {
+		return &os.PathError{"chtimes", name, err}
+	}
+
+	return nil
+}
+
+// GetDelegationToken fetches a new delegation token from the server, which
+// can be used to authenticate later requests with
+// ClientOptions.DelegationToken. If renewer is empty, only the owner can
+// renew the token.
+func (c *Client) GetDelegationToken(renewer string) (string, error) {
+	params := url.Values{}
+	if renewer != "" {
+		params.Set("renewer", renewer)
+	}
+
+	var resp tokenResponse
+	err := c.call(http.MethodGet, "/", "GETDELEGATIONTOKEN", params, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Token.URLString, nil
+}
+
+// RenewDelegationToken renews a delegation token, and returns its new
+// expiry time.
+func (c *Client) RenewDelegationToken(token string) (time.Time, error) {
+	var resp longResponse
+	err := c.call(http.MethodPut, "/", "RENEWDELEGATIONTOKEN", url.Values{"token": {token}}, &resp)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fromMillis(resp.Long), nil
+}
+
+// CancelDelegationToken cancels a delegation token.
+func (c *Client) CancelDelegationToken(token string) error {
+	return c.call(http.MethodPut, "/", "CANCELDELEGATIONTOKEN", url.Values{"token": {token}}, nil)
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
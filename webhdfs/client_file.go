@@ -0,0 +1,323 @@
+package webhdfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// FileReader implements hdfs.ReadableFile for a Client. Data is streamed
+// from the server, starting at the current offset; seeking closes the stream,
+// and the next Read opens a new one.
+type FileReader struct {
+	client *Client
+	name   string
+	info   os.FileInfo
+
+	offset int64
+	body   io.ReadCloser
+
+	entries []os.FileInfo
+	closed  bool
+}
+
+// FileWriter implements hdfs.WritableFile for a Client. Data is streamed to
+// the server in a single request, which is completed by Close.
+type FileWriter struct {
+	name string
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+var (
+	_ hdfs.ReadableFile = (*FileReader)(nil)
+	_ hdfs.WritableFile = (*FileWriter)(nil)
+)
+
+// Open opens the named file or directory for reading.
+func (c *Client) Open(name string) (hdfs.ReadableFile, error) {
+	info, err := c.Stat(name)
+	if err != nil {
+		return nil, &os.PathError{"open", name, errors.Unwrap(err)}
+	}
+
+	return &FileReader{client: c, name: name, info: info}, nil
+}
+
+// Create creates a new file and opens it for writing. It returns an error if
+// the file already exists.
+func (c *Client) Create(name string) (hdfs.WritableFile, error) {
+	_, err := c.Stat(name)
+	if err == nil {
+		return nil, &os.PathError{"create", name, os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return nil, &os.PathError{"create", name, errors.Unwrap(err)}
+	}
+
+	return c.startWrite(http.MethodPut, "CREATE", name, url.Values{"overwrite": {"false"}})
+}
+
+// Append opens an existing file for writing, at the end of the file.
+func (c *Client) Append(name string) (hdfs.WritableFile, error) {
+	return c.startWrite(http.MethodPost, "APPEND", name, nil)
+}
+
+// startWrite performs the first step of CREATE or APPEND, which returns a
+// redirect to where the data should be sent, and then starts streaming the
+// data there.
+func (c *Client) startWrite(method, op, name string, params url.Values) (*FileWriter, error) {
+	opName := "create"
+	if op == "APPEND" {
+		opName = "append"
+	}
+
+	req, err := http.NewRequest(method, c.url(name, op, params), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, &os.PathError{opName, name, err}
+	}
+
+	loc, err := redirectLocation(resp)
+	if err != nil {
+		return nil, &os.PathError{opName, name, err}
+	} else if loc == "" {
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return nil, &os.PathError{opName, name, responseError(op, resp)}
+		}
+
+		return nil, &os.PathError{opName, name,
+			fmt.Errorf("expected a redirect, got %s", resp.Status)}
+	}
+
+	pr, pw := io.Pipe()
+	req, err = http.NewRequest(method, loc, pr)
+	if err != nil {
+		return nil, &os.PathError{opName, name, err}
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	f := &FileWriter{name: name, pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+
+		resp, err := c.do(req)
+		if err == nil {
+			if resp.StatusCode >= 300 {
+				err = responseError(op, resp)
+			}
+
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err != nil {
+			f.err = &os.PathError{opName, name, err}
+			pr.CloseWithError(f.err)
+		}
+	}()
+
+	return f, nil
+}
+
+// Name returns the name of the file.
+func (f *FileReader) Name() string {
+	return f.name
+}
+
+// Stat returns the FileInfo for the file, as of when it was opened.
+func (f *FileReader) Stat() os.FileInfo {
+	return f.info
+}
+
+// Read implements io.Reader.
+func (f *FileReader) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, io.ErrClosedPipe
+	} else if f.info.IsDir() {
+		return 0, &os.PathError{"read", f.name, errors.New("is a directory")}
+	} else if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	} else if len(b) == 0 {
+		return 0, nil
+	}
+
+	if f.body == nil {
+		body, err := f.client.openStream(f.name, f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+
+		f.body = body
+	}
+
+	n, err := f.body.Read(b)
+	f.offset += int64(n)
+	if err == io.EOF {
+		f.body.Close()
+		f.body = nil
+		if f.offset < f.info.Size() {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt. Each call makes a separate request, and
+// doesn't affect the offset used by Read and Seek.
+func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, io.ErrClosedPipe
+	} else if off < 0 {
+		return 0, &os.PathError{"readat", f.name, errors.New("negative offset")}
+	} else if off >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	body, err := f.client.openStream(f.name, off, int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (f *FileReader) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	var off int64
+	switch whence {
+	case io.SeekStart:
+		off = offset
+	case io.SeekCurrent:
+		off = f.offset + offset
+	case io.SeekEnd:
+		off = f.info.Size() + offset
+	default:
+		return f.offset, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	if off < 0 || off > f.info.Size() {
+		return f.offset, fmt.Errorf("invalid resulting offset: %d", off)
+	}
+
+	if off != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+
+	f.offset = off
+	return f.offset, nil
+}
+
+// Readdir reads the contents of the directory, like hdfs.FileReader.Readdir.
+// The whole listing is fetched by the first call.
+func (f *FileReader) Readdir(n int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, io.ErrClosedPipe
+	} else if !f.info.IsDir() {
+		return nil, &os.PathError{"readdir", f.name, errors.New("the file is not a directory")}
+	}
+
+	if n <= 0 || f.entries == nil {
+		entries, err := f.client.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if n <= 0 {
+			f.entries = nil
+			return entries, nil
+		}
+
+		f.entries = entries
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	} else if n > len(f.entries) {
+		n = len(f.entries)
+	}
+
+	res := f.entries[:n]
+	f.entries = f.entries[n:]
+	return res, nil
+}
+
+// Close closes the file.
+func (f *FileReader) Close() error {
+	f.closed = true
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+
+	return nil
+}
+
+// openStream opens the file at the given offset. If length is negative, the
+// stream continues to the end of the file.
+func (c *Client) openStream(name string, offset, length int64) (io.ReadCloser, error) {
+	params := url.Values{"offset": {strconv.FormatInt(offset, 10)}}
+	if length >= 0 {
+		params.Set("length", strconv.FormatInt(length, 10))
+	}
+
+	resp, err := c.get(c.url(name, "OPEN", params))
+	if err != nil {
+		return nil, &os.PathError{"read", name, err}
+	} else if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, &os.PathError{"read", name, responseError("OPEN", resp)}
+	}
+
+	return resp.Body, nil
+}
+
+// Write implements io.Writer.
+func (f *FileWriter) Write(b []byte) (int, error) {
+	n, err := f.pw.Write(b)
+	if err != nil {
+		// The request failed; wait for the real error.
+		<-f.done
+		if f.err != nil {
+			err = f.err
+		}
+	}
+
+	return n, err
+}
+
+// Flush does nothing, since data isn't buffered by the FileWriter. It exists
+// to implement hdfs.WritableFile.
+func (f *FileWriter) Flush() error {
+	return nil
+}
+
+// Close finishes the upload, and waits for the server to acknowledge it.
+func (f *FileWriter) Close() error {
+	f.pw.Close()
+	<-f.done
+	return f.err
+}
@@ -0,0 +1,249 @@
+package webhdfs
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNamenode serves a single file, redirecting reads and writes to a fake
+// datanode, like a real WebHDFS server.
+type fakeNamenode struct {
+	t        *testing.T
+	contents []byte
+	exists   bool
+}
+
+func (fn *fakeNamenode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.URL.Path == "/datanode" {
+		fn.serveData(w, r)
+		return
+	}
+
+	assert.Equal(fn.t, PathPrefix+"/foo", r.URL.Path)
+	assert.Equal(fn.t, "gohdfs1", q.Get("user.name"))
+
+	switch q.Get("op") {
+	case "GETFILESTATUS":
+		if !fn.exists {
+			writeError(w, &os.PathError{"stat", "/foo", os.ErrNotExist})
+			return
+		}
+
+		json.NewEncoder(w).Encode(fileStatusResponse{fileStatusJSON{
+			Type:       "FILE",
+			Length:     int64(len(fn.contents)),
+			Permission: "644",
+			Owner:      "gohdfs1",
+		}})
+	case "OPEN", "CREATE":
+		q.Set("delegation", "token")
+		http.Redirect(w, r, "/datanode?"+q.Encode(), http.StatusTemporaryRedirect)
+	default:
+		writeError(w, &requestError{http.StatusForbidden, accessControlException, "denied"})
+	}
+}
+
+func (fn *fakeNamenode) serveData(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	assert.Equal(fn.t, "token", q.Get("delegation"))
+
+	switch q.Get("op") {
+	case "CREATE":
+		b, err := io.ReadAll(r.Body)
+		require.NoError(fn.t, err)
+		fn.contents = b
+		fn.exists = true
+		w.WriteHeader(http.StatusCreated)
+	case "OPEN":
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		end := len(fn.contents)
+		if length, err := strconv.Atoi(q.Get("length")); err == nil && offset+length < end {
+			end = offset + length
+		}
+
+		w.Write(fn.contents[offset:end])
+	}
+}
+
+func getFakeClient(t *testing.T, fn *fakeNamenode) *Client {
+	ts := httptest.NewServer(fn)
+	t.Cleanup(ts.Close)
+
+	c, err := NewClient(ClientOptions{Address: ts.URL, User: "gohdfs1"})
+	require.NoError(t, err)
+	return c
+}
+
+func TestClientCreateAndOpen(t *testing.T) {
+	fn := &fakeNamenode{t: t}
+	c := getFakeClient(t, fn)
+
+	w, err := c.Create("/foo")
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "foobar", string(fn.contents))
+
+	_, err = c.Create("/foo")
+	assertPathError(t, err, "create", "/foo", os.ErrExist)
+
+	r, err := c.Open("/foo")
+	require.NoError(t, err)
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(b))
+
+	buf := make([]byte, 2)
+	n, err := r.ReadAt(buf, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "ob", string(buf))
+
+	off, err := r.Seek(3, io.SeekStart)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, off)
+
+	b, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+}
+
+func TestClientStat(t *testing.T) {
+	fn := &fakeNamenode{t: t, contents: []byte("foo"), exists: true}
+	c := getFakeClient(t, fn)
+
+	info, err := c.Stat("/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", info.Name())
+	assert.EqualValues(t, 3, info.Size())
+	assert.EqualValues(t, 0644, info.Mode())
+	assert.False(t, info.IsDir())
+	assert.Equal(t, "gohdfs1", info.(*FileInfo).Owner())
+	assert.Equal(t, "gohdfs1", info.Sys().(*hdfs.FileStatus).GetOwner())
+}
+
+func TestClientErrors(t *testing.T) {
+	fn := &fakeNamenode{t: t}
+	c := getFakeClient(t, fn)
+
+	_, err := c.Stat("/foo")
+	assertPathError(t, err, "stat", "/foo", os.ErrNotExist)
+
+	_, err = c.Open("/foo")
+	assertPathError(t, err, "open", "/foo", os.ErrNotExist)
+
+	err = c.Chmod("/foo", 0755)
+	assertPathError(t, err, "chmod", "/foo", os.ErrPermission)
+}
+
+func TestResponseError(t *testing.T) {
+	cases := []struct {
+		op    string
+		class string
+		err   error
+	}{
+		{"GETFILESTATUS", "java.io.FileNotFoundException", os.ErrNotExist},
+		{"MKDIRS", "org.apache.hadoop.HadoopIllegalArgumentException", os.ErrInvalid},
+		{"DELETE", "org.apache.hadoop.fs.PathIsNotEmptyDirectoryException", syscall.ENOTEMPTY},
+		{"CREATE", "org.apache.hadoop.hdfs.protocol.AlreadyBeingCreatedException", os.ErrExist},
+		{"APPEND", "org.apache.hadoop.hdfs.protocol.AlreadyBeingCreatedException", nil},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		writeError(w, &requestError{http.StatusForbidden, c.class, "failed"})
+
+		err := responseError(c.op, w.Result())
+		if c.err != nil {
+			assert.Equal(t, c.err, err, c.class)
+		} else {
+			require.IsType(t, &remoteError{}, err, c.class)
+			assert.Equal(t, c.class, err.(hdfs.Error).Exception())
+		}
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	_, err := NewClient(ClientOptions{Address: "http://localhost:9870"})
+	assert.Error(t, err)
+
+	_, err = NewClient(ClientOptions{Address: "localhost:9870", User: "foo"})
+	assert.Error(t, err)
+
+	c, err := NewClient(ClientOptions{
+		Address:         "http://localhost:9870/gateway/",
+		DelegationToken: "token",
+		ProxyUser:       "bar",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9870/gateway/webhdfs/v1/foo?delegation=token&doas=bar&op=GETFILESTATUS",
+		c.url("foo", "GETFILESTATUS", nil))
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	ts := getTestServer(t)
+	c, err := NewClient(ClientOptions{Address: ts.URL, User: testUser})
+	require.NoError(t, err)
+
+	var fs hdfs.FileSystem = c
+	require.NoError(t, fs.RemoveAll("/_test/webhdfs/client"))
+	require.NoError(t, fs.MkdirAll("/_test/webhdfs/client/dir", 0755))
+
+	w, err := fs.Create("/_test/webhdfs/client/foo")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	w, err = fs.Append("/_test/webhdfs/client/foo")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := fs.Open("/_test/webhdfs/client/foo")
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(b))
+	require.NoError(t, r.Close())
+
+	infos, err := fs.ReadDir("/_test/webhdfs/client")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "dir", infos[0].Name())
+	assert.Equal(t, "foo", infos[1].Name())
+
+	require.NoError(t, fs.Rename("/_test/webhdfs/client/foo", "/_test/webhdfs/client/bar"))
+	_, err = fs.Stat("/_test/webhdfs/client/foo")
+	assertPathError(t, err, "stat", "/_test/webhdfs/client/foo", os.ErrNotExist)
+
+	err = fs.Mkdir("/_test/webhdfs/client/dir", 0755)
+	assertPathError(t, err, "mkdir", "/_test/webhdfs/client/dir", os.ErrExist)
+
+	err = fs.Remove("/_test/webhdfs/client/nonexistent")
+	assertPathError(t, err, "remove", "/_test/webhdfs/client/nonexistent", os.ErrNotExist)
+}
+
+func assertPathError(t *testing.T, err error, op, path string, wrappedErr error) {
+	require.NotNil(t, err)
+
+	expected := &os.PathError{op, path, wrappedErr}
+	require.Equal(t, expected.Error(), err.Error())
+	require.Equal(t, expected, err)
+}
@@ -0,0 +1,93 @@
+package webhdfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/internal/exception"
+)
+
+// The java exception classes used in error responses. WebHDFS clients use
+// these to reconstruct the original exception.
+const (
+	fileNotFoundException      = exception.FileNotFound
+	accessControlException     = exception.AccessControl
+	fileAlreadyExistsException = exception.FileAlreadyExists
+	pathIsNotEmptyDirException = exception.PathIsNotEmptyDir
+	illegalArgumentException   = "java.lang.IllegalArgumentException"
+	securityException          = "java.lang.SecurityException"
+	authorizationException     = "org.apache.hadoop.security.authorize.AuthorizationException"
+	invalidTokenException      = "org.apache.hadoop.security.token.SecretManager$InvalidToken"
+	ioException                = "java.io.IOException"
+)
+
+// requestError is an error with a specific HTTP status and exception class.
+type requestError struct {
+	status    int
+	exception string
+	message   string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &requestError{http.StatusBadRequest, illegalArgumentException,
+		fmt.Sprintf(format, args...)}
+}
+
+type remoteExceptionJSON struct {
+	RemoteException struct {
+		Exception     string `json:"exception"`
+		JavaClassName string `json:"javaClassName"`
+		Message       string `json:"message"`
+	} `json:"RemoteException"`
+}
+
+// writeError writes a RemoteException response for err, choosing the status
+// code the same way as the java implementation.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusForbidden
+	class := ioException
+
+	var reqErr *requestError
+	var remoteErr hdfs.Error
+	switch {
+	case errors.As(err, &reqErr):
+		status = reqErr.status
+		class = reqErr.exception
+	case errors.Is(err, os.ErrNotExist):
+		status = http.StatusNotFound
+		class = fileNotFoundException
+	case errors.Is(err, os.ErrPermission):
+		class = accessControlException
+	case errors.Is(err, os.ErrExist):
+		class = fileAlreadyExistsException
+	case errors.Is(err, syscall.ENOTEMPTY):
+		class = pathIsNotEmptyDirException
+	case errors.Is(err, os.ErrInvalid):
+		status = http.StatusBadRequest
+		class = illegalArgumentException
+	case errors.As(err, &remoteErr):
+		class = remoteErr.Exception()
+	}
+
+	var resp remoteExceptionJSON
+	resp.RemoteException.Exception = class[strings.LastIndexAny(class, ".$")+1:]
+	resp.RemoteException.JavaClassName = class
+	resp.RemoteException.Message = err.Error()
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,105 @@
+package webhdfs
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	pb "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// FileInfo implements os.FileInfo for files returned by a Client. It has the
+// same methods as hdfs.FileInfo, and Sys likewise returns an
+// *hdfs.FileStatus, with the fields available over WebHDFS filled in.
+type FileInfo struct {
+	name   string
+	status *hdfs.FileStatus
+}
+
+func newFileInfo(s fileStatusJSON, name string) *FileInfo {
+	fileType := pb.HdfsFileStatusProto_IS_FILE
+	switch s.Type {
+	case "DIRECTORY":
+		fileType = pb.HdfsFileStatusProto_IS_DIR
+	case "SYMLINK":
+		fileType = pb.HdfsFileStatusProto_IS_SYMLINK
+	}
+
+	perm, _ := strconv.ParseUint(s.Permission, 8, 32)
+	return &FileInfo{
+		name: name,
+		status: &hdfs.FileStatus{
+			FileType:         fileType.Enum(),
+			Path:             []byte(s.PathSuffix),
+			Length:           proto.Uint64(uint64(s.Length)),
+			Permission:       &pb.FsPermissionProto{Perm: proto.Uint32(uint32(perm))},
+			Owner:            proto.String(s.Owner),
+			Group:            proto.String(s.Group),
+			ModificationTime: proto.Uint64(uint64(s.ModificationTime)),
+			AccessTime:       proto.Uint64(uint64(s.AccessTime)),
+			Symlink:          []byte(s.Symlink),
+			BlockReplication: proto.Uint32(uint32(s.Replication)),
+			Blocksize:        proto.Uint64(uint64(s.BlockSize)),
+			FileId:           proto.Uint64(s.FileID),
+			ChildrenNum:      proto.Int32(int32(s.ChildrenNum)),
+			StoragePolicy:    proto.Uint32(uint32(s.StoragePolicy)),
+		},
+	}
+}
+
+func (fi *FileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *FileInfo) Size() int64 {
+	return int64(fi.status.GetLength())
+}
+
+func (fi *FileInfo) Mode() os.FileMode {
+	mode := os.FileMode(fi.status.GetPermission().GetPerm())
+	if fi.IsDir() {
+		mode |= os.ModeDir
+	}
+
+	return mode
+}
+
+func (fi *FileInfo) ModTime() time.Time {
+	return fromMillis(int64(fi.status.GetModificationTime()))
+}
+
+func (fi *FileInfo) IsDir() bool {
+	return fi.status.GetFileType() == pb.HdfsFileStatusProto_IS_DIR
+}
+
+// Sys returns an *hdfs.FileStatus.
+func (fi *FileInfo) Sys() interface{} {
+	return fi.status
+}
+
+// Owner returns the name of the user that owns the file or directory.
+func (fi *FileInfo) Owner() string {
+	return fi.status.GetOwner()
+}
+
+// OwnerGroup returns the name of the group that owns the file or directory.
+func (fi *FileInfo) OwnerGroup() string {
+	return fi.status.GetGroup()
+}
+
+// AccessTime returns the last time the file was accessed.
+func (fi *FileInfo) AccessTime() time.Time {
+	return fromMillis(int64(fi.status.GetAccessTime()))
+}
+
+// Replication returns the replication factor of the file.
+func (fi *FileInfo) Replication() int {
+	return int(fi.status.GetBlockReplication())
+}
+
+// BlockSize returns the block size of the file.
+func (fi *FileInfo) BlockSize() int64 {
+	return int64(fi.status.GetBlocksize())
+}
@@ -0,0 +1,169 @@
+package webhdfs
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/colinmarc/hdfs/v2"
+	pb "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// These types mirror the JSON schemas in the WebHDFS documentation.
+
+type fileStatusJSON struct {
+	AccessTime       int64  `json:"accessTime"`
+	BlockSize        int64  `json:"blockSize"`
+	ChildrenNum      int    `json:"childrenNum"`
+	FileID           uint64 `json:"fileId"`
+	Group            string `json:"group"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+	Owner            string `json:"owner"`
+	PathSuffix       string `json:"pathSuffix"`
+	Permission       string `json:"permission"`
+	Replication      int    `json:"replication"`
+	StoragePolicy    int    `json:"storagePolicy"`
+	Symlink          string `json:"symlink,omitempty"`
+	Type             string `json:"type"`
+}
+
+type fileStatusResponse struct {
+	FileStatus fileStatusJSON `json:"FileStatus"`
+}
+
+type fileStatusesResponse struct {
+	FileStatuses struct {
+		FileStatus []fileStatusJSON `json:"FileStatus"`
+	} `json:"FileStatuses"`
+}
+
+type contentSummaryResponse struct {
+	ContentSummary struct {
+		DirectoryCount int   `json:"directoryCount"`
+		FileCount      int   `json:"fileCount"`
+		Length         int64 `json:"length"`
+		Quota          int   `json:"quota"`
+		SpaceConsumed  int64 `json:"spaceConsumed"`
+		SpaceQuota     int64 `json:"spaceQuota"`
+	} `json:"ContentSummary"`
+}
+
+type fileChecksumResponse struct {
+	FileChecksum struct {
+		Algorithm string `json:"algorithm"`
+		Bytes     string `json:"bytes"`
+		Length    int    `json:"length"`
+	} `json:"FileChecksum"`
+}
+
+type xattrJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type xattrsResponse struct {
+	XAttrs []xattrJSON `json:"XAttrs"`
+}
+
+type xattrNamesResponse struct {
+	// XAttrNames is itself a JSON-encoded array.
+	XAttrNames string `json:"XAttrNames"`
+}
+
+type tokenResponse struct {
+	Token struct {
+		URLString string `json:"urlString"`
+	} `json:"Token"`
+}
+
+type booleanResponse struct {
+	Boolean bool `json:"boolean"`
+}
+
+type longResponse struct {
+	Long int64 `json:"long"`
+}
+
+type pathResponse struct {
+	Path string `json:"Path"`
+}
+
+type locationResponse struct {
+	Location string `json:"Location"`
+}
+
+// newFileStatusJSON converts the os.FileInfo returned by the hdfs package.
+// pathSuffix is empty for GETFILESTATUS, and the name of the entry for
+// LISTSTATUS.
+func newFileStatusJSON(info os.FileInfo, pathSuffix string) fileStatusJSON {
+	fs := info.Sys().(*hdfs.FileStatus)
+
+	var t string
+	switch fs.GetFileType() {
+	case pb.HdfsFileStatusProto_IS_DIR:
+		t = "DIRECTORY"
+	case pb.HdfsFileStatusProto_IS_SYMLINK:
+		t = "SYMLINK"
+	default:
+		t = "FILE"
+	}
+
+	return fileStatusJSON{
+		AccessTime:       int64(fs.GetAccessTime()),
+		BlockSize:        int64(fs.GetBlocksize()),
+		ChildrenNum:      int(fs.GetChildrenNum()),
+		FileID:           fs.GetFileId(),
+		Group:            fs.GetGroup(),
+		Length:           int64(fs.GetLength()),
+		ModificationTime: int64(fs.GetModificationTime()),
+		Owner:            fs.GetOwner(),
+		PathSuffix:       pathSuffix,
+		Permission:       strconv.FormatUint(uint64(fs.GetPermission().GetPerm()), 8),
+		Replication:      int(fs.GetBlockReplication()),
+		StoragePolicy:    int(fs.GetStoragePolicy()),
+		Symlink:          string(fs.GetSymlink()),
+		Type:             t,
+	}
+}
+
+// encodeXAttrValue encodes an xattr value as described by the encoding
+// parameter: "text" values are quoted, "hex" values are prefixed with 0x, and
+// "base64" values with 0s.
+func encodeXAttrValue(value, encoding string) (string, error) {
+	switch strings.ToLower(encoding) {
+	case "", "text":
+		return `"` + value + `"`, nil
+	case "hex":
+		return "0x" + hex.EncodeToString([]byte(value)), nil
+	case "base64":
+		return "0s" + base64.StdEncoding.EncodeToString([]byte(value)), nil
+	default:
+		return "", badRequest("invalid value for webhdfs parameter \"encoding\": %q", encoding)
+	}
+}
+
+// decodeXAttrValue reverses encodeXAttrValue. Values without a recognized
+// prefix or quotes are used as-is.
+func decodeXAttrValue(s string) (string, error) {
+	var b []byte
+	var err error
+	switch {
+	case len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`):
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		b, err = hex.DecodeString(s[2:])
+	case strings.HasPrefix(s, "0s") || strings.HasPrefix(s, "0S"):
+		b, err = base64.StdEncoding.DecodeString(s[2:])
+	default:
+		return s, nil
+	}
+
+	if err != nil {
+		return "", badRequest("invalid value for webhdfs parameter \"xattr.value\": %q", s)
+	}
+
+	return string(b), nil
+}
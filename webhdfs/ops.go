@@ -0,0 +1,646 @@
+package webhdfs
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+type operation struct {
+	method string
+	handle func(s *Server, req *request) error
+}
+
+var operations = map[string]operation{
+	"OPEN":                  {http.MethodGet, (*Server).open},
+	"GETFILESTATUS":         {http.MethodGet, (*Server).getFileStatus},
+	"LISTSTATUS":            {http.MethodGet, (*Server).listStatus},
+	"GETCONTENTSUMMARY":     {http.MethodGet, (*Server).getContentSummary},
+	"GETFILECHECKSUM":       {http.MethodGet, (*Server).getFileChecksum},
+	"GETHOMEDIRECTORY":      {http.MethodGet, (*Server).getHomeDirectory},
+	"GETXATTRS":             {http.MethodGet, (*Server).getXAttrs},
+	"LISTXATTRS":            {http.MethodGet, (*Server).listXAttrs},
+	"GETDELEGATIONTOKEN":    {http.MethodGet, (*Server).getDelegationToken},
+	"CREATE":                {http.MethodPut, (*Server).create},
+	"MKDIRS":                {http.MethodPut, (*Server).mkdirs},
+	"RENAME":                {http.MethodPut, (*Server).rename},
+	"SETPERMISSION":         {http.MethodPut, (*Server).setPermission},
+	"SETOWNER":              {http.MethodPut, (*Server).setOwner},
+	"SETREPLICATION":        {http.MethodPut, (*Server).setReplication},
+	"SETTIMES":              {http.MethodPut, (*Server).setTimes},
+	"SETXATTR":              {http.MethodPut, (*Server).setXAttr},
+	"REMOVEXATTR":           {http.MethodPut, (*Server).removeXAttr},
+	"RENEWDELEGATIONTOKEN":  {http.MethodPut, (*Server).renewDelegationToken},
+	"CANCELDELEGATIONTOKEN": {http.MethodPut, (*Server).cancelDelegationToken},
+	"APPEND":                {http.MethodPost, (*Server).append},
+	"DELETE":                {http.MethodDelete, (*Server).delete},
+}
+
+func (s *Server) open(req *request) error {
+	offset, err := req.params.int64("offset", 0)
+	if err != nil {
+		return err
+	}
+
+	length, err := req.params.int64("length", -1)
+	if err != nil {
+		return err
+	} else if offset < 0 {
+		return badRequest("invalid value for webhdfs parameter \"offset\": %d", offset)
+	}
+
+	f, err := req.client.Open(req.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if f.Stat().IsDir() {
+		return &os.PathError{"open", req.name, fmt.Errorf("is a directory")}
+	} else if offset > f.Stat().Size() {
+		return badRequest("offset %d is past the end of the file", offset)
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	remaining := f.Stat().Size() - offset
+	if length >= 0 && length < remaining {
+		remaining = length
+	}
+
+	h := req.w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", fmt.Sprint(remaining))
+	req.w.WriteHeader(http.StatusOK)
+
+	// At this point, it's too late to send an error response; the client will
+	// notice that the body is truncated.
+	io.Copy(req.w, io.LimitReader(f, remaining))
+	return nil
+}
+
+func (s *Server) getFileStatus(req *request) error {
+	info, err := req.client.Stat(req.name)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, fileStatusResponse{newFileStatusJSON(info, "")})
+	return nil
+}
+
+func (s *Server) listStatus(req *request) error {
+	info, err := req.client.Stat(req.name)
+	if err != nil {
+		return err
+	}
+
+	var resp fileStatusesResponse
+	if !info.IsDir() {
+		resp.FileStatuses.FileStatus = []fileStatusJSON{newFileStatusJSON(info, "")}
+	} else {
+		infos, err := req.client.ReadDir(req.name)
+		if err != nil {
+			return err
+		}
+
+		resp.FileStatuses.FileStatus = make([]fileStatusJSON, len(infos))
+		for i, info := range infos {
+			resp.FileStatuses.FileStatus[i] = newFileStatusJSON(info, info.Name())
+		}
+	}
+
+	writeJSON(req.w, http.StatusOK, resp)
+	return nil
+}
+
+func (s *Server) getContentSummary(req *request) error {
+	cs, err := req.client.GetContentSummary(req.name)
+	if err != nil {
+		return err
+	}
+
+	var resp contentSummaryResponse
+	resp.ContentSummary.DirectoryCount = cs.DirectoryCount()
+	resp.ContentSummary.FileCount = cs.FileCount()
+	resp.ContentSummary.Length = cs.Size()
+	resp.ContentSummary.Quota = cs.NameQuota()
+	resp.ContentSummary.SpaceConsumed = cs.SizeAfterReplication()
+	resp.ContentSummary.SpaceQuota = cs.SpaceQuota()
+	writeJSON(req.w, http.StatusOK, resp)
+	return nil
+}
+
+// getFileChecksum returns the MD5-of-MD5-of-CRC32C checksum for a file, in
+// the serialized form used by MD5MD5CRC32FileChecksum in the java client:
+// bytes per CRC, CRCs per block, and then the MD5 itself.
+func (s *Server) getFileChecksum(req *request) error {
+	f, err := req.client.Open(req.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	md5, err := f.Checksum()
+	if err != nil {
+		return err
+	}
+
+	defaults, err := req.client.ServerDefaults()
+	if err != nil {
+		return err
+	}
+
+	// The java client only reports CRCs per block for files with more than
+	// one block.
+	bytesPerCRC := defaults.BytesPerChecksum
+	var crcPerBlock int64
+	info := f.Stat().(*hdfs.FileInfo)
+	if bytesPerCRC > 0 && info.Size() > info.BlockSize() {
+		crcPerBlock = info.BlockSize() / int64(bytesPerCRC)
+	}
+
+	b := make([]byte, 12, 12+len(md5))
+	binary.BigEndian.PutUint32(b, uint32(bytesPerCRC))
+	binary.BigEndian.PutUint64(b[4:], uint64(crcPerBlock))
+	b = append(b, md5...)
+
+	var resp fileChecksumResponse
+	resp.FileChecksum.Algorithm = fmt.Sprintf("MD5-of-%dMD5-of-%dCRC32C", crcPerBlock, bytesPerCRC)
+	resp.FileChecksum.Bytes = hex.EncodeToString(b)
+	resp.FileChecksum.Length = len(b)
+	writeJSON(req.w, http.StatusOK, resp)
+	return nil
+}
+
+func (s *Server) getHomeDirectory(req *request) error {
+	writeJSON(req.w, http.StatusOK, pathResponse{path.Join("/user", req.user)})
+	return nil
+}
+
+func (s *Server) getXAttrs(req *request) error {
+	encoding := req.params.get("encoding")
+	names := req.params["xattr.name"]
+	if len(names) == 0 {
+		all, err := req.client.ListXAttrs(req.name)
+		if err != nil {
+			return err
+		}
+
+		for name := range all {
+			names = append(names, name)
+		}
+	}
+
+	attrs, err := req.client.GetXAttrs(req.name, names...)
+	if err != nil {
+		return err
+	}
+
+	resp := xattrsResponse{XAttrs: make([]xattrJSON, 0, len(attrs))}
+	for name, value := range attrs {
+		encoded, err := encodeXAttrValue(value, encoding)
+		if err != nil {
+			return err
+		}
+
+		resp.XAttrs = append(resp.XAttrs, xattrJSON{Name: name, Value: encoded})
+	}
+
+	sort.Slice(resp.XAttrs, func(i, j int) bool {
+		return resp.XAttrs[i].Name < resp.XAttrs[j].Name
+	})
+
+	writeJSON(req.w, http.StatusOK, resp)
+	return nil
+}
+
+func (s *Server) listXAttrs(req *request) error {
+	attrs, err := req.client.ListXAttrs(req.name)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, xattrNamesResponse{string(b)})
+	return nil
+}
+
+func (s *Server) getDelegationToken(req *request) error {
+	if req.params.get("delegation") != "" {
+		return &requestError{http.StatusForbidden, accessControlException,
+			"a delegation token can't be used to get another one"}
+	}
+
+	token, err := s.tokens.issue(req.user, req.params.get("renewer"))
+	if err != nil {
+		return err
+	}
+
+	var resp tokenResponse
+	resp.Token.URLString = token
+	writeJSON(req.w, http.StatusOK, resp)
+	return nil
+}
+
+func (s *Server) renewDelegationToken(req *request) error {
+	expiry, err := s.tokens.renew(req.params.get("token"), req.user)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, longResponse{expiry.UnixNano() / int64(time.Millisecond)})
+	return nil
+}
+
+func (s *Server) cancelDelegationToken(req *request) error {
+	err := s.tokens.cancel(req.params.get("token"), req.user)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// redirectForData implements the first step of CREATE and APPEND, which
+// redirects the client back to the same URL with data=true. If it returns
+// false, the request already has data=true, and the caller should proceed.
+func (s *Server) redirectForData(req *request) (bool, error) {
+	data, err := req.params.bool("data", false)
+	if err != nil || data {
+		return false, err
+	}
+
+	noRedirect, err := req.params.bool("noredirect", false)
+	if err != nil {
+		return false, err
+	}
+
+	u := *req.r.URL
+	u.Host = req.r.Host
+	u.Scheme = "http"
+	if req.r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	q := u.Query()
+	q.Set("data", "true")
+	u.RawQuery = q.Encode()
+
+	if noRedirect {
+		writeJSON(req.w, http.StatusOK, locationResponse{u.String()})
+	} else {
+		req.w.Header().Set("Location", u.String())
+		req.w.WriteHeader(http.StatusTemporaryRedirect)
+	}
+
+	return true, nil
+}
+
+func (s *Server) create(req *request) error {
+	overwrite, err := req.params.bool("overwrite", false)
+	if err != nil {
+		return err
+	}
+
+	perm, err := req.params.perm("permission", 0644)
+	if err != nil {
+		return err
+	}
+
+	replication, err := req.params.int64("replication", 0)
+	if err != nil {
+		return err
+	}
+
+	blockSize, err := req.params.int64("blocksize", 0)
+	if err != nil {
+		return err
+	}
+
+	if redirected, err := s.redirectForData(req); redirected || err != nil {
+		return err
+	}
+
+	// Like the java implementation, create any missing parent directories.
+	opts := hdfs.CreateOptions{
+		Overwrite:    overwrite,
+		CreateParent: true,
+		Perm:         perm,
+	}
+
+	// Otherwise, the namenode's defaults are used.
+	if replication > 0 {
+		opts.Replication = int(replication)
+	}
+
+	if blockSize > 0 {
+		opts.BlockSize = blockSize
+	}
+
+	w, err := req.client.CreateWithOptions(req.name, opts)
+	if err != nil {
+		return err
+	}
+
+	err = copyAndClose(w, req.r.Body)
+	if err != nil {
+		return err
+	}
+
+	req.w.Header().Set("Location", "webhdfs://"+req.r.Host+req.name)
+	req.w.Header().Set("Content-Length", "0")
+	req.w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (s *Server) append(req *request) error {
+	if redirected, err := s.redirectForData(req); redirected || err != nil {
+		return err
+	}
+
+	w, err := req.client.Append(req.name)
+	if err != nil {
+		return err
+	}
+
+	err = copyAndClose(w, req.r.Body)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// copyAndClose streams the request body to the file. The file is always
+// closed, so that the lease is released even if the upload fails.
+func copyAndClose(w *hdfs.FileWriter, body io.Reader) error {
+	_, err := io.Copy(w, body)
+	closeErr := w.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+func (s *Server) mkdirs(req *request) error {
+	perm, err := req.params.perm("permission", 0755)
+	if err != nil {
+		return err
+	}
+
+	err = req.client.MkdirAll(req.name, perm)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, booleanResponse{true})
+	return nil
+}
+
+// rename follows the semantics of FileSystem.rename in the java client: the
+// source is moved into the destination if it's a directory, and the rename
+// fails (returning false) if the destination exists or the source doesn't.
+//
+// If renameoptions is passed, it instead follows the semantics of
+// FileContext.rename, which either succeeds with an empty response or fails
+// with an exception. The destination is replaced if renameoptions is
+// OVERWRITE.
+func (s *Server) rename(req *request) error {
+	dest := req.params.get("destination")
+	if dest == "" || !path.IsAbs(dest) {
+		return badRequest("invalid value for webhdfs parameter \"destination\": %q", dest)
+	}
+
+	if options, ok := req.params["renameoptions"]; ok {
+		return s.renameWithOptions(req, path.Clean(dest), options)
+	}
+
+	_, err := req.client.Stat(req.name)
+	if os.IsNotExist(err) {
+		writeJSON(req.w, http.StatusOK, booleanResponse{false})
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	dest = path.Clean(dest)
+	info, err := req.client.Stat(dest)
+	if err == nil && info.IsDir() {
+		dest = path.Join(dest, path.Base(req.name))
+	}
+
+	err = req.client.RenameWithOptions(req.name, dest, hdfs.RenameOptions{})
+	if os.IsExist(err) {
+		writeJSON(req.w, http.StatusOK, booleanResponse{false})
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, booleanResponse{true})
+	return nil
+}
+
+func (s *Server) renameWithOptions(req *request, dest string, options []string) error {
+	overwrite := false
+	for _, opt := range options {
+		for _, o := range strings.Split(opt, ",") {
+			switch strings.ToUpper(o) {
+			case "OVERWRITE":
+				overwrite = true
+			case "NONE", "":
+			default:
+				return badRequest("invalid value for webhdfs parameter \"renameoptions\": %q", o)
+			}
+		}
+	}
+
+	err := req.client.RenameWithOptions(req.name, dest, hdfs.RenameOptions{Overwrite: overwrite})
+	if os.IsExist(err) {
+		return &requestError{http.StatusConflict, fileAlreadyExistsException, err.Error()}
+	} else if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) delete(req *request) error {
+	recursive, err := req.params.bool("recursive", false)
+	if err != nil {
+		return err
+	}
+
+	if recursive {
+		_, err = req.client.Stat(req.name)
+		if err == nil {
+			err = req.client.RemoveAll(req.name)
+		}
+	} else {
+		err = req.client.Remove(req.name)
+	}
+
+	if os.IsNotExist(err) {
+		writeJSON(req.w, http.StatusOK, booleanResponse{false})
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, booleanResponse{true})
+	return nil
+}
+
+func (s *Server) setPermission(req *request) error {
+	perm, err := req.params.perm("permission", 0755)
+	if err != nil {
+		return err
+	}
+
+	err = req.client.Chmod(req.name, perm)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) setOwner(req *request) error {
+	owner := req.params.get("owner")
+	group := req.params.get("group")
+	if owner == "" && group == "" {
+		return badRequest("both owner and group are empty")
+	}
+
+	err := req.client.Chown(req.name, owner, group)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) setReplication(req *request) error {
+	replication, err := req.params.int64("replication", 0)
+	if err != nil {
+		return err
+	} else if replication <= 0 {
+		defaults, err := req.client.ServerDefaults()
+		if err != nil {
+			return err
+		}
+
+		replication = int64(defaults.Replication)
+	}
+
+	err = req.client.SetReplication(req.name, int(replication))
+	if err != nil {
+		return err
+	}
+
+	writeJSON(req.w, http.StatusOK, booleanResponse{true})
+	return nil
+}
+
+func (s *Server) setTimes(req *request) error {
+	mtime, err := req.params.int64("modificationtime", -1)
+	if err != nil {
+		return err
+	}
+
+	atime, err := req.params.int64("accesstime", -1)
+	if err != nil {
+		return err
+	}
+
+	// -1 means the time should be left unchanged.
+	info, err := req.client.Stat(req.name)
+	if err != nil {
+		return err
+	}
+
+	fi := info.(*hdfs.FileInfo)
+	mt, at := fi.ModTime(), fi.AccessTime()
+	if mtime != -1 {
+		mt = time.Unix(0, mtime*int64(time.Millisecond))
+	}
+
+	if atime != -1 {
+		at = time.Unix(0, atime*int64(time.Millisecond))
+	}
+
+	err = req.client.Chtimes(req.name, at, mt)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// setXAttr sets an xattr. The flag parameter is accepted but ignored, since
+// the hdfs package always creates or replaces the attribute.
+func (s *Server) setXAttr(req *request) error {
+	name := req.params.get("xattr.name")
+	if name == "" {
+		return badRequest("missing webhdfs parameter \"xattr.name\"")
+	}
+
+	value, err := decodeXAttrValue(req.params.get("xattr.value"))
+	if err != nil {
+		return err
+	}
+
+	err = req.client.SetXAttr(req.name, name, value)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) removeXAttr(req *request) error {
+	name := req.params.get("xattr.name")
+	if name == "" {
+		return badRequest("missing webhdfs parameter \"xattr.name\"")
+	}
+
+	err := req.client.RemoveXAttr(req.name, name)
+	if err != nil {
+		return err
+	}
+
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
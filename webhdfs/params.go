@@ -0,0 +1,76 @@
+package webhdfs
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// params holds the query parameters of a request. Like in the java
+// implementation, parameter names are case-insensitive.
+type params map[string][]string
+
+func newParams(values url.Values) params {
+	p := make(params, len(values))
+	for k, v := range values {
+		k = strings.ToLower(k)
+		p[k] = append(p[k], v...)
+	}
+
+	return p
+}
+
+func (p params) get(name string) string {
+	if v := p[name]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func (p params) bool(name string, def bool) (bool, error) {
+	s := p.get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	switch strings.ToLower(s) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, badRequest("invalid value for webhdfs parameter %q: %q", name, s)
+	}
+}
+
+func (p params) int64(name string, def int64) (int64, error) {
+	s := p.get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, badRequest("invalid value for webhdfs parameter %q: %q", name, s)
+	}
+
+	return i, nil
+}
+
+// perm parses an octal permission, like "755" or "1777". As elsewhere in the
+// hdfs package, the sticky bit is passed through as 01000.
+func (p params) perm(name string, def os.FileMode) (os.FileMode, error) {
+	s := p.get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	i, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || i > 01777 {
+		return 0, badRequest("invalid value for webhdfs parameter %q: %q", name, s)
+	}
+
+	return os.FileMode(i), nil
+}
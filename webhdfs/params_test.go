@@ -0,0 +1,68 @@
+package webhdfs
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParams(t *testing.T) {
+	values, err := url.ParseQuery("op=OPEN&Offset=10&overwrite=TRUE&permission=1777&doAs=foo")
+	require.NoError(t, err)
+
+	p := newParams(values)
+	assert.Equal(t, "OPEN", p.get("op"))
+	assert.Equal(t, "foo", p.get("doas"))
+
+	offset, err := p.int64("offset", 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, offset)
+
+	length, err := p.int64("length", -1)
+	require.NoError(t, err)
+	assert.EqualValues(t, -1, length)
+
+	overwrite, err := p.bool("overwrite", false)
+	require.NoError(t, err)
+	assert.True(t, overwrite)
+
+	perm, err := p.perm("permission", 0644)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(01777), perm)
+}
+
+func TestParamsInvalid(t *testing.T) {
+	values, err := url.ParseQuery("offset=foo&overwrite=yes&permission=999")
+	require.NoError(t, err)
+
+	p := newParams(values)
+	_, err = p.int64("offset", 0)
+	assert.Error(t, err)
+
+	_, err = p.bool("overwrite", false)
+	assert.Error(t, err)
+
+	_, err = p.perm("permission", 0644)
+	assert.Error(t, err)
+}
+
+func TestXAttrValueEncoding(t *testing.T) {
+	for _, encoding := range []string{"text", "hex", "base64"} {
+		encoded, err := encodeXAttrValue("foo", encoding)
+		require.NoError(t, err)
+
+		decoded, err := decodeXAttrValue(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, "foo", decoded, encoding)
+	}
+
+	decoded, err := decodeXAttrValue("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", decoded)
+
+	_, err = encodeXAttrValue("foo", "rot13")
+	assert.Error(t, err)
+}
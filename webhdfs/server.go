@@ -0,0 +1,224 @@
+// Package webhdfs implements both sides of the WebHDFS REST API.
+//
+// Client is a WebHDFS client which implements hdfs.FileSystem, for use when
+// only the HTTP endpoints of a cluster (or an HttpFS gateway) are reachable.
+//
+// Server is a gateway that serves the WebHDFS REST API over HTTP, translating
+// each request into calls on a native hdfs.Client. This makes it possible for
+// clients outside the cluster network, which can reach only a single HTTP
+// endpoint, to use HDFS.
+//
+// Like HttpFS, the Server proxies all data itself, rather than redirecting
+// clients to the datanodes. CREATE and APPEND still follow the two-step
+// protocol: the first request is redirected back to the gateway with
+// data=true added, and the second request carries the file contents. Data is
+// streamed in both directions, without being buffered in memory.
+//
+// Users are identified with the user.name parameter (as with Hadoop's
+// "simple" authentication), a delegation token issued by the gateway itself
+// with GETDELEGATIONTOKEN, or ServerOptions.Authenticate. A user may act as
+// another user with doAs, if ServerOptions.ProxyUsers allows it.
+//
+// If the gateway connects to HDFS with kerberos, user.name isn't accepted,
+// since it would let anyone use the gateway's credentials to act as any user.
+// In that case, requests must carry a delegation token or be authenticated by
+// ServerOptions.Authenticate, which can implement SPNEGO, for example.
+package webhdfs
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/internal/clientcache"
+)
+
+// PathPrefix is the prefix for all WebHDFS URLs.
+const PathPrefix = "/webhdfs/v1"
+
+// ServerOptions represents the configurable options for a Server.
+type ServerOptions struct {
+	// ClientOptions is used to connect to HDFS. The Server creates one Client
+	// for each user it sees, and closes it again once it has been idle for a
+	// while. If KerberosClient is set, each Client authenticates as the
+	// kerberos principal and impersonates the user with ProxyUser, so the
+	// principal must be allowed to do that by the namenode. Otherwise, User is
+	// simply set to the name of the user.
+	ClientOptions hdfs.ClientOptions
+	// Authenticate, if set, authenticates requests that don't carry a
+	// delegation token, and returns the user that made the request. An error
+	// is returned to the client with a 401 status; Authenticate can set
+	// headers such as WWW-Authenticate on w beforehand. If it returns an empty
+	// user and no error, the request is authenticated as if Authenticate
+	// weren't set.
+	Authenticate func(w http.ResponseWriter, r *http.Request) (string, error)
+	// DefaultUser is the user for requests that specify neither user.name nor
+	// a delegation token. If empty, such requests are rejected. It can't be
+	// used with kerberos.
+	DefaultUser string
+	// ProxyUsers maps each user to the list of users it can act as, using the
+	// doAs parameter. The special value "*" allows a user to act as anyone.
+	ProxyUsers map[string][]string
+	// TokenSecret is used to sign delegation tokens. If empty, a random
+	// secret is generated. Either way, tokens are only tracked in memory, and
+	// don't survive a restart.
+	TokenSecret []byte
+	// TokenRenewInterval specifies how long a delegation token is valid for
+	// after it's issued or renewed. If zero, it defaults to 24 hours.
+	TokenRenewInterval time.Duration
+	// TokenMaxLifetime specifies how long a delegation token can be renewed
+	// for. If zero, it defaults to seven days.
+	TokenMaxLifetime time.Duration
+}
+
+// Server is an http.Handler that serves the WebHDFS REST API under
+// PathPrefix.
+type Server struct {
+	options ServerOptions
+	secure  bool
+	tokens  *tokenManager
+	clients *clientcache.Cache
+}
+
+// NewServer returns a new Server with the given options.
+func NewServer(options ServerOptions) (*Server, error) {
+	secure := options.ClientOptions.KerberosClient != nil
+	if secure && options.DefaultUser != "" {
+		return nil, errors.New("a default user can't be used with kerberos")
+	}
+
+	if options.TokenRenewInterval == 0 {
+		options.TokenRenewInterval = 24 * time.Hour
+	}
+
+	if options.TokenMaxLifetime == 0 {
+		options.TokenMaxLifetime = 7 * 24 * time.Hour
+	}
+
+	tokens, err := newTokenManager(options.TokenSecret,
+		options.TokenRenewInterval, options.TokenMaxLifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		options: options,
+		secure:  secure,
+		tokens:  tokens,
+		clients: clientcache.New(options.ClientOptions,
+			clientcache.DefaultCapacity, clientcache.DefaultExpiry),
+	}, nil
+}
+
+// request holds the state for a single WebHDFS request.
+type request struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	params params
+	name   string
+	user   string
+	client *hdfs.Client
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.serve(w, r)
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != PathPrefix && !strings.HasPrefix(r.URL.Path, PathPrefix+"/") {
+		return &requestError{http.StatusNotFound, fileNotFoundException,
+			"no such endpoint: " + r.URL.Path}
+	}
+
+	p := newParams(r.URL.Query())
+	op := strings.ToUpper(p.get("op"))
+	operation, ok := operations[op]
+	if !ok {
+		return badRequest("invalid value for webhdfs parameter \"op\": %q", p.get("op"))
+	} else if operation.method != r.Method {
+		return badRequest("invalid HTTP %s operation %s, expected %s",
+			r.Method, op, operation.method)
+	}
+
+	user, err := s.authenticate(w, r, p)
+	if err != nil {
+		return err
+	}
+
+	client, release, err := s.clients.Get(user)
+	if err != nil {
+		return &requestError{http.StatusInternalServerError, ioException, err.Error()}
+	}
+	defer release()
+
+	req := &request{
+		w:      w,
+		r:      r,
+		params: p,
+		name:   path.Clean("/" + strings.TrimPrefix(r.URL.Path, PathPrefix)),
+		user:   user,
+		client: client,
+	}
+
+	return operation.handle(s, req)
+}
+
+// authenticate returns the user that the request should be performed as.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, p params) (string, error) {
+	var user string
+	if token := p.get("delegation"); token != "" {
+		id, err := s.tokens.verify(token)
+		if err != nil {
+			return "", err
+		}
+
+		user = id.Owner
+	} else if s.options.Authenticate != nil {
+		var err error
+		user, err = s.options.Authenticate(w, r)
+		if err != nil {
+			return "", &requestError{http.StatusUnauthorized, securityException,
+				"authentication failed: " + err.Error()}
+		}
+	}
+
+	if user == "" {
+		if s.secure {
+			return "", &requestError{http.StatusUnauthorized, securityException,
+				"authentication required: user.name isn't accepted with kerberos, specify delegation"}
+		} else if name := p.get("user.name"); name != "" {
+			user = name
+		} else if s.options.DefaultUser != "" {
+			user = s.options.DefaultUser
+		} else {
+			return "", &requestError{http.StatusUnauthorized, securityException,
+				"authentication required: specify user.name or delegation"}
+		}
+	}
+
+	doAs := p.get("doas")
+	if doAs == "" || doAs == user {
+		return user, nil
+	}
+
+	for _, allowed := range s.options.ProxyUsers[user] {
+		if allowed == "*" || allowed == doAs {
+			return doAs, nil
+		}
+	}
+
+	return "", &requestError{http.StatusForbidden, authorizationException,
+		"User: " + user + " is not allowed to impersonate " + doAs}
+}
+
+// Close closes all the clients opened by the Server.
+func (s *Server) Close() error {
+	return s.clients.Close()
+}
@@ -0,0 +1,391 @@
+package webhdfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	krb "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUser = "gohdfs1"
+
+func getTestServer(t *testing.T) *httptest.Server {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	options := hdfs.ClientOptionsFromConf(conf)
+	if options.Addresses == nil {
+		t.Fatal("Missing namenode addresses in ambient config")
+	} else if options.KerberosClient != nil {
+		t.Skip("Kerberos isn't supported by these tests")
+	}
+
+	s, err := NewServer(ServerOptions{ClientOptions: options})
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+
+	return ts
+}
+
+func doRequest(t *testing.T, ts *httptest.Server, method, p, query string, body []byte) *http.Response {
+	u := ts.URL + PathPrefix + p + "?user.name=" + testUser + "&" + query
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	require.NoError(t, err)
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func decodeResponse(t *testing.T, resp *http.Response, v interface{}) {
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+// authenticate calls s.authenticate with a GET request for the given query.
+func authenticate(s *Server, query string) (string, error) {
+	r := httptest.NewRequest("GET", PathPrefix+"/?"+query, nil)
+	return s.authenticate(httptest.NewRecorder(), r, newParams(r.URL.Query()))
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, err := NewServer(ServerOptions{
+		ProxyUsers: map[string][]string{"foo": {"bar"}, "baz": {"*"}},
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		query string
+		user  string
+	}{
+		{"user.name=foo", "foo"},
+		{"user.name=foo&doas=bar", "bar"},
+		{"user.name=foo&doAs=foo", "foo"},
+		{"user.name=baz&doas=qux", "qux"},
+		{"user.name=foo&doas=qux", ""},
+		{"user.name=bar&doas=foo", ""},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		user, err := authenticate(s, c.query)
+		if c.user == "" {
+			assert.Error(t, err, c.query)
+		} else {
+			assert.NoError(t, err, c.query)
+			assert.Equal(t, c.user, user, c.query)
+		}
+	}
+}
+
+func TestAuthenticateDelegationToken(t *testing.T) {
+	s, err := NewServer(ServerOptions{DefaultUser: "default"})
+	require.NoError(t, err)
+
+	token, err := s.tokens.issue("foo", "")
+	require.NoError(t, err)
+
+	user, err := authenticate(s, "delegation="+url.QueryEscape(token))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", user)
+
+	user, err = authenticate(s, "")
+	require.NoError(t, err)
+	assert.Equal(t, "default", user)
+
+	_, err = authenticate(s, "delegation=foo")
+	assert.Error(t, err)
+}
+
+func TestAuthenticateKerberos(t *testing.T) {
+	options := ServerOptions{
+		ClientOptions: hdfs.ClientOptions{KerberosClient: &krb.Client{}},
+		ProxyUsers:    map[string][]string{"foo": {"bar"}},
+	}
+
+	s, err := NewServer(options)
+	require.NoError(t, err)
+
+	_, err = authenticate(s, "user.name=foo")
+	assert.Error(t, err)
+
+	_, err = authenticate(s, "")
+	assert.Error(t, err)
+
+	token, err := s.tokens.issue("foo", "")
+	require.NoError(t, err)
+
+	user, err := authenticate(s, "user.name=baz&delegation="+url.QueryEscape(token))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", user)
+
+	options.DefaultUser = "foo"
+	_, err = NewServer(options)
+	assert.Error(t, err)
+}
+
+func TestAuthenticateAuthenticator(t *testing.T) {
+	s, err := NewServer(ServerOptions{
+		ClientOptions: hdfs.ClientOptions{KerberosClient: &krb.Client{}},
+		Authenticate: func(w http.ResponseWriter, r *http.Request) (string, error) {
+			switch r.Header.Get("Authorization") {
+			case "":
+				w.Header().Set("WWW-Authenticate", "Negotiate")
+				return "", nil
+			case "Negotiate foo":
+				return "foo", nil
+			default:
+				return "", errors.New("bad ticket")
+			}
+		},
+	})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", PathPrefix+"/?user.name=bar", nil)
+	w := httptest.NewRecorder()
+	_, err = s.authenticate(w, r, newParams(r.URL.Query()))
+	assert.Error(t, err)
+	assert.Equal(t, "Negotiate", w.Header().Get("WWW-Authenticate"))
+
+	r.Header.Set("Authorization", "Negotiate foo")
+	user, err := s.authenticate(httptest.NewRecorder(), r, newParams(r.URL.Query()))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", user)
+
+	r.Header.Set("Authorization", "Negotiate bar")
+	_, err = s.authenticate(httptest.NewRecorder(), r, newParams(r.URL.Query()))
+	assert.Error(t, err)
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	ts := getTestServer(t)
+	doRequest(t, ts, "DELETE", "/_test/webhdfs/create", "op=DELETE&recursive=true", nil)
+
+	resp := doRequest(t, ts, "PUT", "/_test/webhdfs/create/foo.txt", "op=CREATE", []byte("foo\nbar\n"))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/create/foo.txt", "op=OPEN", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "foo\nbar\n", string(b))
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/create/foo.txt", "op=OPEN&offset=4&length=2", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ba", string(b))
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/create/foo.txt", "op=CREATE", []byte("baz"))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	var remoteErr remoteExceptionJSON
+	decodeResponse(t, resp, &remoteErr)
+	assert.Equal(t, "FileAlreadyExistsException", remoteErr.RemoteException.Exception)
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/create/foo.txt", "op=CREATE&overwrite=true", []byte("baz"))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/_test/webhdfs/create/foo.txt", "op=APPEND", []byte("qux"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/create/foo.txt", "op=OPEN", nil)
+	b, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "bazqux", string(b))
+}
+
+func TestCreateOverwriteDirectory(t *testing.T) {
+	ts := getTestServer(t)
+	doRequest(t, ts, "DELETE", "/_test/webhdfs/createdir", "op=DELETE&recursive=true", nil)
+
+	resp := doRequest(t, ts, "PUT", "/_test/webhdfs/createdir/foo", "op=MKDIRS", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/createdir/foo", "op=CREATE&overwrite=true", []byte("foo"))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/createdir/foo", "op=GETFILESTATUS", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var status fileStatusResponse
+	decodeResponse(t, resp, &status)
+	assert.Equal(t, "DIRECTORY", status.FileStatus.Type)
+}
+
+func TestCreateNoRedirect(t *testing.T) {
+	ts := getTestServer(t)
+
+	resp := doRequest(t, ts, "PUT", "/_test/webhdfs/noredirect", "op=CREATE&noredirect=true", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var loc locationResponse
+	decodeResponse(t, resp, &loc)
+	assert.True(t, strings.Contains(loc.Location, "data=true"), loc.Location)
+}
+
+func TestFileStatus(t *testing.T) {
+	ts := getTestServer(t)
+
+	resp := doRequest(t, ts, "GET", "/_test/foo.txt", "op=GETFILESTATUS", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var status fileStatusResponse
+	decodeResponse(t, resp, &status)
+	assert.Equal(t, "FILE", status.FileStatus.Type)
+	assert.EqualValues(t, 4, status.FileStatus.Length)
+	assert.Equal(t, "", status.FileStatus.PathSuffix)
+
+	resp = doRequest(t, ts, "GET", "/_test/nonexistent", "op=GETFILESTATUS", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var remoteErr remoteExceptionJSON
+	decodeResponse(t, resp, &remoteErr)
+	assert.Equal(t, "FileNotFoundException", remoteErr.RemoteException.Exception)
+	assert.Equal(t, fileNotFoundException, remoteErr.RemoteException.JavaClassName)
+}
+
+func TestListStatus(t *testing.T) {
+	ts := getTestServer(t)
+	doRequest(t, ts, "DELETE", "/_test/webhdfs/list", "op=DELETE&recursive=true", nil)
+	doRequest(t, ts, "PUT", "/_test/webhdfs/list/dir", "op=MKDIRS", nil)
+	doRequest(t, ts, "PUT", "/_test/webhdfs/list/foo", "op=CREATE", []byte{})
+
+	resp := doRequest(t, ts, "GET", "/_test/webhdfs/list", "op=LISTSTATUS", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var statuses fileStatusesResponse
+	decodeResponse(t, resp, &statuses)
+	require.Len(t, statuses.FileStatuses.FileStatus, 2)
+	assert.Equal(t, "dir", statuses.FileStatuses.FileStatus[0].PathSuffix)
+	assert.Equal(t, "DIRECTORY", statuses.FileStatuses.FileStatus[0].Type)
+	assert.Equal(t, "foo", statuses.FileStatuses.FileStatus[1].PathSuffix)
+}
+
+func TestRenameAndDelete(t *testing.T) {
+	ts := getTestServer(t)
+	doRequest(t, ts, "DELETE", "/_test/webhdfs/rename", "op=DELETE&recursive=true", nil)
+	doRequest(t, ts, "PUT", "/_test/webhdfs/rename/dir", "op=MKDIRS", nil)
+	doRequest(t, ts, "PUT", "/_test/webhdfs/rename/foo", "op=CREATE", []byte{})
+
+	var result booleanResponse
+	resp := doRequest(t, ts, "PUT", "/_test/webhdfs/rename/foo", "op=RENAME&destination=/_test/webhdfs/rename/dir", nil)
+	decodeResponse(t, resp, &result)
+	assert.True(t, result.Boolean)
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/rename/dir/foo", "op=GETFILESTATUS", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/rename/foo", "op=RENAME&destination=/_test/webhdfs/rename/bar", nil)
+	decodeResponse(t, resp, &result)
+	assert.False(t, result.Boolean)
+
+	resp = doRequest(t, ts, "DELETE", "/_test/webhdfs/rename/dir", "op=DELETE", nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = doRequest(t, ts, "DELETE", "/_test/webhdfs/rename/dir", "op=DELETE&recursive=true", nil)
+	decodeResponse(t, resp, &result)
+	assert.True(t, result.Boolean)
+
+	resp = doRequest(t, ts, "DELETE", "/_test/webhdfs/rename/dir", "op=DELETE&recursive=true", nil)
+	decodeResponse(t, resp, &result)
+	assert.False(t, result.Boolean)
+}
+
+func TestRenameDestExists(t *testing.T) {
+	ts := getTestServer(t)
+	doRequest(t, ts, "DELETE", "/_test/webhdfs/rename2", "op=DELETE&recursive=true", nil)
+	doRequest(t, ts, "PUT", "/_test/webhdfs/rename2/foo", "op=CREATE", []byte{})
+	doRequest(t, ts, "PUT", "/_test/webhdfs/rename2/bar", "op=CREATE", []byte{})
+
+	var result booleanResponse
+	resp := doRequest(t, ts, "PUT", "/_test/webhdfs/rename2/foo", "op=RENAME&destination=/_test/webhdfs/rename2/bar", nil)
+	decodeResponse(t, resp, &result)
+	assert.False(t, result.Boolean)
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/rename2/foo", "op=RENAME&destination=/_test/webhdfs/rename2/bar&renameoptions=NONE", nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/rename2/foo", "op=RENAME&destination=/_test/webhdfs/rename2/bar&renameoptions=OVERWRITE", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestXAttrs(t *testing.T) {
+	ts := getTestServer(t)
+	doRequest(t, ts, "DELETE", "/_test/webhdfs/xattrs", "op=DELETE", nil)
+	doRequest(t, ts, "PUT", "/_test/webhdfs/xattrs", "op=CREATE", []byte{})
+
+	resp := doRequest(t, ts, "PUT", "/_test/webhdfs/xattrs", "op=SETXATTR&xattr.name=user.foo&xattr.value=%22bar%22&flag=CREATE", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/xattrs", "op=GETXATTRS&encoding=hex", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var attrs xattrsResponse
+	decodeResponse(t, resp, &attrs)
+	assert.Equal(t, []xattrJSON{{"user.foo", "0x626172"}}, attrs.XAttrs)
+
+	resp = doRequest(t, ts, "GET", "/_test/webhdfs/xattrs", "op=LISTXATTRS", nil)
+	var names xattrNamesResponse
+	decodeResponse(t, resp, &names)
+	assert.Equal(t, `["user.foo"]`, names.XAttrNames)
+
+	resp = doRequest(t, ts, "PUT", "/_test/webhdfs/xattrs", "op=REMOVEXATTR&xattr.name=user.foo", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDelegationToken(t *testing.T) {
+	ts := getTestServer(t)
+
+	resp := doRequest(t, ts, "GET", "/", "op=GETDELEGATIONTOKEN", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var token tokenResponse
+	decodeResponse(t, resp, &token)
+	require.NotEmpty(t, token.Token.URLString)
+
+	u := ts.URL + PathPrefix + "/_test/foo.txt?op=GETFILESTATUS&delegation=" + url.QueryEscape(token.Token.URLString)
+	resp, err := ts.Client().Get(u)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var status fileStatusResponse
+	decodeResponse(t, resp, &status)
+	assert.Equal(t, "FILE", status.FileStatus.Type)
+}
+
+func TestInvalidOperation(t *testing.T) {
+	ts := getTestServer(t)
+
+	resp := doRequest(t, ts, "GET", "/_test/foo.txt", "op=FOO", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/_test/foo.txt", "op=MKDIRS", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,214 @@
+package webhdfs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenIdentifier is the public part of a delegation token.
+type tokenIdentifier struct {
+	Owner    string `json:"owner"`
+	Renewer  string `json:"renewer,omitempty"`
+	Issued   int64  `json:"issued"`
+	MaxDate  int64  `json:"maxDate"`
+	Sequence uint64 `json:"seq"`
+}
+
+// tokenManager issues and validates delegation tokens. Tokens consist of a
+// JSON identifier and an HMAC of it, both base64-encoded; clients treat them
+// as opaque strings. Expiry dates are kept in memory, so that tokens can be
+// renewed and cancelled. They're keyed by the HMAC rather than the sequence
+// number, since the sequence starts over when the process restarts, but the
+// secret may not.
+type tokenManager struct {
+	secret        []byte
+	renewInterval time.Duration
+	maxLifetime   time.Duration
+
+	sequence uint64
+	expiry   map[string]time.Time
+	lock     sync.Mutex
+}
+
+func newTokenManager(secret []byte, renewInterval, maxLifetime time.Duration) (*tokenManager, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &tokenManager{
+		secret:        secret,
+		renewInterval: renewInterval,
+		maxLifetime:   maxLifetime,
+		expiry:        make(map[string]time.Time),
+	}, nil
+}
+
+// issue returns a new token for owner, which can be renewed by renewer (or,
+// if renewer is empty, by the owner).
+func (tm *tokenManager) issue(owner, renewer string) (string, error) {
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	now := time.Now()
+	for key, expiry := range tm.expiry {
+		if now.After(expiry) {
+			delete(tm.expiry, key)
+		}
+	}
+
+	tm.sequence++
+	id := tokenIdentifier{
+		Owner:    owner,
+		Renewer:  renewer,
+		Issued:   now.UnixNano() / int64(time.Millisecond),
+		MaxDate:  now.Add(tm.maxLifetime).UnixNano() / int64(time.Millisecond),
+		Sequence: tm.sequence,
+	}
+
+	b, err := json.Marshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	key := encodeTokenPart(tm.sign(b))
+	tm.expiry[key] = now.Add(tm.renewInterval)
+	return encodeTokenPart(b) + "." + key, nil
+}
+
+// verify checks that the token is valid and hasn't expired or been cancelled.
+func (tm *tokenManager) verify(token string) (*tokenIdentifier, error) {
+	id, _, err := tm.verifyKey(token)
+	return id, err
+}
+
+// verifyKey is like verify, but also returns the key for the token's expiry.
+func (tm *tokenManager) verifyKey(token string) (*tokenIdentifier, string, error) {
+	id, key, err := tm.decode(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	if now.After(maxDate(id)) {
+		return nil, "", invalidToken("token has expired")
+	}
+
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	expiry, ok := tm.expiry[key]
+	if !ok || now.After(expiry) {
+		return nil, "", invalidToken("token has expired or been cancelled")
+	}
+
+	return id, key, nil
+}
+
+// renew extends the token's expiry, up to its maximum lifetime. Only the
+// renewer (or the owner, if there is no renewer) can do this.
+func (tm *tokenManager) renew(token, user string) (time.Time, error) {
+	id, key, err := tm.verifyKey(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	renewer := id.Renewer
+	if renewer == "" {
+		renewer = id.Owner
+	}
+
+	if user != renewer {
+		return time.Time{}, &requestError{http.StatusForbidden, accessControlException,
+			user + " tried to renew a token without a renewer or with a different renewer"}
+	}
+
+	expiry := time.Now().Add(tm.renewInterval)
+	if max := maxDate(id); expiry.After(max) {
+		expiry = max
+	}
+
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	if _, ok := tm.expiry[key]; !ok {
+		return time.Time{}, invalidToken("token has been cancelled")
+	}
+
+	tm.expiry[key] = expiry
+	return expiry, nil
+}
+
+// cancel invalidates the token. Only the owner or renewer can do this.
+func (tm *tokenManager) cancel(token, user string) error {
+	id, key, err := tm.decode(token)
+	if err != nil {
+		return err
+	}
+
+	if user != id.Owner && user != id.Renewer {
+		return &requestError{http.StatusForbidden, accessControlException,
+			user + " is not authorized to cancel the token"}
+	}
+
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	delete(tm.expiry, key)
+	return nil
+}
+
+// decode checks the token's signature, and returns its identifier and the key
+// for its expiry.
+func (tm *tokenManager) decode(token string) (*tokenIdentifier, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, "", invalidToken("malformed token")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, "", invalidToken("malformed token")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, tm.sign(b)) {
+		return nil, "", invalidToken("token signature is invalid")
+	}
+
+	id := &tokenIdentifier{}
+	err = json.Unmarshal(b, id)
+	if err != nil {
+		return nil, "", invalidToken("malformed token")
+	}
+
+	return id, encodeTokenPart(sig), nil
+}
+
+func (tm *tokenManager) sign(b []byte) []byte {
+	mac := hmac.New(sha256.New, tm.secret)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+func maxDate(id *tokenIdentifier) time.Time {
+	return time.Unix(0, id.MaxDate*int64(time.Millisecond))
+}
+
+func encodeTokenPart(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func invalidToken(msg string) error {
+	return &requestError{http.StatusForbidden, invalidTokenException, msg}
+}
@@ -0,0 +1,99 @@
+package webhdfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokens(t *testing.T) {
+	tm, err := newTokenManager(nil, time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+
+	token, err := tm.issue("foo", "bar")
+	require.NoError(t, err)
+
+	id, err := tm.verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", id.Owner)
+	assert.Equal(t, "bar", id.Renewer)
+
+	_, err = tm.renew(token, "foo")
+	assert.Error(t, err)
+
+	expiry, err := tm.renew(token, "bar")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+
+	require.NoError(t, tm.cancel(token, "foo"))
+	_, err = tm.verify(token)
+	assert.Error(t, err)
+}
+
+func TestTokenRenewMaxLifetime(t *testing.T) {
+	tm, err := newTokenManager(nil, time.Hour, time.Minute)
+	require.NoError(t, err)
+
+	token, err := tm.issue("foo", "")
+	require.NoError(t, err)
+
+	expiry, err := tm.renew(token, "foo")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiry, 5*time.Second)
+}
+
+func TestTokenInvalid(t *testing.T) {
+	tm, err := newTokenManager([]byte("secret"), time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+
+	other, err := newTokenManager([]byte("other"), time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+
+	token, err := other.issue("foo", "")
+	require.NoError(t, err)
+
+	for _, s := range []string{"", "foo", "foo.bar", token} {
+		_, err = tm.verify(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTokenAfterRestart(t *testing.T) {
+	secret := []byte("secret")
+	before, err := newTokenManager(secret, time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+
+	old, err := before.issue("bar", "")
+	require.NoError(t, err)
+
+	// The sequence starts over, so the new token has the same sequence number
+	// as the old one, but the old one must still be rejected.
+	after, err := newTokenManager(secret, time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+
+	token, err := after.issue("foo", "")
+	require.NoError(t, err)
+
+	id, err := after.verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", id.Owner)
+
+	_, err = after.verify(old)
+	assert.Error(t, err)
+}
+
+func TestTokenMaxDate(t *testing.T) {
+	tm, err := newTokenManager(nil, time.Hour, time.Millisecond)
+	require.NoError(t, err)
+
+	token, err := tm.issue("foo", "")
+	require.NoError(t, err)
+
+	// The renewal interval is longer, but the token can't outlive its maximum
+	// lifetime.
+	time.Sleep(5 * time.Millisecond)
+	_, err = tm.verify(token)
+	assert.Error(t, err)
+}